@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+
+	markdown "github.com/teekennedy/goldmark-markdown"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// abbrev is one abbreviation definition found in a file.
+type abbrev struct {
+	term      string
+	expansion string
+}
+
+// kindAbbreviationDefinition is the node kind of abbreviation definitions.
+var kindAbbreviationDefinition = ast.NewNodeKind("AbbreviationDefinition")
+
+// abbreviationDefinition is a Markdown Extra abbreviation definition line, such
+// as "*[HTML]: HyperText Markup Language".
+type abbreviationDefinition struct {
+	ast.BaseBlock
+	abbrev
+}
+
+// Kind implements ast.Node.
+func (n *abbreviationDefinition) Kind() ast.NodeKind {
+	return kindAbbreviationDefinition
+}
+
+// Dump implements ast.Node.
+func (n *abbreviationDefinition) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Term": n.term, "Expansion": n.expansion}, nil)
+}
+
+// abbreviations is the extension --abbreviations adds to the parser, which
+// reads abbreviation definitions as abbreviationDefinition blocks.
+type abbreviations struct{}
+
+// Extend implements goldmark.Extender.
+func (abbreviations) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithBlockParsers(util.Prioritized(abbreviationParser{}, 250)))
+}
+
+// abbreviationParser parses abbreviation definitions. Each line is a block of
+// its own, and a definition can't interrupt a paragraph, so a definition line
+// in a paragraph with other text is left as text.
+type abbreviationParser struct{}
+
+// Trigger implements parser.BlockParser.
+func (abbreviationParser) Trigger() []byte {
+	return []byte{'*'}
+}
+
+// Open implements parser.BlockParser.
+func (abbreviationParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, _ := reader.PeekLine()
+	definition, ok := parseAbbreviation(line)
+	if !ok {
+		return nil, parser.NoChildren
+	}
+	reader.AdvanceToEOL()
+	return &abbreviationDefinition{abbrev: definition}, parser.NoChildren
+}
+
+// Continue implements parser.BlockParser.
+func (abbreviationParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	return parser.Close
+}
+
+// Close implements parser.BlockParser.
+func (abbreviationParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+// CanInterruptParagraph implements parser.BlockParser.
+func (abbreviationParser) CanInterruptParagraph() bool {
+	return false
+}
+
+// CanAcceptIndentedLine implements parser.BlockParser.
+func (abbreviationParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// parseAbbreviation reads a definition line: *[term]: expansion.
+func parseAbbreviation(line []byte) (abbrev, bool) {
+	rest, ok := bytes.CutPrefix(bytes.TrimLeft(line, " \t"), []byte("*["))
+	if !ok {
+		return abbrev{}, false
+	}
+	term, expansion, ok := bytes.Cut(rest, []byte("]:"))
+	if !ok || len(term) == 0 || bytes.IndexByte(term, ']') >= 0 {
+		return abbrev{}, false
+	}
+	return abbrev{term: string(term), expansion: string(bytes.TrimSpace(expansion))}, true
+}
+
+// renderAbbreviationDefinition renders an abbreviation definition line.
+func renderAbbreviationDefinition(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*abbreviationDefinition)
+	_, err := w.Write([]byte("*[" + n.term + "]: " + n.expansion + "\n"))
+	return ast.WalkContinue, err
+}
+
+// collectAbbreviations removes the abbreviation definitions of doc and returns
+// them for RenderAbbreviations. Definitions apply to the whole document, so
+// they are written once, at the end.
+func collectAbbreviations(doc ast.Node) []abbrev {
+	var definitions []*abbreviationDefinition
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if definition, ok := n.(*abbreviationDefinition); ok && entering {
+			definitions = append(definitions, definition)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	var found []abbrev
+	for _, definition := range definitions {
+		found = append(found, definition.abbrev)
+		definition.Parent().RemoveChild(definition.Parent(), definition)
+	}
+	return found
+}
+
+// RenderAbbreviations renders the abbreviation definitions of all processed
+// files, merged in traversal order. An abbreviation defined again with a
+// different expansion keeps its first definition, with a warning. Returns nil
+// when there are none.
+func (fp *FileProcessor) RenderAbbreviations() []byte {
+	var files []string
+	for file := range fp.abbrevs {
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return fp.fileOrder[files[i]] < fp.fileOrder[files[j]]
+	})
+
+	merged := make(map[string]string)
+	doc := ast.NewDocument()
+	for _, file := range files {
+		for _, abbr := range fp.abbrevs[file] {
+			existing, ok := merged[abbr.term]
+			if !ok {
+				merged[abbr.term] = abbr.expansion
+				doc.AppendChild(doc, &abbreviationDefinition{abbrev: abbr})
+			} else if existing != abbr.expansion {
+				fmt.Fprintf(os.Stderr, "Warning: %s: abbreviation %q redefined as %q, keeping %q\n",
+					displayPath(file), abbr.term, abbr.expansion, existing)
+			}
+		}
+	}
+
+	renderer := fp.renderers.Get().(*markdown.Renderer)
+	defer fp.renderers.Put(renderer)
+
+	// Rendering into a buffer can't fail
+	var buf bytes.Buffer
+	_ = renderer.Render(&buf, nil, doc)
+	return buf.Bytes()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+func TestAbbreviationParser(t *testing.T) {
+	source := []byte("*[HTML]: HyperText Markup Language\n" +
+		"  *[CSS]:Cascading Style Sheets  \n" +
+		"\n" +
+		"Text with a definition after it:\n" +
+		"*[API]: Application Programming Interface\n" +
+		"\n" +
+		"    *[CODE]: Indented code\n" +
+		"\n" +
+		"*[]: No term\n" +
+		"* [x]: A list item\n")
+	md := NewMarkdownParser(abbreviations{})
+	doc := md.Parser().Parse(text.NewReader(source))
+
+	var found []abbrev
+	var kinds []ast.NodeKind
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		kinds = append(kinds, child.Kind())
+		if definition, ok := child.(*abbreviationDefinition); ok {
+			found = append(found, definition.abbrev)
+		}
+	}
+
+	expected := []abbrev{
+		{term: "HTML", expansion: "HyperText Markup Language"},
+		{term: "CSS", expansion: "Cascading Style Sheets"},
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("definitions = %+v, want %+v", found, expected)
+	}
+	expectedKinds := []ast.NodeKind{
+		kindAbbreviationDefinition, kindAbbreviationDefinition,
+		ast.KindParagraph, ast.KindCodeBlock, ast.KindParagraph, ast.KindList,
+	}
+	if !reflect.DeepEqual(kinds, expectedKinds) {
+		t.Errorf("blocks = %v, want %v", kinds, expectedKinds)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// AnchorMap lists the anchors of a combined document and what they lead to,
+// as --anchor-map writes it. Comparing the maps of two builds with
+// anchors-diff shows the links to the published document a change breaks.
+type AnchorMap struct {
+	Anchors []AnchorEntry `json:"anchors"` // In document order
+}
+
+// AnchorEntry is the anchor of a section or of a heading in one.
+type AnchorEntry struct {
+	Anchor  string `json:"anchor"`            // ID in the combined document
+	File    string `json:"file"`              // Source path relative to the scope directory, with forward slashes
+	Heading string `json:"heading,omitempty"` // Heading text, empty for the section itself
+}
+
+// key identifies what an entry leads to across builds: its file, and its
+// heading text counting repeats, since a file may use the same heading twice.
+func (e AnchorEntry) key(occurrence int) string {
+	return e.File + "#" + e.Heading + "#" + strconv.Itoa(occurrence)
+}
+
+// AnchorMap returns the anchors of the combined document of the processor's
+// files. Sections whose heading is the file's own H1 are listed as that
+// heading; synthetic section headings are listed as the section itself.
+func (fp *FileProcessor) AnchorMap() *AnchorMap {
+	anchors := &AnchorMap{Anchors: []AnchorEntry{}}
+	var addHeadings func(path string, headings []*Heading)
+	addHeadings = func(path string, headings []*Heading) {
+		for _, heading := range headings {
+			anchors.Anchors = append(anchors.Anchors, AnchorEntry{Anchor: heading.Anchor, File: path, Heading: heading.Text})
+			addHeadings(path, heading.Children)
+		}
+	}
+	for _, section := range fp.Document().Sections {
+		if section.Synthetic {
+			anchors.Anchors = append(anchors.Anchors, AnchorEntry{Anchor: section.Anchor, File: section.Path})
+		}
+		addHeadings(section.Path, section.Headings)
+	}
+	return anchors
+}
+
+// LoadAnchorMap reads an anchor map written by --anchor-map.
+func LoadAnchorMap(path string) (*AnchorMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read anchor map: %w", err)
+	}
+	var anchors AnchorMap
+	if err := json.Unmarshal(data, &anchors); err != nil {
+		return nil, fmt.Errorf("failed to parse anchor map %q: %w", path, err)
+	}
+	return &anchors, nil
+}
+
+// WriteAnchorMap writes anchors as indented JSON to path.
+func WriteAnchorMap(path string, anchors *AnchorMap) error {
+	data, err := json.MarshalIndent(anchors, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write anchor map: %w", err)
+	}
+	return nil
+}
+
+// Kinds of AnchorChange.
+const (
+	AnchorRemoved = "removed" // Nothing in the new build has the anchor or leads where it did
+	AnchorRenamed = "renamed" // What the anchor led to has a different anchor now
+)
+
+// AnchorChange is an anchor of an old build that links can no longer use.
+type AnchorChange struct {
+	Kind    string `json:"kind"`              // One of the Anchor* change kinds
+	Anchor  string `json:"anchor"`            // Anchor in the old build
+	New     string `json:"new,omitempty"`     // Anchor in the new build, for renamed anchors
+	File    string `json:"file"`              // Source path in the old build
+	Heading string `json:"heading,omitempty"` // Heading text in the old build, empty for a section
+}
+
+// DiffAnchorMaps returns the anchors of old that new lacks, in old's order.
+// An anchor is renamed when new has a different one for the same heading of
+// the same file, or the same file's section, or else a new anchor in the same
+// place among the file's anchors, as when a heading's text is reworded. It is
+// removed otherwise. Anchors that are still there are fine even if they lead
+// elsewhere now.
+func DiffAnchorMaps(old, new *AnchorMap) []AnchorChange {
+	existed := make(map[string]bool)
+	for _, entry := range old.Anchors {
+		existed[entry.Anchor] = true
+	}
+	present := make(map[string]bool)
+	current := make(map[string]string)
+	byFile := make(map[string][]string)
+	counts := make(map[string]int)
+	for _, entry := range new.Anchors {
+		present[entry.Anchor] = true
+		occurrence := counts[entry.File+"#"+entry.Heading]
+		counts[entry.File+"#"+entry.Heading]++
+		current[entry.key(occurrence)] = entry.Anchor
+		byFile[entry.File] = append(byFile[entry.File], entry.Anchor)
+	}
+
+	changes := []AnchorChange{}
+	counts = make(map[string]int)
+	positions := make(map[string]int)
+	for _, entry := range old.Anchors {
+		occurrence := counts[entry.File+"#"+entry.Heading]
+		counts[entry.File+"#"+entry.Heading]++
+		position := positions[entry.File]
+		positions[entry.File]++
+		if present[entry.Anchor] {
+			continue
+		}
+		change := AnchorChange{Kind: AnchorRemoved, Anchor: entry.Anchor, File: entry.File, Heading: entry.Heading}
+		if anchor, ok := current[entry.key(occurrence)]; ok {
+			change.Kind = AnchorRenamed
+			change.New = anchor
+		} else if anchors := byFile[entry.File]; position < len(anchors) && !existed[anchors[position]] {
+			change.Kind = AnchorRenamed
+			change.New = anchors[position]
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// writeAnchorChangesText writes changes as one line each, like
+// "guide.md: #setup renamed to #set-up (\"Setup\")".
+func writeAnchorChangesText(w io.Writer, changes []AnchorChange) error {
+	for _, change := range changes {
+		what := "section"
+		if change.Heading != "" {
+			what = strconv.Quote(change.Heading)
+		}
+		var err error
+		if change.Kind == AnchorRenamed {
+			_, err = fmt.Fprintf(w, "%s: #%s renamed to #%s (%s)\n", change.File, change.Anchor, change.New, what)
+		} else {
+			_, err = fmt.Fprintf(w, "%s: #%s removed (%s)\n", change.File, change.Anchor, what)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runAnchorsDiff implements the anchors-diff command: it compares the anchors
+// of the build with the anchor map at opts.AnchorsDiffBase, writes the anchors
+// links can no longer use to standard output, and fails if there are any.
+func runAnchorsDiff(processor *FileProcessor, opts Options) error {
+	old, err := LoadAnchorMap(opts.AnchorsDiffBase)
+	if err != nil {
+		return err
+	}
+	changes := DiffAnchorMaps(old, processor.AnchorMap())
+	if opts.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(changes); err != nil {
+			return err
+		}
+	} else if err := writeAnchorChangesText(os.Stdout, changes); err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		return fmt.Errorf("%d anchor(s) of %s removed or renamed", len(changes), opts.AnchorsDiffBase)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffAnchorMaps(t *testing.T) {
+	old := &AnchorMap{Anchors: []AnchorEntry{
+		{Anchor: "home", File: "index.md", Heading: "Home"},
+		{Anchor: "setup", File: "index.md", Heading: "Setup"},
+		{Anchor: "usage", File: "index.md", Heading: "Usage"},
+		{Anchor: "notesmd", File: "notes.md"},
+		{Anchor: "faq", File: "faq.md", Heading: "FAQ"},
+		{Anchor: "faq-1", File: "faq.md", Heading: "FAQ"},
+	}}
+	new := &AnchorMap{Anchors: []AnchorEntry{
+		{Anchor: "home", File: "index.md", Heading: "Home"},
+		{Anchor: "set-up", File: "index.md", Heading: "Set up"},
+		{Anchor: "notes", File: "notes.md"},
+		{Anchor: "faq", File: "faq.md", Heading: "FAQ"},
+		{Anchor: "faq-2", File: "faq.md", Heading: "FAQ"},
+	}}
+
+	want := []AnchorChange{
+		{Kind: AnchorRenamed, Anchor: "setup", New: "set-up", File: "index.md", Heading: "Setup"},
+		{Kind: AnchorRemoved, Anchor: "usage", File: "index.md", Heading: "Usage"},
+		{Kind: AnchorRenamed, Anchor: "notesmd", New: "notes", File: "notes.md"},
+		{Kind: AnchorRenamed, Anchor: "faq-1", New: "faq-2", File: "faq.md", Heading: "FAQ"},
+	}
+	if got := DiffAnchorMaps(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffAnchorMaps() = %+v, want %+v", got, want)
+	}
+	if got := DiffAnchorMaps(old, old); len(got) != 0 {
+		t.Errorf("DiffAnchorMaps(old, old) = %+v, want no changes", got)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Section anchor strategies accepted by --section-anchors.
+const (
+	SectionAnchorsTitle    = "title"    // The ID of each section's heading, see TitleAnchors
+	SectionAnchorsFilename = "filename" // Each file's path, see FilenameAnchors
+	SectionAnchorsHash     = "hash"     // A hash of each file's path, see HashAnchors
+)
+
+// SectionInfo describes a file's section to an AnchorStrategy.
+type SectionInfo struct {
+	Path    string // Path relative to the scope directory, with forward slashes
+	Title   string // Section title, including any disambiguating qualifier
+	Heading string // ID of the section's heading, which links point at by default
+}
+
+// AnchorStrategy derives the ID that links to a file's section point at, so that
+// the combined document can follow an existing publishing system's anchor scheme.
+// IDs other than SectionInfo.Heading are written as an HTML anchor right before
+// the section. Programs embedding catmd can supply their own through
+// Options.AnchorStrategy.
+type AnchorStrategy interface {
+	SectionAnchor(section SectionInfo) string
+}
+
+// TitleAnchors is the default AnchorStrategy. It links to each section's heading.
+type TitleAnchors struct{}
+
+// SectionAnchor implements AnchorStrategy.
+func (TitleAnchors) SectionAnchor(section SectionInfo) string {
+	return section.Heading
+}
+
+// FilenameAnchors links to each section by its file's path relative to the scope
+// directory, such as "api/overview.md", with whitespace replaced by dashes.
+type FilenameAnchors struct{}
+
+// SectionAnchor implements AnchorStrategy.
+func (FilenameAnchors) SectionAnchor(section SectionInfo) string {
+	return strings.Join(strings.Fields(section.Path), "-")
+}
+
+// HashAnchors links to each section by "s-" and the first 8 hex digits of the
+// SHA-256 of its file's path, which stays the same when the section is retitled.
+type HashAnchors struct{}
+
+// SectionAnchor implements AnchorStrategy.
+func (HashAnchors) SectionAnchor(section SectionInfo) string {
+	sum := sha256.Sum256([]byte(section.Path))
+	return "s-" + hex.EncodeToString(sum[:4])
+}
+
+// anchorStrategy returns Options.AnchorStrategy, or the built-in strategy named
+// by --section-anchors.
+func (fp *FileProcessor) anchorStrategy() AnchorStrategy {
+	if fp.opts.AnchorStrategy != nil {
+		return fp.opts.AnchorStrategy
+	}
+	switch fp.opts.SectionAnchors {
+	case SectionAnchorsFilename:
+		return FilenameAnchors{}
+	case SectionAnchorsHash:
+		return HashAnchors{}
+	}
+	return TitleAnchors{}
+}
+
+// sectionAnchorTag returns the HTML anchor to write before filename's section,
+// or "" when links point at its heading's own ID.
+func (fp *FileProcessor) sectionAnchorTag(filename string) string {
+	id := fp.generateTargetAnchor(filename)[1:]
+	if !fp.omitsSection(filename) && id == fp.headingAnchor(filename)[1:] {
+		return ""
+	}
+	return anchorHTML(id)
+}
+
+// anchorHTML returns an empty HTML anchor with the given ID, which links to
+// "#id" lead to.
+func anchorHTML(id string) string {
+	return `<a id="` + html.EscapeString(id) + `"></a>`
+}
+
+// newAnchor returns an inline node holding anchorHTML(id).
+func newAnchor(id string) *ast.String {
+	return newRawHTML(anchorHTML(id))
+}
+
+// newRawHTML returns an inline node holding HTML catmd generates. goldmark's
+// RawHTML nodes can only hold HTML from the source, so it is a String marked
+// as code, which both the markdown and the HTML renderer write as it is.
+func newRawHTML(html string) *ast.String {
+	node := ast.NewString([]byte(html))
+	node.SetCode(true)
+	return node
+}
+
+// resolveAnchors works out the ID each heading of every included file ends up
+// with in the combined document. Renderers generate heading IDs once across the
+// whole document, after catmd has added synthetic headers, qualified duplicate
+// titles, and dropped or flattened headings, so a heading's ID in its own file
+// ("setup") may differ from its final one ("setup-1" when an earlier file also
+// has a Setup section). Links with fragments are rewritten using the result, and
+// the ID of each synthetic header is recorded under the file name followed by "#".
+//
+// The same registry of IDs then gives the anchors of flattened headings and the
+// id attributes of raw HTML unique IDs: one that an earlier anchor or any
+// heading already has gets a "-1", "-2", and so on suffix, and is rewritten
+// along with the links to it. Headings keep the IDs renderers give them, apart
+// from IDs set in --heading-attributes attribute lists, which are made unique
+// the same way.
+func (fp *FileProcessor) resolveAnchors(orderedFiles []string) {
+	ids := newSlugger(fp.opts)
+	type htmlAnchor struct {
+		file, id  string
+		flattened bool
+	}
+	var htmlAnchors []htmlAnchor
+	appendixStart := fp.appendixStart()
+	chunk := 0
+	for _, file := range orderedFiles {
+		if !fp.visitedFiles[file] {
+			continue
+		}
+		if fp.chunks != nil && fp.chunks[file] != chunk {
+			// Each chunk file gets its heading IDs on its own
+			ids, chunk = newSlugger(fp.opts), fp.chunks[file]
+		}
+		if file == appendixStart {
+			fp.appendixID = string(ids.Generate([]byte(fp.opts.AppendixTitle), ast.KindHeading))
+		}
+
+		headers := fp.fileHeaders[file]
+		synthetic := fp.generateFileHeader(file, headers) != "" && !fp.omitsSection(file)
+		if synthetic {
+			fp.anchors[file+"#"] = string(ids.Generate([]byte(fp.sectionTitle(file)), ast.KindHeading))
+
+			// Mirror removeDuplicateTitle, sending links to the dropped title
+			// to the synthetic header that replaces it
+			if fp.opts.CollapseTitles && duplicatesTitle(file, headers) {
+				fp.anchors[file+"#"+headers[0].ID] = fp.anchors[file+"#"]
+				headers = headers[1:]
+			}
+		}
+
+		if fp.titlesDocument(file) {
+			// Mirror removeTitleHeading, sending links to the title to the
+			// anchor before the file's content
+			fp.anchors[file+"#"+headers[0].ID] = GenerateSectionLink(file)[1:]
+			headers = headers[1:]
+		}
+
+		qualified := false
+		levels := fp.finalLevels(file, headers, synthetic)
+		for i, header := range headers {
+			if fp.opts.FlattenBelow > 0 && levels[i] > fp.opts.FlattenBelow {
+				// Flattened headings keep their ID as an HTML anchor
+				htmlAnchors = append(htmlAnchors, htmlAnchor{file: file, id: header.ID, flattened: true})
+				continue
+			}
+
+			line := header.Line
+			if qualifier, ok := fp.qualifiers[file]; ok && !synthetic && header.Level == 1 && !qualified {
+				// Mirror qualifyHeading
+				line += " (" + qualifier + ")"
+				qualified = true
+			}
+			if header.ExplicitID {
+				// Written back out by writeHeadingAttributes
+				fp.anchors[file+"#"+header.ID] = ids.Unique(header.ID)
+				continue
+			}
+			fp.anchors[file+"#"+header.ID] = string(ids.Generate([]byte(line), ast.KindHeading))
+		}
+		for _, id := range fp.htmlIDs[file] {
+			htmlAnchors = append(htmlAnchors, htmlAnchor{file: file, id: id})
+		}
+	}
+
+	for _, anchor := range htmlAnchors {
+		key := anchor.file + "#" + anchor.id
+		if anchor.flattened {
+			fp.anchors[key] = ids.Unique(anchor.id)
+		} else if _, ok := fp.htmlAnchors[key]; !ok {
+			fp.htmlAnchors[key] = ids.Unique(anchor.id)
+		}
+	}
+	if fp.opts.ElementAnchors {
+		fp.resolveElementAnchors(orderedFiles)
+	}
+}
+
+// finalLevels returns the levels of the headers of file after the Header
+// Adjustment Rules, when it gets a synthetic header if synthetic is set, after
+// moving it into the appendix, and after removing the document title, which
+// headers must not include.
+func (fp *FileProcessor) finalLevels(file string, headers []HeaderInfo, synthetic bool) []int {
+	levels := make([]int, len(headers))
+	highest, hasLevel1 := 6, false
+	for i, header := range headers {
+		levels[i] = header.Level
+		highest = min(highest, header.Level)
+		hasLevel1 = hasLevel1 || header.Level == 1
+	}
+
+	for i := range levels {
+		if synthetic && fp.opts.PromoteHeadings {
+			levels[i] = min(levels[i]+2-highest, 6)
+		} else if synthetic && hasLevel1 {
+			levels[i] = min(levels[i]+1, 6)
+		}
+		levels[i] = min(levels[i]+fp.nesting(file), 6)
+		if fp.titlesDocument(file) {
+			levels[i] = max(levels[i]-1, 1)
+		}
+	}
+	return levels
+}
+
+// finalAnchor returns the ID in the combined document of the heading of file
+// whose own ID is id, which may carry GitHub's "user-content-" prefix.
+// Fragments that name no heading, such as explicit HTML anchors, are returned
+// unchanged.
+func (fp *FileProcessor) finalAnchor(file, id string) string {
+	if final, ok := fp.anchors[file+"#"+id]; ok {
+		return final
+	}
+	if unprefixed, ok := strings.CutPrefix(id, githubFragmentPrefix); ok {
+		if final, ok := fp.anchors[file+"#"+unprefixed]; ok {
+			return final
+		}
+	}
+	if final, ok := fp.htmlAnchors[file+"#"+id]; ok {
+		return final
+	}
+	return id
+}
+
+// hasAnchor reports whether id names a heading or anchor of file.
+func (fp *FileProcessor) hasAnchor(file, id string) bool {
+	unprefixed := strings.TrimPrefix(id, githubFragmentPrefix)
+	_, heading := fp.anchors[file+"#"+id]
+	_, prefixed := fp.anchors[file+"#"+unprefixed]
+	_, raw := fp.htmlAnchors[file+"#"+id]
+	return heading || prefixed || raw
+}
+
+// resolveBareFragment returns the file a fragment-only link of file leads to and
+// the fragment's ID in the combined document. Fragments name a heading or anchor
+// of file itself, or, with --resolve-bare-fragments, of any included file, for
+// sources written to be read merged. All files with a match are returned as
+// well, so ambiguous fragments, which go to the first, can be reported.
+func (fp *FileProcessor) resolveBareFragment(file, fragment string) (target, anchor string, matches []string) {
+	if !fp.opts.BareFragments || fp.hasAnchor(file, fragment) {
+		return file, fp.finalAnchor(file, fragment), nil
+	}
+	for _, other := range fp.files {
+		if other != file && fp.visitedFiles[other] && fp.hasAnchor(other, fragment) {
+			matches = append(matches, other)
+		}
+	}
+	if len(matches) == 0 {
+		return file, fragment, nil
+	}
+	return matches[0], fp.finalAnchor(matches[0], fragment), matches
+}
+
+// rawHTMLIDs returns the id attributes of the raw HTML in doc, in source order.
+func rawHTMLIDs(doc ast.Node, source []byte) []string {
+	var ids []string
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		var html []byte
+		switch node := n.(type) {
+		case *ast.RawHTML:
+			html = segmentsValue(node.Segments, source)
+		case *ast.HTMLBlock:
+			html = htmlBlockSource(node, source)
+		default:
+			return ast.WalkContinue, nil
+		}
+		if entering {
+			ids = append(ids, htmlIDs(html)...)
+		}
+		return ast.WalkContinue, nil
+	})
+	return ids
+}
+
+// rewriteHTMLIDs rewrites the id attributes of the raw HTML in doc, part of
+// file, that resolveAnchors gave other IDs to keep them unique. Rewritten HTML
+// is written as is, through String nodes.
+func (fp *FileProcessor) rewriteHTMLIDs(doc ast.Node, source []byte, file string) {
+	rewrite := func(html []byte) ([]byte, bool) {
+		return renameHTMLIDs(html, func(id string) (string, bool) {
+			final, ok := fp.htmlAnchors[file+"#"+id]
+			return final, ok
+		})
+	}
+
+	var nodes []ast.Node
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		switch n.(type) {
+		case *ast.RawHTML, *ast.HTMLBlock:
+			if entering {
+				nodes = append(nodes, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, n := range nodes {
+		parent := n.Parent()
+		switch node := n.(type) {
+		case *ast.RawHTML:
+			if html, ok := rewrite(segmentsValue(node.Segments, source)); ok {
+				parent.ReplaceChild(parent, node, ast.NewString(html))
+			}
+		case *ast.HTMLBlock:
+			if html, ok := rewrite(htmlBlockSource(node, source)); ok {
+				// A paragraph of the raw HTML is written just like the block
+				paragraph := ast.NewParagraph()
+				paragraph.SetBlankPreviousLines(node.HasBlankPreviousLines())
+				paragraph.AppendChild(paragraph, ast.NewString(bytes.TrimRight(html, "\n")))
+				parent.ReplaceChild(parent, node, paragraph)
+			}
+		}
+	}
+}
+
+// segmentsValue returns the bytes of segments in source, joined.
+func segmentsValue(segments *text.Segments, source []byte) []byte {
+	var value []byte
+	for i := 0; i < segments.Len(); i++ {
+		segment := segments.At(i)
+		value = append(value, segment.Value(source)...)
+	}
+	return value
+}
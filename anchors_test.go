@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileProcessor_FragmentLinksAfterHeadingAdjustment(t *testing.T) {
+	dir := t.TempDir()
+	sources := map[string]string{
+		// Links to the same heading text in two files, and to a qualified title
+		"index.md": "# Index\n\n[a](a.md#setup) [b](b.md#setup) [b2](b.md#setup-1) [overview](api/overview.md#overview)\n\n## Notes\n",
+		// The H1 isn't the first heading, so a synthetic header is added and it shifts to ##
+		"a.md": "## Intro\n\n# Setup\n",
+		// Same-file fragments must follow the renumbered IDs too
+		"b.md":             "## Setup\n\n## Setup\n\n## Notes\n\nSee [setup](#setup) and [again](#setup-1).\n",
+		"api/overview.md":  "# Overview\n",
+		"docs/overview.md": "# Overview\n",
+	}
+	files := []string{"index.md", "a.md", "b.md", "api/overview.md", "docs/overview.md"}
+	var ordered []string
+	for _, name := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(sources[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ordered = append(ordered, path)
+	}
+
+	processor := NewFileProcessor(dir, ordered, Options{TOC: true})
+	tests := []struct {
+		file     string
+		expected []string
+	}{
+		{"index.md", []string{"[a](#setup)", "[b](#setup-1)", "[b2](#setup-2)", "[overview](#overview-api)"}},
+		{"b.md", []string{"[setup](#setup-1)", "[again](#setup-2)"}},
+	}
+	for _, tt := range tests {
+		processed, err := processor.ProcessFile(filepath.Join(dir, tt.file), []byte(sources[tt.file]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.expected {
+			if !strings.Contains(string(processed), want) {
+				t.Errorf("ProcessFile(%s) = %q, want it to contain %q", tt.file, processed, want)
+			}
+		}
+	}
+}
+
+// upperAnchors is a custom AnchorStrategy used by TestFileProcessor_AnchorStrategy.
+type upperAnchors struct{}
+
+func (upperAnchors) SectionAnchor(section SectionInfo) string {
+	return "doc-" + strings.ToUpper(section.Title)
+}
+
+func TestFileProcessor_AnchorStrategy(t *testing.T) {
+	dir := t.TempDir()
+	index := filepath.Join(dir, "index.md")
+	guide := filepath.Join(dir, "my guide.md")
+	content := "# Index\n\nRead the [guide](<my guide.md>).\n"
+	if err := os.WriteFile(index, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(guide, []byte("# Guide\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{"title", Options{}, []string{"[guide](#guide)"}},
+		{"filename", Options{SectionAnchors: SectionAnchorsFilename}, []string{`<a id="index.md"></a>`, "[guide](#my-guide.md)"}},
+		{"hash", Options{SectionAnchors: SectionAnchorsHash}, []string{"[guide](#" + HashAnchors{}.SectionAnchor(SectionInfo{Path: "my guide.md"}) + ")"}},
+		{"custom", Options{AnchorStrategy: upperAnchors{}}, []string{`<a id="doc-INDEX"></a>`, "[guide](#doc-GUIDE)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processed, err := NewFileProcessor(dir, []string{index, guide}, tt.opts).ProcessFile(index, []byte(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.expected {
+				if !strings.Contains(string(processed), want) {
+					t.Errorf("ProcessFile() = %q, want it to contain %q", processed, want)
+				}
+			}
+			if tt.name == "title" && strings.Contains(string(processed), "<a id=") {
+				t.Errorf("ProcessFile() = %q, want no anchor for the heading's own ID", processed)
+			}
+		})
+	}
+}
+
+func TestFileProcessor_HTMLAnchorCollisions(t *testing.T) {
+	dir := t.TempDir()
+	sources := map[string]string{
+		"index.md": "# Index\n\n## Intro\n\nSee [guide](guide.md#intro) and [faq](guide.md#faq).\n",
+		// One raw HTML anchor clashes with a heading of the file before
+		"guide.md": "# Guide\n\n<a id=\"intro\"></a>Start here.\n\n<div id=\"faq\">\nQuestions\n</div>\n",
+	}
+	files := []string{"index.md", "guide.md"}
+	var ordered []string
+	for _, name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(sources[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ordered = append(ordered, path)
+	}
+
+	processor := NewFileProcessor(dir, ordered, Options{})
+	tests := []struct {
+		file     string
+		expected []string
+	}{
+		{"index.md", []string{"[guide](#intro-1)", "[faq](#faq)"}},
+		{"guide.md", []string{`<a id="intro-1"></a>Start here.`, `<div id="faq">`}},
+	}
+	for _, tt := range tests {
+		processed, err := processor.ProcessFile(filepath.Join(dir, tt.file), []byte(sources[tt.file]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.expected {
+			if !strings.Contains(string(processed), want) {
+				t.Errorf("ProcessFile(%s) = %q, want it to contain %q", tt.file, processed, want)
+			}
+		}
+	}
+}
+
+func TestFileProcessor_ResolveBareFragment(t *testing.T) {
+	dir := t.TempDir()
+	sources := map[string]string{
+		"index.md":   "# Index\n\n## Setup\n",
+		"install.md": "# Install\n\n## Setup\n\n## Requirements\n",
+		"usage.md":   "# Usage\n\n## Requirements\n",
+	}
+	var ordered []string
+	for _, name := range []string{"index.md", "install.md", "usage.md"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(sources[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ordered = append(ordered, path)
+	}
+
+	processor := NewFileProcessor(dir, ordered, Options{BareFragments: true})
+	tests := []struct {
+		file, fragment string
+		target, anchor string
+		matches        int
+	}{
+		{"install.md", "setup", "install.md", "setup-1", 0},
+		{"index.md", "requirements", "install.md", "requirements", 2},
+		{"install.md", "usage", "usage.md", "usage", 1},
+		{"usage.md", "missing", "usage.md", "missing", 0},
+	}
+	for _, tt := range tests {
+		target, anchor, matches := processor.resolveBareFragment(filepath.Join(dir, tt.file), tt.fragment)
+		if filepath.Base(target) != tt.target || anchor != tt.anchor || len(matches) != tt.matches {
+			t.Errorf("resolveBareFragment(%s, %q) = %s, %q, %d matches, want %s, %q, %d matches", tt.file, tt.fragment, filepath.Base(target), anchor, len(matches), tt.target, tt.anchor, tt.matches)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+
+	markdown "github.com/teekennedy/goldmark-markdown"
+	"github.com/yuin/goldmark/ast"
+)
+
+// UseAppendix groups files, the orphans --append-orphans adds after the
+// traversed files, under an appendix heading titled by --appendix-title. Their
+// sections move one level down, below that heading, and the table of contents
+// lists them under an entry for it.
+func (fp *FileProcessor) UseAppendix(files []string) {
+	fp.appendix = make(map[string]bool)
+	for _, file := range files {
+		if fp.visitedFiles[file] {
+			fp.appendix[file] = true
+		}
+	}
+
+	// Anchors depend on heading levels and on the appendix heading's own ID
+	fp.anchors = make(map[string]string)
+	fp.resolveAnchors(fp.files)
+}
+
+// InAppendix reports whether filename's section is in the appendix.
+func (fp *FileProcessor) InAppendix(filename string) bool {
+	return fp.appendix[filename]
+}
+
+// AppendixHeading renders the heading written before the first appendix
+// section.
+func (fp *FileProcessor) AppendixHeading() []byte {
+	doc := ast.NewDocument()
+	heading := ast.NewHeading(1)
+	heading.AppendChild(heading, newLiteral(fp.opts.AppendixTitle))
+	doc.AppendChild(doc, heading)
+
+	renderer := fp.renderers.Get().(*markdown.Renderer)
+	defer fp.renderers.Put(renderer)
+
+	// Rendering into a buffer can't fail
+	var buf bytes.Buffer
+	_ = renderer.Render(&buf, nil, doc)
+	return buf.Bytes()
+}
+
+// appendixStart returns the first file in the appendix, or "" if there is none.
+func (fp *FileProcessor) appendixStart() string {
+	for _, file := range fp.files {
+		if fp.appendix[file] {
+			return file
+		}
+	}
+	return ""
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// archiveTime is the modification time of every archive member, so that the
+// same inputs always produce a byte-identical archive.
+var archiveTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveMember is a file to store in an archive.
+type archiveMember struct {
+	name    string // Slash-separated path within the archive
+	content []byte
+}
+
+// archiveExtension returns the recognized archive extension of path, or "".
+func archiveExtension(path string) string {
+	lower := strings.ToLower(path)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// archiveDocumentName is the name of the combined document inside the archive
+// at path: the archive's own name with the extension of the output format.
+func archiveDocumentName(path, format string) string {
+	base := filepath.Base(path)
+	ext := ".md"
+	if format == FormatHTML {
+		ext = ".html"
+	}
+	return base[:len(base)-len(archiveExtension(base))] + ext
+}
+
+// WriteArchive writes the combined document, named as the report's output, the
+// run report, and every existing asset the report lists into a single archive
+// at path, in the format its extension names. The document is at the top of
+// the archive, and assets keep their path relative to baseDir, the directory
+// the document's references to them are relative to, so they still resolve
+// after extraction. Assets outside baseDir are left out, with a warning.
+func WriteArchive(path string, document []byte, report *Report, baseDir string) error {
+	var reportJSON bytes.Buffer
+	if err := report.Encode(&reportJSON); err != nil {
+		return err
+	}
+
+	members := []archiveMember{
+		{name: report.Output, content: document},
+		{name: "report.json", content: reportJSON.Bytes()},
+	}
+	for _, asset := range report.Assets {
+		if !asset.Exists {
+			continue
+		}
+		rel, err := filepath.Rel(baseDir, asset.target)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			fmt.Fprintf(os.Stderr, "Warning: asset %q is outside the root file's directory and was left out of the archive\n", asset.Path)
+			continue
+		}
+		content, err := os.ReadFile(asset.target)
+		if err != nil {
+			return fmt.Errorf("failed to read asset %q: %w", asset.Path, err)
+		}
+		members = append(members, archiveMember{name: filepath.ToSlash(rel), content: content})
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create archive %q: %w", path, err)
+	}
+	defer f.Close()
+
+	switch archiveExtension(path) {
+	case ".zip":
+		err = writeZip(f, members)
+	case ".tar":
+		err = writeTar(f, members)
+	case ".tar.gz", ".tgz":
+		gz := gzip.NewWriter(f)
+		if err = writeTar(gz, members); err == nil {
+			err = gz.Close()
+		}
+	default:
+		err = fmt.Errorf("unsupported archive format")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write archive %q: %w", path, err)
+	}
+	return f.Close()
+}
+
+func writeZip(w io.Writer, members []archiveMember) error {
+	zw := zip.NewWriter(w)
+	for _, member := range members {
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     member.name,
+			Method:   zip.Deflate,
+			Modified: archiveTime,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(member.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTar(w io.Writer, members []archiveMember) error {
+	tw := tar.NewWriter(w)
+	for _, member := range members {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    member.name,
+			Mode:    0644,
+			Size:    int64(len(member.content)),
+			ModTime: archiveTime,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tw.Write(member.content); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// archiveInputSeparator separates an archive from the path of a file inside it
+// in input arguments, as in docs.zip!/index.md.
+const archiveInputSeparator = "!/"
+
+// splitArchiveInput splits an input argument like docs.zip!/guide/index.md into
+// the archive and the slash-separated path inside it, and reports whether the
+// argument names a file inside an archive.
+func splitArchiveInput(arg string) (archive, inner string, ok bool) {
+	archive, inner, ok = strings.Cut(arg, archiveInputSeparator)
+	if !ok || archiveExtension(archive) == "" {
+		return "", "", false
+	}
+	return archive, inner, true
+}
+
+// Limits on what is read from an input archive, so that a corrupt or hostile
+// archive can't exhaust memory or disk.
+const (
+	maxArchiveEntrySize = 64 << 20  // Largest file read from an archive
+	maxArchiveSize      = 512 << 20 // Most bytes read from an archive in all
+)
+
+// openArchiveFS opens the .zip, .tar, .tar.gz, or .tgz archive at file as a
+// read-only file system. The returned closer, if not nil, releases the archive.
+func openArchiveFS(file string) (fs.FS, io.Closer, error) {
+	if archiveExtension(file) == ".zip" {
+		zr, err := zip.OpenReader(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if ext := archiveExtension(file); ext == ".tar.gz" || ext == ".tgz" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	fsys, err := readTarFS(r, maxArchiveEntrySize, maxArchiveSize)
+	return fsys, nil, err
+}
+
+// tarFS is a read-only file system holding the regular files of a tar archive
+// and the directories they imply. Tar archives can't be read at random, so
+// their files are held in memory.
+type tarFS map[string]*tarEntry
+
+// tarEntry is a file or directory in a tarFS. It is its own fs.FileInfo.
+type tarEntry struct {
+	name    string // Slash-separated path within the archive
+	data    []byte // Contents, nil for a directory
+	modTime time.Time
+	dir     bool
+}
+
+// readTarFS reads the tar archive from r, refusing files over entryLimit bytes
+// or more than totalLimit bytes of files in all. Entries other than regular
+// files, and those with names that aren't valid fs paths, are ignored.
+func readTarFS(r io.Reader, entryLimit, totalLimit int64) (tarFS, error) {
+	fsys := tarFS{".": {name: ".", dir: true}}
+	var total int64
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return fsys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(path.Clean(header.Name), "./")
+		if header.Typeflag != tar.TypeReg || !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		if header.Size > entryLimit {
+			return nil, fmt.Errorf("%s is larger than %d bytes", name, entryLimit)
+		}
+		if total += header.Size; total > totalLimit {
+			return nil, fmt.Errorf("archive holds more than %d bytes", totalLimit)
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, header.Size))
+		if err != nil {
+			return nil, err
+		}
+		fsys[name] = &tarEntry{name: name, data: data, modTime: header.ModTime}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if _, ok := fsys[dir]; !ok {
+				fsys[dir] = &tarEntry{name: dir, modTime: header.ModTime, dir: true}
+			}
+		}
+	}
+}
+
+// Open implements fs.FS.
+func (fsys tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := fsys[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	file := &tarFile{entry: entry, r: bytes.NewReader(entry.data)}
+	if entry.dir {
+		file.dirents, _ = fsys.ReadDir(name)
+	}
+	return file, nil
+}
+
+// ReadDir implements fs.ReadDirFS, listing the entries in dir sorted by name.
+func (fsys tarFS) ReadDir(dir string) ([]fs.DirEntry, error) {
+	if entry, ok := fsys[dir]; !ok || !entry.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: dir, Err: fs.ErrNotExist}
+	}
+	var entries []fs.DirEntry
+	for name, entry := range fsys {
+		if name != "." && path.Dir(name) == dir {
+			entries = append(entries, fs.FileInfoToDirEntry(entry))
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+func (e *tarEntry) Name() string       { return path.Base(e.name) }
+func (e *tarEntry) Size() int64        { return int64(len(e.data)) }
+func (e *tarEntry) ModTime() time.Time { return e.modTime }
+func (e *tarEntry) IsDir() bool        { return e.dir }
+func (e *tarEntry) Sys() any           { return nil }
+
+func (e *tarEntry) Mode() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// tarFile is an open tarEntry.
+type tarFile struct {
+	entry   *tarEntry
+	r       *bytes.Reader
+	dirents []fs.DirEntry // Directory entries not yet read, for a directory
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+func (f *tarFile) Close() error               { return nil }
+
+func (f *tarFile) Read(p []byte) (int, error) {
+	if f.entry.dir {
+		return 0, &fs.PathError{Op: "read", Path: f.entry.name, Err: fs.ErrInvalid}
+	}
+	return f.r.Read(p)
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (f *tarFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.entry.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: f.entry.name, Err: fs.ErrInvalid}
+	}
+	if n <= 0 {
+		entries := f.dirents
+		f.dirents = nil
+		return entries, nil
+	}
+	if len(f.dirents) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(f.dirents))
+	entries := f.dirents[:n]
+	f.dirents = f.dirents[n:]
+	return entries, nil
+}
+
+// unpackArchiveInput reads the archive at path through its file system and
+// copies its files into a new temporary directory, which the caller removes,
+// since traversal and processing work on local paths.
+func unpackArchiveInput(path string) (string, error) {
+	fsys, closer, err := openArchiveFS(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive %q: %w", path, err)
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	dir, err := os.MkdirTemp("", "catmd-input-")
+	if err != nil {
+		return "", err
+	}
+	if err := copyArchiveFS(dir, fsys, maxArchiveEntrySize, maxArchiveSize); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to read archive %q: %w", path, err)
+	}
+	return dir, nil
+}
+
+// copyArchiveFS copies the regular files of fsys into dir, refusing files over
+// entryLimit bytes or more than totalLimit bytes in all. Sizes are counted as
+// the files are read, since an archive's own record of them can't be trusted.
+func copyArchiveFS(dir string, fsys fs.FS, entryLimit, totalLimit int64) error {
+	var total int64
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		src, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		dst, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+
+		n, err := io.Copy(dst, io.LimitReader(src, min(entryLimit, totalLimit-total)+1))
+		if err != nil {
+			return err
+		}
+		if n > entryLimit {
+			return fmt.Errorf("%s is larger than %d bytes", name, entryLimit)
+		}
+		if total += n; total > totalLimit {
+			return fmt.Errorf("archive holds more than %d bytes", totalLimit)
+		}
+		return dst.Close()
+	})
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWriteArchive(t *testing.T) {
+	dir := t.TempDir()
+	asset := filepath.Join(dir, "img", "logo.png")
+	if err := os.MkdirAll(filepath.Dir(asset), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(asset, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := NewReport(filepath.Join(dir, "index.md"), "docs.md")
+	report.Assets = append(report.Assets,
+		ReportAsset{Reference: "img/logo.png", Exists: true, target: asset},
+		ReportAsset{Reference: "missing.png", target: filepath.Join(dir, "missing.png")},
+	)
+
+	for _, name := range []string{"docs.zip", "docs.tar", "docs.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := WriteArchive(path, []byte("# Docs\n"), report, dir); err != nil {
+				t.Fatal(err)
+			}
+
+			members := readArchive(t, path)
+			var names []string
+			for _, member := range members {
+				names = append(names, member.name)
+			}
+			expected := []string{"docs.md", "report.json", "img/logo.png"}
+			if !reflect.DeepEqual(names, expected) {
+				t.Fatalf("archive members = %v, want %v", names, expected)
+			}
+			if string(members[0].content) != "# Docs\n" {
+				t.Errorf("document = %q, want %q", members[0].content, "# Docs\n")
+			}
+			if string(members[2].content) != "png" {
+				t.Errorf("asset = %q, want %q", members[2].content, "png")
+			}
+		})
+	}
+}
+
+func TestWriteArchive_RootBelowScope(t *testing.T) {
+	// The root file is in guide/, so the document refers to img/diagram.png
+	// and ../img/logo.png, which is outside the document's directory
+	dir := t.TempDir()
+	inside := filepath.Join(dir, "guide", "img", "diagram.png")
+	outside := filepath.Join(dir, "img", "logo.png")
+	for _, asset := range []string{inside, outside} {
+		if err := os.MkdirAll(filepath.Dir(asset), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(asset, []byte("png"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := NewReport(filepath.Join(dir, "guide", "index.md"), "docs.md")
+	report.Assets = append(report.Assets,
+		ReportAsset{Reference: "img/diagram.png", Exists: true, target: inside},
+		ReportAsset{Reference: "../img/logo.png", Exists: true, target: outside},
+	)
+	path := filepath.Join(t.TempDir(), "docs.zip")
+	if err := WriteArchive(path, []byte("# Docs\n"), report, filepath.Join(dir, "guide")); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, member := range readArchive(t, path) {
+		names = append(names, member.name)
+	}
+	expected := []string{"docs.md", "report.json", "img/diagram.png"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("archive members = %v, want %v", names, expected)
+	}
+}
+
+func readArchive(t *testing.T, path string) []archiveMember {
+	t.Helper()
+	var members []archiveMember
+
+	if archiveExtension(path) == ".zip" {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		for _, file := range zr.File {
+			rc, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			members = append(members, archiveMember{name: file.Name, content: content})
+		}
+		return members
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if archiveExtension(path) != ".tar" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, archiveMember{name: header.Name, content: content})
+	}
+	return members
+}
+
+func TestUnpackArchiveInput(t *testing.T) {
+	members := []archiveMember{
+		{name: "docs/index.md", content: []byte("# Docs\n\nSee [setup](guide/setup.md).\n")},
+		{name: "docs/guide/setup.md", content: []byte("# Setup\n")},
+	}
+
+	for _, name := range []string{"docs.zip", "docs.tar", "docs.tgz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch archiveExtension(name) {
+			case ".zip":
+				err = writeZip(f, members)
+			case ".tar":
+				err = writeTar(f, members)
+			default:
+				gz := gzip.NewWriter(f)
+				if err = writeTar(gz, members); err == nil {
+					err = gz.Close()
+				}
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			archive, inner, ok := splitArchiveInput(path + "!/docs/index.md")
+			if !ok || archive != path || inner != "docs/index.md" {
+				t.Fatalf("splitArchiveInput() = %q, %q, %v", archive, inner, ok)
+			}
+			dir, err := unpackArchiveInput(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			root := filepath.Join(dir, "docs", "index.md")
+			files, err := NewFileTraversal(root, filepath.Dir(root)).Traverse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []string{root, filepath.Join(dir, "docs", "guide", "setup.md")}
+			if !reflect.DeepEqual(files, expected) {
+				t.Errorf("Traverse() = %v, want %v", files, expected)
+			}
+		})
+	}
+
+	if _, _, ok := splitArchiveInput("notes.md!/index.md"); ok {
+		t.Error("splitArchiveInput() accepted a path that isn't an archive")
+	}
+}
+
+func TestTarFS(t *testing.T) {
+	var buf bytes.Buffer
+	members := []archiveMember{
+		{name: "docs/index.md", content: []byte("# Docs\n")},
+		{name: "docs/guide/setup.md", content: []byte("# Setup\n")},
+		{name: "README.md", content: []byte("# Readme\n")},
+	}
+	if err := writeTar(&buf, members); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := readTarFS(&buf, 1<<10, 1<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "docs/index.md", "docs/guide/setup.md", "README.md"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestArchiveSizeLimits(t *testing.T) {
+	var buf bytes.Buffer
+	members := []archiveMember{
+		{name: "a.md", content: []byte(strings.Repeat("a", 100))},
+		{name: "b.md", content: []byte(strings.Repeat("b", 100))},
+	}
+	if err := writeTar(&buf, members); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	if _, err := readTarFS(bytes.NewReader(archive), 99, 1000); err == nil {
+		t.Error("readTarFS() accepted a file over the entry limit")
+	}
+	if _, err := readTarFS(bytes.NewReader(archive), 100, 150); err == nil {
+		t.Error("readTarFS() accepted files over the total limit")
+	}
+
+	fsys := fstest.MapFS{
+		"a.md":     {Data: []byte(strings.Repeat("a", 100))},
+		"sub/b.md": {Data: []byte(strings.Repeat("b", 100))},
+	}
+	if err := copyArchiveFS(t.TempDir(), fsys, 99, 1000); err == nil {
+		t.Error("copyArchiveFS() accepted a file over the entry limit")
+	}
+	if err := copyArchiveFS(t.TempDir(), fsys, 100, 150); err == nil {
+		t.Error("copyArchiveFS() accepted files over the total limit")
+	}
+	dir := t.TempDir()
+	if err := copyArchiveFS(dir, fsys, 100, 200); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "sub", "b.md")); err != nil || len(content) != 100 {
+		t.Errorf("copied sub/b.md = %d bytes, %v; want 100 bytes", len(content), err)
+	}
+}
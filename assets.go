@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// assetsDir returns the absolute directory --assets-dir copies images into,
+// which is relative to the directory of the combined document.
+func (fp *FileProcessor) assetsDir() string {
+	if filepath.IsAbs(fp.opts.AssetsDir) {
+		return filepath.Clean(fp.opts.AssetsDir)
+	}
+	return filepath.Join(fp.assetBase, fp.opts.AssetsDir)
+}
+
+// allocateAssets gives the images of file, whose document is doc, their paths
+// under the --assets-dir directory, skipping the paths in taken and adding the
+// new ones to it. Images inside the scope keep their path relative to it, so
+// img/logo.png becomes assets/img/logo.png; others are copied under their base
+// name, with a number added if that is taken. Files are allocated in traversal
+// order ahead of processing, so the paths don't depend on how files are
+// scheduled across --jobs. Destinations that aren't local files that exist are
+// skipped.
+func (fp *FileProcessor) allocateAssets(file string, doc ast.Node, taken map[string]bool) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		image, ok := n.(*ast.Image)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		target, ok := resolveAsset(file, string(image.Destination))
+		if !ok || fp.assets[target] != "" {
+			return ast.WalkContinue, nil
+		}
+		if info, err := os.Stat(target); err != nil || info.IsDir() {
+			return ast.WalkContinue, nil
+		}
+
+		name := filepath.ToSlash(filepath.Base(target))
+		if rel, err := filepath.Rel(fp.scopeDir, target); err == nil && !strings.HasPrefix(rel, "..") {
+			name = filepath.ToSlash(rel)
+		}
+		ext := filepath.Ext(name)
+		for i := 1; taken[name]; i++ {
+			name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(filepath.ToSlash(filepath.Base(target)), ext), i, ext)
+		}
+		fp.assets[target] = name
+		taken[name] = true
+		return ast.WalkContinue, nil
+	})
+}
+
+// assetDestination returns the destination of the --assets-dir copy of the image
+// destination in filename, relative to the directory of the combined document,
+// keeping any query string and fragment. Images allocateAssets gave no path
+// are rebased like other assets.
+func (fp *FileProcessor) assetDestination(filename, destination string) string {
+	target, ok := resolveAsset(filename, destination)
+	name := fp.assets[target]
+	if !ok || name == "" {
+		return fp.rebaseAsset(filename, destination)
+	}
+
+	rel, err := filepath.Rel(fp.assetBase, filepath.Join(fp.assetsDir(), filepath.FromSlash(name)))
+	if err != nil {
+		return destination
+	}
+	suffix := ""
+	if i := strings.IndexAny(destination, "?#"); i >= 0 {
+		suffix = destination[i:]
+	}
+	return filepath.ToSlash(rel) + suffix
+}
+
+// CopyAssets copies the images collected while processing files into the
+// --assets-dir directory.
+func (fp *FileProcessor) CopyAssets() error {
+	targets := make([]string, 0, len(fp.assets))
+	for target := range fp.assets {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	dir := fp.assetsDir()
+	for _, target := range targets {
+		dest := filepath.Join(dir, filepath.FromSlash(fp.assets[target]))
+		if err := copyFile(target, dest); err != nil {
+			return fmt.Errorf("failed to copy asset %q: %w", displayPath(target), err)
+		}
+	}
+	return nil
+}
+
+// copyFile copies the file at src to dest, creating dest's directory.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/util"
+)
+
+// writeHeadingAttributes writes the attribute list of each heading of doc that
+// had one in filename back after the heading's text, for --heading-attributes,
+// since the markdown renderer drops attributes. The list starts with the
+// heading's ID in the combined document, so renderers that read attribute
+// lists give the heading the ID links were rewritten to, followed by its
+// classes and other attributes as written. Headings flattened by
+// --flatten-below are paragraphs by now and keep only their anchor.
+func (fp *FileProcessor) writeHeadingAttributes(doc ast.Node, source []byte, filename string) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		attrs := headingAttributeList(heading, source)
+		id, ok := heading.AttributeString("id")
+		if len(attrs) == 0 || !ok {
+			return ast.WalkSkipChildren, nil
+		}
+		idBytes, ok := id.([]byte)
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+		list := formatAttributeList(fp.finalAnchor(filename, string(idBytes)), attrs)
+		heading.AppendChild(heading, ast.NewString([]byte(" "+list)))
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// formatAttributeList formats an {#id .class key=value} attribute list with id
+// and the classes and other attributes of attrs, whose own ID is left out.
+// Values are written as goldmark parses them back, and an ID or classes the #
+// and . shorthands can't hold are written as id= or class= values instead.
+func formatAttributeList(id string, attrs parser.Attributes) string {
+	parts := []string{"#" + id}
+	if !isShorthandName(id) {
+		parts[0] = "id=" + formatAttributeValue([]byte(id))
+	}
+	for _, attr := range attrs {
+		name := string(attr.Name)
+		switch name {
+		case "id":
+		case "class":
+			classes := strings.Fields(attributeValue(attr.Value))
+			if slices.ContainsFunc(classes, func(class string) bool { return !isShorthandName(class) }) {
+				parts = append(parts, "class="+formatAttributeValue(attr.Value))
+				continue
+			}
+			for _, class := range classes {
+				parts = append(parts, "."+class)
+			}
+		default:
+			parts = append(parts, name+"="+formatAttributeValue(attr.Value))
+		}
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// isShorthandName reports whether name can be written as a #id or .class
+// shorthand, which stops at spaces and at punctuation other than _ - : and .
+func isShorthandName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; util.IsSpace(c) || util.IsPunct(c) && !strings.ContainsRune("_-:.", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// formatAttributeValue formats an attribute value as goldmark parsed it: a
+// string as []byte, which is quoted with the escapes goldmark reads, a number,
+// boolean, or null, an array, or a nested attribute list.
+func formatAttributeValue(value any) string {
+	switch value := value.(type) {
+	case []byte:
+		var b strings.Builder
+		b.WriteByte('"')
+		for _, c := range value {
+			switch c {
+			case '"', '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case '\n':
+				b.WriteString(`\n`)
+			case '\r':
+				b.WriteString(`\r`)
+			case '\t':
+				b.WriteString(`\t`)
+			case '\b':
+				b.WriteString(`\b`)
+			case '\f':
+				b.WriteString(`\f`)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte('"')
+		return b.String()
+	case []any:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = formatAttributeValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case parser.Attributes:
+		items := make([]string, len(value))
+		for i, attr := range value {
+			items[i] = string(attr.Name) + "=" + formatAttributeValue(attr.Value)
+		}
+		return "{" + strings.Join(items, " ") + "}"
+	default:
+		return attributeValue(value)
+	}
+}
+
+// attributeValue returns an attribute value as goldmark parsed it, a string as
+// []byte or a number, boolean, or null, as text.
+func attributeValue(value any) string {
+	switch value := value.(type) {
+	case []byte:
+		return string(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+func TestHeadingAttributeList(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"# Title {#custom .a .b data-x=1}\n", `{#final .a .b data-x=1}`},
+		{"## Setup {.wide}\n", "{#final .wide}"},
+		{"Setext {title=\"Long title\"}\n---\n", `{#final title="Long title"}`},
+		{`# Quote {title="say \"hi\"\tnow" data-path="C:\\docs" hidden=true}` + "\n", `{#final title="say \"hi\"\tnow" data-path="C:\\docs" hidden=true}`},
+		{`# Odd {class="a+b c"}` + "\n", `{#final class="a+b c"}`},
+		{"# Plain\n", ""},
+	}
+	md := NewMarkdownParser(parserExtensions(Options{HeadingAttributes: true})...)
+	for _, test := range tests {
+		parsed, err := parseMarkdownWith(md, []byte(test.source), "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		heading := parsed.AST.FirstChild().(*ast.Heading)
+		got := ""
+		if attrs := headingAttributeList(heading, parsed.Source); attrs != nil {
+			got = formatAttributeList("final", attrs)
+		}
+		if got != test.expected {
+			t.Errorf("attribute list of %q = %q, want %q", test.source, got, test.expected)
+		}
+	}
+}
+
+func TestHeadingAttributeList_Unparsed(t *testing.T) {
+	// Without --heading-attributes the list is part of the heading text
+	parsed, err := ParseMarkdownFile([]byte("# Title {#custom}\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs := headingAttributeList(parsed.AST.FirstChild().(*ast.Heading), parsed.Source); attrs != nil {
+		t.Errorf("headingAttributeList() = %v, want nil", attrs)
+	}
+	if parsed.Headers[0].ExplicitID {
+		t.Error("ExplicitID = true, want false")
+	}
+}
+
+func TestFormatAttributeList_RoundTrip(t *testing.T) {
+	attrs := parser.Attributes{
+		{Name: []byte("class"), Value: []byte("wide a+b")},
+		{Name: []byte("title"), Value: []byte("line\none \"two\" \\ é")},
+		{Name: []byte("data-n"), Value: -1.5},
+		{Name: []byte("data-list"), Value: []any{[]byte("x"), true, nil}},
+	}
+	list := formatAttributeList("a/b", attrs)
+	parsed, ok := parser.ParseAttributes(text.NewReader([]byte(list)))
+	if !ok {
+		t.Fatalf("ParseAttributes(%q) failed", list)
+	}
+	want := append(parser.Attributes{{Name: []byte("id"), Value: []byte("a/b")}}, attrs...)
+	if !reflect.DeepEqual(parsed, want) {
+		t.Errorf("ParseAttributes(%q) = %v, want %v", list, parsed, want)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// recordBacklinks notes every included file that sourceFile links to, so that the
+// target's section can later list sourceFile under "Referenced by". Self-links and
+// repeated links to the same target are recorded once at most.
+func (fp *FileProcessor) recordBacklinks(sourceFile string, links []LinkInfo) {
+	seen := make(map[string]bool)
+	for _, link := range links {
+		if !link.IsInternal || link.IsFootnote {
+			continue
+		}
+
+		target, err := fp.resolveLink(sourceFile, link.URL)
+		if err != nil || target == sourceFile || seen[target] || !fp.visitedFiles[target] {
+			continue
+		}
+
+		seen[target] = true
+		fp.backlinks[target] = append(fp.backlinks[target], sourceFile)
+	}
+}
+
+// linksBetween reports whether any of files links to one of others, or the
+// other way around.
+func (fp *FileProcessor) linksBetween(files, others []string) bool {
+	linked := func(sources []string, targets []string) bool {
+		for _, target := range targets {
+			for _, source := range fp.backlinks[target] {
+				if slices.Contains(sources, source) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return linked(files, others) || linked(others, files)
+}
+
+// appendBacklinks adds a "Referenced by" paragraph followed by a bullet list of
+// section links to the end of the document, one entry per included file that links
+// to filename. Files nobody links to are left untouched.
+func (fp *FileProcessor) appendBacklinks(doc ast.Node, filename string) {
+	sources := fp.backlinks[filename]
+	if len(sources) == 0 {
+		return
+	}
+
+	label := ast.NewParagraph()
+	label.AppendChild(label, ast.NewString([]byte("Referenced by:")))
+	label.SetBlankPreviousLines(true)
+	doc.AppendChild(doc, label)
+
+	list := ast.NewList('-')
+	list.IsTight = true
+	list.SetBlankPreviousLines(true)
+	for _, source := range sources {
+		link := ast.NewLink()
+		link.Destination = []byte(fp.sectionLink(filename, source))
+		link.AppendChild(link, newLiteral(fp.sectionTitle(source)))
+
+		block := ast.NewTextBlock()
+		block.AppendChild(block, link)
+
+		item := ast.NewListItem(2)
+		item.AppendChild(item, block)
+		list.AppendChild(list, item)
+	}
+	doc.AppendChild(doc, list)
+}
+
+// sectionTitle returns the text of the top-level header that starts a file's
+// section in the output: the file's own H1 when the header rules keep it,
+// otherwise the synthetic filename header. Disambiguated titles carry their
+// qualifier in parentheses.
+func (fp *FileProcessor) sectionTitle(filename string) string {
+	if qualifier, ok := fp.qualifiers[filename]; ok {
+		return fp.baseSectionTitle(filename) + " (" + qualifier + ")"
+	}
+	return fp.baseSectionTitle(filename)
+}
+
+// baseSectionTitle is sectionTitle without any disambiguating qualifier.
+func (fp *FileProcessor) baseSectionTitle(filename string) string {
+	headers := fp.fileHeaders[filename]
+	if fp.generateFileHeader(filename, headers) == "" {
+		for _, header := range headers {
+			if header.Level == 1 {
+				return fp.caseHeadingText(header.Text)
+			}
+		}
+	}
+	return fp.headerPath(filename)
+}
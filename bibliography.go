@@ -0,0 +1,483 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// BibEntry is one work listed in a --bibliography file.
+type BibEntry struct {
+	Key       string    // Citation key, as in [@key]
+	Authors   []BibName // Authors or editors, in order
+	Title     string
+	Year      string
+	Container string // Journal, book, or site the work appeared in
+	Publisher string
+	URL       string
+}
+
+// BibName is a person or, with only Family set, an organization.
+type BibName struct {
+	Family string
+	Given  string
+}
+
+// LoadBibliography reads a bibliography in BibTeX (.bib) or CSL JSON (.json)
+// format, keyed by citation key.
+func LoadBibliography(path string) (map[string]*BibEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bibliography: %w", err)
+	}
+
+	var entries []*BibEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".bib":
+		entries, err = parseBibTeX(string(data))
+	case ".json":
+		entries, err = parseCSLJSON(data)
+	default:
+		return nil, fmt.Errorf("unsupported bibliography format %q (want .bib or .json)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bibliography %q: %w", path, err)
+	}
+
+	bibliography := make(map[string]*BibEntry)
+	for _, entry := range entries {
+		bibliography[entry.Key] = entry
+	}
+	return bibliography, nil
+}
+
+// parseBibTeX extracts the entries of a BibTeX file. Only the fields catmd
+// formats are kept. It reads the BibTeX that reference managers export, not
+// everything BibTeX accepts:
+//   - @string macros are not expanded, so a bare macro name is kept as written
+//   - crossref fields are not followed
+//   - LaTeX commands other than escaped special characters, like \"o or \emph,
+//     are left in the text, without their braces
+//   - names are "Last, First" or "First Last", so particles like "van" and
+//     suffixes like "Jr." are read as part of the given name
+//
+// See TestParseBibTeX_Limits.
+func parseBibTeX(data string) ([]*BibEntry, error) {
+	var entries []*BibEntry
+	for i := 0; ; {
+		at := strings.IndexByte(data[i:], '@')
+		if at < 0 {
+			return entries, nil
+		}
+		start := i + at + 1
+		end := start
+		for end < len(data) && (unicode.IsLetter(rune(data[end])) || unicode.IsDigit(rune(data[end]))) {
+			end++
+		}
+		kind := strings.ToLower(data[start:end])
+
+		open := end
+		for open < len(data) && unicode.IsSpace(rune(data[open])) {
+			open++
+		}
+		if open >= len(data) || (data[open] != '{' && data[open] != '(') {
+			i = end
+			continue
+		}
+		closing, err := bibTeXGroupEnd(data, open)
+		if err != nil {
+			return nil, fmt.Errorf("@%s entry: %w", kind, err)
+		}
+		i = closing + 1
+
+		switch kind {
+		case "comment", "string", "preamble":
+			continue
+		}
+		entry, err := parseBibTeXEntry(data[open+1 : closing])
+		if err != nil {
+			return nil, fmt.Errorf("@%s entry: %w", kind, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// bibTeXGroupEnd returns the index of the brace or parenthesis closing the
+// group opened at data[open].
+func bibTeXGroupEnd(data string, open int) (int, error) {
+	closer := byte('}')
+	if data[open] == '(' {
+		closer = ')'
+	}
+	depth := 0
+	for i := open + 1; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case c == closer && depth == 0:
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated entry")
+}
+
+// parseBibTeXEntry parses the body of an entry: the key followed by
+// comma-separated field = value pairs.
+func parseBibTeXEntry(body string) (*BibEntry, error) {
+	key, rest, _ := strings.Cut(body, ",")
+	entry := &BibEntry{Key: strings.TrimSpace(key)}
+	if entry.Key == "" {
+		return nil, fmt.Errorf("missing citation key")
+	}
+
+	fields := make(map[string]string)
+	for i := 0; i < len(rest); {
+		for i < len(rest) && (unicode.IsSpace(rune(rest[i])) || rest[i] == ',') {
+			i++
+		}
+		if i >= len(rest) {
+			break
+		}
+		eq := strings.IndexByte(rest[i:], '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("%s: field without a value", entry.Key)
+		}
+		name := strings.ToLower(strings.TrimSpace(rest[i : i+eq]))
+		value, next, err := readBibTeXValue(rest, i+eq+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: field %q: %w", entry.Key, name, err)
+		}
+		fields[name] = value
+		i = next
+	}
+
+	entry.Authors = parseBibTeXNames(fields["author"])
+	if len(entry.Authors) == 0 {
+		entry.Authors = parseBibTeXNames(fields["editor"])
+	}
+	entry.Title = cleanBibTeX(fields["title"])
+	entry.Year = cleanBibTeX(fields["year"])
+	if entry.Year == "" && len(fields["date"]) >= 4 {
+		entry.Year = fields["date"][:4]
+	}
+	for _, name := range []string{"journal", "booktitle", "journaltitle", "howpublished"} {
+		if entry.Container == "" {
+			entry.Container = cleanBibTeX(fields[name])
+		}
+	}
+	entry.Publisher = cleanBibTeX(fields["publisher"])
+	entry.URL = cleanBibTeX(fields["url"])
+	if doi := cleanBibTeX(fields["doi"]); entry.URL == "" && doi != "" {
+		entry.URL = "https://doi.org/" + doi
+	}
+	return entry, nil
+}
+
+// readBibTeXValue reads a field value starting at data[i]: braced and quoted
+// strings and bare words, joined with #. The value is returned raw, braces
+// included, and the index after it.
+func readBibTeXValue(data string, i int) (string, int, error) {
+	var value strings.Builder
+	for {
+		for i < len(data) && unicode.IsSpace(rune(data[i])) {
+			i++
+		}
+		if i >= len(data) {
+			return "", i, fmt.Errorf("missing value")
+		}
+
+		switch data[i] {
+		case '{':
+			end, err := bibTeXGroupEnd(data, i)
+			if err != nil {
+				return "", i, err
+			}
+			value.WriteString(data[i+1 : end])
+			i = end + 1
+		case '"':
+			depth, end := 0, -1
+			for j := i + 1; j < len(data) && end < 0; j++ {
+				switch {
+				case data[j] == '{':
+					depth++
+				case data[j] == '}':
+					depth--
+				case data[j] == '"' && depth == 0:
+					end = j
+				}
+			}
+			if end < 0 {
+				return "", i, fmt.Errorf("unterminated string")
+			}
+			value.WriteString(data[i+1 : end])
+			i = end + 1
+		default:
+			end := i
+			for end < len(data) && data[end] != ',' && data[end] != '#' && !unicode.IsSpace(rune(data[end])) {
+				end++
+			}
+			value.WriteString(data[i:end])
+			i = end
+		}
+
+		for i < len(data) && unicode.IsSpace(rune(data[i])) {
+			i++
+		}
+		if i >= len(data) || data[i] != '#' {
+			return value.String(), i, nil
+		}
+		i++
+	}
+}
+
+// parseBibTeXNames splits a raw BibTeX name list on its top-level "and"s.
+// Names are "Last, First" or "First Last"; a fully braced name such as
+// "{Python Software Foundation}" is an organization.
+func parseBibTeXNames(raw string) []BibName {
+	var names []BibName
+	add := func(name string) {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return
+		}
+		if strings.HasPrefix(name, "{") && strings.HasSuffix(name, "}") {
+			names = append(names, BibName{Family: cleanBibTeX(name)})
+			return
+		}
+		name = cleanBibTeX(name)
+		if family, given, ok := strings.Cut(name, ","); ok {
+			names = append(names, BibName{Family: strings.TrimSpace(family), Given: strings.TrimSpace(given)})
+			return
+		}
+		words := strings.Fields(name)
+		if len(words) == 0 {
+			return
+		}
+		names = append(names, BibName{Family: words[len(words)-1], Given: strings.Join(words[:len(words)-1], " ")})
+	}
+
+	depth, start := 0, 0
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+		if depth == 0 && i > 0 && unicode.IsSpace(rune(raw[i-1])) && strings.HasPrefix(raw[i:], "and") &&
+			i+3 < len(raw) && unicode.IsSpace(rune(raw[i+3])) {
+			add(raw[start:i])
+			start = i + 3
+		}
+	}
+	add(raw[start:])
+	return names
+}
+
+// cleanBibTeX turns a raw BibTeX value into plain text: grouping braces are
+// dropped, escaped special characters unescaped, and whitespace collapsed.
+func cleanBibTeX(value string) string {
+	replacer := strings.NewReplacer("{", "", "}", "", `\&`, "&", `\%`, "%", `\$`, "$", `\_`, "_", `\#`, "#", "~", " ", "--", "–")
+	return strings.Join(strings.Fields(replacer.Replace(value)), " ")
+}
+
+// cslItem is the subset of a CSL JSON item catmd formats.
+type cslItem struct {
+	ID     string `json:"id"`
+	Author []struct {
+		Family  string `json:"family"`
+		Given   string `json:"given"`
+		Literal string `json:"literal"`
+	} `json:"author"`
+	Title  string `json:"title"`
+	Issued struct {
+		DateParts [][]any `json:"date-parts"`
+	} `json:"issued"`
+	ContainerTitle string `json:"container-title"`
+	Publisher      string `json:"publisher"`
+	URL            string `json:"URL"`
+	DOI            string `json:"DOI"`
+}
+
+// parseCSLJSON extracts the entries of a CSL JSON file, as exported by Zotero
+// and used by Pandoc.
+func parseCSLJSON(data []byte) ([]*BibEntry, error) {
+	var items []cslItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+
+	var entries []*BibEntry
+	for _, item := range items {
+		if item.ID == "" {
+			return nil, fmt.Errorf("item without an id")
+		}
+		entry := &BibEntry{
+			Key:       item.ID,
+			Title:     item.Title,
+			Container: item.ContainerTitle,
+			Publisher: item.Publisher,
+			URL:       item.URL,
+		}
+		for _, author := range item.Author {
+			if author.Literal != "" {
+				entry.Authors = append(entry.Authors, BibName{Family: author.Literal})
+			} else {
+				entry.Authors = append(entry.Authors, BibName{Family: author.Family, Given: author.Given})
+			}
+		}
+		if parts := item.Issued.DateParts; len(parts) > 0 && len(parts[0]) > 0 {
+			entry.Year = fmt.Sprint(parts[0][0])
+		}
+		if entry.URL == "" && item.DOI != "" {
+			entry.URL = "https://doi.org/" + item.DOI
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// citationPattern matches a bracketed Pandoc citation such as [@doe99] or
+// [see @doe99, p. 33; @smith04].
+var citationPattern = regexp.MustCompile(`\[[^\[\]]*@[^\[\]]*\]`)
+
+// citationItemPattern splits one item of a citation into its prefix, the
+// author-suppressing minus, the key, and the locator.
+var citationItemPattern = regexp.MustCompile(`^((?:.*?\s)?)(-?)@([\pL\pN_][\pL\pN_:.#$%&+?<>~/-]*)(.*)$`)
+
+// citationID is the anchor of a work in the References section.
+func citationID(key string) string {
+	return "ref-" + strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' || r == ':' {
+			return r
+		}
+		return '-'
+	}, key)
+}
+
+// citationLabel is the author-date text citing entry, e.g. "Knuth 1984",
+// "Kernighan and Ritchie 1978", or "Gamma et al. 1994".
+func citationLabel(entry *BibEntry, suppressAuthor bool) string {
+	year := entry.Year
+	if year == "" {
+		year = "n.d."
+	}
+	if suppressAuthor {
+		return year
+	}
+
+	var author string
+	switch len(entry.Authors) {
+	case 0:
+		author = entry.Title
+	case 1:
+		author = entry.Authors[0].Family
+	case 2:
+		author = entry.Authors[0].Family + " and " + entry.Authors[1].Family
+	default:
+		author = entry.Authors[0].Family + " et al."
+	}
+	return strings.TrimSpace(author + " " + year)
+}
+
+// formatReference builds entry's reference for the References section,
+// author-date style: authors, year, title, container, and publisher, each
+// ending in a period, and the URL. The URL is appended to source, which its
+// autolink reads it from, and the source is returned.
+func formatReference(entry *BibEntry, source []byte) ([]ast.Node, []byte) {
+	var authors []string
+	for i, name := range entry.Authors {
+		switch {
+		case name.Given == "":
+			authors = append(authors, name.Family)
+		case i == 0:
+			authors = append(authors, name.Family+", "+name.Given)
+		default:
+			authors = append(authors, name.Given+" "+name.Family)
+		}
+	}
+
+	var nodes []ast.Node
+	add := func(part string) {
+		if len(nodes) > 0 {
+			nodes = append(nodes, ast.NewString([]byte(" ")))
+		}
+		if !strings.HasSuffix(part, ".") {
+			part += "."
+		}
+		nodes = append(nodes, newLiteral(part))
+	}
+	switch len(authors) {
+	case 0:
+	case 1:
+		add(authors[0])
+	case 2:
+		add(authors[0] + ", and " + authors[1])
+	default:
+		add(strings.Join(authors[:len(authors)-1], ", ") + ", and " + authors[len(authors)-1])
+	}
+	if entry.Year != "" {
+		add(entry.Year)
+	} else {
+		add("n.d.")
+	}
+	if entry.Title != "" {
+		title := ast.NewEmphasis(1)
+		title.AppendChild(title, newLiteral(strings.TrimRight(entry.Title, ".")))
+		nodes = append(nodes, ast.NewString([]byte(" ")), title, ast.NewString([]byte(".")))
+	}
+	for _, part := range []string{entry.Container, entry.Publisher} {
+		if part != "" {
+			add(part)
+		}
+	}
+
+	if entry.URL != "" {
+		nodes = append(nodes, ast.NewString([]byte(" ")))
+		if autoLinkURL.MatchString(entry.URL) {
+			start := len(source)
+			source = append(source, entry.URL...)
+			nodes = append(nodes, ast.NewAutoLink(ast.AutoLinkURL, ast.NewTextSegment(text.NewSegment(start, len(source)))))
+		} else {
+			nodes = append(nodes, newLiteral(entry.URL))
+		}
+	}
+	return nodes, source
+}
+
+// autoLinkURL matches the URLs that can be written as autolinks: an absolute
+// URI without spaces or angle brackets.
+var autoLinkURL = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]{1,31}:[^\x00-\x20<>]*$`)
+
+// sortReferences orders entries by first author, then year, title, and key.
+func sortReferences(entries []*BibEntry) {
+	sortKey := func(entry *BibEntry) string {
+		if len(entry.Authors) > 0 {
+			return strings.ToLower(entry.Authors[0].Family + " " + entry.Authors[0].Given)
+		}
+		return strings.ToLower(entry.Title)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if ka, kb := sortKey(a), sortKey(b); ka != kb {
+			return ka < kb
+		}
+		if a.Year != b.Year {
+			return a.Year < b.Year
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return a.Key < b.Key
+	})
+}
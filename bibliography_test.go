@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBibTeX(t *testing.T) {
+	data := `@comment{ignored}
+@string{cj = "The Computer Journal"}
+@Article{knuth84,
+  author  = "Knuth, Donald E.",
+  title   = {Literate {P}rogramming},
+  journal = cj,
+  year    = 1984,
+}
+@online(psf, author = {{Python Software Foundation} and Guido van Rossum},
+  title = "Python " # "Docs", date = {2024-01-02}, url = {https://docs.python.org/})
+`
+	entries, err := parseBibTeX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*BibEntry{
+		{
+			Key:       "knuth84",
+			Authors:   []BibName{{Family: "Knuth", Given: "Donald E."}},
+			Title:     "Literate Programming",
+			Year:      "1984",
+			Container: "cj",
+		},
+		{
+			Key:     "psf",
+			Authors: []BibName{{Family: "Python Software Foundation"}, {Family: "Rossum", Given: "Guido van"}},
+			Title:   "Python Docs",
+			Year:    "2024",
+			URL:     "https://docs.python.org/",
+		},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("parseBibTeX() =\n%+v\nwant\n%+v", entries, expected)
+	}
+}
+
+func TestParseCSLJSON(t *testing.T) {
+	data := `[{
+		"id": "kr78",
+		"author": [{"family": "Kernighan", "given": "Brian W."}, {"family": "Ritchie", "given": "Dennis M."}],
+		"title": "The C Programming Language",
+		"issued": {"date-parts": [[1978, 2]]},
+		"publisher": "Prentice Hall",
+		"DOI": "10.5555/1234"
+	}]`
+	entries, err := parseCSLJSON([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*BibEntry{{
+		Key:       "kr78",
+		Authors:   []BibName{{Family: "Kernighan", Given: "Brian W."}, {Family: "Ritchie", Given: "Dennis M."}},
+		Title:     "The C Programming Language",
+		Year:      "1978",
+		Publisher: "Prentice Hall",
+		URL:       "https://doi.org/10.5555/1234",
+	}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("parseCSLJSON() =\n%+v\nwant\n%+v", entries, expected)
+	}
+}
+
+func TestCitationLabel(t *testing.T) {
+	names := func(families ...string) []BibName {
+		var result []BibName
+		for _, family := range families {
+			result = append(result, BibName{Family: family})
+		}
+		return result
+	}
+
+	tests := []struct {
+		entry          *BibEntry
+		suppressAuthor bool
+		expected       string
+	}{
+		{&BibEntry{Authors: names("Knuth"), Year: "1984"}, false, "Knuth 1984"},
+		{&BibEntry{Authors: names("Kernighan", "Ritchie"), Year: "1978"}, false, "Kernighan and Ritchie 1978"},
+		{&BibEntry{Authors: names("Gamma", "Helm", "Johnson"), Year: "1994"}, false, "Gamma et al. 1994"},
+		{&BibEntry{Title: "Anonymous Work"}, false, "Anonymous Work n.d."},
+		{&BibEntry{Authors: names("Knuth"), Year: "1984"}, true, "1984"},
+	}
+
+	for _, tt := range tests {
+		if got := citationLabel(tt.entry, tt.suppressAuthor); got != tt.expected {
+			t.Errorf("citationLabel(%+v, %v) = %q, want %q", tt.entry, tt.suppressAuthor, got, tt.expected)
+		}
+	}
+}
+
+// The BibTeX parser's documented limits, see parseBibTeX.
+func TestParseBibTeX_Limits(t *testing.T) {
+	data := `@string{acm = "ACM"}
+@book{godel31,
+  author    = {G{\"o}del, Kurt and Ludwig van Beethoven and King, Jr., Martin Luther},
+  title     = {\emph{On} Things},
+  publisher = acm,
+  crossref  = {collection},
+  year      = 1931
+}`
+	entries, err := parseBibTeX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*BibEntry{{
+		Key: "godel31",
+		Authors: []BibName{
+			{Family: `G\"odel`, Given: "Kurt"},
+			{Family: "Beethoven", Given: "Ludwig van"},
+			{Family: "King", Given: "Jr., Martin Luther"},
+		},
+		Title:     `\emphOn Things`,
+		Year:      "1931",
+		Publisher: "acm",
+	}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("parseBibTeX() =\n%+v\nwant\n%+v", entries, expected)
+	}
+}
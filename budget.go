@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// What --overflow does when the output would exceed --max-output-bytes.
+const (
+	OverflowError    = "error"    // Fail without writing any output
+	OverflowTruncate = "truncate" // Leave out the sections that don't fit, with a warning
+	OverflowPriority = "priority" // Include the shallowest files that fit, listing the rest at the end
+)
+
+// outputBudget admits sections to the output until --max-output-bytes is
+// reached. A nil budget admits everything.
+type outputBudget struct {
+	limit   int      // Most bytes the output may have
+	used    int      // Bytes admitted so far
+	full    bool     // Whether a section was turned away, after which none are admitted
+	skip    bool     // Whether later sections may still be admitted after one is turned away
+	omitted []string // Names of the sections turned away, in output order
+}
+
+// newOutputBudget returns a budget of limit bytes, or nil for no limit. With
+// --overflow priority, a section that doesn't fit is skipped rather than
+// ending the output.
+func newOutputBudget(limit int, overflow string) *outputBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &outputBudget{limit: limit, skip: overflow == OverflowPriority}
+}
+
+// admit reports whether the section called name, which takes size bytes of
+// output, fits in the budget, and counts it if so. Unless the budget skips,
+// once a section doesn't fit no later section is admitted either, so the
+// output ends at a section boundary.
+func (b *outputBudget) admit(name string, size int) bool {
+	if b == nil {
+		return true
+	}
+	if !b.full && b.used+size <= b.limit {
+		b.used += size
+		return true
+	}
+	b.full = !b.skip
+	b.drop(name)
+	return false
+}
+
+// admitTrailing is admit for the document-wide sections that follow the files,
+// such as the endnotes. They serve the sections that were kept, so each is
+// admitted whenever it fits in what is left, even after a file was turned away.
+func (b *outputBudget) admitTrailing(name string, size int) bool {
+	if b == nil {
+		return true
+	}
+	if b.used+size <= b.limit {
+		b.used += size
+		return true
+	}
+	b.drop(name)
+	return false
+}
+
+// drop records the section called name as turned away without trying to fit
+// it, as for a section an earlier assembly of the output already found didn't
+// fit. Later sections are still admitted if they fit.
+func (b *outputBudget) drop(name string) {
+	if b == nil {
+		return
+	}
+	b.omitted = append(b.omitted, name)
+}
+
+// overflow returns the error for the first section that didn't fit, for
+// --overflow error.
+func (b *outputBudget) overflow() error {
+	return fmt.Errorf("output would exceed --max-output-bytes %d at %s; nothing was written (use --overflow truncate to write the sections that fit)", b.limit, b.omitted[0])
+}
+
+// warnTruncated warns about the sections left out by --overflow truncate.
+func (b *outputBudget) warnTruncated() {
+	if b == nil || len(b.omitted) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: output truncated to %d bytes to stay within --max-output-bytes %d; left out %d section(s): %s\n",
+		b.used, b.limit, len(b.omitted), strings.Join(b.omitted, ", "))
+}
+
+// prioritizeSections picks the files a --overflow priority build includes when
+// its output may have at most limit bytes: as many as fit, preferring files
+// fewer links from the root, then earlier ones in traversal order. The root
+// file, the first of files, is always kept. Sizes are estimated from the
+// sources, with room kept for the list of omitted sections. Both lists are
+// returned in traversal order.
+func prioritizeSections(files []string, snapshot *Snapshot, depth func(string) int, scopeDir string, limit int) (kept, omitted []string) {
+	sizes := make(map[string]int)
+	for _, file := range files {
+		if content, err := snapshot.ReadFile(file); err == nil {
+			// Processing mostly keeps sizes; allow for the headers and
+			// blank lines it adds
+			sizes[file] = len(content) + len(content)/10 + len("\n\n\n")
+		}
+	}
+
+	priority := append([]string(nil), files[1:]...)
+	sort.SliceStable(priority, func(i, j int) bool {
+		return depth(priority[i]) < depth(priority[j])
+	})
+	chosen := map[string]bool{files[0]: true}
+	used := sizes[files[0]]
+	for _, file := range priority {
+		if used+sizes[file] <= limit {
+			chosen[file] = true
+			used += sizes[file]
+		}
+	}
+
+	split := func() {
+		kept, omitted = nil, nil
+		for _, file := range files {
+			if chosen[file] {
+				kept = append(kept, file)
+			} else {
+				omitted = append(omitted, file)
+			}
+		}
+	}
+	split()
+	// Make room for the omitted sections list, dropping the least important
+	// files first
+	for i := len(priority) - 1; i >= 0 && len(omitted) > 0 && used+len(renderOmittedSections(omitted, scopeDir)) > limit; i-- {
+		if chosen[priority[i]] {
+			delete(chosen, priority[i])
+			used -= sizes[priority[i]]
+			split()
+		}
+	}
+	return kept, omitted
+}
+
+// renderOmittedSections renders the list of files --overflow priority left
+// out, or nothing if there are none.
+func renderOmittedSections(files []string, scopeDir string) []byte {
+	if len(files) == 0 {
+		return nil
+	}
+	doc := ast.NewDocument()
+	heading := ast.NewHeading(1)
+	heading.AppendChild(heading, ast.NewString([]byte("Omitted sections")))
+	doc.AppendChild(doc, heading)
+
+	label := ast.NewParagraph()
+	label.AppendChild(label, ast.NewString([]byte("Left out to keep the output within its size limit:")))
+	label.SetBlankPreviousLines(true)
+	doc.AppendChild(doc, label)
+
+	list := ast.NewList('-')
+	list.IsTight = true
+	list.SetBlankPreviousLines(true)
+	for _, file := range files {
+		path := file
+		if rel, err := filepath.Rel(scopeDir, file); err == nil {
+			path = rel
+		}
+		code := ast.NewCodeSpan()
+		code.AppendChild(code, ast.NewString([]byte(filepath.ToSlash(path))))
+
+		block := ast.NewTextBlock()
+		block.AppendChild(block, code)
+
+		item := ast.NewListItem(2)
+		item.AppendChild(item, block)
+		list.AppendChild(list, item)
+	}
+	doc.AppendChild(doc, list)
+
+	// Rendering into a buffer can't fail
+	var buf bytes.Buffer
+	_ = newMarkdownRenderer(nil).Render(&buf, nil, doc)
+	return buf.Bytes()
+}
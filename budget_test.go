@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOutputBudget(t *testing.T) {
+	budget := newOutputBudget(100, OverflowTruncate)
+	admitted := []bool{
+		budget.admit("a.md", 60),
+		budget.admit("b.md", 50),
+		// Small enough to fit, but the output already ended before b.md
+		budget.admit("c.md", 10),
+	}
+	if expected := []bool{true, false, false}; !reflect.DeepEqual(admitted, expected) {
+		t.Errorf("admit() = %v, want %v", admitted, expected)
+	}
+	if expected := []string{"b.md", "c.md"}; !reflect.DeepEqual(budget.omitted, expected) {
+		t.Errorf("omitted = %v, want %v", budget.omitted, expected)
+	}
+
+	// The trailing sections serve what was kept, so they still go in if they fit
+	if !budget.admitTrailing("endnotes", 30) {
+		t.Error("admitTrailing() after a section was turned away = false, want true")
+	}
+	if budget.admitTrailing("references", 20) {
+		t.Error("admitTrailing() past the limit = true, want false")
+	}
+
+	// Sections an earlier assembly dropped are only recorded; they don't end
+	// the output
+	budget = newOutputBudget(100, OverflowTruncate)
+	budget.drop("a.md")
+	if !budget.admit("b.md", 10) {
+		t.Error("admit() after drop() = false, want true")
+	}
+	if expected := []string{"a.md"}; !reflect.DeepEqual(budget.omitted, expected) {
+		t.Errorf("omitted = %v, want %v", budget.omitted, expected)
+	}
+
+	unlimited := newOutputBudget(0, OverflowError)
+	if !unlimited.admit("a.md", 1<<30) {
+		t.Error("a zero limit should admit everything")
+	}
+}
+
+func TestPrioritizeSections(t *testing.T) {
+	dir := t.TempDir()
+	files := make([]string, 0, 4)
+	for _, name := range []string{"index.md", "deep.md", "near.md", "big.md"} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(strings.Repeat("x", 100)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	depths := map[string]int{"index.md": 0, "deep.md": 2, "near.md": 1, "big.md": 1}
+	depth := func(file string) int { return depths[filepath.Base(file)] }
+
+	// Room for three files and the omitted list, so deep.md loses to the two
+	// files nearer the root even though it comes first in traversal order
+	kept, omitted := prioritizeSections(files, nil, depth, dir, 430)
+	if expected := []string{files[0], files[2], files[3]}; !reflect.DeepEqual(kept, expected) {
+		t.Errorf("kept = %v, want %v", kept, expected)
+	}
+	if expected := []string{files[1]}; !reflect.DeepEqual(omitted, expected) {
+		t.Errorf("omitted = %v, want %v", omitted, expected)
+	}
+}
+
+func TestRenderOmittedSections(t *testing.T) {
+	got := string(renderOmittedSections([]string{"/docs/guide.md", "/docs/odd `name`.md"}, "/docs"))
+	want := "# Omitted sections\n\nLeft out to keep the output within its size limit:\n\n- `guide.md`\n- ``odd `name`.md``\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := renderOmittedSections(nil, "/docs"); got != nil {
+		t.Errorf("got %q for no files, want nothing", got)
+	}
+}
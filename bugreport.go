@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// writeBugReport saves everything needed to reproduce a processing panic into a
+// fresh temporary directory and returns its path: the offending file (and only
+// that file, so the bundle stays small and shareable), the options and arguments
+// of the run, and the stack trace. Panics almost always come from the upstream
+// markdown renderer, so the bundle is meant to be attached to an issue there.
+func writeBugReport(filename string, content []byte, opts Options, perr *panicError) (string, error) {
+	dir, err := os.MkdirTemp("", "catmd-bug-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create bug report directory: %w", err)
+	}
+
+	options, err := json.MarshalIndent(struct {
+		Args      []string
+		GoVersion string
+		Options   Options
+	}{os.Args, runtime.Version(), opts}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode options: %w", err)
+	}
+
+	var readme strings.Builder
+	fmt.Fprintf(&readme, "catmd panicked while processing %s.\n\n", filepath.Base(filename))
+	fmt.Fprintf(&readme, "Reproduce with the flags recorded in options.json:\n\n    catmd %s\n\n", filepath.Base(filename))
+	fmt.Fprintf(&readme, "Files:\n")
+	fmt.Fprintf(&readme, "  %-14s the file being processed\n", filepath.Base(filename))
+	fmt.Fprintf(&readme, "  %-14s arguments and options of the failing run\n", "options.json")
+	fmt.Fprintf(&readme, "  %-14s the panic value and stack trace\n", "stack.txt")
+
+	files := map[string][]byte{
+		filepath.Base(filename): content,
+		"options.json":          append(options, '\n'),
+		"stack.txt":             []byte(fmt.Sprintf("%v\n\n%s", perr.value, perr.stack)),
+		"README.txt":            []byte(readme.String()),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+
+	return dir, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteBugReport(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	content := []byte("| a |\n|---|\n| 1 |\n")
+	perr := &panicError{value: "index out of range", stack: []byte("goroutine 1 [running]:\n")}
+
+	dir, err := writeBugReport("/docs/table.md", content, Options{Backlinks: true}, perr)
+	if err != nil {
+		t.Fatalf("writeBugReport() error = %v", err)
+	}
+
+	saved, err := os.ReadFile(filepath.Join(dir, "table.md"))
+	if err != nil || string(saved) != string(content) {
+		t.Errorf("offending file not saved verbatim: %q, %v", saved, err)
+	}
+
+	stack, err := os.ReadFile(filepath.Join(dir, "stack.txt"))
+	if err != nil || !strings.Contains(string(stack), "index out of range") || !strings.Contains(string(stack), "goroutine 1") {
+		t.Errorf("stack.txt missing panic value or trace: %q, %v", stack, err)
+	}
+
+	options, err := os.ReadFile(filepath.Join(dir, "options.json"))
+	if err != nil || !strings.Contains(string(options), `"Backlinks": true`) {
+		t.Errorf("options.json missing run options: %q, %v", options, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "README.txt")); err != nil {
+		t.Errorf("README.txt missing: %v", err)
+	}
+}
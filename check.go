@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// Rule identifiers for the problems reported by --check.
+const (
+	RuleBrokenLink = "broken-link" // Internal link to a file that doesn't exist
+	RuleBadAnchor  = "bad-anchor"  // Link fragment that matches no heading in its target
+	RuleOrphan     = "orphan"      // Markdown file in scope that no traversed file links to
+	RuleMissingAlt = "missing-alt" // Image without alt text
+)
+
+// ruleDescriptions gives a one-line description of each check rule.
+var ruleDescriptions = map[string]string{
+	RuleBrokenLink: "Internal link points to a file that does not exist",
+	RuleBadAnchor:  "Link fragment does not match any heading in the target file",
+	RuleOrphan:     "Markdown file in scope is not reachable from the root file",
+	RuleMissingAlt: "Image has no alt text for screen readers",
+}
+
+// Diagnostic describes one problem found in the source tree.
+type Diagnostic struct {
+	Rule    string // One of the Rule* identifiers
+	File    string // Absolute path of the file the problem was found in
+	Line    int    // 1-based line, 0 if the problem concerns the whole file
+	Column  int    // 1-based column, 0 if unknown
+	Message string // Human-readable description
+}
+
+// CheckFiles inspects the files reached by traversal and reports broken internal
+// links, fragments that match no heading, images without alt text, and markdown
+// files in the scope that traversal never reached. Links with the URL schemes of schemes, like those of
+// defaultExternalSchemes, are external. Files are read from snapshot, so a root
+// file read from standard input is checked too. Diagnostics are ordered by
+// traversal order, followed by orphans sorted by path.
+func CheckFiles(orderedFiles []string, scopeDir string, snapshot *Snapshot, schemes []string) []Diagnostic {
+	parsedFiles := make(map[string]*ParsedFile)
+	for _, file := range orderedFiles {
+		if parsed, err := snapshot.ParseFile(file, scopeDir); err == nil {
+			parsedFiles[file] = parsed
+		}
+	}
+
+	var diagnostics []Diagnostic
+	for _, file := range orderedFiles {
+		parsed, ok := parsedFiles[file]
+		if !ok {
+			continue
+		}
+		for _, link := range parsed.Links {
+			if diagnostic, ok := checkLink(file, link, parsed, scopeDir, schemes); !ok {
+				diagnostics = append(diagnostics, diagnostic)
+			}
+		}
+		diagnostics = append(diagnostics, checkImages(file, parsed)...)
+	}
+
+	reached := make(map[string]bool)
+	for _, file := range orderedFiles {
+		reached[file] = true
+	}
+	if allFiles, err := WalkDirectoryForMarkdown(scopeDir); err == nil {
+		sort.Strings(allFiles)
+		for _, file := range allFiles {
+			if !reached[file] {
+				diagnostics = append(diagnostics, Diagnostic{
+					Rule:    RuleOrphan,
+					File:    file,
+					Message: "file is not linked from any file reachable from the root",
+				})
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+// BrokenLinks returns the internal links of orderedFiles whose target files
+// don't exist, as RuleBrokenLink diagnostics in traversal order. Traversal
+// skips over these links, so --check-links reports them during builds. Files are
+// read from snapshot, like CheckFiles.
+func BrokenLinks(orderedFiles []string, scopeDir string, snapshot *Snapshot, schemes []string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, file := range orderedFiles {
+		parsed, err := snapshot.ParseFile(file, scopeDir)
+		if err != nil {
+			continue
+		}
+		for _, link := range parsed.Links {
+			if diagnostic, ok := checkLink(file, link, parsed, scopeDir, schemes); !ok && diagnostic.Rule == RuleBrokenLink {
+				diagnostics = append(diagnostics, diagnostic)
+			}
+		}
+	}
+	return diagnostics
+}
+
+// checkImages reports the images in file whose alt text is empty or blank.
+// Combined documents are often reviewed for accessibility as a whole, so every
+// included file is held to it.
+func checkImages(file string, parsed *ParsedFile) []Diagnostic {
+	var diagnostics []Diagnostic
+	ast.Walk(parsed.AST, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		image, ok := n.(*ast.Image)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		if extractTextFromNode(image, parsed.Source) == "" {
+			line, column := sourcePosition(parsed.Source, imageOffset(image))
+			diagnostics = append(diagnostics, Diagnostic{
+				Rule:    RuleMissingAlt,
+				File:    file,
+				Line:    line,
+				Column:  column,
+				Message: fmt.Sprintf("image %q has no alt text", image.Destination),
+			})
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	return diagnostics
+}
+
+// imageOffset returns the byte offset of an image's "![", which directly
+// follows the text before it, or starts its block if nothing does. Other
+// images fall back to nodeOffset.
+func imageOffset(image *ast.Image) int {
+	if text, ok := image.PreviousSibling().(*ast.Text); ok {
+		return text.Segment.Stop
+	}
+	if parent := image.Parent(); image.PreviousSibling() == nil && parent.Type() == ast.TypeBlock && parent.Lines().Len() > 0 {
+		return parent.Lines().At(0).Start
+	}
+	return nodeOffset(image)
+}
+
+// checkLink validates a single link, returning ok=false and a diagnostic if the
+// link's target file or fragment doesn't exist.
+func checkLink(file string, link LinkInfo, parsed *ParsedFile, scopeDir string, schemes []string) (Diagnostic, bool) {
+	diagnostic := Diagnostic{File: file, Line: link.Line, Column: link.Column}
+
+	if link.IsFootnote {
+		return diagnostic, true
+	}
+
+	// Fragment-only links refer to the file itself
+	if strings.HasPrefix(link.URL, "#") {
+		if !hasHeaderID(parsed.Headers, link.URL[1:]) && !hasElementFragment(parsed.AST, link.URL[1:]) {
+			diagnostic.Rule = RuleBadAnchor
+			diagnostic.Message = fmt.Sprintf("no heading with ID %q in this file", link.URL[1:])
+			return diagnostic, false
+		}
+		return diagnostic, true
+	}
+
+	if !link.IsInternal || isExternalScheme(link.URL, schemes) {
+		return diagnostic, true
+	}
+
+	target, err := resolveLinkTarget(file, link.URL)
+	if err != nil {
+		return diagnostic, true
+	}
+
+	info, err := os.Stat(target)
+	if err != nil || info.IsDir() {
+		diagnostic.Rule = RuleBrokenLink
+		diagnostic.Message = fmt.Sprintf("link target %q does not exist", link.URL)
+		return diagnostic, false
+	}
+
+	_, fragment, hasFragment := strings.Cut(link.URL, "#")
+	if !hasFragment || fragment == "" || !(&FileTraversal{}).isMarkdownFile(target) {
+		return diagnostic, true
+	}
+
+	content, err := os.ReadFile(target)
+	if err != nil {
+		return diagnostic, true
+	}
+	targetParsed, err := ParseMarkdownFile(content, scopeDir)
+	if err != nil {
+		return diagnostic, true
+	}
+	if !hasHeaderID(targetParsed.Headers, fragment) && !hasElementFragment(targetParsed.AST, fragment) {
+		diagnostic.Rule = RuleBadAnchor
+		diagnostic.Message = fmt.Sprintf("no heading with ID %q in %s", fragment, filepath.Base(target))
+		return diagnostic, false
+	}
+	return diagnostic, true
+}
+
+// hasHeaderID reports whether any header has the given auto-generated ID,
+// which may carry GitHub's "user-content-" prefix.
+func hasHeaderID(headers []HeaderInfo, id string) bool {
+	unprefixed := strings.TrimPrefix(id, githubFragmentPrefix)
+	for _, header := range headers {
+		if header.ID == id || header.ID == unprefixed {
+			return true
+		}
+	}
+	return false
+}
+
+// runCheck implements --check: it writes the diagnostics for the traversed files
+// in the requested format and fails if any were found.
+func runCheck(traversal *FileTraversal, orderedFiles []string, scopeDir string, opts Options) error {
+	var diagnostics []Diagnostic
+	for _, diagnostic := range CheckFiles(orderedFiles, scopeDir, opts.Snapshot, opts.Schemes) {
+		// Files outside the --only directories are left out on purpose
+		if diagnostic.Rule != RuleOrphan || traversal.IsAllowed(diagnostic.File) {
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+
+	writer, closeOutput, err := createOutput(opts.Output)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if opts.CheckFormat == "sarif" {
+		err = WriteSARIF(writer, diagnostics)
+	} else {
+		err = writeDiagnosticsText(writer, diagnostics)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write diagnostics: %w", err)
+	}
+
+	if len(diagnostics) > 0 {
+		return fmt.Errorf("check found %d problem(s)", len(diagnostics))
+	}
+	return nil
+}
+
+// reportBrokenLinks implements --check-links, writing the broken internal links
+// of orderedFiles to standard error. With --strict, finding any is an error.
+func reportBrokenLinks(orderedFiles []string, scopeDir string, opts Options) error {
+	diagnostics := BrokenLinks(orderedFiles, scopeDir, opts.Snapshot, opts.Schemes)
+	if err := writeDiagnosticsText(os.Stderr, diagnostics); err != nil {
+		return fmt.Errorf("failed to write broken links: %w", err)
+	}
+	if opts.Strict && len(diagnostics) > 0 {
+		return fmt.Errorf("found %d broken internal link(s)", len(diagnostics))
+	}
+	return nil
+}
+
+// writeDiagnosticsText writes one "path:line:column: rule: message" line per
+// diagnostic, in the style of compilers and linters.
+func writeDiagnosticsText(w io.Writer, diagnostics []Diagnostic) error {
+	for _, d := range diagnostics {
+		location := displayPath(d.File)
+		if d.Line > 0 {
+			location += fmt.Sprintf(":%d", d.Line)
+			if d.Column > 0 {
+				location += fmt.Sprintf(":%d", d.Column)
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s: %s\n", location, d.Rule, d.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// displayPath shows an absolute path relative to the working directory, with
+// forward slashes, when it lies below it; other paths are returned unchanged.
+func displayPath(path string) string {
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(path)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.md":    "# Index\n\nSee [guide](guide.md#setup), [missing](missing.md), and [top](#index).\n\n[Call](tel:+15551234) or [chat](slack://open).\n\n![Diagram](diagram.png) and ![](chart.png)\n\n| A |\n| - |\n| 1 |\n",
+		"guide.md":    "# Guide\n\n## Setup\n\nBack to [index](index.md#nope).\n\nThe [table](index.md#table-1) and [setup](#user-content-setup) resolve.\n",
+		"orphaned.md": "# Orphaned\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index := filepath.Join(dir, "index.md")
+	guide := filepath.Join(dir, "guide.md")
+	diagnostics := CheckFiles([]string{index, guide}, dir, nil, []string{"slack"})
+
+	expected := []Diagnostic{
+		{Rule: RuleBrokenLink, File: index, Line: 3},
+		{Rule: RuleMissingAlt, File: index, Line: 7},
+		{Rule: RuleBadAnchor, File: guide, Line: 5},
+		{Rule: RuleOrphan, File: filepath.Join(dir, "orphaned.md")},
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("CheckFiles() returned %d diagnostics, want %d: %+v", len(diagnostics), len(expected), diagnostics)
+	}
+	for i, want := range expected {
+		got := diagnostics[i]
+		if got.Rule != want.Rule || got.File != want.File || got.Line != want.Line {
+			t.Errorf("diagnostic %d = %+v, want rule %s in %s at line %d", i, got, want.Rule, want.File, want.Line)
+		}
+	}
+}
+
+func TestBrokenLinks(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.md": "# Index\n\nSee [guide](guide.md#nope), [missing](missing.md), and [call](tel:+15551234).\n\n![](chart.png)\n",
+		"guide.md": "# Guide\n\nBack to [index](index.md) or [gone](old/gone.md#setup).\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index := filepath.Join(dir, "index.md")
+	guide := filepath.Join(dir, "guide.md")
+	diagnostics := BrokenLinks([]string{index, guide}, dir, nil, nil)
+
+	// Bad anchors and images without alt text are left to --check
+	expected := []Diagnostic{
+		{Rule: RuleBrokenLink, File: index, Line: 3, Column: 30},
+		{Rule: RuleBrokenLink, File: guide, Line: 3, Column: 31},
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("BrokenLinks() returned %d diagnostics, want %d: %+v", len(diagnostics), len(expected), diagnostics)
+	}
+	for i, want := range expected {
+		got := diagnostics[i]
+		if got.Rule != want.Rule || got.File != want.File || got.Line != want.Line || got.Column != want.Column {
+			t.Errorf("diagnostic %d = %+v, want rule %s in %s at %d:%d", i, got, want.Rule, want.File, want.Line, want.Column)
+		}
+	}
+}
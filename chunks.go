@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/yuin/goldmark/ast"
+
+	markdown "github.com/teekennedy/goldmark-markdown"
+)
+
+// chunkIndexName is the name of the master index --chunks writes next to the
+// chunk files.
+const chunkIndexName = "index.md"
+
+// chunkFileName returns the name of the file of the chunk numbered chunk,
+// counting from 0.
+func chunkFileName(chunk int) string {
+	return fmt.Sprintf("chunk-%03d.md", chunk+1)
+}
+
+// NewChunkProcessor creates a FileProcessor for --chunks, which splits the
+// combined document into files of up to opts.ChunkSize consecutive sections
+// under dir. Heading IDs are worked out for each chunk on its own, the way
+// renderers generate them for each file, and links to sections in another
+// chunk point at that chunk's file. As with --explode, footnotes are inlined
+// and abbreviation definitions left in place, and images are left where they
+// are, with their paths rewritten against dir.
+func NewChunkProcessor(scopeDir string, orderedFiles []string, opts Options, dir string) *FileProcessor {
+	opts.Footnotes = FootnotesInline
+	opts.Abbreviations = false
+	opts.AssetsDir = ""
+	if abs, err := filepath.Abs(dir); err == nil {
+		opts.AssetBase = abs
+	}
+	fp := NewFileProcessor(scopeDir, orderedFiles, opts)
+	fp.chunks = make(map[string]int)
+	for i, file := range fp.files {
+		fp.chunks[file] = i / opts.ChunkSize
+	}
+
+	// Heading IDs only need to be unique within each chunk
+	fp.anchors = make(map[string]string)
+	fp.htmlAnchors = make(map[string]string)
+	fp.resolveAnchors(fp.files)
+	return fp
+}
+
+// chunkLink returns the file links from the section of from to the section of
+// target lead to: "" when both are in the same chunk or without --chunks, and
+// the name of target's chunk file otherwise.
+func (fp *FileProcessor) chunkLink(from, target string) string {
+	chunk, ok := fp.chunks[target]
+	if !ok {
+		return ""
+	}
+	if own, ok := fp.chunks[from]; ok && own == chunk {
+		return ""
+	}
+	return chunkFileName(chunk)
+}
+
+// chunkTOC builds the table of contents of the chunk starting with the section
+// of from, listing files, or of the whole document when from is in no chunk,
+// in which case every entry links to its chunk's file.
+func (fp *FileProcessor) chunkTOC(from string, files []string) *ast.List {
+	var listed []string
+	for _, file := range files {
+		if fp.visitedFiles[file] && !fp.omitsSection(file) {
+			listed = append(listed, file)
+		}
+	}
+	return fp.tocList(from, listed, false)
+}
+
+// WriteChunks processes files with processor, which NewChunkProcessor created,
+// and writes each chunk under dir, starting with a table of contents of its
+// sections, followed by the master index, which lists every chunk with its
+// sections. Files that fail to process are left out, with a warning.
+func WriteChunks(processor *FileProcessor, files []string, dir string, jobs int) error {
+	results := processFiles(processor, files, jobs)
+	outputs := make(map[string][]byte)
+	var chunks [][]string
+	for i, file := range files {
+		result := <-results[i]
+		err := result.readErr
+		if err == nil {
+			err = result.err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: left %q out of --chunks: %v\n", file, err)
+			continue
+		}
+		chunk, ok := processor.chunks[file]
+		if !ok {
+			continue
+		}
+		for len(chunks) <= chunk {
+			chunks = append(chunks, nil)
+		}
+		chunks[chunk] = append(chunks[chunk], file)
+		outputs[file] = result.output
+	}
+
+	renderer := processor.renderers.Get().(*markdown.Renderer)
+	defer processor.renderers.Put(renderer)
+
+	index := ast.NewList('-')
+	index.IsTight = true
+	for chunk, chunkFiles := range chunks {
+		if len(chunkFiles) == 0 {
+			continue
+		}
+		toc := ast.NewDocument()
+		label := ast.NewParagraph()
+		label.AppendChild(label, ast.NewString([]byte("Contents:")))
+		toc.AppendChild(toc, label)
+		list := processor.chunkTOC(chunkFiles[0], chunkFiles)
+		list.SetBlankPreviousLines(true)
+		toc.AppendChild(toc, list)
+
+		var content bytes.Buffer
+		if err := renderer.Render(&content, nil, toc); err != nil {
+			return fmt.Errorf("failed to render table of contents of %s: %w", chunkFileName(chunk), err)
+		}
+		for _, file := range chunkFiles {
+			content.WriteString("\n\n")
+			content.Write(outputs[file])
+		}
+
+		path := filepath.Join(dir, chunkFileName(chunk))
+		if err := writeSectionFile(path, content.Bytes(), processor.opts.MaxBlankLines); err != nil {
+			return err
+		}
+
+		item := tocItem(chunkFileName(chunk), fmt.Sprintf("Part %d", chunk+1))
+		item.AppendChild(item, processor.chunkTOC("", chunkFiles))
+		index.AppendChild(index, item)
+	}
+
+	doc := ast.NewDocument()
+	label := ast.NewParagraph()
+	label.AppendChild(label, ast.NewString([]byte("Contents:")))
+	doc.AppendChild(doc, label)
+	index.SetBlankPreviousLines(true)
+	doc.AppendChild(doc, index)
+	var content bytes.Buffer
+	if err := renderer.Render(&content, nil, doc); err != nil {
+		return fmt.Errorf("failed to render %s: %w", chunkIndexName, err)
+	}
+	return writeSectionFile(filepath.Join(dir, chunkIndexName), content.Bytes(), processor.opts.MaxBlankLines)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteChunks(t *testing.T) {
+	dir := t.TempDir()
+	sources := map[string]string{
+		"index.md": "# Index\n\nRead the [guide](guide.md#setup) and the [FAQ](faq.md#setup).\n",
+		"guide.md": "# Guide\n\n## Setup\n\nSee the [FAQ](faq.md).\n",
+		"faq.md":   "# FAQ\n\n## Setup\n\nBack to the [guide](guide.md#setup).\n",
+	}
+	var files []string
+	for _, name := range []string{"index.md", "guide.md", "faq.md"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(sources[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+
+	out := filepath.Join(t.TempDir(), "chunks")
+	processor := NewChunkProcessor(dir, files, Options{ChunkSize: 2, MaxBlankLines: 2}, out)
+	if err := WriteChunks(processor, files, out, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// The FAQ's Setup heading is the first in its chunk, so it keeps its ID
+	expected := map[string]string{
+		"chunk-001.md": "Contents:\n\n- [Index](#index)\n- [Guide](#guide)\n\n\n# Index\n\nRead the [guide](#setup) and the [FAQ](chunk-002.md#setup).\n\n\n# Guide\n\n## Setup\n\nSee the [FAQ](chunk-002.md#faq).\n",
+		"chunk-002.md": "Contents:\n\n- [FAQ](#faq)\n\n\n# FAQ\n\n## Setup\n\nBack to the [guide](chunk-001.md#setup).\n",
+		"index.md":     "Contents:\n\n- [Part 1](chunk-001.md)\n  - [Index](chunk-001.md#index)\n  - [Guide](chunk-001.md#guide)\n- [Part 2](chunk-002.md)\n  - [FAQ](chunk-002.md#faq)\n",
+	}
+	for name, want := range expected {
+		got, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s =\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
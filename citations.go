@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	markdown "github.com/teekennedy/goldmark-markdown"
+	"github.com/yuin/goldmark/ast"
+)
+
+// UseBibliography enables --bibliography: Pandoc-style [@key] citations are
+// replaced with author-date links to a References section listing the cited
+// works.
+func (fp *FileProcessor) UseBibliography(bibliography map[string]*BibEntry) {
+	fp.bibliography = bibliography
+	fp.cited = make(map[string]bool)
+}
+
+// replaceCitations replaces the bracketed citations in the text of doc, such
+// as [@knuth84] or [see @knuth84, p. 3; @lamport94], with "(Knuth 1984)" style
+// text linking to the References section, adding the keys it cites to cited. A
+// citation naming a key missing from the bibliography is left as is, with a
+// warning.
+func (fp *FileProcessor) replaceCitations(doc ast.Node, source []byte, filename string, cited map[string]bool) {
+	replaceInText(doc, source, skipsText, func(text string) []textReplacement {
+		var replacements []textReplacement
+		for _, match := range citationPattern.FindAllStringIndex(text, -1) {
+			if citation := fp.citationNodes(text[match[0]:match[1]], filename, cited); citation != nil {
+				replacements = append(replacements, textReplacement{start: match[0], end: match[1], nodes: citation})
+			}
+		}
+		return replacements
+	})
+}
+
+// citationNodes builds the replacement for one bracketed citation, adding its
+// keys to cited, or returns nil if it isn't a well-formed citation of known
+// keys.
+func (fp *FileProcessor) citationNodes(citation, filename string, cited map[string]bool) []ast.Node {
+	nodes := []ast.Node{ast.NewString([]byte("("))}
+	for i, item := range strings.Split(citation[1:len(citation)-1], ";") {
+		m := citationItemPattern.FindStringSubmatch(strings.TrimSpace(item))
+		if m == nil {
+			return nil
+		}
+		prefix, suppressAuthor, key, locator := strings.TrimSpace(m[1]), m[2] == "-", m[3], m[4]
+
+		// Keys end in a letter or digit; punctuation after one starts the locator
+		trimmed := strings.TrimRightFunc(key, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		key, locator = trimmed, key[len(trimmed):]+locator
+
+		entry, ok := fp.bibliography[key]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Warning: %s: unknown citation key %q\n", displayPath(filename), key)
+			return nil
+		}
+		cited[key] = true
+
+		if i > 0 {
+			nodes = append(nodes, ast.NewString([]byte("; ")))
+		}
+		if prefix != "" {
+			nodes = append(nodes, ast.NewString([]byte(prefix+" ")))
+		}
+		link := ast.NewLink()
+		link.Destination = []byte("#" + citationID(key))
+		link.AppendChild(link, newLiteral(citationLabel(entry, suppressAuthor)))
+		nodes = append(nodes, link)
+		if locator = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(locator), ",")); locator != "" {
+			nodes = append(nodes, ast.NewString([]byte(", "+locator)))
+		}
+	}
+	return append(nodes, ast.NewString([]byte(")")))
+}
+
+// RenderReferences renders the References section listing every cited work,
+// ordered by author, each preceded by the anchor citations link to. Returns nil
+// when nothing was cited.
+func (fp *FileProcessor) RenderReferences() []byte {
+	if len(fp.cited) == 0 {
+		return nil
+	}
+
+	var entries []*BibEntry
+	for key := range fp.cited {
+		entries = append(entries, fp.bibliography[key])
+	}
+	sortReferences(entries)
+
+	doc := ast.NewDocument()
+	heading := ast.NewHeading(1)
+	heading.AppendChild(heading, ast.NewString([]byte("References")))
+	doc.AppendChild(doc, heading)
+
+	// The source holds the URLs the autolinks read from
+	var source []byte
+	for _, entry := range entries {
+		paragraph := ast.NewParagraph()
+		paragraph.SetBlankPreviousLines(true)
+		paragraph.AppendChild(paragraph, newAnchor(citationID(entry.Key)))
+		var nodes []ast.Node
+		nodes, source = formatReference(entry, source)
+		for _, node := range nodes {
+			paragraph.AppendChild(paragraph, node)
+		}
+		doc.AppendChild(doc, paragraph)
+	}
+
+	renderer := fp.renderers.Get().(*markdown.Renderer)
+	defer fp.renderers.Put(renderer)
+
+	// Rendering into a buffer can't fail
+	var buf bytes.Buffer
+	_ = renderer.Render(&buf, source, doc)
+	return buf.Bytes()
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFileName is the config file catmd reads from the root file's directory,
+// or the nearest directory above it that has one. A TOMLConfigFileName there is
+// read instead when there is none.
+const (
+	ConfigFileName     = ".catmd.yaml"
+	TOMLConfigFileName = "catmd.toml"
+)
+
+// ConfigEnvVar names the environment variable giving the path of a config file
+// to read instead of looking for one.
+const ConfigEnvVar = "CATMD_CONFIG"
+
+// Config is the contents of a config file.
+//
+// Options set flags, keyed by flag name, for every build from the root file:
+//
+//	scope: ..
+//	exclude: [drafts/*]
+//	section-anchors: filename
+//
+// Paths are relative to the config file's directory; see pathFlags.
+//
+// Targets name sets of options for each way the same sources are published,
+// such as web, pdf, or llm, and --target picks one. The options of a target
+// are keyed by flag name, and lists may be given for comma-separated flags:
+//
+//	targets:
+//	  llm:
+//	    flatten-below: 3
+//	    heading-acronyms: [API, CLI]
+//
+// Order rules move sections of the combined document, whatever the target; see
+// OrderRule.
+type Config struct {
+	Options map[string]any            `yaml:",inline"`
+	Targets map[string]map[string]any `yaml:"targets"`
+	Order   []OrderRule               `yaml:"order"`
+}
+
+// LoadConfig reads and parses the config file at path, which is TOML if its
+// extension is .toml and YAML otherwise.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) == ".toml" {
+		// Decoded like the YAML it is equivalent to
+		var values map[string]any
+		if _, err := toml.Decode(string(data), &values); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = yaml.Marshal(values); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, rule := range config.Order {
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	config.resolvePaths(filepath.Dir(path))
+	return &config, nil
+}
+
+// pathFlags are the flags that take a file or directory path, which config
+// files give relative to their own directory.
+var pathFlags = []string{"output", "o", "scope", "glossary", "bibliography", "file-header", "file-footer", "redirects-file", "explode", "chunks", "archive", "anchor-map", "report"}
+
+// resolvePaths makes the relative paths the config's options and targets give
+// for pathFlags relative to dir, the config file's directory, rather than to
+// the directory catmd runs in.
+func (c *Config) resolvePaths(dir string) {
+	resolve := func(options map[string]any) {
+		for _, name := range pathFlags {
+			if path, ok := options[name].(string); ok && path != "" && !filepath.IsAbs(path) {
+				options[name] = filepath.Join(dir, path)
+			}
+		}
+	}
+	resolve(c.Options)
+	for _, options := range c.Targets {
+		resolve(options)
+	}
+}
+
+// configPath returns the path of the config file for rootFile: the one
+// CATMD_CONFIG names, or else the nearest one in rootFile's directory or the
+// directories above it, stopping at the top of its git repository, so builds
+// started anywhere in a repository find the project's config. It returns "" if
+// there is none.
+func configPath(rootFile string) string {
+	if path := os.Getenv(ConfigEnvVar); path != "" {
+		return path
+	}
+	dir, err := filepath.Abs(filepath.Dir(rootFile))
+	if err != nil {
+		dir = filepath.Dir(rootFile)
+	}
+	for {
+		for _, name := range []string{ConfigFileName, TOMLConfigFileName} {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Apply sets the flags of flags that the config configures, given the named
+// target, or none if name is empty. Flags given on the command line, which are
+// listed in explicit, take precedence over the target's options, which take
+// precedence over the config's own.
+func (c *Config) Apply(name string, flags *flag.FlagSet, explicit map[string]bool) error {
+	set := make(map[string]bool)
+	for key := range explicit {
+		set[key] = true
+	}
+	if name != "" {
+		if err := c.ApplyTarget(name, flags, set); err != nil {
+			return err
+		}
+		for key := range c.Targets[name] {
+			set[key] = true
+		}
+	}
+	return setFlags("config", c.Options, flags, set)
+}
+
+// ApplyTarget sets the flags of flags that the named target configures. Flags
+// given on the command line, which are listed in explicit, take precedence and
+// are left alone.
+func (c *Config) ApplyTarget(name string, flags *flag.FlagSet, explicit map[string]bool) error {
+	options, ok := c.Targets[name]
+	if !ok {
+		return fmt.Errorf("no target %q in the config file (have: %s)", name, strings.Join(c.targetNames(), ", "))
+	}
+	return setFlags(fmt.Sprintf("target %q", name), options, flags, explicit)
+}
+
+// setFlags sets the flags of flags named by the keys of options, except those
+// in explicit. Errors are prefixed with where the options come from.
+func setFlags(where string, options map[string]any, flags *flag.FlagSet, explicit map[string]bool) error {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if flags.Lookup(key) == nil || key == "target" || key == "no-config" {
+			return fmt.Errorf("%s: unknown option %q", where, key)
+		}
+		if explicit[key] {
+			continue
+		}
+		if err := flags.Set(key, configValue(options[key])); err != nil {
+			return fmt.Errorf("%s: option %q: %w", where, key, err)
+		}
+	}
+	return nil
+}
+
+// targetNames returns the names of the config's targets, sorted.
+func (c *Config) targetNames() []string {
+	names := make([]string, 0, len(c.Targets))
+	for name := range c.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configValue formats a config value as it would be written on the command
+// line, joining lists with commas.
+func configValue(value any) string {
+	if list, ok := value.([]any); ok {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// loadRootConfig reads the config file for rootFile, see configPath,
+// returning it and its path, or nil and "" if there is none.
+func loadRootConfig(rootFile string) (*Config, string, error) {
+	path := configPath(rootFile)
+	if path == "" {
+		return nil, "", nil
+	}
+	config, err := LoadConfig(path)
+	if err != nil && os.Getenv(ConfigEnvVar) != "" {
+		err = fmt.Errorf("%s: %w", ConfigEnvVar, err)
+	}
+	return config, path, err
+}
+
+// applyConfig applies rootFile's config file, config, with the named target,
+// if any, to the command line flags that weren't given explicitly, which are
+// those not in explicit.
+func applyConfig(config *Config, rootFile, target string, explicit map[string]bool) error {
+	if config == nil {
+		if target != "" {
+			return fmt.Errorf("--target %q given, but there is no %s in the directory of %s or above it", target, ConfigFileName, rootFile)
+		}
+		return nil
+	}
+	return config.Apply(target, flag.CommandLine, explicit)
+}
+
+// explicitFlags returns the names of the flags given on the command line.
+func explicitFlags() map[string]bool {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	return explicit
+}
+
+// listFlags are the flags that take comma-separated lists, which config files
+// may also give as YAML or TOML lists.
+var listFlags = []string{"only", "exclude", "external-schemes", "tags", "heading-acronyms"}
+
+// ConfigSchemaID is the $id of the JSON Schema ConfigSchema describes config
+// files with.
+const ConfigSchemaID = "https://github.com/brandonbloom/catmd/raw/main/catmd.schema.json"
+
+// ConfigSchema returns a JSON Schema for config files whose options are the
+// flags of flags. Each option's type follows its flag's, and its description is
+// the flag's usage. Defaults are left out, since some, like --jobs, depend on
+// the machine.
+func ConfigSchema(flags *flag.FlagSet) map[string]any {
+	options := make(map[string]any)
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Name == "target" || f.Name == "no-config" {
+			return
+		}
+		options[f.Name] = optionSchema(f)
+	})
+
+	properties := map[string]any{
+		"targets": map[string]any{
+			"description":          "Named sets of options, picked with --target, that override the top-level ones",
+			"type":                 "object",
+			"additionalProperties": map[string]any{"$ref": "#/$defs/options"},
+		},
+		"order": map[string]any{
+			"description": "Rules moving the sections matching a path pattern, applied in order after traversal",
+			"type":        "array",
+			"items":       map[string]any{"$ref": "#/$defs/orderRule"},
+		},
+	}
+	for name, option := range options {
+		properties[name] = option
+	}
+
+	place := func(description string) map[string]any {
+		return map[string]any{"description": description, "type": "string"}
+	}
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"$id":                  ConfigSchemaID,
+		"title":                "catmd config file",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+		"$defs": map[string]any{
+			"options": map[string]any{
+				"type":                 "object",
+				"properties":           options,
+				"additionalProperties": false,
+			},
+			"orderRule": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"sections": place("Path pattern, relative to the scope directory, of the sections to move"),
+					"position": map[string]any{"description": "Where to move the sections", "enum": []string{OrderFirst, OrderLast}},
+					"before":   place("Path pattern of the sections to move them before"),
+					"after":    place("Path pattern of the sections to move them after"),
+				},
+				"required":             []string{"sections"},
+				"oneOf":                []any{map[string]any{"required": []string{"position"}}, map[string]any{"required": []string{"before"}}, map[string]any{"required": []string{"after"}}},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+// optionSchema returns the JSON Schema of the config option setting f.
+func optionSchema(f *flag.Flag) map[string]any {
+	schema := map[string]any{"description": f.Usage}
+	var value any
+	if getter, ok := f.Value.(flag.Getter); ok {
+		value = getter.Get()
+	}
+	switch value.(type) {
+	case bool:
+		schema["type"] = "boolean"
+	case int, int64, uint, uint64:
+		schema["type"] = "integer"
+	case float64:
+		schema["type"] = "number"
+	default:
+		schema["type"] = "string"
+	}
+	if slices.Contains(listFlags, f.Name) {
+		schema["type"] = []string{"string", "array"}
+		schema["items"] = map[string]any{"type": "string"}
+	}
+	return schema
+}
+
+// writeEffectiveOptions writes every option of flags with its value and where
+// the value comes from: the command line, the named target, the config file,
+// or the default. Flags given on the command line are listed in explicit.
+func writeEffectiveOptions(w io.Writer, config *Config, target string, flags *flag.FlagSet, explicit map[string]bool) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "OPTION\tVALUE\tSOURCE\n")
+	flags.VisitAll(func(f *flag.Flag) {
+		source := "default"
+		switch {
+		case explicit[f.Name]:
+			source = "command line"
+		case config != nil && target != "" && config.Targets[target][f.Name] != nil:
+			source = fmt.Sprintf("target %q", target)
+		case config != nil && config.Options[f.Name] != nil:
+			source = "config"
+		}
+		value := f.Value.String()
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", f.Name, value, source)
+	})
+	return table.Flush()
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	goast "go/ast"
+	"go/doc/comment"
+	goparser "go/parser"
+	"go/token"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+func TestConfig_ApplyTarget(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ConfigFileName)
+	config := "targets:\n  llm:\n    toc: true\n    flatten-below: 3\n    heading-acronyms: [API, CLI]\n  web:\n    backlinks: true\n"
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := flag.NewFlagSet("catmd", flag.ContinueOnError)
+	toc := flags.Bool("toc", false, "")
+	flatten := flags.Int("flatten-below", 0, "")
+	acronyms := flags.String("heading-acronyms", "", "")
+	flags.Bool("backlinks", false, "")
+	if err := flags.Parse([]string{"--flatten-below", "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loaded.ApplyTarget("llm", flags, map[string]bool{"flatten-below": true}); err != nil {
+		t.Fatal(err)
+	}
+	if !*toc || *acronyms != "API,CLI" {
+		t.Errorf("target options not applied: toc=%v heading-acronyms=%q", *toc, *acronyms)
+	}
+	if *flatten != 2 {
+		t.Errorf("flatten-below = %d, want the command line's 2", *flatten)
+	}
+
+	err = loaded.ApplyTarget("pdf", flags, nil)
+	if err == nil || !strings.Contains(err.Error(), "llm, web") {
+		t.Errorf("ApplyTarget(pdf) error = %v, want one listing the targets", err)
+	}
+
+	loaded.Targets["bad"] = map[string]any{"no-such-flag": 1}
+	if err := loaded.ApplyTarget("bad", flags, nil); err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+}
+
+func TestConfig_Apply(t *testing.T) {
+	config := &Config{
+		Options: map[string]any{"toc": true, "flatten-below": 4, "exclude": []any{"drafts/*", "old/*"}},
+		Targets: map[string]map[string]any{"llm": {"flatten-below": 3}},
+	}
+	flags := flag.NewFlagSet("catmd", flag.ContinueOnError)
+	toc := flags.Bool("toc", false, "")
+	flatten := flags.Int("flatten-below", 0, "")
+	exclude := flags.String("exclude", "", "")
+	if err := flags.Parse([]string{"--toc=false"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.Apply("llm", flags, map[string]bool{"toc": true}); err != nil {
+		t.Fatal(err)
+	}
+	if *toc || *flatten != 3 || *exclude != "drafts/*,old/*" {
+		t.Errorf("toc=%v flatten-below=%d exclude=%q, want the command line's false, the target's 3, and the config's patterns", *toc, *flatten, *exclude)
+	}
+
+	config.Options["no-such-flag"] = 1
+	if err := config.Apply("", flags, nil); err == nil || !strings.Contains(err.Error(), "no-such-flag") {
+		t.Errorf("Apply error = %v, want one naming the unknown option", err)
+	}
+}
+
+func TestLoadConfig_TOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TOMLConfigFileName)
+	source := `# Shared options
+scope = ".."
+exclude = ["drafts/*", 'a#b'] # trailing comment
+max-blank-lines = 1_0
+
+[targets.llm]
+heading-acronyms = ["API", "CLI"]
+"flatten-below" = 3
+output = "build/llm.md"
+
+[[order]]
+sections = "changelog/*"
+position = "last"
+
+[[order]]
+sections = "tutorials/*"
+before = "reference/*"
+`
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Options["scope"] != filepath.Join(filepath.Dir(path), "..") || configValue(config.Options["exclude"]) != "drafts/*,a#b" || configValue(config.Options["max-blank-lines"]) != "10" {
+		t.Errorf("options = %v", config.Options)
+	}
+	if llm := config.Targets["llm"]; configValue(llm["heading-acronyms"]) != "API,CLI" || configValue(llm["flatten-below"]) != "3" || llm["output"] != filepath.Join(filepath.Dir(path), "build", "llm.md") {
+		t.Errorf("llm target = %v", llm)
+	}
+	want := []OrderRule{{Sections: "changelog/*", Position: OrderLast}, {Sections: "tutorials/*", Before: "reference/*"}}
+	if !reflect.DeepEqual(config.Order, want) {
+		t.Errorf("order = %+v, want %+v", config.Order, want)
+	}
+
+	for _, bad := range []string{"toc", "toc = [1,", "toc = true\ntoc = false", "x = 1\n[x]"} {
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("LoadConfig(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	flags := flag.NewFlagSet("catmd", flag.ContinueOnError)
+	flags.Bool("toc", false, "Prepend a table of contents")
+	flags.Int("flatten-below", 0, "")
+	flags.Duration("file-timeout", 0, "")
+	flags.String("exclude", "", "")
+	flags.String("target", "", "")
+
+	schema := ConfigSchema(flags)
+	properties := schema["properties"].(map[string]any)
+	types := map[string]any{
+		"toc":           "boolean",
+		"flatten-below": "integer",
+		"file-timeout":  "string",
+		"exclude":       []string{"string", "array"},
+	}
+	for name, want := range types {
+		option, ok := properties[name].(map[string]any)
+		if !ok {
+			t.Errorf("schema has no option %q", name)
+			continue
+		}
+		if !reflect.DeepEqual(option["type"], want) {
+			t.Errorf("type of %q = %v, want %v", name, option["type"], want)
+		}
+	}
+	if properties["toc"].(map[string]any)["description"] != "Prepend a table of contents" {
+		t.Errorf("toc description = %v, want the flag's usage", properties["toc"])
+	}
+	if _, ok := properties["target"]; ok {
+		t.Error("schema allows target, which config files can't set")
+	}
+	for _, key := range []string{"targets", "order"} {
+		if _, ok := properties[key]; !ok {
+			t.Errorf("schema has no %q", key)
+		}
+	}
+}
+
+func TestWriteEffectiveOptions(t *testing.T) {
+	config := &Config{
+		Options: map[string]any{"toc": true, "flatten-below": 4},
+		Targets: map[string]map[string]any{"llm": {"flatten-below": 3}},
+	}
+	flags := flag.NewFlagSet("catmd", flag.ContinueOnError)
+	flags.Bool("toc", false, "")
+	flags.Int("flatten-below", 0, "")
+	flags.String("exclude", "", "")
+	flags.String("scope", "", "")
+	if err := flags.Parse([]string{"--scope", ".."}); err != nil {
+		t.Fatal(err)
+	}
+	explicit := map[string]bool{"scope": true}
+	if err := config.Apply("llm", flags, explicit); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := writeEffectiveOptions(&out, config, "llm", flags, explicit); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`exclude        ""     default`,
+		`flatten-below  3      target "llm"`,
+		`scope          ..     command line`,
+		`toc            true   config`,
+	}
+	for _, line := range want {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("writeEffectiveOptions() = %q, want a line %q", out.String(), line)
+		}
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "repo", "docs", "guide", "index.md")
+	if err := os.MkdirAll(filepath.Dir(root), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "repo", ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Above the repository, so never found
+	if err := os.WriteFile(filepath.Join(dir, ConfigFileName), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(ConfigEnvVar, "")
+	if path := configPath(root); path != "" {
+		t.Errorf("configPath() = %q, want none outside the repository", path)
+	}
+
+	project := filepath.Join(dir, "repo", TOMLConfigFileName)
+	if err := os.WriteFile(project, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if path := configPath(root); path != project {
+		t.Errorf("configPath() = %q, want the repository's %q", path, project)
+	}
+
+	t.Setenv(ConfigEnvVar, "elsewhere.yaml")
+	if path := configPath(root); path != "elsewhere.yaml" {
+		t.Errorf("configPath() = %q, want $%s's %q", path, ConfigEnvVar, "elsewhere.yaml")
+	}
+}
+
+func TestConfigExamples(t *testing.T) {
+	type example struct {
+		where, name, source string
+	}
+	var examples []example
+
+	readme, err := os.ReadFile("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := defaultParser().Parser().Parse(text.NewReader(readme))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		block, ok := n.(*ast.FencedCodeBlock)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		name := map[string]string{"yaml": ConfigFileName, "toml": TOMLConfigFileName}[string(block.Language(readme))]
+		if name != "" {
+			line, _ := sourcePosition(readme, block.Lines().At(0).Start)
+			examples = append(examples, example{fmt.Sprintf("README.md:%d", line), name, string(block.Lines().Value(readme))})
+		}
+		return ast.WalkContinue, nil
+	})
+
+	files, err := goparser.ParseFile(token.NewFileSet(), "config.go", nil, goparser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decl := range files.Decls {
+		if gen, ok := decl.(*goast.GenDecl); ok && gen.Tok == token.TYPE && gen.Specs[0].(*goast.TypeSpec).Name.Name == "Config" {
+			for _, block := range new(comment.Parser).Parse(gen.Doc.Text()).Content {
+				if code, ok := block.(*comment.Code); ok {
+					examples = append(examples, example{"Config doc comment", ConfigFileName, code.Text})
+				}
+			}
+		}
+	}
+	if len(examples) < 5 {
+		t.Fatalf("found %d config examples, want the README's and Config's", len(examples))
+	}
+
+	for _, example := range examples {
+		path := filepath.Join(t.TempDir(), example.name)
+		if err := os.WriteFile(path, []byte(example.source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := LoadConfig(path)
+		if err != nil {
+			t.Errorf("%s: %v", example.where, err)
+			continue
+		}
+		for _, options := range append([]map[string]any{config.Options}, slices.Collect(maps.Values(config.Targets))...) {
+			opts := Options{Jobs: 1, ChunkSize: 1}
+			for name, field := range map[string]*string{
+				"section-anchors": &opts.SectionAnchors,
+				"title-preamble":  &opts.TitlePreamble,
+				"slug-style":      &opts.SlugStyle,
+				"link-order":      &opts.LinkOrder,
+				"footnotes":       &opts.Footnotes,
+				"format":          &opts.Format,
+			} {
+				if value, ok := options[name]; ok {
+					*field = configValue(value)
+				}
+			}
+			if err := opts.Validate(); err != nil {
+				t.Errorf("%s: %v", example.where, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// diagramLanguages are the fenced code block languages the diagram hook renders.
+var diagramLanguages = map[string]bool{"mermaid": true, "plantuml": true}
+
+// DiagramRenderer turns the source of a diagram into SVG. Rendered output
+// formats like HTML call it for fenced code blocks in one of the diagram
+// languages; markdown output always keeps the blocks as written.
+type DiagramRenderer interface {
+	RenderDiagram(language string, source []byte) ([]byte, error)
+}
+
+// CommandDiagrams renders diagrams with an external command or service. When
+// Command is an http or https URL, the diagram source is POSTed to it and the
+// response body is the SVG, which suits services like Kroki. Otherwise Command
+// is split into words and run without a shell, with the source on stdin and the
+// SVG read from stdout. Either way, "{lang}" in Command is replaced by the
+// diagram's language.
+type CommandDiagrams struct {
+	Command string
+	Timeout time.Duration // Zero for no limit
+}
+
+// RenderDiagram implements DiagramRenderer.
+func (d CommandDiagrams) RenderDiagram(language string, source []byte) ([]byte, error) {
+	ctx := context.Background()
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	command := strings.ReplaceAll(d.Command, "{lang}", language)
+
+	if strings.HasPrefix(command, "http://") || strings.HasPrefix(command, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, command, bytes.NewReader(source))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "text/plain")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+		}
+		return body, nil
+	}
+
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no diagram command")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(source)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// diagramExtension is a goldmark extension for HTML output that inlines
+// diagrams rendered by a DiagramRenderer in place of their fenced code blocks.
+type diagramExtension struct {
+	diagrams DiagramRenderer
+}
+
+// NewDiagramExtension returns a goldmark extension that renders diagram blocks
+// with diagrams when the HTML renderer is used. A diagram that fails to render
+// is left as a code block, with a warning.
+func NewDiagramExtension(diagrams DiagramRenderer) goldmark.Extender {
+	return &diagramExtension{diagrams: diagrams}
+}
+
+// Extend implements goldmark.Extender.
+func (e *diagramExtension) Extend(m goldmark.Markdown) {
+	// Higher priority than the stock HTML renderer's 1000, so this one wins
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 500)))
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (e *diagramExtension) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, e.renderFencedCodeBlock)
+}
+
+// renderFencedCodeBlock renders diagram blocks as a figure holding the SVG,
+// and every other fenced code block the way the stock HTML renderer does.
+func (e *diagramExtension) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.FencedCodeBlock)
+	language := string(n.Language(source))
+
+	var content bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		content.Write(segment.Value(source))
+	}
+
+	if diagramLanguages[language] {
+		svg, err := e.diagrams.RenderDiagram(language, content.Bytes())
+		if err == nil {
+			fmt.Fprintf(w, "<figure class=\"diagram diagram-%s\">\n", language)
+			_, _ = w.Write(bytes.TrimSpace(svg))
+			_, err := w.WriteString("\n</figure>\n")
+			return ast.WalkSkipChildren, err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s diagram left as a code block: %v\n", language, err)
+	}
+
+	_, _ = w.WriteString("<pre><code")
+	if language != "" {
+		_, _ = w.WriteString(" class=\"language-")
+		_, _ = w.Write(util.EscapeHTML([]byte(language)))
+		_, _ = w.WriteString("\"")
+	}
+	_, _ = w.WriteString(">")
+	_, _ = w.Write(util.EscapeHTML(content.Bytes()))
+	_, err := w.WriteString("</code></pre>\n")
+	return ast.WalkSkipChildren, err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark"
+)
+
+// fakeDiagrams renders every diagram as an SVG naming its language, and fails
+// for sources containing "broken".
+type fakeDiagrams struct{}
+
+func (fakeDiagrams) RenderDiagram(language string, source []byte) ([]byte, error) {
+	if bytes.Contains(source, []byte("broken")) {
+		return nil, fmt.Errorf("syntax error")
+	}
+	return []byte("<svg>" + language + "</svg>\n"), nil
+}
+
+func TestDiagramExtension(t *testing.T) {
+	source := "```mermaid\ngraph TD\n```\n\n```plantuml\nbroken\n```\n\n```go\nx := a < b\n```\n"
+	md := goldmark.New(goldmark.WithExtensions(NewDiagramExtension(fakeDiagrams{})))
+	var html bytes.Buffer
+	if err := md.Convert([]byte(source), &html); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"<figure class=\"diagram diagram-mermaid\">\n<svg>mermaid</svg>\n</figure>",
+		"<pre><code class=\"language-plantuml\">broken\n</code></pre>",
+		"<pre><code class=\"language-go\">x := a &lt; b\n</code></pre>",
+	} {
+		if !strings.Contains(html.String(), want) {
+			t.Errorf("HTML does not contain %q:\n%s", want, html.String())
+		}
+	}
+}
+
+func TestCommandDiagrams(t *testing.T) {
+	svg, err := CommandDiagrams{Command: "cat"}.RenderDiagram("mermaid", []byte("<svg/>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(svg) != "<svg/>" {
+		t.Errorf("RenderDiagram = %q, want the command's output", svg)
+	}
+
+	if _, err := (CommandDiagrams{Command: "false {lang}"}).RenderDiagram("mermaid", nil); err == nil {
+		t.Error("expected an error from a failing command")
+	}
+}
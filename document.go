@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+)
+
+// Document describes the structure of the combined document: its sections,
+// their heading trees and anchors, and the links in them, with positions in the
+// source files. It is built from the same state that rendering uses, so tools
+// can build navigation or analytics without parsing catmd's output.
+type Document struct {
+	Sections []*Section `json:"sections"` // In output order
+}
+
+// Section is one included file's part of the combined document.
+type Section struct {
+	File      string         `json:"file"`      // Absolute path of the source file
+	Path      string         `json:"path"`      // Path relative to the scope directory, with forward slashes
+	Title     string         `json:"title"`     // Section title, including any disambiguating qualifier
+	Anchor    string         `json:"anchor"`    // ID that links to the section point at
+	Synthetic bool           `json:"synthetic"` // Whether catmd adds a heading for the section
+	Headings  []*Heading     `json:"headings"`  // Top-level headings of the file's content
+	Links     []DocumentLink `json:"links"`     // In source order, footnote references excluded
+}
+
+// Heading is a heading of a section's content, with the headings nested under it.
+type Heading struct {
+	Text      string     `json:"text"`
+	Level     int        `json:"level"`     // Level in the combined document, after adjustment
+	Anchor    string     `json:"anchor"`    // ID in the combined document
+	Flattened bool       `json:"flattened"` // Whether --flatten-below turns it into a bold paragraph
+	Line      int        `json:"line"`      // 1-based source line, 0 if unknown
+	Children  []*Heading `json:"children,omitempty"`
+}
+
+// DocumentLink is a link in a section's source.
+type DocumentLink struct {
+	URL         string `json:"url"`                // Destination as written
+	Text        string `json:"text"`               // Link text
+	Target      string `json:"target,omitempty"`   // Absolute path of the file an internal link resolves to
+	Destination string `json:"destination"`        // Destination in the combined document
+	Resolved    bool   `json:"resolved"`           // Whether the link points into the combined document
+	Line        int    `json:"line"`               // 1-based source line, 0 if unknown
+	Column      int    `json:"column"`             // 1-based source column, 0 if unknown
+	External    bool   `json:"external,omitempty"` // Whether the link is a URL or absolute path rather than a relative link
+	Fragment    string `json:"fragment,omitempty"` // Fragment of the destination as written, without "#"
+}
+
+// Document builds the Document model of the combined output of the processor's
+// files. Files that can't be read or parsed get a section without headings or
+// links, and files that look like binary data, which are skipped, get none.
+func (fp *FileProcessor) Document() *Document {
+	doc := &Document{Sections: []*Section{}}
+	for _, file := range fp.files {
+		if !fp.visitedFiles[file] {
+			// Binary files are skipped
+			continue
+		}
+		section := &Section{
+			File:   file,
+			Path:   fp.relPath(file),
+			Title:  fp.sectionTitle(file),
+			Anchor: fp.generateTargetAnchor(file)[1:],
+			Links:  []DocumentLink{},
+		}
+		if fp.omitsSection(file) {
+			section.Title = ""
+		}
+		doc.Sections = append(doc.Sections, section)
+
+		headers := fp.fileHeaders[file]
+		section.Synthetic = fp.generateFileHeader(file, headers) != "" && !fp.omitsSection(file)
+		if section.Synthetic && fp.opts.CollapseTitles && duplicatesTitle(file, headers) {
+			// Mirror removeDuplicateTitle
+			headers = headers[1:]
+		}
+		if fp.titlesDocument(file) {
+			// Mirror removeTitleHeading
+			headers = headers[1:]
+		}
+		section.Headings = fp.headingTree(file, headers, section.Synthetic)
+
+		content, err := fp.opts.Snapshot.ReadFile(file)
+		if err != nil || looksBinary(content) {
+			continue
+		}
+		parsed, err := parseMarkdownWith(fp.md, content, fp.scopeDir, newSlugger(fp.opts))
+		if err != nil {
+			continue
+		}
+		for _, link := range parsed.Links {
+			if !link.IsFootnote {
+				section.Links = append(section.Links, fp.documentLink(file, link))
+			}
+		}
+	}
+	return doc
+}
+
+// headingTree nests the headers of file by their final levels.
+func (fp *FileProcessor) headingTree(file string, headers []HeaderInfo, synthetic bool) []*Heading {
+	roots := []*Heading{}
+	var open []*Heading
+	for i, level := range fp.finalLevels(file, headers, synthetic) {
+		heading := &Heading{
+			Text:      fp.caseHeadingText(headers[i].Text),
+			Level:     level,
+			Anchor:    fp.finalAnchor(file, headers[i].ID),
+			Flattened: fp.opts.FlattenBelow > 0 && level > fp.opts.FlattenBelow,
+			Line:      headers[i].StartLine,
+		}
+		for len(open) > 0 && open[len(open)-1].Level >= level {
+			open = open[:len(open)-1]
+		}
+		if len(open) == 0 {
+			roots = append(roots, heading)
+		} else {
+			parent := open[len(open)-1]
+			parent.Children = append(parent.Children, heading)
+		}
+		open = append(open, heading)
+	}
+	return roots
+}
+
+// documentLink describes link, found in file, as transformLinks rewrites it.
+func (fp *FileProcessor) documentLink(file string, link LinkInfo) DocumentLink {
+	result := DocumentLink{
+		URL:         link.URL,
+		Text:        link.Text,
+		Destination: link.URL,
+		Line:        link.Line,
+		Column:      link.Column,
+	}
+	if fragment := linkFragment(link.URL); fragment != "" {
+		result.Fragment = fragment[1:]
+	}
+
+	if fragment, ok := strings.CutPrefix(link.URL, "#"); ok {
+		target, anchor, _ := fp.resolveBareFragment(file, fragment)
+		result.Target = target
+		result.Resolved = true
+		if !fp.exploded {
+			result.Destination = "#" + anchor
+		}
+		return result
+	}
+	if !fp.isInternalLink(link.URL, file) {
+		result.External = true
+		return result
+	}
+
+	result.Destination = fp.rebaseAsset(file, link.URL)
+	target, err := fp.resolveLink(file, link.URL)
+	if err != nil {
+		return result
+	}
+	result.Target = target
+	if section, destination, ok := fp.retarget(target, link.URL); ok {
+		result.Resolved = true
+		result.Destination = fp.sectionDestination(file, section, destination)
+	}
+	return result
+}
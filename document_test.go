@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileProcessor_Document(t *testing.T) {
+	dir := t.TempDir()
+	sources := map[string]string{
+		"index.md": "# Index\n\nSee [setup](guide.md#setup), [notes](#notes), [site](https://example.com), and [old](old.md).\n\n## Notes\n",
+		"guide.md": "## Install\n\n### Setup\n\n## Usage\n",
+		"old.md":   "# Old\n",
+	}
+	var files []string
+	for _, name := range []string{"index.md", "guide.md"} {
+		path := filepath.Join(dir, name)
+		files = append(files, path)
+	}
+	for name, content := range sources {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	doc := NewFileProcessor(dir, files, Options{}).Document()
+	if len(doc.Sections) != 2 {
+		t.Fatalf("Document() has %d sections, want 2", len(doc.Sections))
+	}
+
+	index, guide := doc.Sections[0], doc.Sections[1]
+	if index.Title != "Index" || index.Anchor != "index" || index.Synthetic {
+		t.Errorf("index section = %+v, want title Index, anchor index, and its own heading", index)
+	}
+	if guide.Path != "guide.md" || guide.Anchor != "guidemd" || !guide.Synthetic {
+		t.Errorf("guide section = %+v, want path guide.md, anchor guidemd, and a synthetic heading", guide)
+	}
+
+	// The guide's headings keep their levels under its synthetic header
+	want := []*Heading{
+		{Text: "Install", Level: 2, Anchor: "install", Line: 1, Children: []*Heading{
+			{Text: "Setup", Level: 3, Anchor: "setup", Line: 3},
+		}},
+		{Text: "Usage", Level: 2, Anchor: "usage", Line: 5},
+	}
+	if !reflect.DeepEqual(guide.Headings, want) {
+		t.Errorf("guide headings = %+v, want %+v", guide.Headings, want)
+	}
+
+	links := []struct {
+		url, destination string
+		resolved         bool
+	}{
+		{"guide.md#setup", "#setup", true},
+		{"#notes", "#notes", true},
+		{"https://example.com", "https://example.com", false},
+		{"old.md", "old.md", false},
+	}
+	if len(index.Links) != len(links) {
+		t.Fatalf("index links = %+v, want %d", index.Links, len(links))
+	}
+	for i, link := range links {
+		got := index.Links[i]
+		if got.URL != link.url || got.Destination != link.destination || got.Resolved != link.resolved || got.Line != 3 {
+			t.Errorf("index link %d = %+v, want %+v on line 3", i, got, link)
+		}
+	}
+	if target := index.Links[3].Target; target != filepath.Join(dir, "old.md") {
+		t.Errorf("unincluded link target = %q, want the resolved path", target)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+)
+
+// githubFragmentPrefix is the prefix GitHub adds to the IDs it generates when
+// rendering markdown, so a link to "#user-content-setup" reaches the heading
+// with ID "setup" there. catmd treats such fragments as the unprefixed ID.
+const githubFragmentPrefix = "user-content-"
+
+// elementFragment is a row of the fragment resolution table. Fragments made of
+// prefix and a position counting from 1, like "table-2", name the element of a
+// file at that position among those of one of kinds.
+type elementFragment struct {
+	prefix string
+	kinds  []ast.NodeKind
+}
+
+// elementFragments is the fragment resolution table for elements that have no
+// ID of their own. Supporting another kind of element takes one more row.
+var elementFragments = []elementFragment{
+	{"table-", []ast.NodeKind{extast.KindTable}},
+	{"code-", []ast.NodeKind{ast.KindFencedCodeBlock, ast.KindCodeBlock}},
+	{"figure-", []ast.NodeKind{ast.KindImage}},
+}
+
+// elementRef is an element of a document and the fragment naming it.
+type elementRef struct {
+	node     ast.Node
+	fragment string
+}
+
+// elementFragmentsOf returns the elements of doc in the fragment resolution
+// table, in document order.
+func elementFragmentsOf(doc ast.Node) []elementRef {
+	var refs []elementRef
+	counts := make([]int, len(elementFragments))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		for i, row := range elementFragments {
+			if slices.Contains(row.kinds, n.Kind()) {
+				counts[i]++
+				refs = append(refs, elementRef{n, row.prefix + strconv.Itoa(counts[i])})
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return refs
+}
+
+// hasElementFragment reports whether fragment names an element of doc by its
+// position, like "table-2" in a file with two or more tables.
+func hasElementFragment(doc ast.Node, fragment string) bool {
+	for _, ref := range elementFragmentsOf(doc) {
+		if ref.fragment == fragment {
+			return true
+		}
+	}
+	return false
+}
+
+// recordElements notes, for --element-anchors, the links of file whose
+// fragment may name an element, and the elements of file that have no heading
+// or HTML anchor of the same name.
+func (fp *FileProcessor) recordElements(file string, parsed *ParsedFile) {
+	for _, link := range parsed.Links {
+		if link.IsFootnote {
+			continue
+		}
+		target := file
+		if !strings.HasPrefix(link.URL, "#") {
+			if !link.IsInternal {
+				continue
+			}
+			resolved, err := fp.resolveLink(file, link.URL)
+			if err != nil {
+				continue
+			}
+			target = resolved
+		}
+		if fragment := linkFragment(link.URL); fragment != "" {
+			fp.elementLinks[target+fragment] = true
+		}
+	}
+
+	existing := make(map[string]bool)
+	for _, header := range parsed.Headers {
+		existing[header.ID] = true
+	}
+	ast.Walk(parsed.AST, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		switch node := n.(type) {
+		case *ast.RawHTML:
+			addHTMLAnchors(existing, segmentsValue(node.Segments, parsed.Source))
+		case *ast.HTMLBlock:
+			addHTMLAnchors(existing, htmlBlockSource(node, parsed.Source))
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, ref := range elementFragmentsOf(parsed.AST) {
+		if !existing[ref.fragment] {
+			fp.elements[file] = append(fp.elements[file], ref.fragment)
+		}
+	}
+}
+
+// resolveElementAnchors gives each element that a link reaches by position an
+// ID that is unique in the combined document, usually the fragment itself.
+// Elements are numbered in each file's source, so the IDs hold however the file
+// is transformed afterwards.
+func (fp *FileProcessor) resolveElementAnchors(orderedFiles []string) {
+	used := make(map[string]bool)
+	for _, id := range fp.anchors {
+		used[id] = true
+	}
+	for _, id := range fp.htmlAnchors {
+		used[id] = true
+	}
+	for _, file := range orderedFiles {
+		if !fp.visitedFiles[file] {
+			continue
+		}
+		for _, fragment := range fp.elements[file] {
+			key := file + "#" + fragment
+			if !fp.elementLinks[key] {
+				continue
+			}
+			id := fragment
+			for i := 1; used[id]; i++ {
+				id = fragment + "-" + strconv.Itoa(i)
+			}
+			used[id] = true
+			fp.anchors[key] = id
+			fp.elementIDs[key] = id
+		}
+	}
+}
+
+// insertElementAnchors writes an HTML anchor right before each element of doc
+// that resolveElementAnchors gave an ID: in a paragraph of its own before tables
+// and code blocks, and inline before images.
+func (fp *FileProcessor) insertElementAnchors(doc ast.Node, filename string) {
+	for _, ref := range elementFragmentsOf(doc) {
+		id, ok := fp.elementIDs[filename+"#"+ref.fragment]
+		if !ok {
+			continue
+		}
+		if fp.exploded {
+			// Links between section files keep their fragments as written
+			id = ref.fragment
+		}
+		anchor := newAnchor(id)
+		parent := ref.node.Parent()
+		if ref.node.Type() == ast.TypeInline {
+			parent.InsertBefore(parent, ref.node, anchor)
+			continue
+		}
+		paragraph := ast.NewParagraph()
+		paragraph.SetBlankPreviousLines(true)
+		paragraph.AppendChild(paragraph, anchor)
+		parent.InsertBefore(parent, ref.node, paragraph)
+	}
+}
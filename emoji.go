@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/yuin/goldmark/ast"
+
+	east "github.com/yuin/goldmark-emoji/ast"
+)
+
+// Emoji shortcode rendering modes accepted by --emoji.
+const (
+	EmojiUnicode   = "unicode"   // Replace :shortcode: with the Unicode emoji
+	EmojiShortcode = "shortcode" // Leave :shortcode: verbatim
+	EmojiStrip     = "strip"     // Remove recognized shortcodes entirely
+)
+
+// convertEmoji replaces the emoji nodes produced by the goldmark-emoji extension
+// according to mode, since the markdown renderer has no notion of emoji nodes.
+// Unknown shortcodes are never parsed as emoji and so always stay verbatim.
+func convertEmoji(doc ast.Node, mode string) {
+	var emojis []*east.Emoji
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			if emojiNode, ok := n.(*east.Emoji); ok {
+				emojis = append(emojis, emojiNode)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// Replace after walking, since the walk can't tolerate sibling changes
+	for _, emojiNode := range emojis {
+		parent := emojiNode.Parent()
+		if parent == nil {
+			continue
+		}
+
+		switch {
+		case mode == EmojiStrip:
+			parent.RemoveChild(parent, emojiNode)
+		case mode == EmojiUnicode && emojiNode.Value.IsUnicode():
+			parent.ReplaceChild(parent, emojiNode, ast.NewString([]byte(string(emojiNode.Value.Unicode))))
+		default:
+			shortcode := ":" + string(emojiNode.ShortName) + ":"
+			parent.ReplaceChild(parent, emojiNode, ast.NewString([]byte(shortcode)))
+		}
+	}
+}
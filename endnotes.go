@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"slices"
+	"strconv"
+
+	markdown "github.com/teekennedy/goldmark-markdown"
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/util"
+)
+
+// Footnote rendering modes accepted by --footnotes.
+const (
+	FootnotesInline   = "inline"   // Replace each reference with the footnote text in parentheses
+	FootnotesEndnotes = "endnotes" // Number references and collect the notes at the end
+)
+
+// endnote is a footnote collected for the Notes section in endnotes mode.
+type endnote struct {
+	file      string     // File defining the footnote, for resolving its links
+	nodes     []ast.Node // Footnote content
+	source    []byte     // Source the content was parsed from
+	citations int        // References to the footnote, each with its own back-reference
+}
+
+// endnoteID is the anchor of endnote number n in the Notes section.
+func endnoteID(n int) string {
+	return "fn-" + strconv.Itoa(n)
+}
+
+// endnoteRefID is the anchor of the citation-th reference to endnote number n.
+// The first reference gets the plain ID, so simple documents get simple anchors.
+func endnoteRefID(n, citation int) string {
+	if citation == 1 {
+		return "fnref-" + strconv.Itoa(n)
+	}
+	return fmt.Sprintf("fnref-%d-%d", n, citation)
+}
+
+// countEndnotes returns how many endnotes collectEndnotes numbers for parsed:
+// one per footnote with a definition that is referenced at least once. Counting
+// them for each file ahead of processing, in traversal order, reserves each
+// file's numbers, so they are the same however files are scheduled across
+// --jobs.
+func countEndnotes(parsed *ParsedFile) int {
+	references, footnoteIndexToID, _ := findFootnotes(parsed)
+	defined := make(map[string]bool)
+	for _, footnote := range parsed.Footnotes {
+		defined[footnote.ID] = true
+	}
+	counted := make(map[string]bool)
+	for _, reference := range references {
+		if id := footnoteIndexToID[reference.Index]; defined[id] {
+			counted[id] = true
+		}
+	}
+	return len(counted)
+}
+
+// findFootnotes returns the footnote references of parsed in document order,
+// the label of each footnote by index, and the footnote definition nodes.
+func findFootnotes(parsed *ParsedFile) ([]*extast.FootnoteLink, map[int]string, []ast.Node) {
+	footnoteIndexToID := make(map[int]string)
+	var references []*extast.FootnoteLink
+	var definitions []ast.Node
+	ast.Walk(parsed.AST, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *extast.FootnoteLink:
+			references = append(references, node)
+		case *extast.Footnote:
+			footnoteIndexToID[node.Index] = string(node.Ref)
+			definitions = append(definitions, n)
+			return ast.WalkSkipChildren, nil
+		case *extast.FootnoteList:
+			definitions = append(definitions, n)
+		}
+		return ast.WalkContinue, nil
+	})
+	return references, footnoteIndexToID, definitions
+}
+
+// collectEndnotes replaces footnote references with numbered superscript links to
+// the Notes section and moves the footnote definitions into c. Notes are
+// numbered across the whole document in order of first reference, since footnote
+// labels are only unique within a file, starting after the notes reserved for
+// the files before it, see countEndnotes. Each reference gets an anchor of its own for the note's
+// back-reference links to return to. A file whose notes don't take up exactly
+// the numbers reserved for it is an error, since the notes would leave a gap in
+// the numbering or take numbers of the next file's.
+func (fp *FileProcessor) collectEndnotes(parsed *ParsedFile, filename string, c *collected) error {
+	if count, reserved := countEndnotes(parsed), fp.endnoteCount[filename]; count != reserved {
+		return fmt.Errorf("file %q has %d endnote(s), but %d were reserved for it", filename, count, reserved)
+	}
+
+	footnotes := make(map[string]FootnoteInfo)
+	for _, footnote := range parsed.Footnotes {
+		footnotes[footnote.ID] = footnote
+	}
+
+	references, footnoteIndexToID, nodesToRemove := findFootnotes(parsed)
+	notes := make(map[string]*endnote)
+	numbers := make(map[string]int)
+	for _, reference := range references {
+		id := footnoteIndexToID[reference.Index]
+		footnote, ok := footnotes[id]
+		if !ok {
+			continue
+		}
+
+		number, seen := numbers[id]
+		if !seen {
+			number = fp.endnoteBase[filename] + len(numbers) + 1
+			numbers[id] = number
+			notes[id] = &endnote{file: filename, nodes: footnote.Nodes, source: footnote.Source}
+			c.endnotes[number] = notes[id]
+		}
+		note := notes[id]
+		note.citations++
+
+		link := ast.NewLink()
+		link.Destination = []byte("#" + endnoteID(number))
+		link.AppendChild(link, ast.NewString([]byte(strconv.Itoa(number))))
+		ref := &endnoteRef{id: endnoteRefID(number, note.citations)}
+		ref.AppendChild(ref, link)
+
+		parent := reference.Parent()
+		parent.ReplaceChild(parent, reference, ref)
+	}
+
+	for _, node := range nodesToRemove {
+		if parent := node.Parent(); parent != nil {
+			parent.RemoveChild(parent, node)
+		}
+	}
+	return nil
+}
+
+// RenderEndnotes renders the Notes section collecting every footnote referenced
+// by the processed files: an ordered list in which each note starts with its
+// anchor and ends with one back-reference link per citation. Returns nil when no
+// footnotes were referenced. Notes reserved for files that failed to process
+// are left out, and the others keep their numbers: the notes after a gap start
+// a list of their own, with the other delimiter so it isn't read as part of the
+// list before.
+func (fp *FileProcessor) RenderEndnotes() ([]byte, error) {
+	fp.mu.Lock()
+	endnotes := slices.Clone(fp.endnotes)
+	fp.mu.Unlock()
+	if !slices.ContainsFunc(endnotes, func(note *endnote) bool { return note != nil }) {
+		return nil, nil
+	}
+
+	doc := ast.NewDocument()
+	heading := ast.NewHeading(1)
+	heading.AppendChild(heading, ast.NewString([]byte("Notes")))
+	doc.AppendChild(doc, heading)
+
+	var list *ast.List
+	delimiter := byte(')')
+	for i, note := range endnotes {
+		if note == nil {
+			list = nil
+			continue
+		}
+		// Each note is rendered against the source of the file defining it,
+		// so it joins the list already rendered
+		content, err := fp.renderEndnote(i+1, note)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render note %d from %q: %w", i+1, note.file, err)
+		}
+
+		if list == nil {
+			if delimiter == '.' {
+				delimiter = ')'
+			} else {
+				delimiter = '.'
+			}
+			list = ast.NewList(delimiter)
+			list.Start = i + 1
+			list.IsTight = true
+			list.SetBlankPreviousLines(true)
+			doc.AppendChild(doc, list)
+		}
+		item := ast.NewListItem(len(strconv.Itoa(i+1)) + 2)
+		item.AppendChild(item, &renderedMarkdown{content: content})
+		list.AppendChild(list, item)
+	}
+
+	renderer := fp.renderers.Get().(*markdown.Renderer)
+	defer fp.renderers.Put(renderer)
+
+	var buf bytes.Buffer
+	if err := renderer.Render(&buf, nil, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderEndnote renders the content of endnote number n against its own source,
+// applying the same citation, link, and emoji transformations as the file
+// defining it.
+func (fp *FileProcessor) renderEndnote(n int, note *endnote) ([]byte, error) {
+	doc := ast.NewDocument()
+	paragraph := ast.NewParagraph()
+	paragraph.AppendChild(paragraph, newAnchor(endnoteID(n)))
+	doc.AppendChild(doc, paragraph)
+
+	var blocks []ast.Node
+	for _, node := range note.nodes {
+		if node.Type() == ast.TypeBlock {
+			blocks = append(blocks, node)
+		} else {
+			paragraph.AppendChild(paragraph, node)
+		}
+	}
+
+	for citation := 1; citation <= note.citations; citation++ {
+		backref := ast.NewLink()
+		backref.Destination = []byte("#" + endnoteRefID(n, citation))
+		backref.AppendChild(backref, ast.NewString([]byte("↩")))
+		paragraph.AppendChild(paragraph, ast.NewString([]byte(" ")))
+		paragraph.AppendChild(paragraph, backref)
+	}
+
+	for _, block := range blocks {
+		block.SetBlankPreviousLines(true)
+		doc.AppendChild(doc, block)
+	}
+
+	if fp.bibliography != nil {
+		cited := make(map[string]bool)
+		fp.replaceCitations(doc, note.source, note.file, cited)
+		fp.record(note.file, &collected{cited: cited})
+	}
+	if err := fp.transformLinks(doc, note.file); err != nil {
+		return nil, err
+	}
+	if fp.opts.Emoji != "" {
+		convertEmoji(doc, fp.opts.Emoji)
+	}
+
+	renderer := fp.renderers.Get().(*markdown.Renderer)
+	defer fp.renderers.Put(renderer)
+
+	var buf bytes.Buffer
+	if err := renderer.Render(&buf, note.source, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// kindEndnoteRef is the node kind of endnote references.
+var kindEndnoteRef = ast.NewNodeKind("EndnoteRef")
+
+// endnoteRef is a reference to an endnote, rendered as a superscript with the
+// anchor the note's back-reference links return to. Its child is the link to
+// the note.
+type endnoteRef struct {
+	ast.BaseInline
+	id string // See endnoteRefID
+}
+
+// Kind implements ast.Node.
+func (n *endnoteRef) Kind() ast.NodeKind {
+	return kindEndnoteRef
+}
+
+// Dump implements ast.Node.
+func (n *endnoteRef) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"ID": n.id}, nil)
+}
+
+// renderEndnoteRef renders an endnote reference as a sup element with its ID.
+func renderEndnoteRef(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		_, err := w.WriteString("</sup>")
+		return ast.WalkContinue, err
+	}
+	_, err := w.WriteString(`<sup id="` + html.EscapeString(node.(*endnoteRef).id) + `">`)
+	return ast.WalkContinue, err
+}
+
+// kindRenderedMarkdown is the node kind of rendered markdown.
+var kindRenderedMarkdown = ast.NewNodeKind("RenderedMarkdown")
+
+// renderedMarkdown is a block already rendered as markdown against another
+// source, like an endnote's, written as is, with the indentation of the
+// container it is in.
+type renderedMarkdown struct {
+	ast.BaseBlock
+	content []byte
+}
+
+// Kind implements ast.Node.
+func (n *renderedMarkdown) Kind() ast.NodeKind {
+	return kindRenderedMarkdown
+}
+
+// Dump implements ast.Node.
+func (n *renderedMarkdown) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Content": string(n.content)}, nil)
+}
+
+// renderRenderedMarkdown writes rendered markdown. Registered renderers replace
+// the stock block separator handling, so the block ends its own last line.
+func renderRenderedMarkdown(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	content := bytes.TrimRight(node.(*renderedMarkdown).content, "\n")
+	_, err := w.Write(append(content, '\n'))
+	return ast.WalkContinue, err
+}
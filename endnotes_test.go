@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileProcessor_RenderEndnotes(t *testing.T) {
+	dir := t.TempDir()
+	contents := map[string]string{
+		"index.md": "# Index\n\nSee [a](a.md) and [b](b.md).[^1]\n\n[^1]: From the index.\n",
+		"a.md":     "# A\n\nText.[^1]\n\n[^1]: Skipped.\n",
+		"b.md":     "# B\n\nText.[^1]\n\n[^1]: From *b*.\n",
+	}
+	files := []string{filepath.Join(dir, "index.md"), filepath.Join(dir, "a.md"), filepath.Join(dir, "b.md")}
+	for _, file := range files {
+		if err := os.WriteFile(file, []byte(contents[filepath.Base(file)]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	processor := NewFileProcessor(dir, files, Options{Footnotes: FootnotesEndnotes})
+	// a.md is never processed, as when it fails, leaving a gap at note 2
+	for _, file := range []string{files[0], files[2]} {
+		if _, err := processor.ProcessFile(file, []byte(contents[filepath.Base(file)])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notes, err := processor.RenderEndnotes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "# Notes\n\n" +
+		"1. <a id=\"fn-1\"></a>From the index. [↩](#fnref-1)\n\n" +
+		"3) <a id=\"fn-3\"></a>From *b*. [↩](#fnref-3)\n"
+	if string(notes) != want {
+		t.Errorf("RenderEndnotes() = %q, want %q", notes, want)
+	}
+}
+
+func TestFileProcessor_CollectEndnotes(t *testing.T) {
+	dir := t.TempDir()
+	contents := map[string]string{
+		// --headings-only leaves out the paragraph the heading's note moves to
+		"index.md": "# Index\n\nIntro.[^1]\n\n## Details[^2]\n\nText.\n\n[^1]: Kept.\n[^2]: Left out.\n",
+		"b.md":     "# B\n\nText.[^1]\n\n[^1]: From b.\n",
+	}
+	files := []string{filepath.Join(dir, "index.md"), filepath.Join(dir, "b.md")}
+	for _, file := range files {
+		if err := os.WriteFile(file, []byte(contents[filepath.Base(file)]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	processor := NewFileProcessor(dir, files, Options{Footnotes: FootnotesEndnotes, HeadingsOnly: true})
+	for _, file := range files {
+		if _, err := processor.ProcessFile(file, []byte(contents[filepath.Base(file)])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notes, err := processor.RenderEndnotes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Notes\n\n" +
+		"1. <a id=\"fn-1\"></a>Kept. [↩](#fnref-1)\n" +
+		"2. <a id=\"fn-2\"></a>From b. [↩](#fnref-2)\n"
+	if string(notes) != want {
+		t.Errorf("RenderEndnotes() = %q, want %q", notes, want)
+	}
+
+	// Content with more notes than were reserved for the file would take the
+	// next file's numbers
+	_, err = processor.ProcessFile(files[0], []byte("# Index\n\nOne.[^1] Two.[^2]\n\n[^1]: One.\n[^2]: Two.\n"))
+	if err == nil {
+		t.Error("ProcessFile() with more notes than reserved succeeded, want error")
+	}
+}
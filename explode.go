@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// NewSectionProcessor creates a FileProcessor for --explode, which renders each
+// file as a standalone section file. Links to other included files point at
+// their section files instead of at anchors in the combined document. Footnotes
+// are inlined and abbreviation definitions left in place, since the Notes and
+// abbreviation sections only exist in the combined document. Relative asset
+// paths are rewritten for where each section file is written under
+// opts.Explode.
+func NewSectionProcessor(scopeDir string, orderedFiles []string, opts Options) *FileProcessor {
+	opts.Footnotes = FootnotesInline
+	opts.Abbreviations = false
+	fp := NewFileProcessor(scopeDir, orderedFiles, opts)
+	fp.exploded = true
+	fp.explodeDir = opts.Explode
+	if dir, err := filepath.Abs(opts.Explode); err == nil {
+		fp.explodeDir = dir
+	}
+	return fp
+}
+
+// sectionLink returns the destination of a link from the section of file from
+// to the section of target: an anchor in the combined document, preceded by the
+// name of target's chunk file when --chunks puts it in another chunk, or the
+// relative path of target's section file with --explode.
+func (fp *FileProcessor) sectionLink(from, target string) string {
+	if fp.exploded {
+		if rel, err := filepath.Rel(filepath.Dir(from), target); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return fp.chunkLink(from, target) + fp.generateTargetAnchor(target)
+}
+
+// WriteExploded processes files with processor, which NewSectionProcessor
+// created, and writes each to its path relative to the scope directory under
+// dir, with the output whitespace policy applied. Files that fail to process
+// are left out, with a warning.
+func WriteExploded(processor *FileProcessor, files []string, dir string, jobs int) error {
+	results := processFiles(processor, files, jobs)
+	for i, file := range files {
+		result := <-results[i]
+		err := result.readErr
+		if err == nil {
+			err = result.err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: left %q out of --explode: %v\n", file, err)
+			continue
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(processor.relPath(file)))
+		if err := writeSectionFile(path, result.output, processor.opts.MaxBlankLines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSectionFile(path string, content []byte, maxBlankLines int) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %q: %w", path, err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create section file %q: %w", path, err)
+	}
+	defer f.Close()
+
+	normalizer := newNormalizingWriter(f, maxBlankLines)
+	if _, err := normalizer.Write(content); err != nil {
+		return fmt.Errorf("failed to write section file %q: %w", path, err)
+	}
+	if err := normalizer.Flush(); err != nil {
+		return fmt.Errorf("failed to write section file %q: %w", path, err)
+	}
+	return f.Close()
+}
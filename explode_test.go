@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteExploded(t *testing.T) {
+	dir := t.TempDir()
+	sources := map[string]string{
+		"index.md":        "# Index\n\nRead the [guide](./docs/guide.md#setup).\n",
+		"docs/guide.md":   "## Setup\n\nSee [the API](api/ref.md) and the [index](../index.md).[^1]\n\n[^1]: A note.\n",
+		"docs/api/ref.md": "# Reference\n\nBack to the [guide](../guide.md).\n",
+	}
+	var files []string
+	for _, name := range []string{"index.md", "docs/guide.md", "docs/api/ref.md"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(sources[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+
+	out := filepath.Join(t.TempDir(), "sections")
+	processor := NewSectionProcessor(dir, files, Options{Footnotes: FootnotesEndnotes, MaxBlankLines: 2})
+	if err := WriteExploded(processor, files, out, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"index.md":        "# Index\n\nRead the [guide](docs/guide.md#setup).\n",
+		"docs/guide.md":   "# guide.md\n\n## Setup\n\nSee [the API](api/ref.md) and the [index](../index.md). (A note.)\n",
+		"docs/api/ref.md": "# Reference\n\nBack to the [guide](../guide.md).\n",
+	}
+	for name, want := range expected {
+		got, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s =\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
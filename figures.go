@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// kindFigure is the node kind of figures.
+var kindFigure = ast.NewNodeKind("Figure")
+
+// figure is an image with a title standing alone in its paragraph, which
+// --figures renders as a numbered, captioned <figure>. Its children are the
+// paragraph's, the image and any anchors before it.
+type figure struct {
+	ast.BaseBlock
+	number  int    // Position among the document's figures, counting from 1
+	caption []byte // The image's title
+}
+
+// Kind implements ast.Node.
+func (n *figure) Kind() ast.NodeKind {
+	return kindFigure
+}
+
+// Dump implements ast.Node.
+func (n *figure) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Number": fmt.Sprint(n.number)}, nil)
+}
+
+// figureExtension is the extension --figures adds to the HTML renderer.
+type figureExtension struct{}
+
+// Extend implements goldmark.Extender.
+func (figureExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(figureExtension{}, 500)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(figureExtension{}, 500)))
+}
+
+// Transform implements parser.ASTTransformer. It turns each paragraph holding
+// nothing but an image with a title, and the anchors --element-anchors writes
+// before images, into a figure, numbering the figures in document order.
+func (figureExtension) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var figures []*ast.Paragraph
+	var captions [][]byte
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		paragraph, ok := n.(*ast.Paragraph)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		if image := figureImage(paragraph, source); image != nil {
+			figures = append(figures, paragraph)
+			captions = append(captions, image.Title)
+		}
+		return ast.WalkSkipChildren, nil
+	})
+
+	for i, paragraph := range figures {
+		fig := &figure{number: i + 1, caption: captions[i]}
+		for child := paragraph.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			fig.AppendChild(fig, child)
+			child = next
+		}
+		parent := paragraph.Parent()
+		parent.ReplaceChild(parent, paragraph, fig)
+	}
+}
+
+// figureImage returns the image with a title that paragraph holds, alone but
+// for raw HTML and whitespace, or nil if it holds anything else.
+func figureImage(paragraph *ast.Paragraph, source []byte) *ast.Image {
+	var image *ast.Image
+	for child := paragraph.FirstChild(); child != nil; child = child.NextSibling() {
+		switch node := child.(type) {
+		case *ast.Image:
+			if image != nil || len(node.Title) == 0 {
+				return nil
+			}
+			image = node
+		case *ast.RawHTML:
+		case *ast.Text:
+			if len(bytes.TrimSpace(node.Segment.Value(source))) > 0 {
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+	return image
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (figureExtension) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindFigure, renderFigure)
+}
+
+// renderFigure renders a figure as a <figure> holding the image, captioned
+// with "Figure N." and the image's title.
+func renderFigure(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*figure)
+	if entering {
+		_, err := w.WriteString("<figure>\n")
+		return ast.WalkContinue, err
+	}
+	_, err := fmt.Fprintf(w, "\n<figcaption>Figure %d. %s</figcaption>\n</figure>\n", n.number, html.EscapeString(string(n.caption)))
+	return ast.WalkContinue, err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// fileTemplateData is what --file-header and --file-footer templates are
+// executed with, once for each included file.
+type fileTemplateData struct {
+	Path        string         // Path relative to the scope directory, with forward slashes
+	Name        string         // Base name of the file
+	Title       string         // Title of the file's section
+	Index       int            // Position of the file in traversal order, starting at 1
+	Document    string         // Title of the combined document with --root-title, empty otherwise
+	FrontMatter map[string]any // YAML front matter, nil if the file has none
+}
+
+// LoadFileTemplate parses the text/template at path, for --file-header or
+// --file-footer.
+func LoadFileTemplate(path string) (*template.Template, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template %q: %w", path, err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %q: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// UseFileTemplates enables --file-header and --file-footer: the output of header
+// is written before each included file's section and that of footer after it.
+// Either may be nil.
+func (fp *FileProcessor) UseFileTemplates(header, footer *template.Template) {
+	fp.fileHeader = header
+	fp.fileFooter = footer
+}
+
+// executeFileTemplate executes tmpl for filename, returning its output without
+// surrounding blank lines, or "" if tmpl is nil.
+func (fp *FileProcessor) executeFileTemplate(tmpl *template.Template, filename string, frontMatter map[string]any) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+
+	data := fileTemplateData{
+		Path:        fp.relPath(filename),
+		Name:        filepath.Base(filename),
+		Title:       fp.sectionTitle(filename),
+		Index:       fp.fileOrder[filename] + 1,
+		Document:    fp.DocumentTitle(),
+		FrontMatter: frontMatter,
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute template %q for %q: %w", tmpl.Name(), filename, err)
+	}
+	return strings.Trim(buf.String(), "\n"), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// frontMatterStrings returns the string values stored under key in a file's front
+// matter. Both YAML lists (`tags: [api, guide]`) and comma-separated strings
+// (`tags: api, guide`) are accepted. Missing keys yield nil.
+func frontMatterStrings(frontMatter map[string]interface{}, key string) []string {
+	value, exists := frontMatter[key]
+	if !exists || value == nil {
+		return nil
+	}
+
+	var values []string
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			values = append(values, strings.TrimSpace(fmt.Sprint(item)))
+		}
+	default:
+		values = splitList(fmt.Sprint(v))
+	}
+	return values
+}
+
+// splitList splits a comma-separated list, trimming whitespace and dropping
+// empty entries.
+func splitList(s string) []string {
+	var values []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+// FilterFiles returns the subset of orderedFiles whose front matter satisfies keep,
+// preserving traversal order. The root file is always kept since it seeds the
+// traversal and usually serves as the navigation page. Files that cannot be read
+// or parsed are treated as having no front matter.
+func FilterFiles(orderedFiles []string, rootFile, scopeDir string, snapshot *Snapshot, keep func(frontMatter map[string]interface{}) bool) []string {
+	var kept []string
+	for _, file := range orderedFiles {
+		if file == rootFile {
+			kept = append(kept, file)
+			continue
+		}
+
+		var frontMatter map[string]interface{}
+		if parsed, err := snapshot.ParseFile(file, scopeDir); err == nil {
+			frontMatter = parsed.FrontMatter
+		}
+
+		if keep(frontMatter) {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
+
+// hasAnyTag returns a FilterFiles predicate matching files whose `tags` front
+// matter contains at least one of the requested tags (case-insensitively).
+func hasAnyTag(tags []string) func(map[string]interface{}) bool {
+	return func(frontMatter map[string]interface{}) bool {
+		for _, fileTag := range frontMatterStrings(frontMatter, "tags") {
+			for _, tag := range tags {
+				if strings.EqualFold(fileTag, tag) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// matchesAudience returns a FilterFiles predicate matching files written for the
+// given audience. Files without an `audience` field are meant for everyone; the
+// field may list several audiences.
+func matchesAudience(audience string) func(map[string]interface{}) bool {
+	return func(frontMatter map[string]interface{}) bool {
+		fileAudiences := frontMatterStrings(frontMatter, "audience")
+		if len(fileAudiences) == 0 {
+			return true
+		}
+		for _, fileAudience := range fileAudiences {
+			if strings.EqualFold(fileAudience, audience) {
+				return true
+			}
+		}
+		return false
+	}
+}
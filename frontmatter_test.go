@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFrontMatterStrings(t *testing.T) {
+	tests := []struct {
+		name        string
+		frontMatter map[string]interface{}
+		key         string
+		expected    []string
+	}{
+		{
+			name:        "missing key",
+			frontMatter: map[string]interface{}{"title": "Doc"},
+			key:         "tags",
+			expected:    nil,
+		},
+		{
+			name:        "nil front matter",
+			frontMatter: nil,
+			key:         "tags",
+			expected:    nil,
+		},
+		{
+			name:        "yaml list",
+			frontMatter: map[string]interface{}{"tags": []interface{}{"api", " guide "}},
+			key:         "tags",
+			expected:    []string{"api", "guide"},
+		},
+		{
+			name:        "comma-separated string",
+			frontMatter: map[string]interface{}{"tags": "api, guide,,"},
+			key:         "tags",
+			expected:    []string{"api", "guide"},
+		},
+		{
+			name:        "single scalar",
+			frontMatter: map[string]interface{}{"tags": 42},
+			key:         "tags",
+			expected:    []string{"42"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := frontMatterStrings(tt.frontMatter, tt.key)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("frontMatterStrings(%v, %q) = %#v, want %#v", tt.frontMatter, tt.key, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHasAnyTag(t *testing.T) {
+	keep := hasAnyTag([]string{"api", "tutorial"})
+
+	if !keep(map[string]interface{}{"tags": []interface{}{"reference", "API"}}) {
+		t.Error("expected case-insensitive tag match to be kept")
+	}
+	if keep(map[string]interface{}{"tags": "reference"}) {
+		t.Error("expected file without requested tags to be dropped")
+	}
+	if keep(nil) {
+		t.Error("expected file without front matter to be dropped")
+	}
+}
+
+func TestMatchesAudience(t *testing.T) {
+	keep := matchesAudience("public")
+
+	tests := []struct {
+		name        string
+		frontMatter map[string]interface{}
+		expected    bool
+	}{
+		{name: "no audience", frontMatter: nil, expected: true},
+		{name: "same audience", frontMatter: map[string]interface{}{"audience": "Public"}, expected: true},
+		{name: "other audience", frontMatter: map[string]interface{}{"audience": "internal"}, expected: false},
+		{name: "audience list", frontMatter: map[string]interface{}{"audience": []interface{}{"internal", "public"}}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := keep(tt.frontMatter); result != tt.expected {
+				t.Errorf("matchesAudience(\"public\")(%v) = %v, want %v", tt.frontMatter, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFileProcessor_FrontMatterKept(t *testing.T) {
+	content := []byte("---\ntags: [api]\n---\n\n# Title\n")
+	for _, frontMatter := range []bool{false, true} {
+		fp := NewFileProcessor("/", []string{"/doc.md"}, Options{FrontMatter: frontMatter})
+		processed, err := fp.ProcessFile("/doc.md", content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept := strings.Contains(string(processed), "tags: [api]"); kept == frontMatter {
+			t.Errorf("FrontMatter %v: ProcessFile() = %q, want the front matter kept only when it isn't read", frontMatter, processed)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Glossary is a --glossary file's terms and their definitions. With --format
+// html, occurrences of the terms in the other files are rendered as <abbr>
+// elements with the definition as their title, which browsers show on hover.
+type Glossary struct {
+	File        string            // Absolute path of the glossary file
+	Definitions map[string]string // Definition of each term, keyed by lowercased term
+	pattern     *regexp.Regexp    // Matches any of the terms, followed by no more of a word
+}
+
+// LoadGlossary reads a glossary written as markdown: each heading is a term,
+// and the paragraph following it its definition. Headings without a paragraph
+// right after them, like a title over the whole list, define nothing.
+func LoadGlossary(path string) (*Glossary, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read glossary: %w", err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := ParseMarkdownFile(content, filepath.Dir(abs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse glossary %q: %w", path, err)
+	}
+
+	glossary := &Glossary{File: abs, Definitions: make(map[string]string)}
+	var terms []string
+	for child := parsed.AST.FirstChild(); child != nil; child = child.NextSibling() {
+		heading, ok := child.(*ast.Heading)
+		if !ok {
+			continue
+		}
+		paragraph, ok := heading.NextSibling().(*ast.Paragraph)
+		if !ok {
+			continue
+		}
+		term := extractTextFromNode(heading, parsed.Source)
+		key := strings.ToLower(term)
+		if _, ok := glossary.Definitions[key]; term == "" || ok {
+			continue
+		}
+		glossary.Definitions[key] = definitionText(paragraph, parsed.Source)
+		terms = append(terms, regexp.QuoteMeta(term))
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("glossary %q defines no terms (want headings, each followed by a paragraph)", path)
+	}
+
+	// Longer terms first, so "link resolver" wins over "link"
+	sort.SliceStable(terms, func(i, j int) bool {
+		return len(terms[i]) > len(terms[j])
+	})
+	glossary.pattern = regexp.MustCompile(`(?i)(` + strings.Join(terms, "|") + `)(?:$|[^\p{L}\p{N}\p{M}_])`)
+	return glossary, nil
+}
+
+// definitionText returns the text of a definition paragraph on one line.
+func definitionText(paragraph ast.Node, source []byte) string {
+	var text strings.Builder
+	ast.Walk(paragraph, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if node, ok := n.(*ast.Text); ok && entering {
+			text.Write(node.Segment.Value(source))
+			if node.SoftLineBreak() || node.HardLineBreak() {
+				text.WriteString(" ")
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+// UseGlossary adds hover definitions for the terms of glossary to every file
+// but the glossary itself, when the output is rendered as HTML.
+func (fp *FileProcessor) UseGlossary(glossary *Glossary) {
+	fp.glossary = glossary
+}
+
+// glossaryExtension is the extension --glossary adds to the HTML renderer.
+type glossaryExtension struct {
+	glossary *Glossary
+	sections []htmlSection // Where sections start in the document, in order
+}
+
+// Extend implements goldmark.Extender.
+func (e glossaryExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(e, 400)))
+}
+
+// Transform implements parser.ASTTransformer. It wraps the glossary terms in
+// the text of every section but the glossary's own in <abbr> elements titled
+// with their definitions. Terms in headings, links, and code are left alone.
+func (e glossaryExtension) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	files := sectionFiles(doc, e.sections)
+	skip := func(n ast.Node) bool {
+		_, heading := n.(*ast.Heading)
+		return heading || skipsText(n)
+	}
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		if files[child] == e.glossary.File {
+			continue
+		}
+		replaceInText(child, reader.Source(), skip, e.glossary.tooltips)
+	}
+}
+
+// tooltips returns the replacements of the glossary terms in text with <abbr>
+// elements.
+func (g *Glossary) tooltips(text string) []textReplacement {
+	var replacements []textReplacement
+	for _, match := range g.findTerms(text) {
+		term := text[match[0]:match[1]]
+		definition := g.Definitions[strings.ToLower(term)]
+		replacements = append(replacements, textReplacement{start: match[0], end: match[1], nodes: []ast.Node{
+			newRawHTML(`<abbr title="` + html.EscapeString(definition) + `">`),
+			ast.NewString([]byte(term)),
+			newRawHTML("</abbr>"),
+		}})
+	}
+	return replacements
+}
+
+// findTerms returns where the glossary terms are in text, as whole words.
+// Go's \b only knows ASCII word characters, so the letter before a match is
+// checked here, and the one after by the pattern, which then falls back to
+// shorter terms.
+func (g *Glossary) findTerms(text string) [][2]int {
+	var found [][2]int
+	for pos := 0; pos < len(text); {
+		m := g.pattern.FindStringSubmatchIndex(text[pos:])
+		if m == nil {
+			break
+		}
+		start, end := pos+m[2], pos+m[3]
+		if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && isWordRune(before) {
+			_, size := utf8.DecodeRuneInString(text[start:])
+			pos = start + size
+			continue
+		}
+		found = append(found, [2]int{start, end})
+		pos = end
+	}
+	return found
+}
+
+// isWordRune reports whether r can be part of a word, so that a term right
+// next to it is not a whole word.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
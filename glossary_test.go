@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadGlossary(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "glossary.md")
+	source := "# Glossary\n\n## API\n\nApplication\nprogramming interface.\n\n## API key\n\nA secret.\n\n## Orphan\n\n- not a paragraph\n\n## api\n\nDuplicate.\n"
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	glossary, err := LoadGlossary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"api":     "Application programming interface.",
+		"api key": "A secret.",
+	}
+	if len(glossary.Definitions) != len(want) {
+		t.Errorf("Definitions = %v, want %v", glossary.Definitions, want)
+	}
+	for term, definition := range want {
+		if got := glossary.Definitions[term]; got != definition {
+			t.Errorf("definition of %q = %q, want %q", term, got, definition)
+		}
+	}
+	for text, want := range map[string][]string{
+		"Get an api key for the API, not APIs.":  {"api key", "API"},
+		"API keys, then the API":                 {"API", "API"},
+		"ÉAPI, APIé, and API_v2 are other words": nil,
+		"« API »": {"API"},
+	} {
+		var got []string
+		for _, match := range glossary.findTerms(text) {
+			got = append(got, text[match[0]:match[1]])
+		}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("terms found in %q = %q, want %q", text, got, want)
+		}
+	}
+
+	empty := filepath.Join(dir, "empty.md")
+	if err := os.WriteFile(empty, []byte("# Nothing here\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadGlossary(empty); err == nil {
+		t.Error("expected an error for a glossary without terms")
+	}
+}
@@ -4,4 +4,12 @@ go 1.24.2
 
 require github.com/yuin/goldmark v1.7.12
 
-require github.com/teekennedy/goldmark-markdown v0.5.1
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/teekennedy/goldmark-markdown v0.5.1
+	github.com/yuin/goldmark-emoji v1.0.6
+	github.com/yuin/goldmark-meta v1.1.0
+	golang.org/x/net v0.47.0
+	golang.org/x/text v0.31.0
+	gopkg.in/yaml.v2 v2.3.0
+)
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// LinkGraph is the link graph the graph command exports: the traversed files
+// and the internal links between them.
+type LinkGraph struct {
+	Nodes []GraphNode `json:"nodes"` // In traversal order
+	Edges []GraphEdge `json:"edges"` // By linking file in traversal order, then in source order
+}
+
+// GraphNode is a traversed file.
+type GraphNode struct {
+	ID     string `json:"id"`               // Path relative to the scope directory, with forward slashes
+	Depth  int    `json:"depth"`            // Links followed from the root to reach the file
+	Parent string `json:"parent,omitempty"` // ID of the file whose link first led to this one, empty for the root
+}
+
+// GraphEdge is a link from one traversed file to another, or to itself.
+type GraphEdge struct {
+	From     string `json:"from"`               // ID of the linking file
+	To       string `json:"to"`                 // ID of the linked file
+	Fragment string `json:"fragment,omitempty"` // Fragment of the link, without "#"
+	Text     string `json:"text"`               // Link text
+	Line     int    `json:"line"`               // 1-based source line of the link in From
+	Column   int    `json:"column"`             // 1-based source column of the link text in From
+}
+
+// BuildLinkGraph returns the link graph of a completed traversal. Links to
+// files traversal left out, fragment-only links, and footnote references are
+// not edges.
+func BuildLinkGraph(traversal *FileTraversal, orderedFiles []string, scopeDir string) LinkGraph {
+	id := func(file string) string {
+		rel, err := filepath.Rel(scopeDir, file)
+		if err != nil {
+			return filepath.ToSlash(file)
+		}
+		return filepath.ToSlash(rel)
+	}
+	included := make(map[string]bool)
+	for _, file := range orderedFiles {
+		included[file] = true
+	}
+
+	graph := LinkGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for _, file := range orderedFiles {
+		node := GraphNode{ID: id(file), Depth: traversal.Depth(file)}
+		if parent := traversal.Parent(file); parent != "" {
+			node.Parent = id(parent)
+		}
+		graph.Nodes = append(graph.Nodes, node)
+
+		parsed, err := traversal.Snapshot().ParseFile(file, scopeDir)
+		if err != nil {
+			continue
+		}
+		for _, link := range parsed.Links {
+			if !link.IsInternal || link.IsFootnote || strings.HasPrefix(link.URL, "#") {
+				continue
+			}
+			target, err := traversal.resolveLink(file, link.URL)
+			if err != nil || !included[target] {
+				continue
+			}
+			edge := GraphEdge{From: node.ID, To: id(target), Text: link.Text, Line: link.Line, Column: link.Column}
+			if fragment := linkFragment(link.URL); fragment != "" {
+				edge.Fragment = fragment[1:]
+			}
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+	return graph
+}
+
+// runGraph implements the graph command: it writes the link graph of the
+// traversed files as JSON.
+func runGraph(traversal *FileTraversal, orderedFiles []string, scopeDir string, opts Options) error {
+	writer, closeOutput, err := createOutput(opts.Output)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(BuildLinkGraph(traversal, orderedFiles, scopeDir)); err != nil {
+		return fmt.Errorf("failed to write graph: %w", err)
+	}
+	return nil
+}
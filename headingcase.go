@@ -0,0 +1,138 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// Heading casing styles accepted by --heading-case.
+const (
+	HeadingCasePreserve = "preserve" // Leave headings as written
+	HeadingCaseTitle    = "title"    // Capitalize Each Major Word
+	HeadingCaseSentence = "sentence" // Capitalize only the first word
+)
+
+// titleCaseMinorWords are the words title case leaves lowercase, unless they
+// start or end the heading.
+var titleCaseMinorWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true,
+	"by": true, "for": true, "from": true, "in": true, "into": true, "nor": true,
+	"of": true, "on": true, "or": true, "per": true, "the": true, "to": true,
+	"via": true, "vs": true, "with": true,
+}
+
+// headingWordPattern matches the words of heading text that casing applies to.
+var headingWordPattern = regexp.MustCompile(`[\p{L}\p{N}][\p{L}\p{N}'’]*`)
+
+// caseHeadings rewrites the text of every heading in doc according to
+// --heading-case. Code spans are left alone, and so are words casing would
+// damage: acronyms in --heading-acronyms (which take their listed spelling),
+// words in all capitals like "API", and mixed-case names like "GitHub".
+func (fp *FileProcessor) caseHeadings(doc ast.Node, source []byte) {
+	if fp.opts.HeadingCase == "" || fp.opts.HeadingCase == HeadingCasePreserve {
+		return
+	}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			fp.caseHeading(heading, source)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// caseHeading rewrites the text nodes of one heading, numbering words across
+// all of them so that title case can tell the first and last words apart.
+func (fp *FileProcessor) caseHeading(heading *ast.Heading, source []byte) {
+	var texts []*ast.Text
+	ast.Walk(heading, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		switch node := n.(type) {
+		case *ast.CodeSpan:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			if entering {
+				texts = append(texts, node)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	total := 0
+	for _, text := range texts {
+		total += len(headingWordPattern.FindAllIndex(text.Segment.Value(source), -1))
+	}
+
+	index := 0
+	for _, text := range texts {
+		value := headingWordPattern.ReplaceAllStringFunc(string(text.Segment.Value(source)), func(word string) string {
+			cased := fp.caseWord(word, index, total)
+			index++
+			return cased
+		})
+		parent := text.Parent()
+		parent.ReplaceChild(parent, text, ast.NewString([]byte(value)))
+	}
+}
+
+// caseHeadingText applies --heading-case to plain heading text, such as a
+// section title listed in the table of contents.
+func (fp *FileProcessor) caseHeadingText(text string) string {
+	if fp.opts.HeadingCase == "" || fp.opts.HeadingCase == HeadingCasePreserve {
+		return text
+	}
+	total := len(headingWordPattern.FindAllStringIndex(text, -1))
+	index := 0
+	return headingWordPattern.ReplaceAllStringFunc(text, func(word string) string {
+		cased := fp.caseWord(word, index, total)
+		index++
+		return cased
+	})
+}
+
+// caseWord cases the word at index among total words of a heading.
+func (fp *FileProcessor) caseWord(word string, index, total int) string {
+	for _, acronym := range fp.opts.Acronyms {
+		if strings.EqualFold(word, acronym) {
+			return acronym
+		}
+	}
+	if keepsCase(word) {
+		return word
+	}
+
+	lower := strings.ToLower(word)
+	switch {
+	case fp.opts.HeadingCase == HeadingCaseSentence && index > 0:
+		return lower
+	case fp.opts.HeadingCase == HeadingCaseTitle && index > 0 && index < total-1 && titleCaseMinorWords[lower]:
+		return lower
+	}
+	first, size := utf8.DecodeRuneInString(lower)
+	return string(unicode.ToTitle(first)) + lower[size:]
+}
+
+// keepsCase reports whether word is written in all capitals, like "API", or has
+// a capital after its first letter, like "GitHub" or "iOS".
+func keepsCase(word string) bool {
+	letters, upper, innerUpper := 0, 0, false
+	for i, r := range word {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.IsUpper(r) {
+			upper++
+			if i > 0 {
+				innerUpper = true
+			}
+		}
+	}
+	if letters >= 2 && upper == letters {
+		return true
+	}
+	return innerUpper && upper < letters
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCaseHeadingText(t *testing.T) {
+	tests := []struct {
+		style, text, expected string
+	}{
+		{HeadingCaseTitle, "getting started with the api", "Getting Started with the API"},
+		{HeadingCaseTitle, "what to look for", "What to Look For"},
+		{HeadingCaseTitle, "deploying to macos via GitHub", "Deploying to macOS via GitHub"},
+		{HeadingCaseSentence, "Getting Started With The API", "Getting started with the API"},
+		{HeadingCaseSentence, "Using GitHub Actions on iOS", "Using GitHub actions on iOS"},
+		{HeadingCaseSentence, "  Trailing Space ", "  Trailing space "},
+		{HeadingCasePreserve, "getting Started", "getting Started"},
+	}
+
+	for _, tt := range tests {
+		fp := &FileProcessor{opts: Options{HeadingCase: tt.style, Acronyms: []string{"API", "macOS"}}}
+		if got := fp.caseHeadingText(tt.text); got != tt.expected {
+			t.Errorf("caseHeadingText(%q) with %s case = %q, want %q", tt.text, tt.style, got, tt.expected)
+		}
+	}
+}
+
+func TestFileProcessor_HeadingCase(t *testing.T) {
+	content := "# configuring the `http_client` setting\n\n## Why Use *Retries* At All\n"
+	fp := NewFileProcessor(t.TempDir(), []string{"doc.md"}, Options{HeadingCase: HeadingCaseSentence})
+	processed, err := fp.ProcessFile("doc.md", []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# Configuring the `http_client` setting", "## Why use *retries* at all"} {
+		if !strings.Contains(string(processed), want) {
+			t.Errorf("ProcessFile() = %q, want it to contain %q", processed, want)
+		}
+	}
+}
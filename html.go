@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"time"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// Output formats accepted by --format.
+const (
+	FormatMarkdown = "markdown" // The combined markdown document
+	FormatHTML     = "html"     // A standalone HTML page rendering it
+)
+
+// diagramTimeout limits how long --diagram-command may take to render one
+// diagram.
+const diagramTimeout = time.Minute
+
+// htmlPage is the page RenderHTML writes the rendered document into. Styles
+// are inline so the page needs nothing but the assets the document refers to.
+const htmlPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%s</title>
+<style>
+body { max-width: 48rem; margin: 2rem auto; padding: 0 1rem; font-family: system-ui, sans-serif; line-height: 1.5; }
+pre { overflow-x: auto; padding: 0.75rem; background: #f6f8fa; }
+code { font-family: ui-monospace, monospace; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d0d7de; padding: 0.25rem 0.5rem; }
+img, svg { max-width: 100%%; }
+</style>
+</head>
+<body>
+<main>
+%s</main>
+</body>
+</html>
+`
+
+// RenderHTML renders document, the combined markdown output, as a standalone
+// HTML page titled after the document title, or else the root file's section.
+//
+// The document is parsed again as a whole, with the extensions the sources were
+// parsed with, rather than rendering the files' ASTs. Rewritten links point at
+// the IDs a renderer generates once across the whole combined document, and
+// only the document has every heading involved: the synthetic headers,
+// --file-header templates, and the Notes and References sections are written
+// as markdown around the files' own ASTs. Parsing it again gives headings the
+// IDs links point at, exactly as any markdown renderer would.
+//
+// Raw HTML, like the anchors catmd writes, is kept. Diagram blocks are
+// rendered with opts.Diagrams, if set, and images with titles as numbered
+// figures with --figures. With --section-classes, the blocks of each section
+// that sections says starts in the document are wrapped in a div, and with
+// --glossary, glossary terms outside the glossary's section get tooltips.
+func (fp *FileProcessor) RenderHTML(document []byte, sections []htmlSection) ([]byte, error) {
+	extensions := parserExtensions(fp.opts)
+	if fp.opts.Diagrams != nil {
+		extensions = append(extensions, NewDiagramExtension(fp.opts.Diagrams))
+	}
+	if fp.opts.Figures {
+		extensions = append(extensions, figureExtension{})
+	}
+	if fp.opts.SectionClasses {
+		extensions = append(extensions, sectionClassExtension{fp: fp, sections: sections})
+	}
+	if fp.glossary != nil {
+		extensions = append(extensions, glossaryExtension{glossary: fp.glossary, sections: sections})
+	}
+	md := NewMarkdownParser(extensions...)
+	md.Renderer().AddOptions(goldmarkhtml.WithUnsafe())
+	doc := md.Parser().Parse(text.NewReader(document), parser.WithContext(parser.NewContext(parser.WithIDs(newSlugger(fp.opts)))))
+
+	var body bytes.Buffer
+	if err := md.Renderer().Render(&body, document, doc); err != nil {
+		return nil, err
+	}
+
+	title := fp.DocumentTitle()
+	if title == "" && len(fp.files) > 0 {
+		title = fp.sectionTitle(fp.files[0])
+	}
+	return fmt.Appendf(nil, htmlPage, html.EscapeString(title), body.Bytes()), nil
+}
+
+// htmlSection records where the section of File starts in the combined
+// document. File is empty where content that belongs to no file's section
+// starts, like the appendix heading and the Notes section.
+type htmlSection struct {
+	File  string
+	Start int // Byte offset in the document
+}
+
+// sectionFiles returns the file whose section each top-level block of doc is
+// in, going by where sections start in the document. Blocks with no source
+// position, like thematic breaks, are in the section of the blocks before
+// them. Blocks in no file's section are left out.
+func sectionFiles(doc ast.Node, sections []htmlSection) map[ast.Node]string {
+	files := make(map[ast.Node]string)
+	file := ""
+	next := 0
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		if offset := nodeOffset(child); offset >= 0 {
+			for next < len(sections) && sections[next].Start <= offset {
+				file = sections[next].File
+				next++
+			}
+		}
+		if file != "" {
+			files[child] = file
+		}
+	}
+	return files
+}
+
+// htmlWriter collects the combined markdown document for --format html, so it
+// can be rendered as a whole once it is complete.
+type htmlWriter struct {
+	dest     io.Writer     // Where the page is written
+	markdown bytes.Buffer  // The document written so far
+	sections []htmlSection // Where sections start in the document, in order
+	page     []byte        // The page, once written
+}
+
+// Write implements io.Writer.
+func (w *htmlWriter) Write(p []byte) (int, error) {
+	return w.markdown.Write(p)
+}
+
+// Section records that what is written next starts the section of file, or
+// belongs to no file's section when file is empty.
+func (w *htmlWriter) Section(file string) {
+	w.sections = append(w.sections, htmlSection{File: file, Start: w.markdown.Len()})
+}
+
+// Flush renders the document with render and writes the page.
+func (w *htmlWriter) Flush(render func([]byte, []htmlSection) ([]byte, error)) error {
+	page, err := render(w.markdown.Bytes(), w.sections)
+	if err != nil {
+		return err
+	}
+	w.page = page
+	_, err = w.dest.Write(page)
+	return err
+}
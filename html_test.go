@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFileProcessor_RenderHTML(t *testing.T) {
+	fp := NewFileProcessor(t.TempDir(), nil, Options{Diagrams: fakeDiagrams{}})
+	document := "# Usage\n\nSee [usage](#usage-1) <a id=\"x\"></a>\n\n# Usage\n\n```mermaid\ngraph TD\n```\n"
+	page, err := fp.RenderHTML([]byte(document), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		`<h1 id="usage">Usage</h1>`,
+		`<h1 id="usage-1">Usage</h1>`,
+		`<a href="#usage-1">usage</a> <a id="x"></a>`,
+		"<svg>mermaid</svg>",
+		"</html>\n",
+	} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("page does not contain %q:\n%s", want, page)
+		}
+	}
+}
+
+func TestFileProcessor_RenderHTMLFigures(t *testing.T) {
+	fp := NewFileProcessor(t.TempDir(), nil, Options{Figures: true})
+	document := "# Home\n\nSee ![inline](a.png \"Inline\") here.\n\n<a id=\"figure-1\"></a>![Overview](arch.png \"System overview\")\n\n![Plain](b.png)\n\n![Flow](flow.png \"Data & flow\")\n"
+	page, err := fp.RenderHTML([]byte(document), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<p>See <img src="a.png" alt="inline" title="Inline"> here.</p>`,
+		"<figure>\n<a id=\"figure-1\"></a><img src=\"arch.png\" alt=\"Overview\" title=\"System overview\">\n<figcaption>Figure 1. System overview</figcaption>\n</figure>",
+		`<p><img src="b.png" alt="Plain"></p>`,
+		"<figcaption>Figure 2. Data &amp; flow</figcaption>",
+	} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("page does not contain %q:\n%s", want, page)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+
+	"golang.org/x/net/html"
+)
+
+// htmlIDs returns the values of the id attributes of the tags in raw HTML, in
+// order, such as those of the <a id="fn-1"> anchors written for endnotes.
+// Markup that only looks like an attribute, in comments or text, is ignored.
+func htmlIDs(raw []byte) []string {
+	var ids []string
+	z := html.NewTokenizer(bytes.NewReader(raw))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ids
+		case html.StartTagToken, html.SelfClosingTagToken:
+			for _, attr := range z.Token().Attr {
+				if attr.Namespace == "" && attr.Key == "id" {
+					ids = append(ids, attr.Val)
+				}
+			}
+		}
+	}
+}
+
+// renameHTMLIDs returns raw HTML with the id attributes rename gives new values
+// for changed, and whether any were. Tags with a renamed ID are written anew,
+// and everything else is kept as it was.
+func renameHTMLIDs(raw []byte, rename func(id string) (string, bool)) ([]byte, bool) {
+	var out bytes.Buffer
+	changed := false
+	z := html.NewTokenizer(bytes.NewReader(raw))
+	for {
+		kind := z.Next()
+		if kind == html.ErrorToken {
+			out.Write(z.Raw())
+			break
+		}
+		source := bytes.Clone(z.Raw())
+		if kind != html.StartTagToken && kind != html.SelfClosingTagToken {
+			out.Write(source)
+			continue
+		}
+
+		token := z.Token()
+		renamed := false
+		for i, attr := range token.Attr {
+			if attr.Namespace != "" || attr.Key != "id" {
+				continue
+			}
+			if id, ok := rename(attr.Val); ok && id != attr.Val {
+				token.Attr[i].Val = id
+				renamed = true
+			}
+		}
+		if renamed {
+			out.WriteString(token.String())
+			changed = true
+		} else {
+			out.Write(source)
+		}
+	}
+	if !changed {
+		return raw, false
+	}
+	return out.Bytes(), true
+}
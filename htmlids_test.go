@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHTMLIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected []string
+	}{
+		{"anchor", `<a id="fn-1"></a>`, []string{"fn-1"}},
+		{"unquoted and uppercase", `<DIV ID=intro class="x">`, []string{"intro"}},
+		{"entity", `<span id="a&amp;b">`, []string{"a&b"}},
+		{"several tags", "<p id=\"one\">\ntext <b id='two'>", []string{"one", "two"}},
+		{"other attributes", `<img data-id="x" alt='id="y"'>`, nil},
+		{"comment", `<!-- id="old" -->`, nil},
+		{"closing tag", `</a>`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := htmlIDs([]byte(tt.html)); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("htmlIDs(%q) = %q, want %q", tt.html, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenameHTMLIDs(t *testing.T) {
+	rename := func(id string) (string, bool) {
+		return id + "-1", id == "intro"
+	}
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+		changed  bool
+	}{
+		{"renamed", `<div id="intro">Hi</div>`, `<div id="intro-1">Hi</div>`, true},
+		{"others kept as written", `<DIV ID=other>Hi <b>there</b></DIV>`, `<DIV ID=other>Hi <b>there</b></DIV>`, false},
+		{"comment", `<!-- id="intro" --><p id='intro'>`, `<!-- id="intro" --><p id="intro-1">`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := renameHTMLIDs([]byte(tt.html), rename)
+			if string(got) != tt.expected || changed != tt.changed {
+				t.Errorf("renameHTMLIDs(%q) = %q, %v, want %q, %v", tt.html, got, changed, tt.expected, tt.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// convertHTMLTables replaces raw HTML blocks holding a single simple <table> with
+// the equivalent GFM table nodes, so plain-markdown output doesn't carry opaque
+// HTML blobs. Tables that can't be expressed in GFM (spanning cells, nested tables,
+// block content in cells, no header row) are left as HTML, and a warning saying
+// why is printed.
+//
+// Converted cells are built from Link, Emphasis, and String nodes, so internal
+// links inside them are rewritten by the later link transformation pass.
+func (fp *FileProcessor) convertHTMLTables(doc ast.Node, source []byte, filename string) {
+	var blocks []*ast.HTMLBlock
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := n.(*ast.HTMLBlock); ok && entering {
+			blocks = append(blocks, block)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, block := range blocks {
+		raw := htmlBlockSource(block, source)
+		if !bytes.Contains(bytes.ToLower(raw), []byte("<table")) {
+			continue
+		}
+
+		table, err := htmlTableToGFM(raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: HTML table left as is: %v\n", displayPath(filename), err)
+			continue
+		}
+
+		table.SetBlankPreviousLines(block.HasBlankPreviousLines())
+		parent := block.Parent()
+		parent.ReplaceChild(parent, block, table)
+	}
+}
+
+// htmlBlockSource returns the raw source of an HTML block, including the line
+// that closed it.
+func htmlBlockSource(block *ast.HTMLBlock, source []byte) []byte {
+	var buf bytes.Buffer
+	lines := block.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		buf.Write(segment.Value(source))
+	}
+	if block.HasClosure() {
+		buf.Write(block.ClosureLine.Value(source))
+	}
+	return buf.Bytes()
+}
+
+// htmlTableToGFM parses raw HTML consisting of exactly one <table> element and
+// builds the GFM table for it, or explains why it can't.
+func htmlTableToGFM(raw []byte) (*extast.Table, error) {
+	nodes, err := html.ParseFragment(bytes.NewReader(raw), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTML: %w", err)
+	}
+
+	var tableNode *html.Node
+	for _, n := range nodes {
+		switch {
+		case n.Type == html.TextNode && strings.TrimSpace(n.Data) == "", n.Type == html.CommentNode:
+		case n.Type == html.ElementNode && n.DataAtom == atom.Table && tableNode == nil:
+			tableNode = n
+		default:
+			return nil, fmt.Errorf("block holds more than a single table")
+		}
+	}
+	if tableNode == nil {
+		return nil, fmt.Errorf("block holds more than a single table")
+	}
+
+	rows := tableRows(tableNode)
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("table has no rows")
+	}
+
+	columns := len(tableCells(rows[0]))
+	for _, cell := range tableCells(rows[0]) {
+		if cell.DataAtom != atom.Th {
+			return nil, fmt.Errorf("first row is not a header row of <th> cells")
+		}
+	}
+
+	table := extast.NewTable()
+	for _, cell := range tableCells(rows[0]) {
+		table.Alignments = append(table.Alignments, cellAlignment(cell))
+	}
+
+	for i, row := range rows {
+		cells := tableCells(row)
+		if len(cells) > columns {
+			return nil, fmt.Errorf("row %d has more cells than the header", i+1)
+		}
+
+		tableRow := extast.NewTableRow(table.Alignments)
+		for j := 0; j < columns; j++ {
+			tableCell := extast.NewTableCell()
+			tableCell.Alignment = table.Alignments[j]
+			if j < len(cells) {
+				for _, attr := range cells[j].Attr {
+					if (attr.Key == "colspan" || attr.Key == "rowspan") && attr.Val != "1" {
+						return nil, fmt.Errorf("row %d uses %s", i+1, attr.Key)
+					}
+				}
+				if err := appendInlineHTML(tableCell, cells[j]); err != nil {
+					return nil, fmt.Errorf("row %d: %w", i+1, err)
+				}
+				trimCellText(tableCell)
+			}
+			tableRow.AppendChild(tableRow, tableCell)
+		}
+
+		if i == 0 {
+			table.AppendChild(table, extast.NewTableHeader(tableRow))
+		} else {
+			table.AppendChild(table, tableRow)
+		}
+	}
+
+	return table, nil
+}
+
+// tableRows returns the <tr> elements of a table in document order, looking
+// through <thead>, <tbody>, and <tfoot>.
+func tableRows(table *html.Node) []*html.Node {
+	var rows []*html.Node
+	for child := table.FirstChild; child != nil; child = child.NextSibling {
+		switch child.DataAtom {
+		case atom.Tr:
+			rows = append(rows, child)
+		case atom.Thead, atom.Tbody, atom.Tfoot:
+			rows = append(rows, tableRows(child)...)
+		}
+	}
+	return rows
+}
+
+// tableCells returns the <th> and <td> elements of a row.
+func tableCells(row *html.Node) []*html.Node {
+	var cells []*html.Node
+	for child := row.FirstChild; child != nil; child = child.NextSibling {
+		if child.DataAtom == atom.Th || child.DataAtom == atom.Td {
+			cells = append(cells, child)
+		}
+	}
+	return cells
+}
+
+// cellAlignment reads a header cell's align attribute or text-align style.
+func cellAlignment(cell *html.Node) extast.Alignment {
+	for _, attr := range cell.Attr {
+		value := strings.ToLower(attr.Val)
+		if attr.Key == "style" {
+			if i := strings.Index(value, "text-align:"); i >= 0 {
+				value = strings.TrimSpace(strings.TrimPrefix(value[i:], "text-align:"))
+			} else {
+				continue
+			}
+		} else if attr.Key != "align" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(value, "left"):
+			return extast.AlignLeft
+		case strings.HasPrefix(value, "right"):
+			return extast.AlignRight
+		case strings.HasPrefix(value, "center"):
+			return extast.AlignCenter
+		}
+	}
+	return extast.AlignNone
+}
+
+// appendInlineHTML converts the children of an HTML element into inline markdown
+// nodes appended to parent. Only phrasing elements with a markdown equivalent are
+// supported.
+func appendInlineHTML(parent ast.Node, element *html.Node) error {
+	for child := element.FirstChild; child != nil; child = child.NextSibling {
+		switch child.Type {
+		case html.TextNode:
+			text := strings.Join(strings.Fields(child.Data), " ")
+			if text == "" && child.Data != "" {
+				text = " "
+			} else if text != "" {
+				if startsWithSpace(child.Data) {
+					text = " " + text
+				}
+				if endsWithSpace(child.Data) {
+					text += " "
+				}
+			}
+			parent.AppendChild(parent, newLiteral(text))
+			continue
+		case html.CommentNode:
+			continue
+		case html.ElementNode:
+		default:
+			return fmt.Errorf("unsupported HTML content")
+		}
+
+		var node ast.Node
+		switch child.DataAtom {
+		case atom.A:
+			link := ast.NewLink()
+			for _, attr := range child.Attr {
+				if attr.Key == "href" {
+					link.Destination = []byte(attr.Val)
+				}
+			}
+			node = link
+		case atom.Strong, atom.B:
+			node = ast.NewEmphasis(2)
+		case atom.Em, atom.I:
+			node = ast.NewEmphasis(1)
+		case atom.Span:
+			if err := appendInlineHTML(parent, child); err != nil {
+				return err
+			}
+			continue
+		case atom.Code:
+			code := ast.NewCodeSpan()
+			code.AppendChild(code, ast.NewString([]byte(strings.Join(strings.Fields(htmlText(child)), " "))))
+			parent.AppendChild(parent, code)
+			continue
+		case atom.Br:
+			parent.AppendChild(parent, newRawHTML("<br>"))
+			continue
+		default:
+			return fmt.Errorf("unsupported <%s> element in a cell", child.Data)
+		}
+
+		if err := appendInlineHTML(node, child); err != nil {
+			return err
+		}
+		parent.AppendChild(parent, node)
+	}
+	return nil
+}
+
+// trimCellText removes the whitespace left at the edges of a cell by the HTML
+// source's indentation.
+func trimCellText(cell ast.Node) {
+	if first, ok := cell.FirstChild().(*literal); ok {
+		first.value = strings.TrimLeft(first.value, " ")
+	}
+	if last, ok := cell.LastChild().(*literal); ok {
+		last.value = strings.TrimRight(last.value, " ")
+	}
+}
+
+// htmlText returns the concatenated text content of an element.
+func htmlText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var text strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		text.WriteString(htmlText(child))
+	}
+	return text.String()
+}
+
+func startsWithSpace(s string) bool {
+	return len(s) > 0 && strings.TrimLeft(s[:1], " \t\r\n") == ""
+}
+
+func endsWithSpace(s string) bool {
+	return len(s) > 0 && strings.TrimRight(s[len(s)-1:], " \t\r\n") == ""
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+func TestHTMLTableToGFM(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		wantErr string
+	}{
+		{
+			name: "simple table",
+			html: "<table><tr><th>A</th></tr><tr><td>1</td></tr></table>",
+		},
+		{
+			name:    "no header row",
+			html:    "<table><tr><td>A</td></tr></table>",
+			wantErr: "not a header row",
+		},
+		{
+			name:    "rowspan",
+			html:    "<table><tr><th>A</th></tr><tr><td rowspan=\"2\">1</td></tr></table>",
+			wantErr: "uses rowspan",
+		},
+		{
+			name:    "block content in cell",
+			html:    "<table><tr><th>A</th></tr><tr><td><ul><li>x</li></ul></td></tr></table>",
+			wantErr: "unsupported <ul> element",
+		},
+		{
+			name:    "nested table",
+			html:    "<table><tr><th>A</th></tr><tr><td><table></table></td></tr></table>",
+			wantErr: "unsupported <table> element",
+		},
+		{
+			name:    "extra cells",
+			html:    "<table><tr><th>A</th></tr><tr><td>1</td><td>2</td></tr></table>",
+			wantErr: "more cells than the header",
+		},
+		{
+			name:    "text after table",
+			html:    "<table><tr><th>A</th></tr></table>\n<p>after</p>",
+			wantErr: "more than a single table",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := htmlTableToGFM([]byte(tt.html))
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("htmlTableToGFM() error = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !contains(err.Error(), tt.wantErr)) {
+				t.Errorf("htmlTableToGFM() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTMLTableToGFM_Cells(t *testing.T) {
+	tests := []struct {
+		name     string
+		cell     string
+		expected string
+	}{
+		{name: "code", cell: "<code>catmd build</code>", expected: "`catmd build`"},
+		{name: "pipe in code", cell: "<code>a | b</code>", expected: "`a \\| b`"},
+		{name: "backticks in code", cell: "<code>use `x`</code>", expected: "`` use `x` ``"},
+		{name: "whitespace in code", cell: "<code>  spaced\n out </code>", expected: "`spaced out`"},
+		{name: "markdown characters", cell: "a | *b* [c]", expected: "a \\| \\*b\\* \\[c\\]"},
+		{name: "emphasis and break", cell: "<b>bold</b><br>next", expected: "**bold**<br>next"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := htmlTableToGFM([]byte("<table><tr><th>A</th></tr><tr><td>" + tt.cell + "</td></tr></table>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc := ast.NewDocument()
+			doc.AppendChild(doc, table)
+			var buf strings.Builder
+			if err := newMarkdownRenderer(nil).Render(&buf, nil, doc); err != nil {
+				t.Fatal(err)
+			}
+			if want := "| " + tt.expected + " |\n"; !strings.HasSuffix(buf.String(), want) {
+				t.Errorf("rendered table = %q, want it to end in %q", buf.String(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// normalizingWriter applies the --normalize-whitespace output policy to the
+// combined document, so it passes markdownlint's whitespace rules out of the
+// box:
+//   - trailing whitespace is stripped from every line
+//   - runs of blank lines are collapsed to at most maxBlankLines
+//   - blank lines at the start and end are dropped, and the output ends with
+//     exactly one newline
+//
+// Code block content is passed through untouched, since whitespace in code can
+// be significant. The document is held back until Flush, since only parsing it
+// as a whole tells which lines are code.
+type normalizingWriter struct {
+	w             io.Writer
+	maxBlankLines int
+	document      bytes.Buffer // Everything written so far
+}
+
+func newNormalizingWriter(w io.Writer, maxBlankLines int) *normalizingWriter {
+	return &normalizingWriter{w: w, maxBlankLines: maxBlankLines}
+}
+
+// Write adds p to the document.
+func (nw *normalizingWriter) Write(p []byte) (int, error) {
+	return nw.document.Write(p)
+}
+
+// Flush writes the normalized document.
+func (nw *normalizingWriter) Flush() error {
+	_, err := nw.w.Write(normalizeWhitespace(nw.document.Bytes(), nw.maxBlankLines))
+	return err
+}
+
+// normalizeWhitespace applies the --normalize-whitespace policy to document,
+// keeping at most maxBlankLines blank lines in a row.
+func normalizeWhitespace(document []byte, maxBlankLines int) []byte {
+	code := codeLines(document)
+
+	var result bytes.Buffer
+	blankLines := 0
+	started := false
+	for start := 0; start < len(document); {
+		end := len(document)
+		next := end
+		if i := bytes.IndexByte(document[start:], '\n'); i >= 0 {
+			end = start + i
+			next = end + 1
+		}
+		line, verbatim := document[start:end], code[start]
+		start = next
+
+		if !verbatim {
+			line = bytes.TrimRight(line, " \t\r")
+		}
+		if len(line) == 0 && !verbatim {
+			blankLines++
+			continue
+		}
+		if started {
+			result.Write(bytes.Repeat([]byte{'\n'}, min(blankLines, maxBlankLines)))
+		}
+		blankLines = 0
+		started = true
+		result.Write(line)
+		result.WriteByte('\n')
+	}
+	return result.Bytes()
+}
+
+// codeLines returns the offsets in document of the lines that are the content
+// of code blocks.
+func codeLines(document []byte) map[int]bool {
+	lines := make(map[int]bool)
+	doc := goldmark.New().Parser().Parse(text.NewReader(document))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.(type) {
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			segments := n.Lines()
+			for i := 0; i < segments.Len(); i++ {
+				// Segments of code in lists and block quotes start after the
+				// indentation or marker, but the whole line is kept
+				start := bytes.LastIndexByte(document[:segments.At(i).Start], '\n') + 1
+				lines[start] = true
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return lines
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNormalizingWriter(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         []string // Written in separate calls
+		maxBlankLines int
+		expected      string
+	}{
+		{
+			name:          "trailing whitespace",
+			input:         []string{"# Title  \n\ntext\t\n"},
+			maxBlankLines: 1,
+			expected:      "# Title\n\ntext\n",
+		},
+		{
+			name:          "blank line runs collapsed",
+			input:         []string{"a\n\n\n\n\nb\n\n\nc\n"},
+			maxBlankLines: 2,
+			expected:      "a\n\n\nb\n\n\nc\n",
+		},
+		{
+			name:          "leading and trailing blank lines dropped",
+			input:         []string{"\n\n  \na\n\n\n"},
+			maxBlankLines: 1,
+			expected:      "a\n",
+		},
+		{
+			name:          "missing final newline added",
+			input:         []string{"a\n", "b"},
+			maxBlankLines: 1,
+			expected:      "a\nb\n",
+		},
+		{
+			name:          "lines split across writes",
+			input:         []string{"a  ", "\n", "\n\n", "\n", "b\n"},
+			maxBlankLines: 1,
+			expected:      "a\n\nb\n",
+		},
+		{
+			name:          "fenced code untouched",
+			input:         []string{"```\nx  \n\n\n\ny\n```\n\n\n\nz\n"},
+			maxBlankLines: 1,
+			expected:      "```\nx  \n\n\n\ny\n```\n\nz\n",
+		},
+		{
+			name:          "longer fence not closed by shorter one",
+			input:         []string{"~~~~\n~~~\n\n\n~~~~\n"},
+			maxBlankLines: 0,
+			expected:      "~~~~\n~~~\n\n\n~~~~\n",
+		},
+		{
+			name:          "fenced code in a block quote untouched",
+			input:         []string{"> ```\n> x  \n>\n> ```\n\n\n\nz\n"},
+			maxBlankLines: 1,
+			expected:      "> ```\n> x  \n>\n> ```\n\nz\n",
+		},
+		{
+			name:          "indented code untouched",
+			input:         []string{"a\n\n    x  \n\n\n    y\n\n\nb\n"},
+			maxBlankLines: 1,
+			expected:      "a\n\n    x  \n\n\n    y\n\nb\n",
+		},
+		{
+			name:          "inline backticks are not a fence",
+			input:         []string{"```a` b\n\n\nc\n"},
+			maxBlankLines: 1,
+			expected:      "```a` b\n\nc\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			nw := newNormalizingWriter(&buf, tt.maxBlankLines)
+			for _, chunk := range tt.input {
+				if _, err := nw.Write([]byte(chunk)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := nw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("normalized = %q, want %q", buf.String(), tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FrontMatterBaseResolver is a LinkResolver for trees authored for static site
+// generators that publish pages somewhere other than next to their sources, so
+// that relative links are written against the published location:
+//
+//   - base: a directory the file's relative links resolve against instead of
+//     its own, relative to the file, or to the scope directory when it starts
+//     with "/"
+//   - slug: the name of the directory the page is published as, next to the
+//     file ("../setup.md" in guide.md with slug: start reaches setup.md beside
+//     guide.md, as it does from /start/ on the site)
+//
+// A base takes precedence over a slug. Links are then resolved by Next.
+type FrontMatterBaseResolver struct {
+	next     LinkResolver
+	scopeDir string
+	snapshot *Snapshot
+	mu       sync.Mutex
+	bases    map[string]string // Link base directory of each file read so far, "" for its own
+}
+
+// NewFrontMatterBaseResolver returns a FrontMatterBaseResolver reading front
+// matter from snapshot and resolving links with next, or as relative paths if
+// next is nil.
+func NewFrontMatterBaseResolver(next LinkResolver, scopeDir string, snapshot *Snapshot) *FrontMatterBaseResolver {
+	if next == nil {
+		next = RelativeResolver{}
+	}
+	return &FrontMatterBaseResolver{
+		next:     next,
+		scopeDir: scopeDir,
+		snapshot: snapshot,
+		bases:    make(map[string]string),
+	}
+}
+
+// ResolveTarget implements LinkResolver.
+func (r *FrontMatterBaseResolver) ResolveTarget(fromFile, url string) (string, bool, error) {
+	if _, ok := fileURLPath(url); !ok && !filepath.IsAbs(url) {
+		if base := r.base(fromFile); base != "" {
+			// Resolve as if the file were in its base directory
+			fromFile = filepath.Join(base, filepath.Base(fromFile))
+		}
+	}
+	return r.next.ResolveTarget(fromFile, url)
+}
+
+// base returns the directory file's relative links resolve against, or "" for
+// its own.
+func (r *FrontMatterBaseResolver) base(file string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if base, ok := r.bases[file]; ok {
+		return base
+	}
+
+	var frontMatter map[string]any
+	if parsed, err := r.snapshot.ParseFile(file, r.scopeDir); err == nil {
+		frontMatter = parsed.FrontMatter
+	}
+	base := ""
+	if value, ok := frontMatterString(frontMatter, "base"); ok {
+		if strings.HasPrefix(value, "/") {
+			base = filepath.Join(r.scopeDir, filepath.FromSlash(value))
+		} else {
+			base = filepath.Join(filepath.Dir(file), filepath.FromSlash(value))
+		}
+	} else if value, ok := frontMatterString(frontMatter, "slug"); ok {
+		base = filepath.Join(filepath.Dir(file), filepath.FromSlash(value))
+	}
+	r.bases[file] = base
+	return base
+}
+
+// frontMatterString returns the non-empty string stored under key in a file's
+// front matter, and whether there is one.
+func frontMatterString(frontMatter map[string]any, key string) (string, bool) {
+	value, ok := frontMatter[key]
+	if !ok || value == nil {
+		return "", false
+	}
+	s := strings.TrimSpace(fmt.Sprint(value))
+	return s, s != ""
+}
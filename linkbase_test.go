@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFrontMatterBaseResolver(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.md":         "# Home\n",
+		"guides/plain.md":  "# Plain\n",
+		"guides/start.md":  "---\nslug: start\n---\n\n# Start\n",
+		"guides/ref.md":    "---\nbase: /shared\nslug: ignored\n---\n\n# Reference\n",
+		"guides/nested.md": "---\nbase: ../shared\n---\n\n# Nested\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	traversal := NewFileTraversal(filepath.Join(dir, "index.md"), dir)
+	traversal.Snapshot().SetFrontMatter(true)
+	resolver := NewFrontMatterBaseResolver(nil, dir, traversal.Snapshot())
+
+	tests := []struct {
+		from string
+		url  string
+		want string
+	}{
+		{"guides/plain.md", "setup.md", "guides/setup.md"},
+		{"guides/start.md", "../setup.md#install", "guides/setup.md"},
+		{"guides/ref.md", "glossary.md", "shared/glossary.md"},
+		{"guides/nested.md", "glossary.md", "shared/glossary.md"},
+	}
+	for _, tt := range tests {
+		from := filepath.Join(dir, filepath.FromSlash(tt.from))
+		got, include, err := resolver.ResolveTarget(from, tt.url)
+		if err != nil || !include {
+			t.Errorf("ResolveTarget(%s, %q) = %q, %v, %v", tt.from, tt.url, got, include, err)
+			continue
+		}
+		if want := filepath.Join(dir, filepath.FromSlash(tt.want)); got != want {
+			t.Errorf("ResolveTarget(%s, %q) = %q, want %q", tt.from, tt.url, got, want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// linkTypoCutset is the stray whitespace and punctuation that link resolution
+// tolerates at the end of a path, as in "api.md." or "<./api.md >".
+const linkTypoCutset = " \t.,;:!?"
+
+// LinkTypo is a link whose destination only resolves once stray whitespace or
+// punctuation is removed from its path.
+type LinkTypo struct {
+	File  string // Absolute path of the file containing the link
+	URL   string // Destination as written
+	Fixed string // Destination with the stray characters removed
+}
+
+// correctLinkURL returns linkURL with stray whitespace around its path and
+// punctuation after it removed, keeping any query string and fragment, and
+// whether anything was removed.
+func correctLinkURL(linkURL string) (string, bool) {
+	end := len(linkURL)
+	if i := strings.IndexAny(linkURL, "?#"); i >= 0 {
+		end = i
+	}
+	path := linkURL[:end]
+	trimmed := strings.TrimLeft(strings.TrimRight(path, linkTypoCutset), " \t")
+	if trimmed == path || trimmed == "" || strings.HasSuffix(trimmed, "/") {
+		return linkURL, false
+	}
+	return trimmed + linkURL[end:], true
+}
+
+// FixLinkTypos rewrites the destinations of typos in their source files. Only
+// the destinations of inline links and images and of reference definitions are
+// changed, so the same text elsewhere, such as in code, is left alone.
+func FixLinkTypos(typos []LinkTypo) error {
+	byFile := make(map[string]map[string]string)
+	var files []string
+	for _, typo := range typos {
+		if _, ok := byFile[typo.File]; !ok {
+			files = append(files, typo.File)
+			byFile[typo.File] = make(map[string]string)
+		}
+		byFile[typo.File][typo.URL] = typo.Fixed
+	}
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var fixed []byte
+		count, last := 0, 0
+		for _, span := range linkDestinationSpans(content) {
+			replacement, ok := byFile[file][string(content[span.start:span.end])]
+			if !ok {
+				continue
+			}
+			fixed = append(append(fixed, content[last:span.start]...), replacement...)
+			last = span.end
+			count++
+		}
+		if count == 0 {
+			continue
+		}
+		fixed = append(fixed, content[last:]...)
+		if err := os.WriteFile(file, fixed, info.Mode().Perm()); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Fixed %d link(s) in %s\n", count, displayPath(file))
+	}
+	return nil
+}
+
+// destinationSpan is where a link destination is written in a file's source,
+// from start up to end.
+type destinationSpan struct {
+	start, end int
+}
+
+// linkDestinationSpans returns where the destinations of the inline links and
+// images and of the reference definitions in source are written, in order.
+// Goldmark keeps destinations as slices of the source, which is what locates
+// them; the few it has to copy, such as ones after a tab in an indented block,
+// are left out.
+func linkDestinationSpans(source []byte) []destinationSpan {
+	pc := parser.NewContext()
+	doc := defaultParser().Parser().Parse(text.NewReader(bytes.TrimPrefix(source, utf8BOM)), parser.WithContext(pc))
+
+	seen := make(map[int]bool)
+	var spans []destinationSpan
+	add := func(destination []byte) {
+		start, ok := offsetIn(source, destination)
+		if ok && !seen[start] {
+			seen[start] = true
+			spans = append(spans, destinationSpan{start: start, end: start + len(destination)})
+		}
+	}
+	for _, ref := range pc.References() {
+		add(ref.Destination())
+	}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			switch node := n.(type) {
+			case *ast.Link:
+				// Reference links share their definition's destination
+				add(node.Destination)
+			case *ast.Image:
+				add(node.Destination)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	slices.SortFunc(spans, func(a, b destinationSpan) int {
+		return a.start - b.start
+	})
+	return spans
+}
+
+// offsetIn returns where b starts in source, if b is a non-empty slice of it.
+func offsetIn(source, b []byte) (int, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	// A slice of source has as much capacity left as source has after its start
+	offset := cap(source) - cap(b)
+	if offset < 0 || offset+len(b) > len(source) || &source[offset] != &b[0] {
+		return 0, false
+	}
+	return offset, true
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCorrectLinkURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		fixed string
+		ok    bool
+	}{
+		{"api.md", "api.md", false},
+		{"api.md.", "api.md", true},
+		{"./api.md ", "./api.md", true},
+		{" api.md", "api.md", true},
+		{"api.md,#usage", "api.md#usage", true},
+		{"api.md?x=1", "api.md?x=1", false},
+		{"../", "../", false},
+		{"..", "..", false},
+	}
+	for _, tt := range tests {
+		fixed, ok := correctLinkURL(tt.url)
+		if fixed != tt.fixed || ok != tt.ok {
+			t.Errorf("correctLinkURL(%q) = %q, %v; want %q, %v", tt.url, fixed, ok, tt.fixed, tt.ok)
+		}
+	}
+}
+
+func TestLinkTypos(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "index.md")
+	source := "# Home\n\nSee [API](api.md.), [missing](gone.md.), and [the API][ref].\n\n[ref]: api.md;\n\n    Not a link: (api.md.)\n"
+	if err := os.WriteFile(root, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "api.md"), []byte("# API\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	traversal := NewFileTraversal(root, dir)
+	files, err := traversal.Traverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("Traverse() = %v, want the root and api.md", files)
+	}
+
+	if err := FixLinkTypos(traversal.LinkTypos()); err != nil {
+		t.Fatal(err)
+	}
+	fixed, err := os.ReadFile(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Home\n\nSee [API](api.md), [missing](gone.md.), and [the API][ref].\n\n[ref]: api.md\n\n    Not a link: (api.md.)\n"
+	if string(fixed) != want {
+		t.Errorf("fixed source = %q, want %q", fixed, want)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rules --lint checks in the sources rather than the generated output, for
+// redundant links that are easier to trim before files are combined.
+const (
+	LintDuplicateLink     = "duplicate-link"      // A file links to the same target too many times
+	LintDivergentLinkText = "divergent-link-text" // A file links to the same target with different texts
+	LintForwardReference  = "forward-reference"   // A link jumps far ahead in the combined document
+	LintBackReferences    = "back-references"     // A file mostly links back to earlier sections
+	LintHeadingOrder      = "heading-order"       // A heading skips levels in the combined document
+)
+
+// maxLinksPerTarget is how many times a file may link to the same target
+// before duplicate-link reports it.
+const maxLinksPerTarget = 2
+
+// maxForwardSections is how many sections a link may skip on its way to a later
+// one before forward-reference reports it; readers of the combined document
+// meet a linked section soon after the link unless the order fights it.
+const maxForwardSections = 2
+
+// maxBackReferences is how many earlier sections a file may link to before
+// back-references reports it, if they are also most of the sections it links
+// to. Such a file builds on what comes before it, and often reads better next
+// to the sections it leans on.
+const maxBackReferences = 3
+
+// LintLinks reports the files that link to one target, such as a section of
+// the combined document or an external URL, more than maxLinksPerTarget times,
+// and the links that point where an earlier link of the same file does under
+// a different text. Targets are compared as rewritten, so links to a file and
+// to its section heading count as one. Diagnostics are in traversal order.
+func (fp *FileProcessor) LintLinks() []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, section := range fp.Document().Sections {
+		counts := make(map[string]int)
+		lines := make(map[string][]string)
+		texts := make(map[string]DocumentLink)
+		for _, link := range section.Links {
+			target := link.Destination
+			if target == "" || link.Text == "" {
+				continue
+			}
+
+			counts[target]++
+			if line := fmt.Sprint(link.Line); len(lines[target]) == 0 || lines[target][len(lines[target])-1] != line {
+				lines[target] = append(lines[target], line)
+			}
+			if counts[target] == maxLinksPerTarget+1 {
+				where := "lines " + strings.Join(lines[target], ", ")
+				if len(lines[target]) == 1 {
+					where = "all on line " + lines[target][0]
+				}
+				diagnostics = append(diagnostics, Diagnostic{
+					Rule:    LintDuplicateLink,
+					File:    section.File,
+					Line:    link.Line,
+					Column:  link.Column,
+					Message: fmt.Sprintf("%d links to %q in this file (%s)", counts[target], target, where),
+				})
+			}
+
+			first, seen := texts[target]
+			if !seen {
+				texts[target] = link
+			} else if !strings.EqualFold(strings.TrimSpace(first.Text), strings.TrimSpace(link.Text)) {
+				diagnostics = append(diagnostics, Diagnostic{
+					Rule:    LintDivergentLinkText,
+					File:    section.File,
+					Line:    link.Line,
+					Column:  link.Column,
+					Message: fmt.Sprintf("link %q points at %q, like %q on line %d", link.Text, target, first.Text, first.Line),
+				})
+			}
+		}
+	}
+	return diagnostics
+}
+
+// LintOrdering reports the links that skip the order of the combined document:
+// each link to a section more than maxForwardSections sections later, once per
+// target, and each file that links back to more than maxBackReferences earlier
+// sections, if they are most of the sections it links to. Links are resolved as
+// they are rewritten, so links to a file --prune-empty left out count as links
+// to the section they land on. Diagnostics are in traversal order.
+func (fp *FileProcessor) LintOrdering() []Diagnostic {
+	sections := fp.Document().Sections
+	position := make(map[string]int)
+	for i, section := range sections {
+		position[section.File] = i
+	}
+
+	var diagnostics []Diagnostic
+	for i, section := range sections {
+		seen := make(map[int]bool)
+		var back []int
+		var firstBack DocumentLink
+		for _, link := range section.Links {
+			if !link.Resolved || link.Target == "" {
+				continue
+			}
+			target, _, _ := fp.retarget(link.Target, link.URL)
+			j, ok := position[target]
+			if !ok || j == i || seen[j] {
+				continue
+			}
+			seen[j] = true
+
+			if j-i > maxForwardSections+1 {
+				diagnostics = append(diagnostics, Diagnostic{
+					Rule:    LintForwardReference,
+					File:    section.File,
+					Line:    link.Line,
+					Column:  link.Column,
+					Message: fmt.Sprintf("link to %q skips %d sections ahead of it in the output", sections[j].Path, j-i-1),
+				})
+			}
+			if j < i {
+				if len(back) == 0 {
+					firstBack = link
+				}
+				back = append(back, j)
+			}
+		}
+
+		if len(back) > maxBackReferences && 2*len(back) > len(seen) {
+			paths := make([]string, len(back))
+			for k, j := range back {
+				paths[k] = sections[j].Path
+			}
+			diagnostics = append(diagnostics, Diagnostic{
+				Rule:    LintBackReferences,
+				File:    section.File,
+				Line:    firstBack.Line,
+				Column:  firstBack.Column,
+				Message: fmt.Sprintf("%d of the %d sections linked to come earlier in the output (%s)", len(back), len(seen), strings.Join(paths, ", ")),
+			})
+		}
+	}
+	return diagnostics
+}
+
+// LintHeadingOrder reports the headings that are more than one level deeper
+// than the heading before them in the combined document, such as an H4 right
+// after an H1, since screen reader users navigating by heading level lose their
+// place at the skipped levels. Levels are compared after every adjustment, with
+// synthetic section headings and the appendix heading counted in, and headings
+// --flatten-below turns into paragraphs left out. Unlike MD001, which reports
+// lines of the output, positions are in the source files, where the fix goes.
+// Diagnostics are in traversal order.
+func (fp *FileProcessor) LintHeadingOrder() []Diagnostic {
+	var diagnostics []Diagnostic
+	previous := 0
+	var check func(section *Section, headings []*Heading)
+	check = func(section *Section, headings []*Heading) {
+		for _, heading := range headings {
+			if !heading.Flattened {
+				if previous > 0 && heading.Level > previous+1 {
+					diagnostics = append(diagnostics, Diagnostic{
+						Rule:    LintHeadingOrder,
+						File:    section.File,
+						Line:    heading.Line,
+						Message: fmt.Sprintf("heading %q is level %d in the output, after level %d", heading.Text, heading.Level, previous),
+					})
+				}
+				previous = heading.Level
+			}
+			check(section, heading.Children)
+		}
+	}
+
+	inAppendix := false
+	for _, section := range fp.Document().Sections {
+		if fp.appendix[section.File] && !inAppendix {
+			inAppendix = true
+			previous = 1
+		}
+		if section.Synthetic {
+			previous = 1 + fp.nesting(section.File)
+		}
+		check(section, section.Headings)
+	}
+	return diagnostics
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileProcessor_LintOrdering(t *testing.T) {
+	dir := t.TempDir()
+	sources := []struct{ name, content string }{
+		{"a.md", "# A\n\nSee [b](b.md), [c](c.md), and [f](f.md), then [f again](f.md#top).\n"},
+		{"b.md", "# B\n"},
+		{"c.md", "# C\n"},
+		{"d.md", "# D\n"},
+		{"e.md", "# E\n\nSee [f](f.md).\n"},
+		{"f.md", "# F\n\nBuilds on [a](a.md), [b](b.md), [c](c.md), [d](d.md), and [itself](#f).\n"},
+	}
+	var files []string
+	for _, source := range sources {
+		path := filepath.Join(dir, source.name)
+		if err := os.WriteFile(path, []byte(source.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+
+	diagnostics := NewFileProcessor(dir, files, Options{}).LintOrdering()
+	want := []struct {
+		rule, file string
+		line       int
+	}{
+		{LintForwardReference, "a.md", 3},
+		{LintBackReferences, "f.md", 3},
+	}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("LintOrdering() = %+v, want %d diagnostics", diagnostics, len(want))
+	}
+	for i, w := range want {
+		d := diagnostics[i]
+		if d.Rule != w.rule || filepath.Base(d.File) != w.file || d.Line != w.line {
+			t.Errorf("diagnostic %d = %+v, want %s in %s on line %d", i, d, w.rule, w.file, w.line)
+		}
+	}
+	if got := diagnostics[0].Message; got != `link to "f.md" skips 4 sections ahead of it in the output` {
+		t.Errorf("forward-reference message = %q", got)
+	}
+}
+
+func TestFileProcessor_LintHeadingOrder(t *testing.T) {
+	dir := t.TempDir()
+	sources := []struct{ name, content string }{
+		{"a.md", "# A\n\n#### Deep\n\n## Fine\n"},
+		{"b.md", "Intro.\n\n### Notes\n"},
+		{"c.md", "# C\n\n## Setup\n\n### Steps\n"},
+	}
+	var files []string
+	for _, source := range sources {
+		path := filepath.Join(dir, source.name)
+		if err := os.WriteFile(path, []byte(source.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+
+	diagnostics := NewFileProcessor(dir, files, Options{}).LintHeadingOrder()
+	want := []struct {
+		file string
+		line int
+	}{
+		{"a.md", 3},
+		{"b.md", 3},
+	}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("LintHeadingOrder() = %+v, want %d diagnostics", diagnostics, len(want))
+	}
+	for i, w := range want {
+		d := diagnostics[i]
+		if d.Rule != LintHeadingOrder || filepath.Base(d.File) != w.file || d.Line != w.line {
+			t.Errorf("diagnostic %d = %+v, want %s in %s on line %d", i, d, LintHeadingOrder, w.file, w.line)
+		}
+	}
+	if got := diagnostics[1].Message; got != `heading "Notes" is level 3 in the output, after level 1` {
+		t.Errorf("heading-order message = %q", got)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Rules checked by --lint, a built-in subset of markdownlint named after the
+// markdownlint rules they mirror. MD025 (single top-level heading) is left out on
+// purpose: every file section in the combined document starts with an H1.
+const (
+	LintHeadingIncrement = "MD001/heading-increment"
+	LintTrailingSpaces   = "MD009/no-trailing-spaces"
+	LintHardTabs         = "MD010/no-hard-tabs"
+	LintMultipleBlanks   = "MD012/no-multiple-blanks"
+	LintDuplicateHeading = "MD024/no-duplicate-heading"
+	LintEmptyLinks       = "MD042/no-empty-links"
+	LintTrailingNewline  = "MD047/single-trailing-newline"
+	LintLinkFragments    = "MD051/link-fragments"
+)
+
+// LintMarkdown checks generated markdown against the built-in lint rules and
+// returns the violations ordered by line, generating heading IDs with ids. The
+// File of each diagnostic is left empty for the caller to fill in.
+func LintMarkdown(source []byte, md goldmark.Markdown, ids parser.IDs) []Diagnostic {
+	doc := md.Parser().Parse(text.NewReader(source), parser.WithContext(parser.NewContext(parser.WithIDs(ids))))
+
+	var diagnostics []Diagnostic
+	report := func(rule string, line, column int, format string, args ...any) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Rule:    rule,
+			Line:    line,
+			Column:  column,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	codeLines := make(map[int]bool)
+	anchors := make(map[string]bool)
+	headingTexts := make(map[string]int)
+	var links []*ast.Link
+	previousLevel := 0
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node := n.(type) {
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			// Include the fence lines, which aren't part of the block's content
+			first, _ := sourcePosition(source, nodeOffset(node))
+			last := first + node.Lines().Len() - 1
+			if _, ok := node.(*ast.FencedCodeBlock); ok {
+				first, last = first-1, last+1
+			}
+			for line := first; line <= last; line++ {
+				codeLines[line] = true
+			}
+			return ast.WalkSkipChildren, nil
+
+		case *ast.Heading:
+			line, _ := sourcePosition(source, nodeOffset(node))
+			if previousLevel > 0 && node.Level > previousLevel+1 {
+				report(LintHeadingIncrement, line, 0, "heading level %d follows level %d", node.Level, previousLevel)
+			}
+			previousLevel = node.Level
+
+			if id, ok := node.AttributeString("id"); ok {
+				if idBytes, ok := id.([]byte); ok {
+					anchors[string(idBytes)] = true
+				}
+			}
+
+			title := extractTextFromNode(node, source)
+			if firstLine, seen := headingTexts[title]; seen {
+				report(LintDuplicateHeading, line, 0, "heading %q duplicates the one on line %d", title, firstLine)
+			} else {
+				headingTexts[title] = line
+			}
+
+		case *ast.RawHTML:
+			addHTMLAnchors(anchors, segmentsValue(node.Segments, source))
+
+		case *ast.HTMLBlock:
+			addHTMLAnchors(anchors, htmlBlockSource(node, source))
+
+		case *ast.Link:
+			links = append(links, node)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, link := range links {
+		line, column := sourcePosition(source, nodeOffset(link))
+		destination := string(link.Destination)
+		if destination == "" || destination == "#" {
+			report(LintEmptyLinks, line, column, "link %q has no destination", extractTextFromNode(link, source))
+		} else if fragment, ok := strings.CutPrefix(destination, "#"); ok && !anchors[fragment] {
+			report(LintLinkFragments, line, column, "link fragment %q matches no heading or anchor", destination)
+		}
+	}
+
+	lines := bytes.Split(source, []byte{'\n'})
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1] // Text after the final newline
+	}
+	blankRun := 0
+	for i, content := range lines {
+		line := i + 1
+		if codeLines[line] {
+			blankRun = 0
+			continue
+		}
+
+		if trimmed := bytes.TrimRight(content, " \t"); len(trimmed) < len(content) {
+			report(LintTrailingSpaces, line, len(trimmed)+1, "trailing whitespace")
+		}
+		if column := bytes.IndexByte(content, '\t'); column >= 0 {
+			report(LintHardTabs, line, column+1, "hard tab")
+		}
+
+		if len(bytes.TrimSpace(content)) == 0 {
+			blankRun++
+			if blankRun == 2 {
+				report(LintMultipleBlanks, line, 0, "multiple consecutive blank lines")
+			}
+		} else {
+			blankRun = 0
+		}
+	}
+
+	if len(source) > 0 && (!bytes.HasSuffix(source, []byte{'\n'}) || bytes.HasSuffix(source, []byte("\n\n"))) {
+		report(LintTrailingNewline, len(lines), 0, "output should end with a single newline")
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Line < diagnostics[j].Line
+	})
+	return diagnostics
+}
+
+// addHTMLAnchors records the id attributes found in raw HTML as link targets.
+func addHTMLAnchors(anchors map[string]bool, html []byte) {
+	for _, id := range htmlIDs(html) {
+		anchors[id] = true
+	}
+}
@@ -1,11 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"gopkg.in/yaml.v2"
 )
 
 func main() {
@@ -13,20 +28,144 @@ func main() {
 		outputFile  = flag.String("output", "/dev/stdout", "Output file to write")
 		outputShort = flag.String("o", "/dev/stdout", "Output file to write (shorthand)")
 		scopeDir    = flag.String("scope", "", "Directory containing all files eligible for concatenation")
+		target      = flag.String("target", "", "Apply the options of this target from the "+ConfigFileName+" for <root> (e.g. web, pdf, llm); flags given here override them")
+		noConfig    = flag.Bool("no-config", false, "Ignore config files, including the one $"+ConfigEnvVar+" names")
+		backlinks   = flag.Bool("backlinks", false, "Append a \"Referenced by\" list to each file's section")
+		navLinks    = flag.Bool("nav-links", false, "Append Previous/Next links to the adjacent sections at the end of each file's section")
+		linkOrder   = flag.String("link-order", LinkOrderLink, "Order in which each file's links are followed: link (as they appear), alpha, weight (front matter weight), or readme (by directory, README or index first); a file's link_order front matter overrides it")
+		exclude     = flag.String("exclude", "", "Comma-separated path patterns within the scope of files to leave out (e.g. drafts/*,*.draft.md)")
+		only        = flag.String("only", "", "Comma-separated directories within the scope to restrict traversal to (e.g. docs/,guides/)")
+		fmParse     = flag.Bool("front-matter", false, "Read each file's YAML front matter, leaving it out of the output; implied by --tags, --audience, --link-order weight, --front-matter-base, and --root-title")
+		tags        = flag.String("tags", "", "Comma-separated front matter tags; only files carrying one of them are included")
+		audience    = flag.String("audience", "", "Skip files whose front matter audience differs (e.g. internal, public)")
+		inputFlavor = flag.String("input-flavor", FlavorGFM, "Markdown dialect of the sources: gfm, commonmark, or mkdocs")
+		preamble    = flag.String("title-preamble", TitlePreambleAny, "What may come before a file's H1 for it to open the file's section: any (anything but other headings), comments (only HTML comments), or none")
+		footnotes   = flag.String("footnotes", FootnotesInline, "Footnote rendering: inline (in parentheses) or endnotes (a Notes section at the end)")
+		headingCase = flag.String("heading-case", HeadingCasePreserve, "Casing of heading text: preserve, title, or sentence")
+		headingAttr = flag.Bool("heading-attributes", false, "Parse {#id .class key=value} attribute lists after heading text and keep them in the output, with IDs made unique")
+		acronyms    = flag.String("heading-acronyms", "", "Comma-separated words --heading-case writes exactly as listed (e.g. API,macOS)")
+		abbrevs     = flag.Bool("abbreviations", false, "Merge *[ABBR]: definitions from all files into one block at the end of the output")
+		glossFile   = flag.String("glossary", "", "With --format html, markdown file of terms, as headings, and their definitions, the paragraph after each, shown as <abbr> hover tooltips where the terms appear")
+		bibFile     = flag.String("bibliography", "", "BibTeX (.bib) or CSL JSON (.json) file resolving [@key] citations, listed in a References section")
+		emojiMode   = flag.String("emoji", "", "Render :shortcode: emoji as unicode, shortcode, or strip (default: untouched)")
+		degrade     = flag.Bool("degrade-gracefully", false, "Emit a placeholder section with the raw source for files that fail to process")
+		check       = flag.Bool("check", false, "Report broken links, bad anchors, and orphaned files instead of concatenating")
+		checkFormat = flag.String("check-format", "text", "Format of --check diagnostics: text or sarif")
+		checkLinks  = flag.Bool("check-links", false, "Report internal links to files that don't exist, which traversal skips, on stderr while building")
+		strict      = flag.Bool("strict", false, "Fail the build, without writing output, if --check-links finds broken links")
+		dryRun      = flag.Bool("dry-run", false, "Print the files that would be concatenated, in order, with how many links from the root each is and which file links to it, instead of concatenating")
+		htmlTables  = flag.Bool("convert-html-tables", false, "Convert simple raw HTML tables to GFM tables")
+		normalizeWS = flag.Bool("normalize-whitespace", false, "Strip trailing whitespace, limit blank line runs, and end the output with exactly one newline")
+		maxBlank    = flag.Int("max-blank-lines", 2, "Longest run of blank lines kept by --normalize-whitespace")
+		fmBase      = flag.Bool("front-matter-base", false, "Resolve a file's relative links against the directory its front matter base: names, or the one its slug: publishes it as")
+		schemes     = flag.String("external-schemes", "", "Comma-separated URL schemes of links to leave alone as external, besides http, https, mailto, tel, and sms (e.g. slack,zoommtg)")
+		stripLinks  = flag.Bool("strip-scheme-links", false, "Replace mailto:, tel:, sms:, and --external-schemes links by their text, for output meant for paper or LLMs")
+		bareFrags   = flag.Bool("resolve-bare-fragments", false, "Point fragment-only links (#setup) that match nothing in their own file at a matching heading of another file, warning when several match")
+		keepQuery   = flag.Bool("keep-query", false, "Keep query strings (e.g. ?highlight=term) on rewritten internal links")
+		fix         = flag.Bool("fix", false, "Correct links with stray whitespace or trailing punctuation (e.g. api.md.) in the source files")
+		omitNotes   = flag.Bool("omission-notes", false, "Follow links to markdown files left out of the output with a note like \"(section omitted: drafts/wip.md)\"")
+		secClasses  = flag.Bool("section-classes", false, "With --format html, wrap each file's section in a <div> with classes derived from its path and front matter tags")
+		dualLinks   = flag.Bool("dual-links", false, "Follow each rewritten internal link with a superscript link to the original file")
+		anchorStyle = flag.String("section-anchors", SectionAnchorsTitle, "Anchor links to file sections point at: title (the section heading's ID), filename, or hash")
+		elemAnchors = flag.Bool("element-anchors", false, "Write an HTML anchor before each table, code block, or image that links name by position, like #table-2 or #code-1")
+		slugStyle   = flag.String("slug-style", SlugStyleGoldmark, "Heading ID style links are rewritten for: goldmark (ASCII only) or github (Unicode letters kept)")
+		slugNorm    = flag.String("slug-normalize", SlugNormalizeNone, "Unicode normalization of heading text before computing IDs: none, nfc, nfkd, or ascii (transliterate accented letters)")
+		toc         = flag.Bool("toc", false, "Start the output with a table of contents linking to each file's section")
+		orphans     = flag.Bool("append-orphans", false, "Append markdown files in the scope that the root never reaches, under an appendix heading")
+		appendix    = flag.String("appendix-title", "Appendix", "Title of the heading --append-orphans groups orphaned files under")
+		pruneEmpty  = flag.Bool("prune-empty", false, "Leave out files with nothing to show, such as only comments or footnote definitions, sending links to them to the file that links to them first")
+		rootTitle   = flag.Bool("root-title", false, "Make the root file's H1 the document title, written as title: front matter, and move its other headings up a level")
+		noRoot      = flag.Bool("no-root-section", false, "Start the output with the root file's content instead of giving it a synthetic section header")
+		outline     = flag.Bool("headings-only", false, "Write only each file's headings and first paragraph, as a compact digest")
+		flatten     = flag.Int("flatten-below", 0, "Turn headings deeper than this level into bold paragraphs (0 to keep all headings)")
+		nestDepth   = flag.Bool("nest-by-depth", false, "Move each file's section one heading level down per link from the root, so linked files nest under the sections that link to them")
+		promote     = flag.Bool("promote-headings", false, "Shift the headings of files given a synthetic header so their highest level is 2")
+		headerPaths = flag.String("header-paths", HeaderPathsBase, "Path shown in synthetic headers: base (the file name) or relative (the path from the scope directory, with forward slashes)")
+		collapseDup = flag.Bool("collapse-duplicate-titles", false, "Drop a file's opening heading when it repeats the file name of its synthetic header")
+		tocDepth    = flag.Int("toc-collapse-depth", 0, "List only files up to this many links from the root in the --toc, moving deeper files to per-section contents (0 for no limit)")
+		redirects   = flag.String("redirects", "", "Also write a redirects file mapping per-file URLs to sections: netlify, nginx, or json")
+		redirFile   = flag.String("redirects-file", "", "Path of the redirects file (default: _redirects, redirects.conf, or redirects.json)")
+		redirTarget = flag.String("redirects-target", "", "URL path of the combined document (default: / plus the output file name)")
+		fileHeader  = flag.String("file-header", "", "text/template file whose output is written before each included file's section")
+		fileFooter  = flag.String("file-footer", "", "text/template file whose output is written after each included file's section")
+		selfCheck   = flag.String("self-check", SelfCheckOff, "Verify that the output's IDs are unique and rewritten links find them: warn, error, or off")
+		lint        = flag.Bool("lint", false, "Check the generated output against built-in markdownlint rules")
+		explode     = flag.String("explode", "", "Also write each file's section as its own markdown file under this directory, with links between them")
+		chunks      = flag.String("chunks", "", "Also write the output split into chunk files of --chunk-size sections under this directory, each with its own TOC, plus an index.md listing them")
+		chunkSize   = flag.Int("chunk-size", 10, "Most sections in each --chunks file")
+		format      = flag.String("format", FormatMarkdown, "Output format: markdown, or html for a standalone HTML page with working anchors")
+		figures     = flag.Bool("figures", false, "With --format html, render images with a title that stand alone in their paragraph as <figure> elements captioned \"Figure N.\" and the title")
+		diagramCmd  = flag.String("diagram-command", "", "Command, or http(s) URL to POST to, that renders mermaid and plantuml blocks to SVG for --format html; {lang} is replaced by the language")
+		assetsDir   = flag.String("assets-dir", "", "Copy the images the output references into this directory, relative to the output file's, and point the output at the copies")
+		archive     = flag.String("archive", "", "Write the output, its referenced assets, and a run report into this .zip, .tar, or .tar.gz file instead")
+		anchorMap   = flag.String("anchor-map", "", "Write a JSON map of the output's anchors and the headings they lead to, for anchors-diff, to this path")
+		reportFile  = flag.String("report", "", "Write a JSON run report (file statuses and referenced assets) to this path")
+		maxBytes    = flag.Int("max-output-bytes", 0, "Most bytes the output may have (0 for no limit); see --overflow")
+		overflow    = flag.String("overflow", OverflowError, "What happens when the output would exceed --max-output-bytes: error (write nothing and fail), truncate (leave out the sections that don't fit), or priority (include the files closest to the root that fit, listing the rest)")
+		jsonOutput  = flag.Bool("json", false, "Write stats, --dry-run, or anchors-diff results as JSON instead of text")
+		fileTimeout = flag.Duration("file-timeout", 0, "Longest time processing one file may take (e.g. 30s) before it gets a placeholder section instead (0 for no limit)")
+		jobs        = flag.Int("jobs", runtime.NumCPU(), "Number of files to process in parallel")
+		update      = flag.Bool("update", false, "Make selftest rewrite expected outputs instead of comparing against them")
 	)
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] <root>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [build|stats|graph|hash|selftest] [options] <root>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s anchors-diff [options] <old-anchor-map.json> <root>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s config validate [options] <root>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s config schema\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\nConcatenates Markdown files intelligently.\n\n")
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  build         Concatenate the files reachable from <root> (default)\n")
+		fmt.Fprintf(os.Stderr, "  stats         Report link graph metrics for the files reachable from <root>\n")
+		fmt.Fprintf(os.Stderr, "  graph         Write the link graph of the files reachable from <root> as JSON\n")
+		fmt.Fprintf(os.Stderr, "  hash          Print a SHA-256 digest of the output build would write, without writing anything\n")
+		fmt.Fprintf(os.Stderr, "  selftest      Build every fixture directory under <root> and compare with its expected.md\n")
+		fmt.Fprintf(os.Stderr, "  anchors-diff  Report the anchors of an --anchor-map from an earlier build that this build removes or renames\n")
+		fmt.Fprintf(os.Stderr, "  config        validate: check the config file next to <root> and print the options a build would use;\n")
+		fmt.Fprintf(os.Stderr, "                schema: print a JSON Schema for config files\n\n")
 		fmt.Fprintf(os.Stderr, "Arguments:\n")
-		fmt.Fprintf(os.Stderr, "  <root>    Root markdown file to start from\n\n")
+		fmt.Fprintf(os.Stderr, "  <root>        Root markdown file to start from, possibly inside an archive like docs.zip!/index.md\n")
+		fmt.Fprintf(os.Stderr, "                or - to read it from standard input, with links resolved against --scope\n")
+		fmt.Fprintf(os.Stderr, "                (selftest: the fixtures directory)\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 	}
 
-	flag.Parse()
+	// "build" is the default command and may be given explicitly
+	command := "build"
+	cmdArgs := os.Args[1:]
+	if len(cmdArgs) > 0 && (cmdArgs[0] == "build" || cmdArgs[0] == "stats" || cmdArgs[0] == "graph" || cmdArgs[0] == "hash" || cmdArgs[0] == "selftest" || cmdArgs[0] == "anchors-diff") {
+		command = cmdArgs[0]
+		cmdArgs = cmdArgs[1:]
+	}
+	var configCommand string
+	if len(cmdArgs) > 0 && cmdArgs[0] == "config" {
+		command = "config"
+		if len(cmdArgs) < 2 || (cmdArgs[1] != "validate" && cmdArgs[1] != "schema") {
+			fmt.Fprintf(os.Stderr, "Error: config needs a subcommand: validate or schema\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		configCommand = cmdArgs[1]
+		cmdArgs = cmdArgs[2:]
+	}
+	flag.CommandLine.Parse(cmdArgs)
+
+	if configCommand == "schema" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(ConfigSchema(flag.CommandLine)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	args := flag.Args()
+	var anchorsBase string
+	if command == "anchors-diff" && len(args) == 2 {
+		anchorsBase, args = args[0], args[1:]
+	}
 	if len(args) != 1 {
 		fmt.Fprintf(os.Stderr, "Error: exactly one root file must be specified\n")
 		flag.Usage()
@@ -35,23 +174,459 @@ func main() {
 
 	rootFile := args[0]
 
+	var config *Config
+	var configFile string
+	var err error
+	if *noConfig {
+		if *target != "" {
+			fmt.Fprintf(os.Stderr, "Error: --target and --no-config can't be used together\n")
+			os.Exit(1)
+		}
+	} else if config, configFile, err = loadRootConfig(rootFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	explicit := explicitFlags()
+	if err := applyConfig(config, rootFile, *target, explicit); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var order []OrderRule
+	if config != nil {
+		order = config.Order
+	}
+
 	output := *outputFile
 	if *outputShort != "/dev/stdout" {
 		output = *outputShort
 	}
 
-	if err := run(rootFile, output, *scopeDir); err != nil {
+	opts := Options{
+		Command:     command,
+		Output:      output,
+		Scope:       *scopeDir,
+		Backlinks:   *backlinks,
+		NavLinks:    *navLinks,
+		LinkOrder:   *linkOrder,
+		Only:        splitList(*only),
+		Exclude:     splitList(*exclude),
+		Schemes:     schemeList(*schemes),
+		FrontMatter: *fmParse,
+		Tags:        splitList(*tags),
+		Audience:    *audience,
+		InputFlavor: *inputFlavor,
+		Emoji:       *emojiMode,
+		Footnotes:   *footnotes,
+		HeadingCase: *headingCase,
+		Acronyms:    splitList(*acronyms),
+
+		TitlePreamble:       *preamble,
+		HeadingAttributes:   *headingAttr,
+		FileHeader:          *fileHeader,
+		FileFooter:          *fileFooter,
+		Abbreviations:       *abbrevs,
+		Bibliography:        *bibFile,
+		Glossary:            *glossFile,
+		DegradeGracefully:   *degrade,
+		Check:               *check,
+		CheckFormat:         *checkFormat,
+		DryRun:              *dryRun,
+		CheckLinks:          *checkLinks,
+		Strict:              *strict,
+		SectionAnchors:      *anchorStyle,
+		ElementAnchors:      *elemAnchors,
+		SlugStyle:           *slugStyle,
+		SlugNormalize:       *slugNorm,
+		TOC:                 *toc,
+		TOCCollapseDepth:    *tocDepth,
+		CollapseTitles:      *collapseDup,
+		HeaderPaths:         *headerPaths,
+		AppendOrphans:       *orphans,
+		AppendixTitle:       *appendix,
+		RootTitle:           *rootTitle,
+		NoRootSection:       *noRoot,
+		PruneEmpty:          *pruneEmpty,
+		HeadingsOnly:        *outline,
+		FlattenBelow:        *flatten,
+		NestByDepth:         *nestDepth,
+		PromoteHeadings:     *promote,
+		DualLinks:           *dualLinks,
+		SectionClasses:      *secClasses,
+		OmissionNotes:       *omitNotes,
+		StripSchemeLinks:    *stripLinks,
+		BareFragments:       *bareFrags,
+		KeepQuery:           *keepQuery,
+		FrontMatterBase:     *fmBase,
+		Fix:                 *fix,
+		NormalizeWhitespace: *normalizeWS,
+		MaxBlankLines:       *maxBlank,
+		ConvertHTMLTables:   *htmlTables,
+		JSON:                *jsonOutput,
+		Report:              *reportFile,
+		AnchorMap:           *anchorMap,
+		AnchorsDiffBase:     anchorsBase,
+		Explode:             *explode,
+		Chunks:              *chunks,
+		ChunkSize:           *chunkSize,
+		Format:              *format,
+		DiagramCommand:      *diagramCmd,
+		Figures:             *figures,
+		Archive:             *archive,
+		AssetsDir:           *assetsDir,
+		Lint:                *lint,
+		SelfCheck:           *selfCheck,
+		Redirects:           *redirects,
+		RedirectsFile:       *redirFile,
+		RedirectsTarget:     *redirTarget,
+		MaxOutputBytes:      *maxBytes,
+		Overflow:            *overflow,
+		Jobs:                *jobs,
+		FileTimeout:         *fileTimeout,
+		Order:               order,
+		Update:              *update,
+	}
+
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if command == "config" {
+		// Options are only checked as far as Validate goes; files they
+		// name, like templates, are read by builds
+		if configFile == "" {
+			configFile = "none"
+		}
+		fmt.Printf("Config file: %s\n\n", configFile)
+		err = writeEffectiveOptions(os.Stdout, config, *target, flag.CommandLine, explicit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if command == "selftest" {
+		err = runSelftest(rootFile, opts, os.Stdout)
+	} else {
+		err = run(rootFile, opts)
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func run(rootFile, outputFile, explicitScope string) error {
-	if err := ValidateRootFile(rootFile); err != nil {
+// Options holds the settings that control a single catmd run.
+type Options struct {
+	Command     string   // Subcommand: "build", "stats", "graph", "hash", "selftest", "anchors-diff", or "config"
+	Output      string   // Output file path ("/dev/stdout" writes to standard output)
+	Scope       string   // Explicit scope directory, or empty for the root file's directory
+	Backlinks   bool     // Append a "Referenced by" list under each file's section
+	NavLinks    bool     // Append links to the previous and next sections under each file's section
+	LinkOrder   string   // Order in which each file's links are followed, see the LinkOrder* constants
+	Only        []string // When non-empty, only traverse into these directories of the scope
+	Exclude     []string // Path patterns, relative to the scope, of files to leave out
+	Schemes     []string // URL schemes of external links besides http, https, and defaultExternalSchemes
+	FrontMatter bool     // Read front matter and leave it out of the output, see readsFrontMatter
+	Tags        []string // When non-empty, only include files tagged with one of these
+	Audience    string   // When set, skip files whose front matter names other audiences
+	InputFlavor string   // Markdown dialect of the sources, see the Flavor* constants
+	Emoji       string   // Emoji shortcode rendering mode, empty to leave shortcodes alone
+	Footnotes   string   // Footnote rendering mode, see the Footnotes* constants
+	HeadingCase string   // Casing applied to heading text, see the HeadingCase* constants
+	Acronyms    []string // Words --heading-case writes as listed, e.g. "API" or "macOS"
+
+	FileHeader          string // Template written before each file's section, empty for none
+	FileFooter          string // Template written after each file's section, empty for none
+	TitlePreamble       string // What may precede a file's H1 for it to open its section, see the TitlePreamble* constants
+	HeadingAttributes   bool   // Parse and keep heading attribute lists, see FileProcessor.writeHeadingAttributes
+	Abbreviations       bool   // Merge abbreviation definitions into a block at the end
+	Bibliography        string // BibTeX or CSL JSON file resolving citations, empty to leave them alone
+	Glossary            string // Markdown file defining terms to add hover tooltips for in HTML output, empty for none
+	DegradeGracefully   bool   // Replace files that fail to process with a raw-source placeholder
+	Check               bool   // Report problems in the source tree instead of concatenating
+	CheckFormat         string // Diagnostic format for Check: "text" or "sarif"
+	DryRun              bool   // Print the files that would be concatenated instead of concatenating
+	CheckLinks          bool   // Report internal links to missing files while building
+	Strict              bool   // Make broken links found by CheckLinks fail the run
+	JSON                bool   // Write stats, dry-run, or anchors-diff results as JSON
+	Report              string // Path of the JSON run report, empty for none
+	AnchorMap           string // Path of the JSON anchor map, empty for none
+	AnchorsDiffBase     string // Anchor map of an earlier build that anchors-diff compares with
+	Explode             string // Directory to also write each section to as its own file, empty for none
+	Chunks              string // Directory to also write the output to in chunks, empty for none
+	ChunkSize           int    // Most sections in each chunk
+	Format              string // Output format, see the Format* constants
+	DiagramCommand      string // Command or URL rendering diagrams in HTML output, empty to keep them as code
+	Figures             bool   // Render titled images as numbered figures in HTML output
+	Archive             string // Path of an archive bundling the output, assets, and report
+	AssetsDir           string // Directory images are copied into, relative to the output file's, empty to leave them in place
+	Lint                bool   // Lint the generated output, reporting violations
+	SelfCheck           string // Verification of the output's anchors, see the SelfCheck* constants
+	ConvertHTMLTables   bool   // Replace simple HTML tables with GFM tables
+	NormalizeWhitespace bool   // Apply the output whitespace policy of normalizingWriter
+	MaxBlankLines       int    // Longest blank line run kept when normalizing whitespace
+	DualLinks           bool   // Keep a link to the original file next to each rewritten link
+	SectionClasses      bool   // Wrap sections in a div with per-file classes in HTML output
+	OmissionNotes       bool   // Note the links to markdown files left out of the output
+	StripSchemeLinks    bool   // Replace links with non-web external schemes, like mailto:, by their text
+	BareFragments       bool   // Resolve fragment-only links against other files' headings when their own has none
+	KeepQuery           bool   // Keep query strings on rewritten internal links
+	FrontMatterBase     bool   // Resolve links against front matter base or slug, see FrontMatterBaseResolver
+	Fix                 bool   // Correct link typos in the source files
+	SectionAnchors      string // How links to file sections are anchored, see the SectionAnchors* constants
+	ElementAnchors      bool   // Anchor the elements links name by position, see elementFragments
+	SlugStyle           string // Heading ID style, see the SlugStyle* constants
+	SlugNormalize       string // Normalization of heading text for IDs, see the SlugNormalize* constants
+	TOC                 bool   // Prepend a table of contents, disambiguating duplicate titles
+	TOCCollapseDepth    int    // Deepest traversal depth listed in the TOC, 0 for no limit
+	AppendOrphans       bool   // Append the scope's unreachable markdown files under an appendix heading
+	AppendixTitle       string // Title of the appendix heading
+	RootTitle           bool   // Make the root file's H1 the document title instead of a heading
+	NoRootSection       bool   // Let the root file's content start the output without a synthetic header
+	PruneEmpty          bool   // Leave out files with nothing to show, retargeting links to them
+	HeadingsOnly        bool   // Keep only the headings and first paragraph of each file
+	FlattenBelow        int    // Deepest heading level kept as a heading, 0 for no limit
+	NestByDepth         bool   // Nest each file's section below its traversal parent's, see FileProcessor.NestByDepth
+	PromoteHeadings     bool   // Make level 2 the highest heading level under synthetic headers
+	CollapseTitles      bool   // Drop opening headings that repeat the synthetic header
+	HeaderPaths         string // Path shown in synthetic headers, see the HeaderPaths* constants
+	Redirects           string // Redirects file format, empty to not write one
+	RedirectsFile       string // Where to write redirects, empty for the format's default
+	RedirectsTarget     string // URL path of the combined document for redirects
+	AssetBase           string // Directory asset paths are rewritten relative to, empty for the output file's
+	MaxOutputBytes      int    // Most bytes the output may have, 0 for no limit
+	Overflow            string // What exceeding MaxOutputBytes does, see the Overflow* constants
+	Jobs                int    // Files processed in parallel; output order is unaffected
+	Update              bool   // Rewrite selftest expected outputs
+
+	// Resolver maps link destinations to files, nil to resolve them as relative
+	// paths. It has no flag; programs embedding catmd set it directly.
+	Resolver LinkResolver
+
+	// AnchorStrategy derives the anchors of file sections, nil for the strategy
+	// --section-anchors names. Like Resolver, it has no flag.
+	AnchorStrategy AnchorStrategy
+
+	// Extensions are goldmark extensions added to the parser after the ones
+	// --input-flavor and --emoji select. Nodes of kinds they introduce are
+	// written with NodeRenderers, since the markdown renderer only knows the
+	// standard ones and catmd's.
+	Extensions []goldmark.Extender `json:"-"`
+
+	// NodeRenderers write nodes of the given kinds as markdown, replacing the
+	// built-in renderer for kinds that already have one. Neither field has a
+	// flag.
+	NodeRenderers map[ast.NodeKind]renderer.NodeRendererFunc `json:"-"`
+
+	// Diagrams renders diagram blocks in HTML output, nil for the renderer
+	// --diagram-command names, if any.
+	Diagrams DiagramRenderer
+
+	// Order moves sections after traversal, applied in order; it comes from
+	// the config file rather than a flag.
+	Order []OrderRule
+
+	// FileTimeout limits how long processing one file may take, 0 for no
+	// limit. Files that run out of time get a placeholder section.
+	FileTimeout time.Duration
+
+	// Snapshot holds the source files as traversal read them, nil to read them
+	// from disk. The build sets it after traversal.
+	Snapshot *Snapshot
+}
+
+// Validate reports option values that are not supported.
+func (opts Options) Validate() error {
+	switch opts.InputFlavor {
+	case "", FlavorGFM, FlavorCommonMark, FlavorMkDocs:
+	default:
+		return fmt.Errorf("invalid --input-flavor value %q (want gfm, commonmark, or mkdocs)", opts.InputFlavor)
+	}
+	switch opts.Emoji {
+	case "", EmojiUnicode, EmojiShortcode, EmojiStrip:
+	default:
+		return fmt.Errorf("invalid --emoji value %q (want unicode, shortcode, or strip)", opts.Emoji)
+	}
+	switch opts.HeadingCase {
+	case "", HeadingCasePreserve, HeadingCaseTitle, HeadingCaseSentence:
+	default:
+		return fmt.Errorf("invalid --heading-case value %q (want preserve, title, or sentence)", opts.HeadingCase)
+	}
+	switch opts.SelfCheck {
+	case "", SelfCheckWarn, SelfCheckError, SelfCheckOff:
+	default:
+		return fmt.Errorf("invalid --self-check value %q (want warn, error, or off)", opts.SelfCheck)
+	}
+	switch opts.SectionAnchors {
+	case "", SectionAnchorsTitle, SectionAnchorsFilename, SectionAnchorsHash:
+	default:
+		return fmt.Errorf("invalid --section-anchors value %q (want title, filename, or hash)", opts.SectionAnchors)
+	}
+	switch opts.HeaderPaths {
+	case "", HeaderPathsBase, HeaderPathsRelative:
+	default:
+		return fmt.Errorf("invalid --header-paths value %q (want base or relative)", opts.HeaderPaths)
+	}
+	switch opts.SlugStyle {
+	case "", SlugStyleGoldmark, SlugStyleGitHub:
+	default:
+		return fmt.Errorf("invalid --slug-style value %q (want goldmark or github)", opts.SlugStyle)
+	}
+	switch opts.SlugNormalize {
+	case "", SlugNormalizeNone, SlugNormalizeNFC, SlugNormalizeNFKD, SlugNormalizeASCII:
+	default:
+		return fmt.Errorf("invalid --slug-normalize value %q (want none, nfc, nfkd, or ascii)", opts.SlugNormalize)
+	}
+	switch opts.LinkOrder {
+	case "", LinkOrderLink, LinkOrderAlpha, LinkOrderWeight, LinkOrderReadme:
+	default:
+		return fmt.Errorf("invalid --link-order value %q (want link, alpha, weight, or readme)", opts.LinkOrder)
+	}
+	switch opts.TitlePreamble {
+	case "", TitlePreambleAny, TitlePreambleComments, TitlePreambleNone:
+	default:
+		return fmt.Errorf("invalid --title-preamble value %q (want any, comments, or none)", opts.TitlePreamble)
+	}
+	switch opts.Footnotes {
+	case "", FootnotesInline, FootnotesEndnotes:
+	default:
+		return fmt.Errorf("invalid --footnotes value %q (want inline or endnotes)", opts.Footnotes)
+	}
+	switch opts.CheckFormat {
+	case "", "text", "sarif":
+	default:
+		return fmt.Errorf("invalid --check-format value %q (want text or sarif)", opts.CheckFormat)
+	}
+	if opts.MaxBlankLines < 0 {
+		return fmt.Errorf("invalid --max-blank-lines value %d (must not be negative)", opts.MaxBlankLines)
+	}
+	for _, pattern := range opts.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --exclude pattern %q: %w", pattern, err)
+		}
+	}
+	for _, scheme := range opts.Schemes {
+		if !schemePattern.MatchString(scheme) {
+			return fmt.Errorf("invalid --external-schemes scheme %q (want letters, digits, +, -, or ., starting with a letter)", scheme)
+		}
+	}
+	switch opts.Format {
+	case "", FormatMarkdown, FormatHTML:
+	default:
+		return fmt.Errorf("invalid --format value %q (want markdown or html)", opts.Format)
+	}
+	if opts.Archive != "" {
+		if archiveExtension(opts.Archive) == "" {
+			return fmt.Errorf("invalid --archive file %q (want .zip, .tar, .tar.gz, or .tgz)", opts.Archive)
+		}
+		if opts.Output != "/dev/stdout" {
+			return fmt.Errorf("--archive and --output can't be used together; the output is written into the archive")
+		}
+		if opts.AssetsDir != "" {
+			return fmt.Errorf("--archive and --assets-dir can't be used together; the archive bundles the assets")
+		}
+	}
+	if opts.DryRun && opts.Command != "" && opts.Command != "build" {
+		return fmt.Errorf("--dry-run can't be used with %s", opts.Command)
+	}
+	if opts.Strict && !opts.CheckLinks {
+		return fmt.Errorf("--strict needs --check-links")
+	}
+	if opts.DryRun && opts.Check {
+		return fmt.Errorf("--dry-run and --check can't be used together")
+	}
+	if opts.Fix && opts.Command == "hash" {
+		return fmt.Errorf("--fix can't be used with hash, which writes nothing")
+	}
+	switch opts.Overflow {
+	case "", OverflowError, OverflowTruncate, OverflowPriority:
+	default:
+		return fmt.Errorf("invalid --overflow value %q (want error, truncate, or priority)", opts.Overflow)
+	}
+	if opts.MaxOutputBytes < 0 {
+		return fmt.Errorf("invalid --max-output-bytes value %d (must not be negative)", opts.MaxOutputBytes)
+	}
+	if opts.Chunks != "" && opts.ChunkSize < 1 {
+		return fmt.Errorf("invalid --chunk-size value %d (must be at least 1)", opts.ChunkSize)
+	}
+	if opts.Jobs < 1 {
+		return fmt.Errorf("invalid --jobs value %d (must be at least 1)", opts.Jobs)
+	}
+	if opts.FlattenBelow < 0 {
+		return fmt.Errorf("invalid --flatten-below value %d (must not be negative)", opts.FlattenBelow)
+	}
+	if opts.TOCCollapseDepth < 0 {
+		return fmt.Errorf("invalid --toc-collapse-depth value %d (must not be negative)", opts.TOCCollapseDepth)
+	}
+	if opts.TOCCollapseDepth > 0 && !opts.TOC {
+		return fmt.Errorf("--toc-collapse-depth requires --toc")
+	}
+	if opts.SectionClasses && opts.Format != FormatHTML {
+		return fmt.Errorf("--section-classes requires --format html")
+	}
+	if opts.Glossary != "" && opts.Format != FormatHTML {
+		return fmt.Errorf("--glossary requires --format html")
+	}
+	if _, ok := redirectFiles[opts.Redirects]; opts.Redirects != "" && !ok {
+		return fmt.Errorf("invalid --redirects value %q (want netlify, nginx, or json)", opts.Redirects)
+	}
+	return nil
+}
+
+func run(rootFile string, opts Options) error {
+	outputFile := opts.Output
+
+	// Roots inside archives, like docs.zip!/index.md, are read from a
+	// temporary copy of the archive's files
+	if archive, inner, ok := splitArchiveInput(rootFile); ok {
+		dir, err := unpackArchiveInput(archive)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		rootFile = filepath.Join(dir, filepath.FromSlash(inner))
+		if _, err := os.Stat(rootFile); err != nil {
+			return fmt.Errorf("invalid root file: archive %q has no file %q", archive, inner)
+		}
+
+		if scopeArchive, scopeInner, ok := splitArchiveInput(opts.Scope); ok {
+			if scopeArchive != archive {
+				return fmt.Errorf("--scope %q is in a different archive than the root file", opts.Scope)
+			}
+			opts.Scope = filepath.Join(dir, filepath.FromSlash(scopeInner))
+		}
+		if opts.AssetBase == "" {
+			// Assets are only found inside the archive, so keep them relative
+			// to the root file there
+			opts.AssetBase = filepath.Dir(rootFile)
+		}
+	}
+
+	// A root file of "-" is read from standard input, standing in for
+	// stdin.md at the top of the scope directory, which its links are
+	// resolved against
+	var stdinRoot []byte
+	if rootFile == StdinRoot {
+		if opts.Scope == "" {
+			return fmt.Errorf("reading the root file from standard input needs --scope")
+		}
+		if opts.Fix {
+			return fmt.Errorf("--fix can't be used with a root file read from standard input")
+		}
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read root file from standard input: %w", err)
+		}
+		stdinRoot = content
+		rootFile = filepath.Join(opts.Scope, stdinRootName)
+	} else if err := ValidateRootFile(rootFile); err != nil {
 		return fmt.Errorf("invalid root file: %w", err)
 	}
 
-	scopeDir, err := DetermineScopeDir(rootFile, explicitScope)
+	scopeDir, err := DetermineScopeDir(rootFile, opts.Scope)
 	if err != nil {
 		return fmt.Errorf("failed to determine scope directory: %w", err)
 	}
@@ -62,55 +637,617 @@ func run(rootFile, outputFile, explicitScope string) error {
 	}
 
 	traversal := NewFileTraversal(rootAbs, scopeDir)
+	if stdinRoot != nil {
+		traversal.Snapshot().Add(rootAbs, stdinRoot)
+	}
+	if opts.readsFrontMatter() {
+		traversal.Snapshot().SetFrontMatter(true)
+	}
+	if opts.LinkOrder != "" {
+		traversal.SetLinkOrder(opts.LinkOrder)
+	}
+	if opts.FrontMatterBase {
+		opts.Resolver = NewFrontMatterBaseResolver(opts.Resolver, scopeDir, traversal.Snapshot())
+	}
+	if opts.Resolver != nil {
+		traversal.SetResolver(opts.Resolver)
+	}
+	if len(opts.Only) > 0 {
+		onlyDirs, err := ResolveOnlyDirs(scopeDir, opts.Only)
+		if err != nil {
+			return err
+		}
+		traversal.RestrictTo(onlyDirs)
+	}
+	if len(opts.Exclude) > 0 {
+		traversal.Exclude(opts.Exclude)
+	}
 	orderedFiles, err := traversal.Traverse()
 	if err != nil {
 		return fmt.Errorf("failed to traverse files: %w", err)
 	}
+	opts.Snapshot = traversal.Snapshot()
+
+	if opts.Fix {
+		if err := FixLinkTypos(traversal.LinkTypos()); err != nil {
+			return fmt.Errorf("failed to fix links: %w", err)
+		}
+	}
+
+	if opts.Command == "stats" {
+		return runStats(traversal, orderedFiles, scopeDir, opts)
+	}
+
+	if opts.Command == "graph" {
+		return runGraph(traversal, orderedFiles, scopeDir, opts)
+	}
+
+	if opts.Check {
+		return runCheck(traversal, orderedFiles, scopeDir, opts)
+	}
+
+	if opts.CheckLinks {
+		if err := reportBrokenLinks(orderedFiles, scopeDir, opts); err != nil {
+			return err
+		}
+	}
+
+	var orphans []string
+	if opts.AppendOrphans {
+		if orphans, err = traversal.Orphans(); err != nil {
+			return err
+		}
+		orderedFiles = append(orderedFiles, orphans...)
+	}
+
+	if len(opts.Tags) > 0 {
+		orderedFiles = FilterFiles(orderedFiles, rootAbs, scopeDir, opts.Snapshot, hasAnyTag(opts.Tags))
+	}
+
+	if opts.Audience != "" {
+		orderedFiles = FilterFiles(orderedFiles, rootAbs, scopeDir, opts.Snapshot, matchesAudience(opts.Audience))
+	}
 
 	if len(orderedFiles) == 0 {
 		return fmt.Errorf("no files found to process")
 	}
+	orderedFiles = ReorderSections(orderedFiles, scopeDir, opts.Order)
 
-	var writer io.Writer
-	if outputFile == "/dev/stdout" {
-		writer = os.Stdout
-	} else {
-		f, err := os.Create(outputFile)
-		if err != nil {
-			return fmt.Errorf("failed to create output file %q: %w", outputFile, err)
+	if opts.DryRun {
+		return runDryRun(traversal, orderedFiles, rootAbs, opts)
+	}
+
+	// Sections --overflow priority leaves out, listed at the end
+	var omitted []string
+	traversalIndex := make(map[string]int)
+	for i, file := range orderedFiles {
+		traversalIndex[file] = i
+	}
+	if opts.MaxOutputBytes > 0 && opts.Overflow == OverflowPriority {
+		depth := func(file string) int {
+			if file != rootAbs && traversal.Parent(file) == "" {
+				// Orphans appended by --append-orphans come last
+				return len(orderedFiles)
+			}
+			return traversal.Depth(file)
+		}
+		orderedFiles, omitted = prioritizeSections(orderedFiles, opts.Snapshot, depth, scopeDir, opts.MaxOutputBytes)
+		kept := make(map[string]bool)
+		for _, file := range orderedFiles {
+			kept[file] = true
+		}
+		var keptOrphans []string
+		for _, file := range orphans {
+			if kept[file] {
+				keptOrphans = append(keptOrphans, file)
+			}
+		}
+		orphans = keptOrphans
+	}
+
+	var bibliography map[string]*BibEntry
+	if opts.Bibliography != "" {
+		if bibliography, err = LoadBibliography(opts.Bibliography); err != nil {
+			return err
 		}
-		defer f.Close()
-		writer = f
 	}
 
-	processor := NewFileProcessor(scopeDir, orderedFiles)
+	var glossary *Glossary
+	if opts.Glossary != "" {
+		if glossary, err = LoadGlossary(opts.Glossary); err != nil {
+			return err
+		}
+	}
 
-	filesWritten := 0
-	for _, filename := range orderedFiles {
-		content, err := os.ReadFile(filename)
-		if err != nil {
-			// Log warning to stderr but continue processing
-			fmt.Fprintf(os.Stderr, "Warning: failed to read file %q: %v\n", filename, err)
+	var headerTemplate, footerTemplate *template.Template
+	if opts.FileHeader != "" {
+		if headerTemplate, err = LoadFileTemplate(opts.FileHeader); err != nil {
+			return err
+		}
+	}
+	if opts.FileFooter != "" {
+		if footerTemplate, err = LoadFileTemplate(opts.FileFooter); err != nil {
+			return err
+		}
+	}
+
+	if opts.DiagramCommand != "" && opts.Diagrams == nil {
+		opts.Diagrams = CommandDiagrams{Command: opts.DiagramCommand, Timeout: diagramTimeout}
+	}
+
+	// Sections --overflow truncate or priority turns away only once they turn
+	// out not to fit may be linked to from what was written before them, so
+	// the document is then assembled again without them, and links to them go
+	// to their files like links to any other file that isn't included
+	var (
+		digest    hash.Hash
+		pending   bytes.Buffer
+		generated bytes.Buffer
+		page      *htmlWriter
+		budget    *outputBudget
+		processor *FileProcessor
+		report    *Report
+		included  []string
+	)
+	// --explode and --redirects still account for the files --prune-empty
+	// leaves out, sending links and redirects for them elsewhere
+	traversed := orderedFiles
+	dropped := make(map[string]bool)
+	for {
+		// The hash command digests the output instead of writing it, and
+		// --archive only writes it into the archive
+		digest = nil
+		var writer io.Writer
+		pending.Reset()
+		budget = newOutputBudget(opts.MaxOutputBytes, opts.Overflow)
+		if opts.Command == "hash" {
+			digest = sha256.New()
+			writer = digest
+		} else if opts.Command == "anchors-diff" {
+			writer = io.Discard
+		} else if opts.Archive != "" {
+			writer = io.Discard
+		} else if opts.MaxOutputBytes > 0 {
+			// Held back until the output is known to fit, so that --overflow
+			// error leaves the output file alone
+			writer = &pending
+		} else {
+			output, closeOutput, err := createOutput(outputFile)
+			if err != nil {
+				return err
+			}
+			defer closeOutput()
+			writer = output
+		}
+
+		// HTML is rendered from the whole markdown document once it is complete
+		page = nil
+		if opts.Format == FormatHTML {
+			page = &htmlWriter{dest: writer}
+			writer = page
+		}
+
+		// Keep a copy of the output for --lint, --archive, and the self-check
+		generated.Reset()
+		if opts.Lint || opts.Archive != "" || ((opts.SelfCheck == SelfCheckWarn || opts.SelfCheck == SelfCheckError) && digest == nil) {
+			writer = io.MultiWriter(writer, &generated)
+		}
+
+		// HTML pages are rendered from the document as it was written, which
+		// also keeps the offsets htmlWriter records of sections right
+		var normalizer *normalizingWriter
+		if opts.NormalizeWhitespace && page == nil {
+			normalizer = newNormalizingWriter(writer, opts.MaxBlankLines)
+			writer = normalizer
+		}
+
+		var files []string
+		for _, file := range traversed {
+			if !dropped[file] {
+				files = append(files, file)
+			}
+		}
+		processor = NewFileProcessor(scopeDir, files, opts)
+		orderedFiles = processor.Files()
+		if bibliography != nil {
+			processor.UseBibliography(bibliography)
+		}
+		if glossary != nil {
+			processor.UseGlossary(glossary)
+		}
+		processor.UseFileTemplates(headerTemplate, footerTemplate)
+		if len(orphans) > 0 {
+			processor.UseAppendix(orphans)
+		}
+		if opts.NestByDepth {
+			processor.NestByDepth(traversal)
+		}
+		if opts.TOC && opts.TOCCollapseDepth > 0 {
+			processor.CollapseTOC(traversal, orderedFiles)
+		}
+
+		if opts.Command == "anchors-diff" {
+			return runAnchorsDiff(processor, opts)
+		}
+
+		report = nil
+		if opts.Report != "" {
+			report = NewReport(rootAbs, outputFile)
+		} else if opts.Archive != "" {
+			report = NewReport(rootAbs, archiveDocumentName(opts.Archive, opts.Format))
+		}
+		if report != nil {
+			for _, file := range processor.Pruned(traversed) {
+				report.AddFile(file, StatusPruned, nil)
+			}
+		}
+
+		if title := processor.DocumentTitle(); title != "" {
+			frontMatter, err := yaml.Marshal(map[string]string{"title": title})
+			if err != nil {
+				return err
+			}
+			frontMatter = fmt.Appendf(nil, "---\n%s---\n\n", frontMatter)
+			if budget.admit("document title", len(frontMatter)) {
+				if _, err := writer.Write(frontMatter); err != nil {
+					return fmt.Errorf("failed to write document title: %w", err)
+				}
+			}
+		}
+
+		filesWritten := 0
+		if opts.TOC && !processor.TOCInline() {
+			toc, err := processor.RenderTOC(orderedFiles)
+			if err != nil {
+				return fmt.Errorf("failed to render table of contents: %w", err)
+			}
+			if budget.admit("table of contents", len(toc)) {
+				if _, err := writer.Write(toc); err != nil {
+					return fmt.Errorf("failed to write table of contents: %w", err)
+				}
+				filesWritten++
+			}
+		}
+
+		results := processFiles(processor, orderedFiles, opts.Jobs)
+		included = nil
+		appendixWritten := false
+		// Already warned about when the document was first assembled
+		warn := io.Writer(os.Stderr)
+		if len(dropped) > 0 {
+			warn = io.Discard
+		}
+		var late []string
+
+		for i, filename := range orderedFiles {
+			result := <-results[i]
+			if result.readErr != nil {
+				// Log warning to stderr but continue processing
+				fmt.Fprintf(warn, "Warning: failed to read file %q: %v\n", filename, result.readErr)
+				if report != nil {
+					report.AddFile(filename, StatusSkipped, result.readErr)
+				}
+				continue
+			}
+
+			status := StatusIncluded
+			content, processedContent, err := result.content, result.output, result.err
+
+			var perr *panicError
+			if errors.As(err, &perr) && len(dropped) == 0 {
+				if dir, reportErr := writeBugReport(filename, content, opts, perr); reportErr == nil {
+					fmt.Fprintf(os.Stderr, "Warning: catmd crashed while processing %q; a bug report bundle was written to %s\n", filename, dir)
+				} else {
+					fmt.Fprintf(os.Stderr, "Warning: failed to write bug report: %v\n", reportErr)
+				}
+			}
+
+			// Files that time out are fine, just slow, so their source is always
+			// worth keeping
+			var terr *timeoutError
+			if err != nil && (opts.DegradeGracefully || errors.As(err, &terr)) && !errors.Is(err, errBinaryContent) {
+				fmt.Fprintf(warn, "Warning: failed to process file %q, emitting placeholder: %v\n", filename, err)
+				processedContent, err = processor.RenderPlaceholder(filename, content, err)
+				status = StatusPlaceholder
+			}
+			if err != nil {
+				fmt.Fprintf(warn, "Warning: failed to process file %q: %v\n", filename, err)
+				if report != nil {
+					report.AddFile(filename, StatusSkipped, err)
+				}
+				continue
+			}
+			size := len(processedContent)
+			if filesWritten > 0 {
+				size += len("\n\n")
+			}
+			if !appendixWritten && processor.InAppendix(filename) {
+				size += len(processor.AppendixHeading()) + len("\n\n")
+			}
+			if !budget.admit(displayPath(filename), size) {
+				late = append(late, filename)
+				switch {
+				case opts.Overflow == OverflowPriority:
+					// Reported with the planned omissions
+					omitted = append(omitted, filename)
+				case opts.Overflow != OverflowTruncate:
+					return budget.overflow()
+				case report != nil:
+					report.AddFile(filename, StatusTruncated, nil)
+				}
+				continue
+			}
+
+			if report != nil {
+				report.AddFile(filename, status, nil)
+			}
+			if status == StatusIncluded {
+				included = append(included, filename)
+			}
+
+			if !appendixWritten && processor.InAppendix(filename) {
+				if page != nil {
+					page.Section("")
+				}
+				if filesWritten > 0 {
+					if _, err := writer.Write([]byte("\n\n")); err != nil {
+						return fmt.Errorf("failed to write separator: %w", err)
+					}
+				}
+				if _, err := writer.Write(processor.AppendixHeading()); err != nil {
+					return fmt.Errorf("failed to write appendix heading: %w", err)
+				}
+				appendixWritten = true
+				filesWritten++
+			}
+
+			if filesWritten > 0 {
+				if _, err := writer.Write([]byte("\n\n")); err != nil {
+					return fmt.Errorf("failed to write separator: %w", err)
+				}
+			}
+
+			if page != nil {
+				page.Section(filename)
+			}
+			if _, err := writer.Write(processedContent); err != nil {
+				return fmt.Errorf("failed to write processed content for file %q: %w", filename, err)
+			}
+			filesWritten++
+		}
+
+		// Sections an earlier assembly turned away stay out, in their place
+		for _, file := range traversed {
+			if !dropped[file] {
+				continue
+			}
+			budget.drop(displayPath(file))
+			if opts.Overflow == OverflowTruncate && report != nil {
+				report.AddFile(file, StatusTruncated, nil)
+			}
+		}
+		if len(late) > 0 && (opts.TOC || processor.linksBetween(orderedFiles, late)) {
+			for _, file := range late {
+				dropped[file] = true
+			}
 			continue
 		}
 
-		processedContent, err := processor.ProcessFile(filename, content)
+		// Document-wide sections collected while processing the files
+		notes, err := processor.RenderEndnotes()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to process file %q: %v\n", filename, err)
-			continue
+			return fmt.Errorf("failed to render endnotes: %w", err)
+		}
+		// Sections dropped after all because the estimate was short are listed
+		// with the planned ones, in traversal order
+		sort.SliceStable(omitted, func(i, j int) bool {
+			return traversalIndex[omitted[i]] < traversalIndex[omitted[j]]
+		})
+		trailing := []struct {
+			name    string
+			content []byte
+		}{
+			{"endnotes", notes},
+			{"references", processor.RenderReferences()},
+			{"abbreviations", processor.RenderAbbreviations()},
+			{"omitted sections", renderOmittedSections(omitted, scopeDir)},
+		}
+		if page != nil {
+			page.Section("")
+		}
+		for _, section := range trailing {
+			if len(section.content) == 0 {
+				continue
+			}
+			if !budget.admitTrailing(section.name, len(section.content)+len("\n\n")) {
+				if opts.Overflow != OverflowTruncate && opts.Overflow != OverflowPriority {
+					return budget.overflow()
+				}
+				continue
+			}
+			if filesWritten > 0 {
+				if _, err := writer.Write([]byte("\n\n")); err != nil {
+					return fmt.Errorf("failed to write separator: %w", err)
+				}
+			}
+			if _, err := writer.Write(section.content); err != nil {
+				return fmt.Errorf("failed to write %s: %w", section.name, err)
+			}
+			filesWritten++
 		}
 
-		if filesWritten > 0 {
-			if _, err := writer.Write([]byte("\n\n")); err != nil {
-				return fmt.Errorf("failed to write separator: %w", err)
+		if normalizer != nil {
+			if err := normalizer.Flush(); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+		if page != nil {
+			if err := page.Flush(processor.RenderHTML); err != nil {
+				return fmt.Errorf("failed to render HTML: %w", err)
+			}
+		}
+		break
+	}
+	budget.warnTruncated()
+	if len(omitted) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: left out %d section(s) to stay within --max-output-bytes %d; they are listed under \"Omitted sections\"\n", len(omitted), opts.MaxOutputBytes)
+		if report != nil {
+			for _, file := range omitted {
+				report.AddFile(file, StatusTruncated, nil)
 			}
 		}
+	}
+
+	if opts.MaxOutputBytes > 0 && digest == nil && opts.Archive == "" {
+		output, closeOutput, err := createOutput(outputFile)
+		if err != nil {
+			return err
+		}
+		defer closeOutput()
+		if _, err := output.Write(pending.Bytes()); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+
+	// Nothing is written in hash mode, including reports and redirects
+	if digest != nil {
+		fmt.Printf("%x\n", digest.Sum(nil))
+		return nil
+	}
+
+	if opts.SelfCheck == SelfCheckWarn || opts.SelfCheck == SelfCheckError {
+		diagnostics := processor.VerifyAnchors(generated.Bytes())
+		for i := range diagnostics {
+			diagnostics[i].File = outputFile
+		}
+		if err := writeDiagnosticsText(os.Stderr, diagnostics); err != nil {
+			return fmt.Errorf("failed to write self-check results: %w", err)
+		}
+		if len(diagnostics) > 0 && opts.SelfCheck == SelfCheckError {
+			return fmt.Errorf("self-check found %d problem(s) in the output", len(diagnostics))
+		}
+	}
+
+	if opts.Lint {
+		diagnostics := LintMarkdown(generated.Bytes(), processor.md, newSlugger(opts))
+		for i := range diagnostics {
+			diagnostics[i].File = outputFile
+		}
+		if err := writeDiagnosticsText(os.Stderr, diagnostics); err != nil {
+			return fmt.Errorf("failed to write lint results: %w", err)
+		}
+		if report != nil {
+			report.AddLint(diagnostics)
+		}
+
+		sourceDiagnostics := append(processor.LintLinks(), processor.LintOrdering()...)
+		sourceDiagnostics = append(sourceDiagnostics, processor.LintHeadingOrder()...)
+		if err := writeDiagnosticsText(os.Stderr, sourceDiagnostics); err != nil {
+			return fmt.Errorf("failed to write lint results: %w", err)
+		}
+		if report != nil {
+			report.AddSourceLint(sourceDiagnostics)
+		}
+	}
+
+	if report != nil {
+		report.CollectAssets(orderedFiles, scopeDir, opts.Snapshot)
+	}
+	if opts.Report != "" {
+		if err := WriteReport(opts.Report, report); err != nil {
+			return err
+		}
+	}
+	if opts.Archive != "" {
+		document := generated.Bytes()
+		if page != nil {
+			document = page.page
+		}
+		// References are relative to the root file's directory, as when
+		// writing to standard output
+		if err := WriteArchive(opts.Archive, document, report, processor.assetBase); err != nil {
+			return err
+		}
+	}
+
+	if opts.AssetsDir != "" && digest == nil {
+		if err := processor.CopyAssets(); err != nil {
+			return err
+		}
+	}
+
+	if opts.Explode != "" {
+		sections := NewSectionProcessor(scopeDir, traversed, opts)
+		sections.UseFileTemplates(headerTemplate, footerTemplate)
+		if opts.TOC && opts.TOCCollapseDepth > 0 {
+			sections.CollapseTOC(traversal, sections.Files())
+		}
+		if err := WriteExploded(sections, included, opts.Explode, opts.Jobs); err != nil {
+			return err
+		}
+	}
 
-		if _, err := writer.Write(processedContent); err != nil {
-			return fmt.Errorf("failed to write processed content for file %q: %w", filename, err)
+	if opts.Chunks != "" {
+		chunks := NewChunkProcessor(scopeDir, traversed, opts, opts.Chunks)
+		chunks.UseFileTemplates(headerTemplate, footerTemplate)
+		if err := WriteChunks(chunks, included, opts.Chunks, opts.Jobs); err != nil {
+			return err
+		}
+	}
+
+	if opts.Redirects != "" {
+		if err := writeRedirectsFile(processor, traversed, rootAbs, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.AnchorMap != "" {
+		if err := WriteAnchorMap(opts.AnchorMap, processor.AnchorMap()); err != nil {
+			return err
 		}
-		filesWritten++
 	}
 
 	return nil
 }
+
+// writeRedirectsFile implements --redirects for a completed run.
+func writeRedirectsFile(processor *FileProcessor, orderedFiles []string, rootFile string, opts Options) error {
+	target := opts.RedirectsTarget
+	if target == "" {
+		target = "/"
+		if opts.Output != "/dev/stdout" {
+			target += filepath.Base(opts.Output)
+		}
+	}
+
+	path := opts.RedirectsFile
+	if path == "" {
+		path = redirectFiles[opts.Redirects]
+	}
+
+	writer, closeOutput, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	redirects := processor.Redirects(orderedFiles, rootFile, target)
+	if err := WriteRedirects(writer, opts.Redirects, redirects); err != nil {
+		return fmt.Errorf("failed to write redirects: %w", err)
+	}
+	return nil
+}
+
+// createOutput opens the output destination, returning a writer and a function
+// that closes it.
+func createOutput(outputFile string) (io.Writer, func() error, error) {
+	if outputFile == "/dev/stdout" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create output file %q: %w", outputFile, err)
+	}
+	return f, f.Close, nil
+}
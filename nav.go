@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/yuin/goldmark/ast"
+)
+
+// appendNavLinks adds a paragraph linking to the sections before and after
+// filename's to the end of the document, for --nav-links. Files whose section
+// has no heading to link to, like a root file without one, are passed over.
+func (fp *FileProcessor) appendNavLinks(doc ast.Node, filename string) {
+	var previous, next string
+	for i, file := range fp.files {
+		if file == filename {
+			previous = fp.adjacentSection(i, -1)
+			next = fp.adjacentSection(i, 1)
+			break
+		}
+	}
+	if previous == "" && next == "" {
+		return
+	}
+
+	paragraph := ast.NewParagraph()
+	paragraph.SetBlankPreviousLines(true)
+	if previous != "" {
+		paragraph.AppendChild(paragraph, ast.NewString([]byte("← ")))
+		paragraph.AppendChild(paragraph, fp.navLink(filename, previous, "Previous"))
+	}
+	if next != "" {
+		if previous != "" {
+			paragraph.AppendChild(paragraph, ast.NewString([]byte(" · ")))
+		}
+		paragraph.AppendChild(paragraph, fp.navLink(filename, next, "Next"))
+		paragraph.AppendChild(paragraph, ast.NewString([]byte(" →")))
+	}
+	doc.AppendChild(doc, paragraph)
+}
+
+// adjacentSection returns the nearest file in direction step from the file at
+// index i of the processor's files that has a section heading to link to, or
+// "" if there is none.
+func (fp *FileProcessor) adjacentSection(i, step int) string {
+	for j := i + step; j >= 0 && j < len(fp.files); j += step {
+		file := fp.files[j]
+		if fp.visitedFiles[file] && !fp.omitsSection(file) {
+			return file
+		}
+	}
+	return ""
+}
+
+// navLink returns a link from filename to target's section, labeled like
+// "Previous: Setup".
+func (fp *FileProcessor) navLink(filename, target, label string) ast.Node {
+	link := ast.NewLink()
+	link.Destination = []byte(fp.sectionLink(filename, target))
+	link.AppendChild(link, newLiteral(label+": "+fp.sectionTitle(target)))
+	return link
+}
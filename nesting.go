@@ -0,0 +1,67 @@
+package main
+
+import "github.com/yuin/goldmark/ast"
+
+// NestByDepth moves each file's section one heading level down for each link
+// traversal followed from the root to reach it, for --nest-by-depth: the root
+// file's section stays at level 1, the files it links to get level 2 sections,
+// the files those link to level 3, and so on, making the combined document a
+// hierarchy rather than a flat sequence of sections.
+func (fp *FileProcessor) NestByDepth(traversal *FileTraversal) {
+	fp.depths = make(map[string]int)
+	for _, file := range fp.files {
+		fp.depths[file] = traversal.Depth(file)
+	}
+
+	// Flattened headings and their anchors depend on heading levels
+	fp.anchors = make(map[string]string)
+	fp.htmlAnchors = make(map[string]string)
+	fp.resolveAnchors(fp.files)
+}
+
+// nesting returns how many levels below level 1 file's section is: its depth
+// with --nest-by-depth, plus one in the appendix, which sits below the
+// appendix heading. Sections are at most level 6.
+func (fp *FileProcessor) nesting(file string) int {
+	levels := fp.depths[file]
+	if fp.appendix[file] {
+		levels++
+	}
+	return min(levels, 5)
+}
+
+// nestedTOCList is tocList for --nest-by-depth, listing each file under the
+// last file before it whose section is less deeply nested.
+func (fp *FileProcessor) nestedTOCList(from string, files []string) *ast.List {
+	type openItem struct {
+		nesting int
+		item    *ast.ListItem
+	}
+	list := ast.NewList('-')
+	list.IsTight = true
+	var open []openItem
+	for _, file := range files {
+		if fp.tocExcluded[file] {
+			continue
+		}
+		item := tocItem(fp.sectionLink(from, file), fp.sectionTitle(file))
+		nesting := fp.nesting(file)
+		for len(open) > 0 && open[len(open)-1].nesting >= nesting {
+			open = open[:len(open)-1]
+		}
+		if len(open) == 0 {
+			list.AppendChild(list, item)
+		} else {
+			parent := open[len(open)-1].item
+			children, ok := parent.LastChild().(*ast.List)
+			if !ok {
+				children = ast.NewList('-')
+				children.IsTight = true
+				parent.AppendChild(parent, children)
+			}
+			children.AppendChild(children, item)
+		}
+		open = append(open, openItem{nesting, item})
+	}
+	return list
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Positions an OrderRule can move sections to.
+const (
+	OrderFirst = "first" // Right after the root file's section
+	OrderLast  = "last"  // At the end of the document
+)
+
+// OrderRule moves the sections of the files matching Sections, a pattern of
+// paths relative to the scope directory, to a place in the combined document
+// regardless of where links put them: Position first or last, or just Before
+// or After the sections matching another pattern. A pattern matches a file if
+// it matches its path or one of the directories it is in, so "changelog/*"
+// takes in everything below changelog/.
+//
+//	order:
+//	  - sections: changelog/*
+//	    position: last
+//	  - sections: tutorials/*
+//	    before: reference/*
+type OrderRule struct {
+	Sections string `yaml:"sections"`
+	Position string `yaml:"position,omitempty"`
+	Before   string `yaml:"before,omitempty"`
+	After    string `yaml:"after,omitempty"`
+}
+
+// Validate reports a rule with a malformed pattern, or with other than one
+// place to move its sections to.
+func (r OrderRule) Validate() error {
+	if r.Sections == "" {
+		return fmt.Errorf("order rule without sections")
+	}
+	places := 0
+	for _, place := range []string{r.Position, r.Before, r.After} {
+		if place != "" {
+			places++
+		}
+	}
+	if places != 1 {
+		return fmt.Errorf("order rule for %q: want exactly one of position, before, or after", r.Sections)
+	}
+	switch r.Position {
+	case "", OrderFirst, OrderLast:
+	default:
+		return fmt.Errorf("order rule for %q: invalid position %q (want first or last)", r.Sections, r.Position)
+	}
+	for _, pattern := range []string{r.Sections, r.Before, r.After} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("order rule for %q: bad pattern %q: %w", r.Sections, pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesSectionPattern reports whether pattern matches rel, a path relative to
+// the scope directory with forward slashes, or one of the directories it is in.
+func matchesSectionPattern(pattern, rel string) bool {
+	for prefix := rel; ; {
+		if ok, _ := path.Match(pattern, prefix); ok {
+			return true
+		}
+		i := strings.LastIndex(prefix, "/")
+		if i < 0 {
+			return false
+		}
+		prefix = prefix[:i]
+	}
+}
+
+// ReorderSections applies rules, in order, to the files after the first, which
+// is the root file and always leads. Each rule moves the files it matches,
+// keeping their relative order; later rules win where rules disagree. A rule
+// whose before or after pattern matches no file leaves the order alone.
+func ReorderSections(files []string, scopeDir string, rules []OrderRule) []string {
+	if len(files) < 2 || len(rules) == 0 {
+		return files
+	}
+	matches := func(pattern, file string) bool {
+		rel, err := filepath.Rel(scopeDir, file)
+		return err == nil && matchesSectionPattern(pattern, filepath.ToSlash(rel))
+	}
+
+	rest := append([]string(nil), files[1:]...)
+	for _, rule := range rules {
+		anchor := rule.Before + rule.After
+		var moved, others []string
+		for _, file := range rest {
+			if matches(rule.Sections, file) && (anchor == "" || !matches(anchor, file)) {
+				moved = append(moved, file)
+			} else {
+				others = append(others, file)
+			}
+		}
+		if len(moved) == 0 {
+			continue
+		}
+
+		var at int
+		switch {
+		case rule.Position == OrderFirst:
+			at = 0
+		case rule.Position == OrderLast:
+			at = len(others)
+		default:
+			at = -1
+			for i, file := range others {
+				if matches(anchor, file) {
+					if at < 0 || rule.After != "" {
+						at = i
+					}
+					if rule.Before != "" {
+						break
+					}
+				}
+			}
+			if at < 0 {
+				continue
+			}
+			if rule.After != "" {
+				at++
+			}
+		}
+		rest = append(append(append([]string(nil), others[:at]...), moved...), others[at:]...)
+	}
+	return append([]string{files[0]}, rest...)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReorderSections(t *testing.T) {
+	scope := "/docs"
+	files := []string{"index.md", "changelog/v2.md", "reference/api.md", "intro.md", "tutorials/a.md", "changelog/v1.md", "tutorials/deep/b.md"}
+	for i, file := range files {
+		files[i] = filepath.Join(scope, file)
+	}
+
+	tests := []struct {
+		rules []OrderRule
+		want  string
+	}{
+		{nil, "index.md changelog/v2.md reference/api.md intro.md tutorials/a.md changelog/v1.md tutorials/deep/b.md"},
+		{[]OrderRule{{Sections: "changelog/*", Position: OrderLast}}, "index.md reference/api.md intro.md tutorials/a.md tutorials/deep/b.md changelog/v2.md changelog/v1.md"},
+		{[]OrderRule{{Sections: "intro.md", Position: OrderFirst}}, "index.md intro.md changelog/v2.md reference/api.md tutorials/a.md changelog/v1.md tutorials/deep/b.md"},
+		{[]OrderRule{{Sections: "tutorials", Before: "reference/*"}}, "index.md changelog/v2.md tutorials/a.md tutorials/deep/b.md reference/api.md intro.md changelog/v1.md"},
+		{[]OrderRule{{Sections: "changelog/*", After: "tutorials/*"}}, "index.md reference/api.md intro.md tutorials/a.md tutorials/deep/b.md changelog/v2.md changelog/v1.md"},
+		{[]OrderRule{{Sections: "intro.md", Before: "missing/*"}}, "index.md changelog/v2.md reference/api.md intro.md tutorials/a.md changelog/v1.md tutorials/deep/b.md"},
+		{[]OrderRule{{Sections: "index.md", Position: OrderLast}}, "index.md changelog/v2.md reference/api.md intro.md tutorials/a.md changelog/v1.md tutorials/deep/b.md"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, file := range ReorderSections(files, scope, tt.rules) {
+			rel, _ := filepath.Rel(scope, file)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		if want := strings.Fields(tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("ReorderSections(%+v) = %v, want %v", tt.rules, got, want)
+		}
+	}
+}
+
+func TestOrderRule_Validate(t *testing.T) {
+	valid := []OrderRule{
+		{Sections: "changelog/*", Position: OrderLast},
+		{Sections: "tutorials/*", Before: "reference/*"},
+	}
+	for _, rule := range valid {
+		if err := rule.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error %v", rule, err)
+		}
+	}
+	invalid := []OrderRule{
+		{Position: OrderLast},
+		{Sections: "a/*"},
+		{Sections: "a/*", Position: "middle"},
+		{Sections: "a/*", Position: OrderFirst, After: "b/*"},
+		{Sections: "[", Position: OrderFirst},
+	}
+	for _, rule := range invalid {
+		if err := rule.Validate(); err == nil {
+			t.Errorf("%+v: expected an error", rule)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// processedFile is the outcome of reading and processing one file.
+type processedFile struct {
+	content []byte // Source as read from the snapshot
+	output  []byte // Processed markdown, if err is nil
+	readErr error  // Error reading the file; the file wasn't processed
+	err     error  // Error processing the file
+}
+
+// processFiles reads and processes files on up to jobs goroutines. It returns one
+// channel per file, in the same order as files, each receiving that file's result,
+// so callers can assemble the output in traversal order while later files are
+// still being processed.
+func processFiles(processor *FileProcessor, files []string, jobs int) []chan processedFile {
+	results := make([]chan processedFile, len(files))
+	for i := range results {
+		results[i] = make(chan processedFile, 1)
+	}
+
+	indexes := make(chan int)
+	go func() {
+		for i := range files {
+			indexes <- i
+		}
+		close(indexes)
+	}()
+
+	for range max(jobs, 1) {
+		go func() {
+			for i := range indexes {
+				results[i] <- processFile(processor, files[i])
+			}
+		}()
+	}
+
+	return results
+}
+
+// parallelMap returns f applied to each index below n, calling it on up to jobs
+// goroutines, with the results in index order.
+func parallelMap[T any](n, jobs int, f func(i int) T) []T {
+	results := make([]T, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(jobs, 1), n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = f(i)
+			}
+		}()
+	}
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+func processFile(processor *FileProcessor, filename string) processedFile {
+	content, err := processor.opts.Snapshot.ReadFile(filename)
+	if err != nil {
+		return processedFile{readErr: err}
+	}
+	output, err := processor.processWithTimeout(filename, content)
+	return processedFile{content: content, output: output, err: err}
+}
+
+// timeoutError is reported for files that take longer than --file-timeout to
+// process.
+type timeoutError struct {
+	limit time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("processing took longer than %v", e.limit)
+}
+
+// processWithTimeout is ProcessFile limited to --file-timeout. The parser and
+// renderer can't be interrupted, so a file that runs out of time is abandoned
+// rather than stopped: its processing gives up at the next step that checks
+// for the deadline, and what it collected for the document-wide sections is
+// only recorded if it finished in time.
+func (fp *FileProcessor) processWithTimeout(filename string, content []byte) ([]byte, error) {
+	if fp.opts.FileTimeout <= 0 {
+		return fp.ProcessFile(filename, content)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fp.opts.FileTimeout)
+	defer cancel()
+
+	type outcome struct {
+		output    []byte
+		collected *collected
+		err       error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		output, c, err := fp.process(ctx, filename, content)
+		done <- outcome{output: output, collected: c, err: err}
+	}()
+	select {
+	case result := <-done:
+		if result.err == nil {
+			fp.record(filename, result.collected)
+			return result.output, nil
+		}
+		if ctx.Err() == nil {
+			return nil, result.err
+		}
+		// Gave up on reaching the deadline
+	case <-ctx.Done():
+	}
+	return nil, fmt.Errorf("failed to process file %q: %w", filename, &timeoutError{limit: fp.opts.FileTimeout})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProcessFiles_OrderedAssembly(t *testing.T) {
+	root := writeBenchmarkTree(t, 50)
+	scopeDir := filepath.Dir(root)
+	files, err := NewFileTraversal(root, scopeDir).Traverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assemble := func(jobs int) []byte {
+		processor := NewFileProcessor(scopeDir, files, Options{Abbreviations: true})
+		var output bytes.Buffer
+		for i, result := range processFiles(processor, files, jobs) {
+			processed := <-result
+			if processed.readErr != nil || processed.err != nil {
+				t.Fatalf("processing %s: %v %v", files[i], processed.readErr, processed.err)
+			}
+			output.Write(processed.output)
+		}
+		return output.Bytes()
+	}
+
+	sequential := assemble(1)
+	for _, jobs := range []int{2, 8} {
+		if parallel := assemble(jobs); !bytes.Equal(parallel, sequential) {
+			t.Errorf("output with %d jobs differs from sequential output", jobs)
+		}
+	}
+}
+
+// Endnote numbers and --assets-dir paths are allocated across files, so they
+// must not depend on scheduling; run with -race to check the allocation too.
+func TestProcessFiles_DeterministicAllocation(t *testing.T) {
+	root := writeBenchmarkTree(t, 50)
+	scopeDir := filepath.Dir(root)
+	shared := filepath.Join(t.TempDir(), "a", "logo.png")
+	other := filepath.Join(filepath.Dir(filepath.Dir(shared)), "b", "logo.png")
+	for _, image := range []string{shared, other} {
+		if err := os.MkdirAll(filepath.Dir(image), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(image, []byte("png"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Later files refer to the image outside the scope that gets the numbered name
+	for i := 0; i < 50; i++ {
+		image := shared
+		if i >= 25 {
+			image = other
+		}
+		path := filepath.Join(scopeDir, fmt.Sprintf("doc%d.md", i))
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = append(content, fmt.Sprintf("\n![Logo](%s) and a second note[^2].\n\n[^2]: Another.\n", filepath.ToSlash(image))...)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := NewFileTraversal(root, scopeDir).Traverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assemble := func(jobs int) []byte {
+		opts := Options{Footnotes: FootnotesEndnotes, AssetsDir: "assets", Output: filepath.Join(scopeDir, "out.md")}
+		processor := NewFileProcessor(scopeDir, files, opts)
+		var output bytes.Buffer
+		for i, result := range processFiles(processor, files, jobs) {
+			processed := <-result
+			if processed.readErr != nil || processed.err != nil {
+				t.Fatalf("processing %s: %v %v", files[i], processed.readErr, processed.err)
+			}
+			output.Write(processed.output)
+		}
+		notes, err := processor.RenderEndnotes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		output.Write(notes)
+		return output.Bytes()
+	}
+
+	sequential := assemble(1)
+	for _, want := range []string{"[100](#fn-100)", "(assets/logo.png)", "(assets/logo-1.png)"} {
+		if !bytes.Contains(sequential, []byte(want)) {
+			t.Errorf("sequential output lacks %q", want)
+		}
+	}
+	for _, jobs := range []int{2, 8} {
+		if parallel := assemble(jobs); !bytes.Equal(parallel, sequential) {
+			t.Errorf("output with %d jobs differs from sequential output", jobs)
+		}
+	}
+}
+
+func TestParallelMap(t *testing.T) {
+	for _, jobs := range []int{0, 1, 3, 100} {
+		squares := parallelMap(10, jobs, func(i int) int { return i * i })
+		for i, square := range squares {
+			if square != i*i {
+				t.Errorf("parallelMap() with %d jobs = %v, want squares in index order", jobs, squares)
+				break
+			}
+		}
+	}
+	if empty := parallelMap(0, 4, func(i int) int { return i }); len(empty) != 0 {
+		t.Errorf("parallelMap() over nothing = %v, want none", empty)
+	}
+}
+
+func TestProcessWithTimeout(t *testing.T) {
+	content := bytes.Repeat([]byte("| a | b |\n| - | - |\n| 1 | 2 |\n\n"), 2000)
+
+	slow := NewFileProcessor("/", []string{"/big.md"}, Options{FileTimeout: time.Nanosecond})
+	_, err := slow.processWithTimeout("/big.md", content)
+	var terr *timeoutError
+	if !errors.As(err, &terr) {
+		t.Errorf("processWithTimeout() error = %v, want a timeout", err)
+	}
+
+	patient := NewFileProcessor("/", []string{"/big.md"}, Options{FileTimeout: time.Minute})
+	if _, err := patient.processWithTimeout("/big.md", content); err != nil {
+		t.Errorf("processWithTimeout() error = %v, want none", err)
+	}
+
+	// Processing given up on records nothing for the document-wide sections
+	abbreviated := []byte("The API.\n\n*[API]: Application Programming Interface\n")
+	abandoned := NewFileProcessor("/", []string{"/api.md"}, Options{Abbreviations: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := abandoned.process(ctx, "/api.md", abbreviated); !errors.Is(err, context.Canceled) {
+		t.Errorf("process() error = %v, want %v", err, context.Canceled)
+	}
+	if abbreviations := abandoned.RenderAbbreviations(); abbreviations != nil {
+		t.Errorf("RenderAbbreviations() after giving up = %q, want nothing", abbreviations)
+	}
+	if _, err := abandoned.ProcessFile("/api.md", abbreviated); err != nil {
+		t.Fatal(err)
+	}
+	if abbreviations := abandoned.RenderAbbreviations(); abbreviations == nil {
+		t.Error("RenderAbbreviations() after processing = nothing, want the definition")
+	}
+}
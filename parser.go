@@ -43,16 +43,24 @@ FOOTNOTE HANDLING INNOVATION
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"path/filepath"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/yuin/goldmark"
+	emoji "github.com/yuin/goldmark-emoji"
+	meta "github.com/yuin/goldmark-meta"
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
 	extast "github.com/yuin/goldmark/extension/ast"
 	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
 )
 
 // LinkInfo represents a link found in markdown content.
@@ -61,6 +69,8 @@ type LinkInfo struct {
 	Text       string // The display text of the link
 	IsInternal bool   // True if this is a relative link within scope
 	IsFootnote bool   // True if this is a footnote reference
+	Line       int    // 1-based source line of the link, 0 if unknown
+	Column     int    // 1-based source column (in characters) of the link text, 0 if unknown
 }
 
 // HeaderInfo represents a heading found in markdown content.
@@ -68,43 +78,152 @@ type HeaderInfo struct {
 	Level int    // Header level (1-6)
 	Text  string // Header text content
 	ID    string // Header ID attribute if present
+	Line  string // Last source line of the header, which its auto ID is generated from
+
+	ExplicitID bool // Whether ID was written in an attribute list rather than generated
+
+	Preamble  int // What comes before the header in the file, see the Preamble* constants
+	StartLine int // 1-based source line the header starts on, 0 if unknown
 }
 
+// Kinds of content that can come before a header, from least to most.
+const (
+	PreambleNone     = iota // Nothing, apart from front matter and blank lines
+	PreambleComments        // Only HTML comments
+	PreambleContent         // Other content, or the header is nested in another block
+)
+
+// utf8BOM is the UTF-8 encoded byte order mark some editors start files with.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
 // FootnoteInfo represents a footnote definition found in markdown content.
 type FootnoteInfo struct {
-	ID    string     // Footnote identifier (e.g., "1" or "note")
-	Nodes []ast.Node // Fresh AST nodes from re-parsed footnote content
+	ID     string     // Footnote identifier (e.g., "1" or "note")
+	Nodes  []ast.Node // Fresh AST nodes from re-parsed footnote content
+	Source []byte     // Footnote markdown the Nodes were parsed from
 }
 
 // ParsedFile contains all extracted information from a markdown file.
 type ParsedFile struct {
-	Headers   []HeaderInfo   // All headers found in the file
-	Links     []LinkInfo     // All links found in the file
-	Footnotes []FootnoteInfo // All footnote definitions found
-	AST       ast.Node       // The parsed AST for content transformation
-	Source    []byte         // Original source content
+	Headers     []HeaderInfo           // All headers found in the file
+	Links       []LinkInfo             // All links found in the file
+	Footnotes   []FootnoteInfo         // All footnote definitions found
+	FrontMatter map[string]interface{} // YAML front matter, nil if the file has none or it isn't read
+	AST         ast.Node               // The parsed AST for content transformation
+	Source      []byte                 // Original source content
 }
 
-// NewMarkdownParser creates a new Goldmark parser configured for GitHub Flavored Markdown
-// with footnote support and automatic heading ID generation.
+// Input flavors accepted by --input-flavor, naming the markdown dialect the
+// sources are written for.
+const (
+	FlavorGFM        = "gfm"        // GitHub Flavored Markdown plus footnotes (the default)
+	FlavorCommonMark = "commonmark" // Strict CommonMark with no extensions
+	FlavorMkDocs     = "mkdocs"     // MkDocs' Python-Markdown defaults: tables, plus footnotes
+)
+
+// NewMarkdownParser creates a new Goldmark parser with the given syntax extensions
+// and automatic heading ID generation.
 //
 // Key configuration choices:
-//   - GFM extension: GitHub-compatible syntax (tables, strikethrough, autolinks, etc.)
-//   - Footnote extension: Support for [^1] footnote references and definitions
 //   - WithAutoHeadingID(): Generates GitHub-compatible anchors automatically
 //     (lowercase, spaces become hyphens, punctuation removed)
-func NewMarkdownParser() goldmark.Markdown {
+//
+// Syntax extensions (GFM, footnotes, emoji shortcodes, front matter) come from
+// parserExtensions.
+func NewMarkdownParser(extensions ...goldmark.Extender) goldmark.Markdown {
 	return goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			extension.Footnote,
-		),
+		goldmark.WithExtensions(extensions...),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(),
 		),
 	)
 }
 
+// parserExtensions returns the goldmark extensions for the input flavor and the
+// optional transformations enabled in opts:
+//   - gfm: GFM (tables, strikethrough, task lists, bare URL autolinks) and
+//     [^1] footnotes
+//   - commonmark: none, so GFM-only syntax stays plain text
+//   - mkdocs: tables and footnotes, but no bare URL autolinks, strikethrough, or
+//     task lists, matching how MkDocs renders pages
+//
+// followed by the embedder's Options.Extensions. When opts.readsFrontMatter,
+// YAML front matter is parsed into the document's metadata and removed from
+// the AST, so it doesn't leak into the output; otherwise it is parsed as the
+// Markdown it looks like, as any other text.
+func parserExtensions(opts Options) []goldmark.Extender {
+	var extensions []goldmark.Extender
+	if opts.readsFrontMatter() {
+		extensions = append(extensions, meta.New(meta.WithStoresInDocument()))
+	}
+	switch opts.InputFlavor {
+	case FlavorCommonMark:
+	case FlavorMkDocs:
+		extensions = append(extensions, extension.Table, extension.Footnote)
+	default:
+		extensions = append(extensions, extension.GFM, extension.Footnote)
+	}
+	if opts.Emoji != "" {
+		extensions = append(extensions, emoji.Emoji)
+	}
+	if opts.HeadingAttributes {
+		extensions = append(extensions, headingAttributes{})
+	}
+	return append(extensions, opts.Extensions...)
+}
+
+// headingAttributes is the extension --heading-attributes adds, which parses
+// {#id .class key=value} attribute lists at the end of headings.
+type headingAttributes struct{}
+
+// Extend implements goldmark.Extender.
+func (headingAttributes) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithHeadingAttribute())
+}
+
+// headingAttributeList returns the attributes of heading's {...} attribute list,
+// in the order written, or nil if it has none, including when attribute lists
+// aren't parsed. Unlike the heading's own attributes, these leave out the ID
+// goldmark generates when the list has none.
+func headingAttributeList(heading *ast.Heading, source []byte) parser.Attributes {
+	lines := heading.Lines()
+	if lines.Len() == 0 {
+		return nil
+	}
+	rest := source[lines.At(lines.Len()-1).Stop:]
+	if end := bytes.IndexByte(rest, '\n'); end >= 0 {
+		rest = rest[:end]
+	}
+	rest = bytes.TrimSpace(rest)
+	if !bytes.HasPrefix(rest, []byte("{")) {
+		return nil
+	}
+	attrs, ok := parser.ParseAttributes(text.NewReader(rest))
+	if !ok {
+		return nil
+	}
+	return attrs
+}
+
+// defaultParser is shared by every ParseMarkdownFile call. Goldmark parsers keep
+// no per-document state, so one instance can safely parse any number of files.
+var defaultParser = sync.OnceValue(func() goldmark.Markdown {
+	return NewMarkdownParser(parserExtensions(Options{})...)
+})
+
+// frontMatterParser is defaultParser reading front matter, for snapshots that
+// read it.
+var frontMatterParser = sync.OnceValue(func() goldmark.Markdown {
+	return NewMarkdownParser(parserExtensions(Options{FrontMatter: true})...)
+})
+
+// readsFrontMatter reports whether files' YAML front matter is read and left
+// out of the output: when asked for, or when an option relying on it is used.
+// Otherwise front matter is kept, as the Markdown it looks like.
+func (opts Options) readsFrontMatter() bool {
+	return opts.FrontMatter || len(opts.Tags) > 0 || opts.Audience != "" || opts.LinkOrder == LinkOrderWeight || opts.FrontMatterBase || opts.RootTitle
+}
+
 // ParseMarkdownFile parses markdown content and extracts all relevant information
 // including headers, links, and footnotes. Links are classified as internal/external
 // based on the provided scope directory.
@@ -113,15 +232,35 @@ func NewMarkdownParser() goldmark.Markdown {
 // - Headers: Extracted with goldmark's auto-generated IDs for anchor generation
 // - Links: Both regular links and footnote references, classified as internal/external
 // - Footnotes: Definitions with re-parsed AST nodes for inline transformation
+// - FrontMatter: YAML metadata from the top of the file, if any
 // - AST: Full document tree for content transformation
 // - Source: Original bytes for accurate text segment extraction
 func ParseMarkdownFile(content []byte, scopeDir string) (*ParsedFile, error) {
-	md := NewMarkdownParser()
+	return parseMarkdownWith(defaultParser(), content, scopeDir, nil)
+}
 
-	doc := md.Parser().Parse(text.NewReader(content))
+// parseMarkdownWith is ParseMarkdownFile using a specific parser configuration,
+// generating heading IDs with ids, or goldmark's generator if ids is nil. Footnote
+// content is re-parsed with the same configuration. A panic while parsing, which
+// malformed input must never cause but a parser bug could, is returned as an
+// error rather than crashing the whole run.
+func parseMarkdownWith(md goldmark.Markdown, content []byte, scopeDir string, ids parser.IDs) (parsed *ParsedFile, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			parsed, err = nil, &panicError{value: r, stack: debug.Stack()}
+		}
+	}()
+
+	// A byte order mark would keep a heading on the first line from being one
+	content = bytes.TrimPrefix(content, utf8BOM)
+	var parseOpts []parser.ParseOption
+	if ids != nil {
+		parseOpts = append(parseOpts, parser.WithContext(parser.NewContext(parser.WithIDs(ids))))
+	}
+	doc := md.Parser().Parse(text.NewReader(content), parseOpts...)
 
 	// First extract footnotes to get the index->ID mapping
-	footnotes := extractFootnotes(doc, content)
+	footnotes := extractFootnotes(md, doc, content)
 
 	// Create index to ID mapping
 	indexToID := make(map[int]string)
@@ -140,20 +279,73 @@ func ParseMarkdownFile(content []byte, scopeDir string) (*ParsedFile, error) {
 		})
 	}
 
-	parsed := &ParsedFile{
-		Headers:   extractHeaders(doc, content),
-		Links:     extractLinks(doc, content, scopeDir, indexToID),
-		Footnotes: footnotes,
-		AST:       doc,
-		Source:    content,
+	var frontMatter map[string]interface{}
+	if document, ok := doc.(*ast.Document); ok {
+		frontMatter = document.Meta()
+	}
+
+	parsed = &ParsedFile{
+		Headers:     extractHeaders(doc, content),
+		Links:       extractLinks(doc, content, scopeDir, indexToID),
+		Footnotes:   footnotes,
+		FrontMatter: frontMatter,
+		AST:         doc,
+		Source:      content,
 	}
 
 	return parsed, nil
 }
 
+// hasFootnoteLink reports whether node contains a footnote reference.
+func hasFootnoteLink(node ast.Node) bool {
+	found := false
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if _, ok := n.(*extast.FootnoteLink); ok {
+			found = true
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return found
+}
+
+// headingLineWithoutFootnotes returns the last line of heading as it is written
+// once moveHeadingFootnotes has taken its footnote references out, for its auto
+// ID to be generated from: the heading is rendered without them and parsed
+// again.
+func headingLineWithoutFootnotes(heading *ast.Heading, source []byte) string {
+	r := newMarkdownRenderer(map[ast.NodeKind]renderer.NodeRendererFunc{
+		extast.KindFootnoteLink: func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+			return ast.WalkSkipChildren, nil
+		},
+	})
+	// Rendering into a buffer can't fail
+	var rendered bytes.Buffer
+	_ = r.Render(&rendered, source, heading)
+
+	doc := goldmark.New().Parser().Parse(text.NewReader(rendered.Bytes()))
+	written, ok := doc.FirstChild().(*ast.Heading)
+	if !ok || written.Lines().Len() == 0 {
+		return ""
+	}
+	line := written.Lines().At(written.Lines().Len() - 1)
+	return string(line.Value(rendered.Bytes()))
+}
+
 func extractHeaders(doc ast.Node, source []byte) []HeaderInfo {
 	var headers []HeaderInfo
 
+	preambles := make(map[ast.Node]int)
+	preamble := PreambleNone
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		preambles[child] = preamble
+		if block, ok := child.(*ast.HTMLBlock); ok && block.HTMLBlockType == ast.HTMLBlockType2 {
+			preamble = max(preamble, PreambleComments)
+		} else {
+			preamble = PreambleContent
+		}
+	}
+
 	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
 		if !entering {
 			return ast.WalkContinue, nil
@@ -170,10 +362,31 @@ func extractHeaders(doc ast.Node, source []byte) []HeaderInfo {
 				}
 			}
 
+			line := ""
+			if lines := heading.Lines(); lines.Len() > 0 {
+				segment := lines.At(lines.Len() - 1)
+				line = string(segment.Value(source))
+			}
+			if hasFootnoteLink(heading) {
+				line = headingLineWithoutFootnotes(heading, source)
+			}
+
+			_, explicitID := headingAttributeList(heading, source).Find([]byte("id"))
+
+			preamble, ok := preambles[heading]
+			if !ok {
+				preamble = PreambleContent
+			}
+			startLine, _ := sourcePosition(source, nodeOffset(heading))
+
 			headers = append(headers, HeaderInfo{
-				Level: heading.Level,
-				Text:  text,
-				ID:    id,
+				Level:      heading.Level,
+				Text:       text,
+				ID:         id,
+				Line:       line,
+				Preamble:   preamble,
+				StartLine:  startLine,
+				ExplicitID: explicitID,
 			})
 		}
 
@@ -196,12 +409,15 @@ func extractLinks(doc ast.Node, source []byte, scopeDir string, indexToID map[in
 			url := string(node.Destination)
 			text := extractTextFromNode(node, source)
 			isInternal := isInternalLink(url, scopeDir)
+			line, column := sourcePosition(source, nodeOffset(node))
 
 			links = append(links, LinkInfo{
 				URL:        url,
 				Text:       text,
 				IsInternal: isInternal,
 				IsFootnote: false,
+				Line:       line,
+				Column:     column,
 			})
 
 		case *extast.FootnoteLink:
@@ -250,16 +466,61 @@ func extractTextFromNode(node ast.Node, source []byte) string {
 	return strings.TrimSpace(buf.String())
 }
 
+// nodeOffset returns the byte offset in the source where a node's content starts,
+// or -1 if it can't be determined. Block nodes know their lines; inline nodes are
+// located through their first text descendant, falling back to the enclosing block.
+func nodeOffset(node ast.Node) int {
+	if node.Type() == ast.TypeBlock && node.Lines().Len() > 0 {
+		return node.Lines().At(0).Start
+	}
+
+	offset := -1
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if textNode, ok := n.(*ast.Text); ok && entering {
+			offset = textNode.Segment.Start
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	if offset >= 0 {
+		return offset
+	}
+
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Type() == ast.TypeBlock && parent.Lines().Len() > 0 {
+			return parent.Lines().At(0).Start
+		}
+	}
+	return -1
+}
+
+// sourcePosition converts a byte offset into a 1-based line and column, where
+// columns count characters rather than bytes. Negative offsets yield 0, 0.
+func sourcePosition(source []byte, offset int) (line, column int) {
+	if offset < 0 || offset > len(source) {
+		return 0, 0
+	}
+	before := source[:offset]
+	line = bytes.Count(before, []byte{'\n'}) + 1
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+	column = utf8.RuneCount(before[lineStart:]) + 1
+	return line, column
+}
+
 func isInternalLink(url, scopeDir string) bool {
-	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+	if path, ok := fileURLPath(url); ok {
+		rel, err := filepath.Rel(scopeDir, path)
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+	}
+	if isFileURL(url) {
 		return false
 	}
 
-	if strings.HasPrefix(url, "#") {
+	if isExternalScheme(url, nil) {
 		return false
 	}
 
-	if strings.HasPrefix(url, "mailto:") {
+	if strings.HasPrefix(url, "#") {
 		return false
 	}
 
@@ -292,7 +553,7 @@ func GenerateSectionLink(filename string) string {
 //
 // Critical design choice: We store AST nodes instead of raw text to enable
 // automatic link transformation within footnote content during the transform phase.
-func extractFootnotes(doc ast.Node, source []byte) []FootnoteInfo {
+func extractFootnotes(md goldmark.Markdown, doc ast.Node, source []byte) []FootnoteInfo {
 	var footnotes []FootnoteInfo
 
 	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
@@ -302,11 +563,12 @@ func extractFootnotes(doc ast.Node, source []byte) []FootnoteInfo {
 
 		if footnoteNode, ok := n.(*extast.Footnote); ok {
 			id := string(footnoteNode.Ref)
-			nodes := extractFootnoteNodes(footnoteNode, source)
+			nodes := extractFootnoteNodes(md, footnoteNode, source)
 
 			footnotes = append(footnotes, FootnoteInfo{
-				ID:    id,
-				Nodes: nodes,
+				ID:     id,
+				Nodes:  nodes,
+				Source: []byte(extractFootnoteMarkdown(footnoteNode, source)),
 			})
 		}
 
@@ -316,7 +578,7 @@ func extractFootnotes(doc ast.Node, source []byte) []FootnoteInfo {
 	return footnotes
 }
 
-func extractFootnoteNodes(footnoteNode *extast.Footnote, source []byte) []ast.Node {
+func extractFootnoteNodes(md goldmark.Markdown, footnoteNode *extast.Footnote, source []byte) []ast.Node {
 	// Extract original source text from the footnote's paragraph children, then
 	// re-parse it to create fresh AST nodes that can be safely inserted elsewhere.
 	//
@@ -329,8 +591,7 @@ func extractFootnoteNodes(footnoteNode *extast.Footnote, source []byte) []ast.No
 	}
 
 	// Re-parse the footnote content to get fresh AST nodes
-	parser := NewMarkdownParser()
-	tempDoc := parser.Parser().Parse(text.NewReader([]byte(originalText)))
+	tempDoc := md.Parser().Parse(text.NewReader([]byte(originalText)))
 
 	// Extract inline content from paragraphs and convert Text nodes to String nodes
 	// to make them source-independent (Text nodes use segments, String nodes store content)
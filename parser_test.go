@@ -1,7 +1,12 @@
 package main
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
 )
 
 func TestGenerateSectionLink(t *testing.T) {
@@ -127,6 +132,31 @@ func TestIsInternalLink(t *testing.T) {
 			scopeDir: "/project",
 			expected: true,
 		},
+		// file:// URLs
+		{
+			name:     "file URL inside scope",
+			url:      "file:///project/docs/api.md#methods",
+			scopeDir: "/project",
+			expected: true,
+		},
+		{
+			name:     "file URL with localhost",
+			url:      "file://localhost/project/api.md",
+			scopeDir: "/project",
+			expected: true,
+		},
+		{
+			name:     "file URL outside scope",
+			url:      "file:///elsewhere/api.md",
+			scopeDir: "/project",
+			expected: false,
+		},
+		{
+			name:     "file URL on a remote host",
+			url:      "file://server/project/api.md",
+			scopeDir: "/project",
+			expected: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -149,3 +179,104 @@ func TestExtractTextFromNode(t *testing.T) {
 		}
 	})
 }
+
+func TestExtractHeaders_FootnoteLines(t *testing.T) {
+	tests := []struct {
+		heading string
+		line    string
+	}{
+		{"## Plain[^1]", "Plain"},
+		{"## Match `[^a-z]` chars[^1]", "Match `[^a-z]` chars"},
+		{"## *Note[^1]* here", "*Note* here"},
+		{"Two\nlines[^1]\n---", "lines"},
+	}
+
+	for _, tt := range tests {
+		content := []byte(tt.heading + "\n\n[^1]: A note.\n")
+		parsed, err := ParseMarkdownFile(content, "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(parsed.Headers) != 1 || parsed.Headers[0].Line != tt.line {
+			t.Errorf("headers of %q = %+v, want one with line %q", tt.heading, parsed.Headers, tt.line)
+		}
+	}
+}
+
+func TestSourcePosition(t *testing.T) {
+	source := []byte("first\nsecond é line\n")
+
+	tests := []struct {
+		offset       int
+		line, column int
+	}{
+		{offset: 0, line: 1, column: 1},
+		{offset: 6, line: 2, column: 1},
+		{offset: 15, line: 2, column: 9}, // after the two-byte é
+		{offset: -1, line: 0, column: 0},
+	}
+
+	for _, tt := range tests {
+		line, column := sourcePosition(source, tt.offset)
+		if line != tt.line || column != tt.column {
+			t.Errorf("sourcePosition(%d) = %d:%d, want %d:%d", tt.offset, line, column, tt.line, tt.column)
+		}
+	}
+}
+
+func BenchmarkParseMarkdownFile(b *testing.B) {
+	content := []byte("# Title\n\nSee [other](other.md#section) and a note[^1].\n\n## Section\n\nText.\n\n[^1]: A [linked](third.md) footnote.\n")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseMarkdownFile(content, "/project"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// fuzzSeeds are malformed inputs the fuzz targets start from.
+var fuzzSeeds = []string{
+	"# Title\n\nSee [other](other.md#section) and a note[^1].\n\n[^1]: A [linked](third.md) footnote.\n",
+	"```go\nunterminated fence\n",
+	"[^a]: Outer note[^b].\n\n[^b]: Inner note[^a].\n\nText[^a].\n",
+	"# " + strings.Repeat("huge heading ", 500) + "\n",
+	"---\ntitle: [unclosed\n---\n\n# Front matter\n",
+	"> - [^1]\n>   > [x](<a b.md>)\n\n[^1]:\n    ```\n",
+	"\xef\xbb\xbf\x00\xff[](#)\n",
+}
+
+func FuzzParseMarkdownFile(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, content []byte) {
+		parsed, err := ParseMarkdownFile(content, "/project")
+		if err != nil {
+			return
+		}
+		for _, header := range parsed.Headers {
+			if header.Level < 1 || header.Level > 6 {
+				t.Errorf("header %q has level %d", header.Text, header.Level)
+			}
+		}
+	})
+}
+
+func FuzzExtractFootnoteMarkdown(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, content []byte) {
+		doc := defaultParser().Parser().Parse(text.NewReader(content))
+		ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+			if footnote, ok := n.(*extast.Footnote); ok && entering {
+				markdown := extractFootnoteMarkdown(footnote, content)
+				if markdown != strings.TrimSpace(markdown) {
+					t.Errorf("footnote markdown %q is not trimmed", markdown)
+				}
+			}
+			return ast.WalkContinue, nil
+		})
+	})
+}
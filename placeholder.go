@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	markdown "github.com/teekennedy/goldmark-markdown"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// errInvalidUTF8 is reported for files whose content is not valid UTF-8.
+var errInvalidUTF8 = errors.New("content is not valid UTF-8")
+
+// errBinaryContent is reported for files that look like binary data, such as an
+// image misnamed as .md. They are skipped even with --degrade-gracefully, since
+// their raw source would only be garbage.
+var errBinaryContent = errors.New("content looks like binary data")
+
+// looksBinary reports whether content looks like binary data rather than text:
+// whether its first 8000 bytes, as git inspects, contain NUL or another control
+// byte that doesn't occur in text (the same set net/http's sniffing uses).
+func looksBinary(content []byte) bool {
+	for _, b := range content[:min(len(content), 8000)] {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\f' && b != '\r' && b != 0x1b {
+			return true
+		}
+	}
+	return false
+}
+
+// panicError wraps a value recovered from a panic during file processing,
+// together with the stack trace at the point of the panic.
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// rootCause returns the innermost error wrapped by err, which describes the
+// problem without the file paths added by each layer of wrapping.
+func rootCause(err error) error {
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return err
+		}
+		err = inner
+	}
+}
+
+// RenderPlaceholder renders a stand-in section for a file that could not be
+// processed: the usual section header, a warning banner naming the cause, and
+// the file's raw source in a fenced code block. Used by --degrade-gracefully so
+// that one bad file doesn't cost readers the rest of the document.
+//
+// Invalid UTF-8 sequences in the source are replaced with U+FFFD so that the
+// placeholder itself is always valid output.
+func (fp *FileProcessor) RenderPlaceholder(filename string, content []byte, cause error) ([]byte, error) {
+	source := []byte(strings.ToValidUTF8(string(content), "�"))
+
+	doc := ast.NewDocument()
+
+	heading := ast.NewHeading(1)
+	heading.AppendChild(heading, newLiteral(fp.sectionTitle(filename)))
+	doc.AppendChild(doc, heading)
+
+	banner := ast.NewParagraph()
+	label := ast.NewEmphasis(2)
+	label.AppendChild(label, ast.NewString([]byte("Warning:")))
+	banner.AppendChild(banner, label)
+	message := fmt.Sprintf(" catmd could not process this file (%v). Its raw source is included below.", rootCause(cause))
+	banner.AppendChild(banner, newLiteral(message))
+	quote := ast.NewBlockquote()
+	quote.AppendChild(quote, banner)
+	quote.SetBlankPreviousLines(true)
+	doc.AppendChild(doc, quote)
+
+	code := ast.NewFencedCodeBlock(nil)
+	code.SetLines(sourceLines(source))
+	code.SetBlankPreviousLines(true)
+	doc.AppendChild(doc, code)
+
+	renderer := fp.renderers.Get().(*markdown.Renderer)
+	defer fp.renderers.Put(renderer)
+
+	var buf bytes.Buffer
+	if err := renderer.Render(&buf, source, doc); err != nil {
+		return nil, fmt.Errorf("failed to render placeholder for %q: %w", filename, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// sourceLines returns one segment per line of source, including line endings.
+func sourceLines(source []byte) *text.Segments {
+	lines := text.NewSegments()
+	start := 0
+	for start < len(source) {
+		end := bytes.IndexByte(source[start:], '\n')
+		if end < 0 {
+			end = len(source)
+		} else {
+			end += start + 1
+		}
+		lines.Append(text.NewSegment(start, end))
+		start = end
+	}
+	return lines
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// PlanEntry is a file --dry-run would concatenate.
+type PlanEntry struct {
+	Path   string `json:"path"`             // Shown relative to the working directory
+	Depth  int    `json:"depth"`            // Links followed from the root to reach the file, -1 for orphans
+	Parent string `json:"parent,omitempty"` // File whose link first led to this one, empty for the root and orphans
+}
+
+// BuildPlan lists orderedFiles, in the order they would be concatenated, with
+// where traversal found them. Files no link led to other than rootFile, such
+// as those --append-orphans adds, are orphans.
+func BuildPlan(traversal *FileTraversal, orderedFiles []string, rootFile string) []PlanEntry {
+	plan := []PlanEntry{}
+	for _, file := range orderedFiles {
+		entry := PlanEntry{Path: displayPath(file), Depth: traversal.Depth(file)}
+		if parent := traversal.Parent(file); parent != "" {
+			entry.Parent = displayPath(parent)
+		} else if file != rootFile {
+			entry.Depth = -1
+		}
+		plan = append(plan, entry)
+	}
+	return plan
+}
+
+// runDryRun implements --dry-run: it writes the plan of orderedFiles as a table,
+// or as JSON with --json, instead of processing them.
+func runDryRun(traversal *FileTraversal, orderedFiles []string, rootFile string, opts Options) error {
+	writer, closeOutput, err := createOutput(opts.Output)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	plan := BuildPlan(traversal, orderedFiles, rootFile)
+	if opts.JSON {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(plan)
+	} else {
+		err = writePlanTable(writer, plan)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+// writePlanTable writes one row per file, followed by the number of files.
+func writePlanTable(w io.Writer, plan []PlanEntry) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "DEPTH\tFILE\tFROM\n")
+	for _, entry := range plan {
+		depth, parent := strconv.Itoa(entry.Depth), entry.Parent
+		if entry.Depth < 0 {
+			depth, parent = "-", "(orphan)"
+		} else if parent == "" {
+			parent = "(root)"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", depth, entry.Path, parent)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nFiles: %d\n", len(plan))
+	return err
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+)
+
+// isEmptyDocument reports whether doc would leave nothing but a heading in its
+// section: it has only HTML comments, which don't show, and footnote
+// definitions, which are moved to where they are referenced.
+func isEmptyDocument(doc ast.Node) bool {
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		switch node := child.(type) {
+		case *ast.HTMLBlock:
+			if node.HTMLBlockType != ast.HTMLBlockType2 {
+				return false
+			}
+		case *extast.FootnoteList:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// pruneEmpty implements --prune-empty: it leaves the files in empty out of the
+// output, and sends links to each of them to the section of the file that
+// first links to it instead, or to the root file's. The root file itself is
+// always kept.
+func (fp *FileProcessor) pruneEmpty(empty map[string]bool) {
+	var kept []string
+	for i, file := range fp.files {
+		if i == 0 || !empty[file] {
+			kept = append(kept, file)
+			continue
+		}
+		to := fp.files[0]
+		for _, source := range fp.backlinks[file] {
+			if fp.fileOrder[source] < i {
+				to = source
+				if parent, ok := fp.pruned[source]; ok {
+					to = parent
+				}
+				break
+			}
+		}
+		fp.pruned[file] = to
+		delete(fp.visitedFiles, file)
+	}
+	fp.files = kept
+
+	for target, sources := range fp.backlinks {
+		var included []string
+		for _, source := range sources {
+			if _, ok := fp.pruned[source]; !ok {
+				included = append(included, source)
+			}
+		}
+		fp.backlinks[target] = included
+	}
+}
+
+// retarget returns the included file a link to target, written as
+// destination, lands on and the destination to rewrite it from: target and
+// destination themselves, or for a file --prune-empty left out, the file that
+// linked to it and destination without its fragment. It reports false when
+// target isn't in the output at all.
+func (fp *FileProcessor) retarget(target, destination string) (string, string, bool) {
+	if to, ok := fp.pruned[target]; ok {
+		path, _, _ := strings.Cut(destination, "#")
+		return to, path, true
+	}
+	return target, destination, fp.visitedFiles[target]
+}
+
+// Files returns the files the processor includes in traversal order: those it
+// was created with, less any that --prune-empty left out.
+func (fp *FileProcessor) Files() []string {
+	return fp.files
+}
+
+// Pruned returns the files --prune-empty left out, in traversal order.
+func (fp *FileProcessor) Pruned(orderedFiles []string) []string {
+	var pruned []string
+	for _, file := range orderedFiles {
+		if _, ok := fp.pruned[file]; ok {
+			pruned = append(pruned, file)
+		}
+	}
+	return pruned
+}
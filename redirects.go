@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Redirect formats accepted by --redirects, with the file each is written to by
+// default.
+var redirectFiles = map[string]string{
+	"netlify": "_redirects",
+	"nginx":   "redirects.conf",
+	"json":    "redirects.json",
+}
+
+// Redirect maps the URL path a file was published at on its own to its section
+// in the combined document. From is percent-encoded like any URL path.
+type Redirect struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Redirects computes a redirect for every included file. A file's old URL is its
+// path relative to the scope directory without the markdown extension; index and
+// README files map to their directory. The root file redirects to the combined
+// document itself, every other file to its section anchor.
+func (fp *FileProcessor) Redirects(orderedFiles []string, rootFile, targetURL string) []Redirect {
+	var redirects []Redirect
+	for _, file := range orderedFiles {
+		rel, err := filepath.Rel(fp.scopeDir, file)
+		if err != nil {
+			continue
+		}
+
+		from := "/" + strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel))
+		switch strings.ToLower(filepath.Base(from)) {
+		case "index", "readme":
+			from = strings.TrimSuffix(from, filepath.Base(from))
+		}
+		from = escapePath(from)
+
+		to := targetURL
+		if file != rootFile {
+			to += fp.generateTargetAnchor(file)
+		}
+
+		if from != to {
+			redirects = append(redirects, Redirect{From: from, To: to})
+		}
+	}
+	return redirects
+}
+
+// escapePath percent-encodes each segment of a slash-separated path.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// WriteRedirects writes redirects in the given format: a Netlify _redirects file,
+// an nginx configuration snippet, or a JSON array.
+func WriteRedirects(w io.Writer, format string, redirects []Redirect) error {
+	switch format {
+	case "netlify":
+		// Fields are separated by whitespace, with no way to quote it
+		for _, r := range redirects {
+			if strings.ContainsFunc(r.From+r.To, unicode.IsSpace) {
+				return fmt.Errorf("redirect from %q to %q can't be written for Netlify: it contains whitespace", r.From, r.To)
+			}
+			if _, err := fmt.Fprintf(w, "%s %s 301\n", r.From, r.To); err != nil {
+				return err
+			}
+		}
+	case "nginx":
+		for _, r := range redirects {
+			// nginx matches locations against the decoded path
+			from, err := url.PathUnescape(r.From)
+			if err != nil {
+				return fmt.Errorf("invalid redirect path %q: %w", r.From, err)
+			}
+			location, err := nginxString(from)
+			if err != nil {
+				return err
+			}
+			// Variables are expanded in the return URL, and can't be escaped
+			// except by encoding the dollar sign
+			to, err := nginxString(strings.ReplaceAll(r.To, "$", "%24"))
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "location = %s { return 301 %s; }\n", location, to); err != nil {
+				return err
+			}
+		}
+	case "json":
+		if redirects == nil {
+			redirects = []Redirect{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(redirects)
+	default:
+		return fmt.Errorf("unknown redirects format %q", format)
+	}
+	return nil
+}
+
+// nginxString writes s as a single nginx configuration token, quoting it if it
+// holds characters that would otherwise end the token or start a comment.
+// Control characters are rejected.
+func nginxString(s string) (string, error) {
+	if strings.ContainsFunc(s, unicode.IsControl) {
+		return "", fmt.Errorf("redirect path %q can't be written for nginx: it contains control characters", s)
+	}
+	if s != "" && !strings.ContainsAny(s, " \"'{};\\") && !strings.HasPrefix(s, "#") {
+		return s, nil
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteRedirects(t *testing.T) {
+	redirects := []Redirect{
+		{From: "/guide/", To: "/book#user-guide"},
+		{From: "/faq", To: "/book#faq"},
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format:   "netlify",
+			expected: "/guide/ /book#user-guide 301\n/faq /book#faq 301\n",
+		},
+		{
+			format:   "nginx",
+			expected: "location = /guide/ { return 301 /book#user-guide; }\nlocation = /faq { return 301 /book#faq; }\n",
+		},
+		{
+			format: "json",
+			expected: `[
+  {
+    "from": "/guide/",
+    "to": "/book#user-guide"
+  },
+  {
+    "from": "/faq",
+    "to": "/book#faq"
+  }
+]
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteRedirects(&buf, tt.format, redirects); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("WriteRedirects(%q) = %q, want %q", tt.format, buf.String(), tt.expected)
+			}
+		})
+	}
+
+	if err := WriteRedirects(&bytes.Buffer{}, "apache", redirects); err == nil {
+		t.Error("WriteRedirects with unknown format succeeded, want error")
+	}
+}
+
+func TestWriteRedirects_UnsafePaths(t *testing.T) {
+	redirects := []Redirect{
+		{From: escapePath("/release notes;v2"), To: "/book#release-notes"},
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format:   "netlify",
+			expected: "/release%20notes%3Bv2 /book#release-notes 301\n",
+		},
+		{
+			format:   "nginx",
+			expected: "location = \"/release notes;v2\" { return 301 /book#release-notes; }\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteRedirects(&buf, tt.format, redirects); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("WriteRedirects(%q) = %q, want %q", tt.format, buf.String(), tt.expected)
+			}
+		})
+	}
+
+	// A target with whitespace can't be written for Netlify at all
+	spaced := []Redirect{{From: "/faq", To: "/my book#faq"}}
+	if err := WriteRedirects(&bytes.Buffer{}, "netlify", spaced); err == nil {
+		t.Error("WriteRedirects wrote a Netlify target with a space, want error")
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	markdown "github.com/teekennedy/goldmark-markdown"
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// newMarkdownRenderer creates a goldmark-markdown renderer with catmd's node
+// renderer overrides registered, followed by custom, the node renderers of
+// Options.NodeRenderers.
+func newMarkdownRenderer(custom map[ast.NodeKind]renderer.NodeRendererFunc) *markdown.Renderer {
+	r := markdown.NewRenderer()
+	r.Register(ast.KindFencedCodeBlock, renderFencedCodeBlock)
+	r.Register(ast.KindCodeSpan, renderCodeSpan)
+	r.Register(extast.KindTable, renderTable)
+	r.Register(extast.KindTableHeader, renderTableRow)
+	r.Register(extast.KindTableRow, renderTableRow)
+	r.Register(extast.KindTableCell, renderTableCell)
+	r.Register(extast.KindStrikethrough, renderStrikethrough)
+	r.Register(extast.KindTaskCheckBox, renderTaskCheckBox)
+	r.Register(kindLiteral, renderLiteral)
+	r.Register(kindEndnoteRef, renderEndnoteRef)
+	r.Register(kindRenderedMarkdown, renderRenderedMarkdown)
+	r.Register(kindAbbreviationDefinition, renderAbbreviationDefinition)
+	for kind, render := range custom {
+		r.Register(kind, render)
+	}
+	return r
+}
+
+// renderFencedCodeBlock renders a fenced code block with a fence long enough that
+// no line of the content can close it early. The stock renderer always uses three
+// backticks, which breaks blocks that themselves contain ``` fences.
+//
+// Registered renderers replace the stock block separator handling, so the blank
+// line before the block and the line flush after it are written here as well.
+func renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.FencedCodeBlock)
+	fence := codeFence(n.Lines(), source)
+
+	if !entering {
+		_, err := w.Write(append(fence, '\n'))
+		return ast.WalkContinue, err
+	}
+
+	if n.PreviousSibling() != nil && n.HasBlankPreviousLines() {
+		_, _ = w.Write([]byte{'\n'})
+	}
+
+	_, _ = w.Write(fence)
+	if n.Info != nil {
+		_, _ = w.Write(n.Info.Value(source))
+	}
+	_, _ = w.Write([]byte{'\n'})
+
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		line := segment.Value(source)
+		if !bytes.HasSuffix(line, []byte{'\n'}) {
+			line = append(line, '\n')
+		}
+		if _, err := w.Write(line); err != nil {
+			return ast.WalkStop, err
+		}
+	}
+
+	return ast.WalkContinue, nil
+}
+
+// codeFence returns a backtick fence longer than any backtick run that opens a
+// line of the given content, and at least three backticks long.
+func codeFence(lines *text.Segments, source []byte) []byte {
+	longest := 2
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		line := bytes.TrimLeft(segment.Value(source), " ")
+		run := len(line) - len(bytes.TrimLeft(line, "`"))
+		if run > longest {
+			longest = run
+		}
+	}
+	return bytes.Repeat([]byte{'`'}, longest+1)
+}
+
+// renderCodeSpan renders a code span between the shortest run of backticks
+// its content doesn't contain, padded with spaces where the content would
+// otherwise be read differently. In a table cell, pipes in the content are
+// escaped, since GFM splits the row into cells before it finds code spans.
+// Unlike the stock renderer, it also takes code built from String nodes.
+func renderCodeSpan(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	var content []byte
+	for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+		content = append(content, textValue(c, source)...)
+	}
+	if inTableCell(node) {
+		content = bytes.ReplaceAll(content, []byte("|"), []byte(`\|`))
+	}
+
+	fence := bytes.Repeat([]byte{'`'}, codeSpanFence(content))
+	trimmed := bytes.Trim(content, " ")
+	pad := len(content) > 0 && (content[0] == '`' || content[len(content)-1] == '`' ||
+		len(trimmed) > 0 && content[0] == ' ' && content[len(content)-1] == ' ')
+
+	_, _ = w.Write(fence)
+	if pad {
+		_ = w.WriteByte(' ')
+	}
+	_, _ = w.Write(content)
+	if pad {
+		_ = w.WriteByte(' ')
+	}
+	_, err := w.Write(fence)
+	return ast.WalkSkipChildren, err
+}
+
+// codeSpanFence returns the length of the shortest run of backticks that
+// doesn't occur in content, which is the shortest that can enclose it.
+func codeSpanFence(content []byte) int {
+	runs := make(map[int]bool)
+	run := 0
+	for _, c := range content {
+		if c == '`' {
+			run++
+			continue
+		}
+		runs[run] = true
+		run = 0
+	}
+	runs[run] = true
+	length := 1
+	for runs[length] {
+		length++
+	}
+	return length
+}
+
+// inTableCell reports whether node is inside a table cell.
+func inTableCell(node ast.Node) bool {
+	for n := node.Parent(); n != nil; n = n.Parent() {
+		if n.Kind() == extast.KindTableCell {
+			return true
+		}
+	}
+	return false
+}
+
+// renderTable renders a GFM table block. The stock renderer has no notion of the
+// GFM extension nodes and panics on them, so tables, strikethrough, and task list
+// checkboxes are all rendered here.
+func renderTable(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	// A table can't follow a paragraph directly, and goldmark doesn't record
+	// the blank line before tables it carves out of paragraphs, so always add one
+	if entering && node.PreviousSibling() != nil {
+		_, _ = w.Write([]byte{'\n'})
+	}
+	return ast.WalkContinue, nil
+}
+
+// renderTableRow renders the pipes around a table row, followed by the delimiter
+// row with the column alignments when the row is the header.
+func renderTableRow(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, err := w.Write([]byte{'|'})
+		return ast.WalkContinue, err
+	}
+
+	_, _ = w.Write([]byte{'\n'})
+	if _, ok := node.(*extast.TableHeader); ok {
+		if table, ok := node.Parent().(*extast.Table); ok {
+			_, _ = w.Write(tableDelimiterRow(table.Alignments))
+		}
+	}
+	return ast.WalkContinue, nil
+}
+
+// renderTableCell pads a cell's content and closes it with a pipe.
+func renderTableCell(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, err := w.Write([]byte{' '})
+		return ast.WalkContinue, err
+	}
+	_, err := w.Write([]byte(" |"))
+	return ast.WalkContinue, err
+}
+
+// tableDelimiterRow returns the line separating a table's header from its body.
+func tableDelimiterRow(alignments []extast.Alignment) []byte {
+	row := []byte{'|'}
+	for _, alignment := range alignments {
+		switch alignment {
+		case extast.AlignLeft:
+			row = append(row, " :-- |"...)
+		case extast.AlignRight:
+			row = append(row, " --: |"...)
+		case extast.AlignCenter:
+			row = append(row, " :-: |"...)
+		default:
+			row = append(row, " --- |"...)
+		}
+	}
+	return append(row, '\n')
+}
+
+// renderStrikethrough renders ~~deleted~~ text.
+func renderStrikethrough(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	_, err := w.Write([]byte("~~"))
+	return ast.WalkContinue, err
+}
+
+// renderTaskCheckBox renders the [x] or [ ] that opens a task list item.
+func renderTaskCheckBox(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	box := "[ ] "
+	if node.(*extast.TaskCheckBox).IsChecked {
+		box = "[x] "
+	}
+	_, err := w.Write([]byte(box))
+	return ast.WalkContinue, err
+}
+
+// kindLiteral is the node kind of literals.
+var kindLiteral = ast.NewNodeKind("Literal")
+
+// literal is inline text catmd adds to a document, like a file path, which the
+// renderer escapes so it reads back as written rather than as markdown syntax.
+type literal struct {
+	ast.BaseInline
+	value string
+}
+
+// newLiteral returns a literal of value.
+func newLiteral(value string) *literal {
+	return &literal{value: value}
+}
+
+// Kind implements ast.Node.
+func (n *literal) Kind() ast.NodeKind {
+	return kindLiteral
+}
+
+// Dump implements ast.Node.
+func (n *literal) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Value": n.value}, nil)
+}
+
+// renderLiteral writes a literal's value escaped.
+func renderLiteral(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*literal)
+	_, err := w.WriteString(escapeMarkdown(n.value, n.PreviousSibling() == nil))
+	return ast.WalkContinue, err
+}
+
+// escapeMarkdown backslash-escapes the characters of s that could open inline
+// markdown syntax, pipes included so it can go in table cells, and replaces
+// line breaks with spaces. When s opens a block, a leading marker that would
+// make it a heading, block quote, list item, or thematic break is escaped too.
+func escapeMarkdown(s string, opensBlock bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\n' || r == '\r':
+			b.WriteByte(' ')
+			continue
+		case strings.ContainsRune("\\`*_[]<>&|~", r):
+			b.WriteByte('\\')
+		case opensBlock && i == 0 && strings.ContainsRune("#>-+=", r):
+			b.WriteByte('\\')
+		case opensBlock && (r == '.' || r == ')') && i > 0 && isDigits(s[:i]):
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isDigits reports whether s is all ASCII digits.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
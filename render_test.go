@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+func TestCodeFence(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name:     "plain content",
+			content:  "echo hello\n",
+			expected: "```",
+		},
+		{
+			name:     "inner three-backtick fence",
+			content:  "```go\nx := 1\n```\n",
+			expected: "````",
+		},
+		{
+			name:     "indented inner fence",
+			content:  "text\n  `````\n",
+			expected: "``````",
+		},
+		{
+			name:     "backticks mid-line are harmless",
+			content:  "use ```` inline\n",
+			expected: "```",
+		},
+		{
+			name:     "empty content",
+			content:  "",
+			expected: "```",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := []byte(tt.content)
+			result := string(codeFence(sourceLines(source), source))
+			if result != tt.expected {
+				t.Errorf("codeFence(%q) = %q, want %q", tt.content, result, tt.expected)
+			}
+		})
+	}
+}
+
+// kindBadge is the node kind badgeExtension appends to every document.
+var kindBadge = ast.NewNodeKind("Badge")
+
+type badgeNode struct {
+	ast.BaseBlock
+}
+
+func (n *badgeNode) Kind() ast.NodeKind { return kindBadge }
+
+func (n *badgeNode) Dump(source []byte, level int) { ast.DumpHelper(n, source, level, nil, nil) }
+
+// badgeExtension is an embedder's extension producing a custom node kind.
+type badgeExtension struct{}
+
+func (badgeExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(badgeExtension{}, 100)))
+}
+
+func (badgeExtension) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	doc.AppendChild(doc, &badgeNode{})
+}
+
+func TestCustomNodeRenderers(t *testing.T) {
+	renderBadge := func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.WriteString("\n![badge](badge.svg)\n")
+		}
+		return ast.WalkContinue, nil
+	}
+	opts := Options{
+		Extensions:    []goldmark.Extender{badgeExtension{}},
+		NodeRenderers: map[ast.NodeKind]renderer.NodeRendererFunc{kindBadge: renderBadge},
+	}
+	processor := NewFileProcessor("/project", []string{"/project/index.md"}, opts)
+	output, err := processor.ProcessFile("/project/index.md", []byte("# Title\n\nText.\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "Text.\n\n![badge](badge.svg)") {
+		t.Errorf("output does not contain the custom node:\n%s", output)
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"plain text", "docs/guide.md", "docs/guide.md\n"},
+		{"emphasis characters", "a_b*c", "a\\_b\\*c\n"},
+		{"link and html", "[x](y) <b>", "\\[x\\](y) \\<b\\>\n"},
+		{"table pipe", "a|b", "a\\|b\n"},
+		{"heading marker", "# not a heading", "\\# not a heading\n"},
+		{"list marker", "- not an item", "\\- not an item\n"},
+		{"ordered list marker", "1. not an item", "1\\. not an item\n"},
+		{"line break", "one\ntwo", "one two\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := ast.NewDocument()
+			paragraph := ast.NewParagraph()
+			paragraph.AppendChild(paragraph, newLiteral(tt.value))
+			doc.AppendChild(doc, paragraph)
+
+			var buf strings.Builder
+			if err := newMarkdownRenderer(nil).Render(&buf, nil, doc); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("got %q, want %q", buf.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestCodeSpanFence(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected int
+	}{
+		{"plain", 1},
+		{"a ` b", 2},
+		{"a `` b", 1},
+		{"` and ``", 3},
+		{"``", 1},
+	}
+
+	for _, tt := range tests {
+		if got := codeSpanFence([]byte(tt.content)); got != tt.expected {
+			t.Errorf("codeSpanFence(%q) = %d, want %d", tt.content, got, tt.expected)
+		}
+	}
+}
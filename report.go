@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// File statuses recorded in the run report.
+const (
+	StatusIncluded    = "included"    // Processed and written to the output
+	StatusPlaceholder = "placeholder" // Replaced by a --degrade-gracefully placeholder
+	StatusSkipped     = "skipped"     // Left out because it couldn't be read or processed
+	StatusTruncated   = "truncated"   // Left out to keep the output within --max-output-bytes
+	StatusPruned      = "pruned"      // Left out by --prune-empty for having nothing to show
+)
+
+// Report is the machine-readable summary of a run written by --report.
+type Report struct {
+	Root   string        `json:"root"`
+	Output string        `json:"output"`
+	Files  []ReportFile  `json:"files"`  // In traversal order
+	Assets []ReportAsset `json:"assets"` // In order of first reference
+	Lint   []ReportLint  `json:"lint,omitempty"`
+}
+
+// ReportFile records what happened to one traversed markdown file.
+type ReportFile struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReportAsset is a non-markdown file referenced by an included file, such as an
+// image or a download link. Publishing pipelines copy these alongside the
+// combined document.
+type ReportAsset struct {
+	Reference    string   `json:"reference"`     // Destination as first written in the source
+	Path         string   `json:"path"`          // Resolved path of the file
+	Exists       bool     `json:"exists"`        // Whether the file exists
+	ReferencedBy []string `json:"referenced_by"` // Files referencing it, in traversal order
+
+	target string // Absolute path of the file
+}
+
+// ReportLint is a --lint violation found in the generated output, or in a
+// source file for the rules that check sources.
+type ReportLint struct {
+	Rule    string `json:"rule"`
+	File    string `json:"file,omitempty"` // Source file, empty for the generated output
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// NewReport starts a report for a run from rootFile.
+func NewReport(rootFile, output string) *Report {
+	return &Report{
+		Root:   displayPath(rootFile),
+		Output: output,
+		Files:  []ReportFile{},
+		Assets: []ReportAsset{},
+	}
+}
+
+// AddFile records the outcome for one file; err may be nil.
+func (r *Report) AddFile(filename, status string, err error) {
+	file := ReportFile{Path: displayPath(filename), Status: status}
+	if err != nil {
+		file.Error = err.Error()
+	}
+	r.Files = append(r.Files, file)
+}
+
+// AddLint records lint violations found in the output.
+func (r *Report) AddLint(diagnostics []Diagnostic) {
+	for _, d := range diagnostics {
+		r.Lint = append(r.Lint, ReportLint{Rule: d.Rule, Line: d.Line, Column: d.Column, Message: d.Message})
+	}
+}
+
+// AddSourceLint records lint violations found in source files.
+func (r *Report) AddSourceLint(diagnostics []Diagnostic) {
+	for _, d := range diagnostics {
+		r.Lint = append(r.Lint, ReportLint{Rule: d.Rule, File: displayPath(d.File), Line: d.Line, Column: d.Column, Message: d.Message})
+	}
+}
+
+// CollectAssets scans the given files for images and links to local files that
+// aren't markdown, recording each distinct target once. Fragments and query
+// strings are ignored when resolving targets.
+func (r *Report) CollectAssets(files []string, scopeDir string, snapshot *Snapshot) {
+	index := make(map[string]int)
+	for _, file := range files {
+		parsed, err := snapshot.ParseFile(file, scopeDir)
+		if err != nil {
+			continue
+		}
+
+		for _, reference := range assetReferences(parsed.AST) {
+			target, ok := resolveAsset(file, reference)
+			if !ok {
+				continue
+			}
+
+			i, seen := index[target]
+			if !seen {
+				_, statErr := os.Stat(target)
+				i = len(r.Assets)
+				index[target] = i
+				r.Assets = append(r.Assets, ReportAsset{
+					Reference: reference,
+					Path:      displayPath(target),
+					Exists:    statErr == nil,
+					target:    target,
+				})
+			}
+
+			asset := &r.Assets[i]
+			source := displayPath(file)
+			if n := len(asset.ReferencedBy); n == 0 || asset.ReferencedBy[n-1] != source {
+				asset.ReferencedBy = append(asset.ReferencedBy, source)
+			}
+		}
+	}
+}
+
+// assetReferences returns the destinations of every image and link in doc, in
+// document order.
+func assetReferences(doc ast.Node) []string {
+	var references []string
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Image:
+			references = append(references, string(node.Destination))
+		case *ast.Link:
+			references = append(references, string(node.Destination))
+		}
+		return ast.WalkContinue, nil
+	})
+	return references
+}
+
+// resolveAsset resolves a reference relative to the file containing it, and
+// reports whether it names a local file other than a markdown document.
+func resolveAsset(currentFile, reference string) (string, bool) {
+	if path, ok := fileURLPath(reference); ok {
+		reference = path
+	} else {
+		if reference == "" || strings.HasPrefix(reference, "#") || strings.Contains(reference, ":") {
+			return "", false
+		}
+		if i := strings.IndexAny(reference, "?#"); i >= 0 {
+			reference = reference[:i]
+		}
+		if unescaped, err := url.PathUnescape(reference); err == nil {
+			reference = unescaped
+		}
+	}
+
+	switch strings.ToLower(filepath.Ext(reference)) {
+	case ".md", ".markdown":
+		return "", false
+	}
+
+	target, err := resolveLinkTarget(currentFile, reference)
+	if err != nil {
+		return "", false
+	}
+	return target, true
+}
+
+// WriteReport writes the report as indented JSON to path.
+func WriteReport(path string, report *Report) error {
+	writer, closeOutput, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	return report.Encode(writer)
+}
+
+// Encode writes the report as indented JSON.
+func (r *Report) Encode(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+)
+
+// The subset of the SARIF 2.1.0 object model needed to report diagnostics.
+// See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// WriteSARIF writes diagnostics as a SARIF 2.1.0 log so that code review tools
+// and editors can annotate the offending source lines. Artifact URIs are relative
+// to the working directory, which is where such tools expect catmd to be run from.
+func WriteSARIF(w io.Writer, diagnostics []Diagnostic) error {
+	driver := sarifDriver{
+		Name:           "catmd",
+		InformationURI: "https://github.com/brandonbloom/catmd",
+	}
+	for _, rule := range []string{RuleBrokenLink, RuleBadAnchor, RuleMissingAlt, RuleOrphan} {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:               rule,
+			ShortDescription: sarifMessage{Text: ruleDescriptions[rule]},
+		})
+	}
+
+	results := []sarifResult{}
+	for _, d := range diagnostics {
+		location := sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: (&url.URL{Path: displayPath(d.File)}).String()},
+		}
+		if d.Line > 0 {
+			location.Region = &sarifRegion{StartLine: d.Line, StartColumn: d.Column}
+		}
+		results = append(results, sarifResult{
+			RuleID:    d.Rule,
+			Level:     "warning",
+			Message:   sarifMessage{Text: d.Message},
+			Locations: []sarifLocation{{PhysicalLocation: location}},
+		})
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: driver},
+			Results: results,
+		}},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
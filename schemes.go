@@ -0,0 +1,95 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// defaultExternalSchemes are the URL schemes of links that lead out of the
+// document without being web pages, besides http and https. --external-schemes
+// adds to them.
+var defaultExternalSchemes = []string{"mailto", "tel", "sms"}
+
+// schemePattern matches a URL scheme as RFC 3986 defines it.
+var schemePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*$`)
+
+// urlScheme returns the lowercased scheme of url, or "" if it has none. A
+// single letter before the colon is taken for a Windows drive letter rather
+// than a scheme.
+func urlScheme(url string) string {
+	scheme, _, ok := strings.Cut(url, ":")
+	if !ok || len(scheme) < 2 || !schemePattern.MatchString(scheme) {
+		return ""
+	}
+	return strings.ToLower(scheme)
+}
+
+// isExternalScheme reports whether url has http, https, or one of the schemes
+// of defaultExternalSchemes or extra, which never name files in the scope.
+func isExternalScheme(url string, extra []string) bool {
+	switch scheme := urlScheme(url); scheme {
+	case "":
+		return false
+	case "http", "https":
+		return true
+	default:
+		return slices.Contains(defaultExternalSchemes, scheme) || slices.ContainsFunc(extra, func(s string) bool {
+			return strings.EqualFold(s, scheme)
+		})
+	}
+}
+
+// schemeList splits the --external-schemes list, accepting each scheme as
+// "slack", "slack:", or "slack://".
+func schemeList(list string) []string {
+	schemes := splitList(list)
+	for i, scheme := range schemes {
+		schemes[i] = strings.TrimSuffix(strings.TrimSuffix(scheme, "//"), ":")
+	}
+	return schemes
+}
+
+// stripSchemeLinks replaces links and autolinks with external schemes other
+// than http and https, such as mailto: and tel:, by their text, for output
+// meant for paper or LLM ingestion, where they lead nowhere.
+func (fp *FileProcessor) stripSchemeLinks(doc ast.Node, source []byte) {
+	var stripped []ast.Node
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var url string
+		switch node := n.(type) {
+		case *ast.Link:
+			url = string(node.Destination)
+		case *ast.AutoLink:
+			url = string(node.URL(source))
+			if node.AutoLinkType == ast.AutoLinkEmail {
+				url = "mailto:" + url
+			}
+		default:
+			return ast.WalkContinue, nil
+		}
+		if scheme := urlScheme(url); scheme != "http" && scheme != "https" && isExternalScheme(url, fp.opts.Schemes) {
+			stripped = append(stripped, n)
+		}
+		return ast.WalkSkipChildren, nil
+	})
+
+	for _, n := range stripped {
+		parent := n.Parent()
+		if autoLink, ok := n.(*ast.AutoLink); ok {
+			parent.ReplaceChild(parent, n, ast.NewString(autoLink.Label(source)))
+			continue
+		}
+		for child := n.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			parent.InsertBefore(parent, n, child)
+			child = next
+		}
+		parent.RemoveChild(parent, n)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestIsExternalScheme(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com", true},
+		{"mailto:docs@example.com", true},
+		{"TEL:+15551234", true},
+		{"sms:+15551234", true},
+		{"slack://open", true},
+		{"zoommtg://zoom.us/join", false},
+		{"guide.md", false},
+		{"C:/docs/guide.md", false},
+		{"#setup", false},
+	}
+	for _, tt := range tests {
+		if got := isExternalScheme(tt.url, []string{"Slack"}); got != tt.want {
+			t.Errorf("isExternalScheme(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
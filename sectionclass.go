@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// sectionClassList returns the classes of the div --section-classes wraps the
+// section of filename in: catmd-section, one derived from the file's path
+// relative to the scope directory, like catmd-path-api-overview for
+// api/overview.md, and one for each of its front matter tags, like
+// catmd-tag-deprecated.
+func (fp *FileProcessor) sectionClassList(filename string, frontMatter map[string]interface{}) []string {
+	path := fp.relPath(filename)
+	classes := []string{"catmd-section", "catmd-path-" + classToken(strings.TrimSuffix(path, filepath.Ext(path)))}
+	for _, tag := range frontMatterStrings(frontMatter, "tags") {
+		if token := classToken(tag); token != "" {
+			classes = append(classes, "catmd-tag-"+token)
+		}
+	}
+	return classes
+}
+
+// classToken lowercases s and replaces each run of characters other than
+// letters and digits with a dash, for use in a class name.
+func classToken(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// kindSectionDiv is the node kind of section divs.
+var kindSectionDiv = ast.NewNodeKind("SectionDiv")
+
+// sectionDiv is the section of an included file in the HTML page, which
+// --section-classes renders as a div. Its children are the section's blocks.
+type sectionDiv struct {
+	ast.BaseBlock
+	path    string   // Path of the file relative to the scope directory
+	classes []string // See sectionClassList
+}
+
+// Kind implements ast.Node.
+func (n *sectionDiv) Kind() ast.NodeKind {
+	return kindSectionDiv
+}
+
+// Dump implements ast.Node.
+func (n *sectionDiv) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Path": n.path}, nil)
+}
+
+// sectionClassExtension is the extension --section-classes adds to the HTML
+// renderer, which wraps the blocks of each file's section in a sectionDiv.
+type sectionClassExtension struct {
+	fp       *FileProcessor
+	sections []htmlSection // Where sections start in the document, in order
+}
+
+// Extend implements goldmark.Extender.
+func (e sectionClassExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(e, 500)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 500)))
+}
+
+// Transform implements parser.ASTTransformer.
+func (e sectionClassExtension) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	files := sectionFiles(doc, e.sections)
+	var current *sectionDiv
+	file := ""
+	for child := doc.FirstChild(); child != nil; {
+		following := child.NextSibling()
+		if files[child] != file {
+			current, file = nil, files[child]
+			if file != "" {
+				current = &sectionDiv{path: e.fp.relPath(file), classes: e.fp.divClasses[file]}
+				doc.InsertBefore(doc, child, current)
+			}
+		}
+		if current != nil {
+			current.AppendChild(current, child)
+		}
+		child = following
+	}
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (e sectionClassExtension) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindSectionDiv, renderSectionDiv)
+}
+
+// renderSectionDiv renders a section as a div with its classes and its path in
+// data-path.
+func renderSectionDiv(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*sectionDiv)
+	if !entering {
+		_, err := w.WriteString("</div>\n")
+		return ast.WalkContinue, err
+	}
+	_, err := fmt.Fprintf(w, "<div class=\"%s\" data-path=\"%s\">\n", html.EscapeString(strings.Join(n.classes, " ")), html.EscapeString(n.path))
+	return ast.WalkContinue, err
+}
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestClassToken(t *testing.T) {
+	tests := map[string]string{
+		"deprecated":             "deprecated",
+		"API v1":                 "api-v1",
+		"guides/Getting Started": "guides-getting-started",
+		"--edge--":               "edge",
+		"Café":                   "café",
+		"":                       "",
+	}
+	for input, expected := range tests {
+		if result := classToken(input); result != expected {
+			t.Errorf("classToken(%q) = %q, want %q", input, result, expected)
+		}
+	}
+}
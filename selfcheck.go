@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Self-check modes accepted by --self-check.
+const (
+	SelfCheckWarn  = "warn"  // Report violations on stderr
+	SelfCheckError = "error" // Report violations and fail the run
+	SelfCheckOff   = "off"   // Skip the check, the default
+)
+
+// RuleDuplicateID is the self-check rule for an ID that more than one heading
+// or HTML anchor of the output has.
+const RuleDuplicateID = "duplicate-id"
+
+// VerifyAnchors checks the assembled output against the invariants link
+// rewriting relies on: no two headings or HTML anchors share an ID, and every
+// link to an ID that catmd derived for a section or heading finds it. Links to
+// other fragments are the source's own, and are left to --check and --lint.
+// The File of each diagnostic is left empty for the caller to fill in.
+func (fp *FileProcessor) VerifyAnchors(output []byte) []Diagnostic {
+	promised := make(map[string]bool)
+	for _, file := range fp.files {
+		promised[fp.generateTargetAnchor(file)[1:]] = true
+	}
+	for _, id := range fp.anchors {
+		promised[id] = true
+	}
+	if fp.appendixID != "" {
+		promised[fp.appendixID] = true
+	}
+
+	doc := fp.md.Parser().Parse(text.NewReader(output), parser.WithContext(parser.NewContext(parser.WithIDs(newSlugger(fp.opts)))))
+
+	var diagnostics []Diagnostic
+	report := func(rule string, node ast.Node, format string, args ...any) {
+		line, column := sourcePosition(output, nodeOffset(node))
+		diagnostics = append(diagnostics, Diagnostic{
+			Rule:    rule,
+			Line:    line,
+			Column:  column,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	ids := make(map[string]bool)
+	addID := func(id string, node ast.Node) {
+		if ids[id] {
+			report(RuleDuplicateID, node, "ID %q is used more than once", id)
+		}
+		ids[id] = true
+	}
+
+	var links []*ast.Link
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Heading:
+			if id, ok := node.AttributeString("id"); ok {
+				if id, ok := id.([]byte); ok {
+					addID(string(id), node)
+				}
+			}
+		case *ast.RawHTML:
+			for _, id := range htmlIDs(segmentsValue(node.Segments, output)) {
+				addID(id, node)
+			}
+		case *ast.HTMLBlock:
+			for _, id := range htmlIDs(htmlBlockSource(node, output)) {
+				addID(id, node)
+			}
+		case *ast.Link:
+			links = append(links, node)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, link := range links {
+		id, ok := strings.CutPrefix(string(link.Destination), "#")
+		if ok && promised[id] && !ids[id] {
+			report(RuleBadAnchor, link, "rewritten link points at %q, which no heading or anchor has", "#"+id)
+		}
+	}
+	return diagnostics
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// constantAnchors gives every section the same anchor.
+type constantAnchors struct{}
+
+func (constantAnchors) SectionAnchor(SectionInfo) string {
+	return "section"
+}
+
+func TestFileProcessor_VerifyAnchors(t *testing.T) {
+	dir := t.TempDir()
+	sources := map[string]string{
+		"index.md": "# Index\n\nSee the [guide](guide.md) and its [setup](guide.md#setup), or [elsewhere](#nowhere).\n",
+		// Gets a synthetic header, whose ID is guidemd rather than guide.md
+		"guide.md": "## Setup\n",
+	}
+	var files []string
+	for _, name := range []string{"index.md", "guide.md"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(sources[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+
+	assemble := func(processor *FileProcessor, files []string) []byte {
+		var output []byte
+		for _, file := range files {
+			processed, err := processor.ProcessFile(file, []byte(sources[filepath.Base(file)]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			output = append(output, processed...)
+			output = append(output, "\n\n"...)
+		}
+		return output
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		sections []string
+		expected []string
+	}{
+		// Links to fragments catmd didn't derive, like #nowhere, aren't its to check
+		{"complete output", Options{}, files, nil},
+		{"missing section", Options{}, files[:1], []string{RuleBadAnchor, RuleBadAnchor}},
+		{"shared anchors", Options{AnchorStrategy: constantAnchors{}}, files, []string{RuleDuplicateID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewFileProcessor(dir, files, tt.opts)
+			diagnostics := processor.VerifyAnchors(assemble(processor, tt.sections))
+			var rules []string
+			for _, diagnostic := range diagnostics {
+				rules = append(rules, diagnostic.Rule)
+			}
+			if len(rules) != len(tt.expected) {
+				t.Fatalf("VerifyAnchors() = %+v, want rules %v", diagnostics, tt.expected)
+			}
+			for i := range rules {
+				if rules[i] != tt.expected[i] {
+					t.Errorf("VerifyAnchors() = %+v, want rules %v", diagnostics, tt.expected)
+				}
+			}
+		})
+	}
+}
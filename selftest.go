@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Selftest fixture results.
+const (
+	SelftestPassed  = "PASSED"
+	SelftestFailed  = "FAILED"
+	SelftestSkipped = "SKIPPED"
+	SelftestUpdated = "UPDATED"
+)
+
+// runSelftest implements the selftest command: every subdirectory of dir is a
+// golden test fixture, laid out like catmd's own test/ directory:
+//   - expected.md holds the expected output
+//   - test.config, if present, holds the catmd arguments, run from inside the
+//     fixture directory; when the arguments name an output file with -o, that
+//     file must be actual.md
+//   - otherwise the fixture's index.md is built with default options
+//   - expected.exit, if present, holds the expected exit status (default 0)
+//
+// The actual output is left in each fixture's actual.md for inspection. With
+// --update, expected.md is rewritten from it instead of being compared.
+func runSelftest(dir string, opts Options, w io.Writer) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read fixture directory: %w", err)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the catmd executable: %w", err)
+	}
+
+	total, failed := 0, 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		fixture := filepath.Join(dir, entry.Name())
+
+		result, detail := runFixture(executable, fixture, opts.Update)
+		fmt.Fprintf(w, "%s %s\n", result, entry.Name())
+		if detail != "" {
+			fmt.Fprintf(w, "%s\n", indent(detail, "    "))
+		}
+
+		if result != SelftestSkipped {
+			total++
+		}
+		if result == SelftestFailed {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d fixture(s) failed", failed, total)
+	}
+	return nil
+}
+
+// runFixture builds one fixture and returns its result, along with details
+// explaining a failure or skip.
+func runFixture(executable, fixture string, update bool) (string, string) {
+	args := []string{"index.md"}
+	if config, err := os.ReadFile(filepath.Join(fixture, "test.config")); err == nil {
+		args = strings.Fields(string(config))
+	} else if _, err := os.Stat(filepath.Join(fixture, "index.md")); err != nil {
+		return SelftestSkipped, "no test.config and no index.md"
+	}
+
+	expectedPath := filepath.Join(fixture, "expected.md")
+	actualPath := filepath.Join(fixture, "actual.md")
+
+	expected, err := os.ReadFile(expectedPath)
+	if err != nil && !update {
+		return SelftestSkipped, "no expected.md"
+	}
+
+	expectedStatus, err := expectedExit(fixture)
+	if err != nil {
+		return SelftestFailed, err.Error()
+	}
+
+	// Don't let output from an earlier run stand in for this one.
+	if err := os.Remove(actualPath); err != nil && !os.IsNotExist(err) {
+		return SelftestFailed, fmt.Sprintf("failed to remove actual.md: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(executable, args...)
+	cmd.Dir = fixture
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	status := 0
+	if err := cmd.Run(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return SelftestFailed, fmt.Sprintf("failed to run catmd: %v", err)
+		}
+		status = exitErr.ExitCode()
+	}
+	if status != expectedStatus {
+		return SelftestFailed, fmt.Sprintf("exit status %d, expected %d\n%s", status, expectedStatus, stderr.String())
+	}
+
+	if !writesOutputFile(args) {
+		if err := os.WriteFile(actualPath, stdout.Bytes(), 0644); err != nil {
+			return SelftestFailed, fmt.Sprintf("failed to write actual.md: %v", err)
+		}
+	}
+	actual, err := os.ReadFile(actualPath)
+	if err != nil {
+		return SelftestFailed, fmt.Sprintf("no output: %v\n%s", err, stderr.String())
+	}
+
+	if update {
+		if bytes.Equal(actual, expected) {
+			return SelftestPassed, ""
+		}
+		if err := os.WriteFile(expectedPath, actual, 0644); err != nil {
+			return SelftestFailed, fmt.Sprintf("failed to update expected.md: %v", err)
+		}
+		return SelftestUpdated, ""
+	}
+
+	if bytes.Equal(actual, expected) {
+		return SelftestPassed, ""
+	}
+	return SelftestFailed, firstDifference(expected, actual)
+}
+
+// expectedExit reads a fixture's expected.exit, defaulting to 0 when the
+// fixture has none.
+func expectedExit(fixture string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(fixture, "expected.exit"))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read expected.exit: %w", err)
+	}
+	status, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid expected.exit: %w", err)
+	}
+	return status, nil
+}
+
+// writesOutputFile reports whether catmd arguments direct output to a file
+// rather than standard output.
+func writesOutputFile(args []string) bool {
+	for _, arg := range args {
+		switch {
+		case arg == "-o", arg == "--o", arg == "-output", arg == "--output",
+			strings.HasPrefix(arg, "-o="), strings.HasPrefix(arg, "--o="),
+			strings.HasPrefix(arg, "-output="), strings.HasPrefix(arg, "--output="):
+			return true
+		}
+	}
+	return false
+}
+
+// firstDifference describes the first line where actual differs from expected.
+func firstDifference(expected, actual []byte) string {
+	expectedLines := strings.Split(string(expected), "\n")
+	actualLines := strings.Split(string(actual), "\n")
+	for i := 0; i < max(len(expectedLines), len(actualLines)); i++ {
+		var want, got string
+		if i < len(expectedLines) {
+			want = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			got = actualLines[i]
+		}
+		if i >= len(expectedLines) || i >= len(actualLines) || want != got {
+			return fmt.Sprintf("first difference at line %d:\n  expected: %q\n  actual:   %q", i+1, want, got)
+		}
+	}
+	return "outputs differ"
+}
+
+// indent prefixes every line of s.
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n"+prefix)
+}
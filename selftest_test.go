@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWritesOutputFile(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected bool
+	}{
+		{[]string{"index.md"}, false},
+		{[]string{"-o", "actual.md", "index.md"}, true},
+		{[]string{"--output=actual.md", "index.md"}, true},
+		{[]string{"--report", "actual.md", "-o", "/dev/null", "index.md"}, true},
+		{[]string{"--redirects-file", "actual.md", "index.md"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := writesOutputFile(tt.args); got != tt.expected {
+			t.Errorf("writesOutputFile(%q) = %v, want %v", tt.args, got, tt.expected)
+		}
+	}
+}
+
+func TestFirstDifference(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     string
+	}{
+		{
+			name:     "changed line",
+			expected: "a\nb\nc\n",
+			actual:   "a\nB\nc\n",
+			want:     "first difference at line 2:\n  expected: \"b\"\n  actual:   \"B\"",
+		},
+		{
+			name:     "missing line",
+			expected: "a\nb\n",
+			actual:   "a\n",
+			want:     "first difference at line 2:\n  expected: \"b\"\n  actual:   \"\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := firstDifference([]byte(tt.expected), []byte(tt.actual)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectedExit(t *testing.T) {
+	dir := t.TempDir()
+	if status, err := expectedExit(dir); err != nil || status != 0 {
+		t.Errorf("expectedExit without expected.exit = %d, %v; want 0, nil", status, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "expected.exit"), []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := expectedExit(dir); err != nil || status != 1 {
+		t.Errorf("expectedExit = %d, %v; want 1, nil", status, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "expected.exit"), []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := expectedExit(dir); err == nil {
+		t.Error("expectedExit accepted a non-numeric status")
+	}
+}
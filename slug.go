@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Heading ID styles accepted by --slug-style, named after the renderers whose IDs
+// they reproduce.
+const (
+	SlugStyleGoldmark = "goldmark" // ASCII letters and digits only, as goldmark and Hugo generate
+	SlugStyleGitHub   = "github"   // Any Unicode letters and digits, and underscores, as GitHub generates
+)
+
+// Unicode normalizations of heading text before slugging, accepted by
+// --slug-normalize.
+const (
+	SlugNormalizeNone  = "none"  // Use the text as written
+	SlugNormalizeNFC   = "nfc"   // Compose characters, so "é" is one character however it was typed
+	SlugNormalizeNFKD  = "nfkd"  // Decompose characters and compatibility forms, such as fullwidth letters
+	SlugNormalizeASCII = "ascii" // Transliterate accented Latin letters to plain ASCII ("Café" gives "cafe")
+)
+
+// slugger generates heading IDs according to --slug-style and --slug-normalize.
+// Like goldmark's own generator, which it reproduces by default, it implements
+// parser.IDs and makes each ID unique by appending "-1", "-2", and so on.
+type slugger struct {
+	style         string
+	normalization string
+	values        map[string]bool
+}
+
+var _ parser.IDs = (*slugger)(nil)
+
+// newSlugger creates a slugger for the slug options of opts.
+func newSlugger(opts Options) *slugger {
+	return &slugger{
+		style:         opts.SlugStyle,
+		normalization: opts.SlugNormalize,
+		values:        make(map[string]bool),
+	}
+}
+
+// Generate returns a unique ID for a node with the given text.
+func (s *slugger) Generate(value []byte, kind ast.NodeKind) []byte {
+	slug := s.slug(strings.TrimSpace(string(value)))
+	if slug == "" {
+		if kind == ast.KindHeading {
+			slug = "heading"
+		} else {
+			slug = "id"
+		}
+	}
+
+	result := slug
+	for i := 1; s.values[result]; i++ {
+		result = fmt.Sprintf("%s-%d", slug, i)
+	}
+	s.values[result] = true
+	return []byte(result)
+}
+
+// Unique returns id, or id followed by the first of "-1", "-2", and so on that
+// no ID has yet, and records the result, for IDs taken as written rather than
+// generated from text, such as those of raw HTML anchors.
+func (s *slugger) Unique(id string) string {
+	result := id
+	for i := 1; s.values[result]; i++ {
+		result = fmt.Sprintf("%s-%d", id, i)
+	}
+	s.values[result] = true
+	return result
+}
+
+// Put records value as an ID that is already in use.
+func (s *slugger) Put(value []byte) {
+	s.values[string(value)] = true
+}
+
+func (s *slugger) slug(text string) string {
+	switch s.normalization {
+	case SlugNormalizeNFC:
+		text = norm.NFC.String(text)
+	case SlugNormalizeNFKD:
+		text = norm.NFKD.String(text)
+	case SlugNormalizeASCII:
+		text = transliterate(text)
+	}
+
+	var slug strings.Builder
+	for _, r := range text {
+		switch {
+		case r < 0x80 && unicode.IsSpace(r), r == '-':
+			slug.WriteByte('-')
+		case r == '_':
+			// GitHub keeps underscores, while goldmark turns them into hyphens
+			if s.style == SlugStyleGitHub {
+				slug.WriteByte('_')
+			} else {
+				slug.WriteByte('-')
+			}
+		case r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			slug.WriteRune(unicode.ToLower(r))
+		case r >= 0x80 && s.style == SlugStyleGitHub && (unicode.In(r, unicode.Letter, unicode.Mark, unicode.Digit)):
+			slug.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return slug.String()
+}
+
+// transliterate decomposes text and drops the combining marks, turning accented
+// Latin letters into their ASCII base letters. Letters with no decomposition,
+// such as CJK characters, are kept for the slug style to handle.
+func transliterate(text string) string {
+	var result strings.Builder
+	for _, r := range norm.NFKD.String(text) {
+		if !unicode.Is(unicode.Mn, r) {
+			result.WriteRune(r)
+		}
+	}
+	return result.String()
+}
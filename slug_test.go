@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+)
+
+func TestSlugger_MatchesGoldmarkByDefault(t *testing.T) {
+	headings := []string{"Getting Started", "Café au lait", "API_v2 -- Notes", "日本語", "Setup", "Setup", "  "}
+
+	ours := newSlugger(Options{})
+	theirs := parser.NewContext().IDs()
+	for _, heading := range headings {
+		got := string(ours.Generate([]byte(heading), ast.KindHeading))
+		want := string(theirs.Generate([]byte(heading), ast.KindHeading))
+		if got != want {
+			t.Errorf("slug of %q = %q, goldmark generates %q", heading, got, want)
+		}
+	}
+}
+
+func TestSlugger_StylesAndNormalization(t *testing.T) {
+	tests := []struct {
+		name      string
+		style     string
+		normalize string
+		heading   string
+		expected  string
+	}{
+		{"goldmark drops accented letters", SlugStyleGoldmark, SlugNormalizeNone, "Café", "caf"},
+		{"github keeps accented letters", SlugStyleGitHub, SlugNormalizeNone, "Café", "café"},
+		{"ascii transliterates", SlugStyleGoldmark, SlugNormalizeASCII, "Café Crème", "cafe-creme"},
+		{"nfc composes decomposed input", SlugStyleGitHub, SlugNormalizeNFC, "Cafe\u0301", "caf\u00e9"},
+		{"nfkd decomposes composed input", SlugStyleGitHub, SlugNormalizeNFKD, "Caf\u00e9", "cafe\u0301"},
+		{"nfkd folds fullwidth letters", SlugStyleGoldmark, SlugNormalizeNFKD, "ＡＰＩ", "api"},
+		{"github keeps CJK", SlugStyleGitHub, SlugNormalizeNone, "日本語 Guide", "日本語-guide"},
+		{"github keeps underscores", SlugStyleGitHub, SlugNormalizeNone, "API_v2", "api_v2"},
+		{"goldmark hyphenates underscores", SlugStyleGoldmark, SlugNormalizeNone, "API_v2", "api-v2"},
+		{"ascii keeps CJK for github style", SlugStyleGitHub, SlugNormalizeASCII, "日本語", "日本語"},
+		{"empty slug falls back", SlugStyleGoldmark, SlugNormalizeNone, "日本語", "heading"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSlugger(Options{SlugStyle: tt.style, SlugNormalize: tt.normalize})
+			if got := string(s.Generate([]byte(tt.heading), ast.KindHeading)); got != tt.expected {
+				t.Errorf("slug of %q = %q, want %q", tt.heading, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSlugger_Unique(t *testing.T) {
+	s := newSlugger(Options{SlugStyle: SlugStyleGitHub})
+	s.Put([]byte("über"))
+	for _, want := range []string{"über-1", "über-2"} {
+		if got := string(s.Generate([]byte("Über"), ast.KindHeading)); got != want {
+			t.Errorf("Generate = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// Snapshot holds the contents of source files as they were first read, so that
+// one build sees a single version of each file even if it changes on disk while
+// the build runs (as happens under a file watcher). Traversal takes the snapshot
+// as it reads files; the header preload, filtering, and processing read from it
+// instead of from disk, so cached headers always agree with the content
+// processed. A nil *Snapshot reads straight from disk.
+type Snapshot struct {
+	mu     sync.Mutex
+	files  map[string]snapshotFile
+	parsed map[string]*ParsedFile // ParseFile results, keyed by scope directory and path
+
+	frontMatter bool // Whether ParseFile reads front matter, see SetFrontMatter
+}
+
+// snapshotFile is the result of the first read of a file.
+type snapshotFile struct {
+	content []byte
+	err     error
+}
+
+// NewSnapshot creates an empty snapshot.
+func NewSnapshot() *Snapshot {
+	return &Snapshot{files: make(map[string]snapshotFile), parsed: make(map[string]*ParsedFile)}
+}
+
+// Add records content as the contents of path, which need not exist on disk,
+// such as a root file read from standard input.
+func (s *Snapshot) Add(path string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[path] = snapshotFile{content: content}
+}
+
+// SetFrontMatter sets whether ParseFile reads files' front matter, as the build's
+// processing does when Options.readsFrontMatter. Set it before parsing any file.
+func (s *Snapshot) SetFrontMatter(enabled bool) {
+	s.frontMatter = enabled
+}
+
+// ParseFile returns ParseMarkdownFile's result for the snapshot's contents of
+// path, parsing them only the first time, so traversal, filtering, and the other
+// passes that only read links, headers, and front matter share one parse of
+// each file. The result is shared, so its AST must not be modified; processing,
+// which transforms it, parses files again. Errors are not cached. A nil
+// *Snapshot parses the file from disk every time.
+func (s *Snapshot) ParseFile(path, scopeDir string) (*ParsedFile, error) {
+	key := scopeDir + "\x00" + path
+	if s != nil {
+		s.mu.Lock()
+		parsed, ok := s.parsed[key]
+		s.mu.Unlock()
+		if ok {
+			return parsed, nil
+		}
+	}
+
+	content, err := s.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	md := defaultParser()
+	if s != nil && s.frontMatter {
+		md = frontMatterParser()
+	}
+	parsed, err := parseMarkdownWith(md, content, scopeDir, nil)
+	if err != nil || s == nil {
+		return parsed, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parsed[key] = parsed
+	return parsed, nil
+}
+
+// ReadFile returns the contents of path when the snapshot first read it, reading
+// it now if it hasn't been read yet. Read errors are remembered too.
+func (s *Snapshot) ReadFile(path string) ([]byte, error) {
+	if s == nil {
+		return os.ReadFile(path)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[path]
+	if !ok {
+		file.content, file.err = os.ReadFile(path)
+		s.files[path] = file
+	}
+	return file.content, file.err
+}
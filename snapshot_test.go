@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot_ConsistentBuild(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "index.md")
+	guide := filepath.Join(dir, "guide.md")
+	if err := os.WriteFile(root, []byte("# Index\n\nSee the [guide](guide.md).\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(guide, []byte("# Guide\n\nOriginal text.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	traversal := NewFileTraversal(root, dir)
+	files, err := traversal.Traverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An editor saves the guide with a new title after traversal read it
+	if err := os.WriteFile(guide, []byte("# Renamed\n\nEdited text.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	processor := NewFileProcessor(dir, files, Options{Snapshot: traversal.Snapshot()})
+	var output strings.Builder
+	for _, result := range processFiles(processor, files, 2) {
+		processed := <-result
+		if processed.err != nil || processed.readErr != nil {
+			t.Fatalf("processing failed: %v, %v", processed.readErr, processed.err)
+		}
+		output.Write(processed.output)
+	}
+
+	for _, want := range []string{"[guide](#guide)", "# Guide", "Original text."} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("output = %q, want it to contain %q", output.String(), want)
+		}
+	}
+}
+
+func TestSnapshot_NilReadsFromDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.md")
+	if err := os.WriteFile(path, []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var snapshot *Snapshot
+	if content, err := snapshot.ReadFile(path); err != nil || string(content) != "one" {
+		t.Errorf("ReadFile() = %q, %v, want %q", content, err, "one")
+	}
+}
+
+func TestSnapshot_AddedRoot(t *testing.T) {
+	dir := t.TempDir()
+	guide := filepath.Join(dir, "docs", "guide.md")
+	if err := os.MkdirAll(filepath.Dir(guide), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(guide, []byte("# Guide\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A root read from standard input exists only in the snapshot
+	root := filepath.Join(dir, stdinRootName)
+	traversal := NewFileTraversal(root, dir)
+	traversal.Snapshot().Add(root, []byte("# Generated\n\nSee the [guide](docs/guide.md).\n"))
+	files, err := traversal.Traverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0] != root || files[1] != guide {
+		t.Errorf("Traverse() = %v, want [%s %s]", files, root, guide)
+	}
+}
+
+func TestSnapshot_ParseFileShared(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.md")
+	if err := os.WriteFile(path, []byte("# Index\n\nSee the [guide](guide.md).\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := NewSnapshot()
+	first, err := snapshot.ParseFile(path, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := snapshot.ParseFile(path, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("ParseFile() parsed the file again, want the first result")
+	}
+	if len(first.Links) != 1 || first.Links[0].URL != "guide.md" {
+		t.Errorf("Links = %+v, want the link to guide.md", first.Links)
+	}
+
+	var none *Snapshot
+	if parsed, err := none.ParseFile(path, dir); err != nil || len(parsed.Headers) != 1 {
+		t.Errorf("nil ParseFile() = %+v, %v, want the file parsed from disk", parsed, err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// FileStats describes one traversed file's place in the link graph.
+type FileStats struct {
+	Path      string `json:"path"`
+	InDegree  int    `json:"in_degree"`  // Distinct traversed files linking to this one
+	OutDegree int    `json:"out_degree"` // Distinct traversed files this one links to
+	Depth     int    `json:"depth"`      // Links followed from the root to reach this file
+}
+
+// GraphStats summarizes the link graph reached from the root file.
+type GraphStats struct {
+	Files        []FileStats `json:"files"`         // In traversal order
+	Unreachable  []string    `json:"unreachable"`   // Markdown files in scope never reached, sorted
+	AverageDepth float64     `json:"average_depth"` // Mean depth over all traversed files
+	LongestChain []string    `json:"longest_chain"` // Root-to-file path of the deepest file
+}
+
+// ComputeGraphStats measures the link graph found by a completed traversal.
+// Paths in the result are shown relative to the working directory. Self-links
+// and repeated links between the same two files count once.
+func ComputeGraphStats(traversal *FileTraversal, orderedFiles []string, scopeDir string) (GraphStats, error) {
+	included := make(map[string]bool)
+	for _, file := range orderedFiles {
+		included[file] = true
+	}
+
+	inDegree := make(map[string]int)
+	outDegree := make(map[string]int)
+	for _, file := range orderedFiles {
+		parsed, err := traversal.Snapshot().ParseFile(file, scopeDir)
+		if err != nil {
+			continue
+		}
+
+		seen := make(map[string]bool)
+		for _, link := range parsed.Links {
+			if !link.IsInternal || link.IsFootnote {
+				continue
+			}
+			target, err := traversal.resolveLink(file, link.URL)
+			if err != nil || target == file || seen[target] || !included[target] {
+				continue
+			}
+			seen[target] = true
+			outDegree[file]++
+			inDegree[target]++
+		}
+	}
+
+	stats := GraphStats{Unreachable: []string{}, LongestChain: []string{}}
+	deepest := ""
+	totalDepth := 0
+	for _, file := range orderedFiles {
+		depth := traversal.Depth(file)
+		stats.Files = append(stats.Files, FileStats{
+			Path:      displayPath(file),
+			InDegree:  inDegree[file],
+			OutDegree: outDegree[file],
+			Depth:     depth,
+		})
+		totalDepth += depth
+		if deepest == "" || depth > traversal.Depth(deepest) {
+			deepest = file
+		}
+	}
+	if len(orderedFiles) > 0 {
+		stats.AverageDepth = float64(totalDepth) / float64(len(orderedFiles))
+	}
+
+	for file := deepest; file != ""; file = traversal.Parent(file) {
+		stats.LongestChain = append([]string{displayPath(file)}, stats.LongestChain...)
+	}
+
+	allFiles, err := WalkDirectoryForMarkdown(scopeDir)
+	if err != nil {
+		return stats, fmt.Errorf("failed to list markdown files in scope: %w", err)
+	}
+	for _, file := range allFiles {
+		if !included[file] {
+			stats.Unreachable = append(stats.Unreachable, displayPath(file))
+		}
+	}
+	sort.Strings(stats.Unreachable)
+
+	return stats, nil
+}
+
+// runStats implements the stats command: it writes graph metrics for the traversed
+// files as a table, or as JSON with --json.
+func runStats(traversal *FileTraversal, orderedFiles []string, scopeDir string, opts Options) error {
+	stats, err := ComputeGraphStats(traversal, orderedFiles, scopeDir)
+	if err != nil {
+		return err
+	}
+
+	writer, closeOutput, err := createOutput(opts.Output)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if opts.JSON {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(stats)
+	} else {
+		err = writeStatsTable(writer, stats)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+	return nil
+}
+
+// writeStatsTable writes a per-file table followed by whole-graph totals.
+func writeStatsTable(w io.Writer, stats GraphStats) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(table, "IN\tOUT\tDEPTH\t  FILE\n")
+	for _, file := range stats.Files {
+		fmt.Fprintf(table, "%d\t%d\t%d\t  %s\n", file.InDegree, file.OutDegree, file.Depth, file.Path)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nFiles: %d\n", len(stats.Files))
+	fmt.Fprintf(w, "Average depth: %.2f\n", stats.AverageDepth)
+	fmt.Fprintf(w, "Longest chain: %s (%d links)\n", strings.Join(stats.LongestChain, " -> "), len(stats.LongestChain)-1)
+	fmt.Fprintf(w, "Unreachable: %d\n", len(stats.Unreachable))
+	for _, file := range stats.Unreachable {
+		if _, err := fmt.Fprintf(w, "  %s\n", file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
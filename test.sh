@@ -19,23 +19,37 @@ run_test() {
     
     echo "Running test: $test_name"
     
+    # Tests expect catmd to succeed unless expected.exit holds the exit
+    # status they expect instead (e.g. --check reporting problems)
+    local expected_exit=0
+    if [ -f "$test_dir/expected.exit" ]; then
+        expected_exit=$(cat "$test_dir/expected.exit")
+    fi
+    local status=0
+
     if [ -f "$test_dir/test.config" ]; then
         # Read config file (contains catmd arguments)
         local config_args=$(cat "$test_dir/test.config")
         # Check if args contain output flag
         if [[ "$config_args" == *"-o "* ]]; then
-            (cd "$test_dir" && catmd $config_args)
+            (cd "$test_dir" && catmd $config_args) || status=$?
         else
-            (cd "$test_dir" && catmd $config_args > actual.md)
+            (cd "$test_dir" && catmd $config_args > actual.md) || status=$?
         fi
     elif [ -f "$test_dir/index.md" ]; then
         # Default: use index.md in test directory
-        catmd "$test_dir/index.md" > "$test_dir/actual.md"
+        catmd "$test_dir/index.md" > "$test_dir/actual.md" || status=$?
     else
         echo "  ✗ SKIPPED (no test.config and no index.md)"
         return
     fi
-        
+
+    if [ "$status" -ne "$expected_exit" ]; then
+        echo "  ✗ FAILED"
+        echo "    Exit status $status, expected $expected_exit"
+        return
+    fi
+
     if diff -q "$test_dir/expected.md" "$test_dir/actual.md" > /dev/null; then
         echo "  ✓ PASSED"
     else
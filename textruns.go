@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// textReplacement replaces the bytes from start to end of a text run's text
+// with nodes.
+type textReplacement struct {
+	start, end int
+	nodes      []ast.Node
+}
+
+// skipsText reports whether the text inside n is left alone when replacing
+// text: that of links, images, code, and raw HTML.
+func skipsText(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.Link, *ast.Image, *ast.AutoLink, *ast.CodeSpan, *ast.RawHTML:
+		return true
+	}
+	return false
+}
+
+// replaceInText replaces parts of the text of doc outside the nodes skip
+// reports. Phrases may span several text nodes, since goldmark splits text at
+// punctuation it might give meaning to, so replace is called with the text of
+// each run of adjacent Text and String nodes, with a newline for each line
+// break, and returns the parts of it to replace, in order. What is left of the
+// run keeps its nodes, split where needed, along with their line breaks.
+func replaceInText(doc ast.Node, source []byte, skip func(ast.Node) bool, replace func(text string) []textReplacement) {
+	var parents []ast.Node
+	seen := make(map[ast.Node]bool)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if skip(n) {
+			return ast.WalkSkipChildren, nil
+		}
+		switch n.(type) {
+		case *ast.Text, *ast.String:
+			if parent := n.Parent(); !seen[parent] {
+				seen[parent] = true
+				parents = append(parents, parent)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, parent := range parents {
+		var run []ast.Node
+		for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+			switch child.(type) {
+			case *ast.Text, *ast.String:
+				run = append(run, child)
+			default:
+				replaceInTextRun(parent, run, source, replace)
+				run = nil
+			}
+		}
+		replaceInTextRun(parent, run, source, replace)
+	}
+}
+
+// replaceInTextRun applies replace to a run of adjacent text nodes of parent.
+func replaceInTextRun(parent ast.Node, run []ast.Node, source []byte, replace func(text string) []textReplacement) {
+	if len(run) == 0 {
+		return
+	}
+
+	// Where the text of each node starts in the run's
+	starts := make([]int, len(run))
+	var content strings.Builder
+	for i, n := range run {
+		starts[i] = content.Len()
+		content.Write(textValue(n, source))
+		if hasLineBreak(n) {
+			content.WriteByte('\n')
+		}
+	}
+	replacements := replace(content.String())
+	if len(replacements) == 0 {
+		return
+	}
+
+	// Keep the text around the replacements, as slices of the nodes it was in
+	var result []ast.Node
+	keep := func(from, to int) {
+		for i, n := range run {
+			length := len(textValue(n, source))
+			start := min(max(from-starts[i], 0), length)
+			end := max(min(to-starts[i], length), start)
+			lineBreak := hasLineBreak(n) && from <= starts[i]+length && starts[i]+length < to
+			if start < end || lineBreak {
+				result = append(result, sliceText(n, start, end, lineBreak))
+			}
+		}
+	}
+	last := 0
+	for _, r := range replacements {
+		keep(last, r.start)
+		result = append(result, r.nodes...)
+		last = r.end
+	}
+	keep(last, content.Len())
+
+	for _, node := range result {
+		parent.InsertBefore(parent, run[0], node)
+	}
+	for _, node := range run {
+		parent.RemoveChild(parent, node)
+	}
+}
+
+// textValue returns the text of a Text or String node.
+func textValue(n ast.Node, source []byte) []byte {
+	switch node := n.(type) {
+	case *ast.Text:
+		return node.Segment.Value(source)
+	case *ast.String:
+		return node.Value
+	}
+	return nil
+}
+
+// hasLineBreak reports whether n is a Text node ending in a line break.
+func hasLineBreak(n ast.Node) bool {
+	text, ok := n.(*ast.Text)
+	return ok && (text.SoftLineBreak() || text.HardLineBreak())
+}
+
+// sliceText returns a copy of the bytes from start to end of a Text or String
+// node's text, which keeps the node's line break if lineBreak is set.
+func sliceText(n ast.Node, start, end int, lineBreak bool) ast.Node {
+	switch node := n.(type) {
+	case *ast.Text:
+		segment := text.NewSegment(node.Segment.Start+start, node.Segment.Start+end)
+		slice := ast.NewTextSegment(segment)
+		slice.SetRaw(node.IsRaw())
+		if lineBreak {
+			slice.SetSoftLineBreak(node.SoftLineBreak())
+			slice.SetHardLineBreak(node.HardLineBreak())
+		}
+		return slice
+	case *ast.String:
+		slice := ast.NewString(node.Value[start:end])
+		slice.SetCode(node.IsCode())
+		slice.SetRaw(node.IsRaw())
+		return slice
+	}
+	return n
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+func TestReplaceInText(t *testing.T) {
+	source := []byte("A *b* c-d e\\\nf `c-d` c-d\n")
+	md := NewMarkdownParser()
+	doc := md.Parser().Parse(text.NewReader(source))
+	replaceInText(doc, source, skipsText, func(text string) []textReplacement {
+		var replacements []textReplacement
+		for i := strings.Index(text, "c-d"); i >= 0; {
+			replacements = append(replacements, textReplacement{start: i, end: i + 3, nodes: []ast.Node{ast.NewString([]byte("X"))}})
+			next := strings.Index(text[i+3:], "c-d")
+			if next < 0 {
+				break
+			}
+			i += 3 + next
+		}
+		return replacements
+	})
+
+	var out bytes.Buffer
+	if err := newMarkdownRenderer(nil).Render(&out, source, doc); err != nil {
+		t.Fatal(err)
+	}
+	if want := "A *b* X e\\\nf `c-d` X\n"; out.String() != want {
+		t.Errorf("rendered %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	markdown "github.com/teekennedy/goldmark-markdown"
+	"github.com/yuin/goldmark/ast"
+)
+
+// disambiguateTitles finds included files whose section titles would produce the
+// same anchor ("Overview" in five directories) and gives each of them a qualifier:
+// the file's directory relative to the scope, or its relative path when the
+// directory alone doesn't tell the duplicates apart. Qualified titles are used in
+// the TOC, in the section headings themselves, and in every link to those sections.
+func (fp *FileProcessor) disambiguateTitles(orderedFiles []string) {
+	groups := make(map[string][]string)
+	for _, file := range orderedFiles {
+		if fp.omitsSection(file) {
+			continue
+		}
+		slug := fp.headingSlug(fp.sectionTitle(file))
+		groups[slug] = append(groups[slug], file)
+	}
+
+	for _, files := range groups {
+		if len(files) < 2 {
+			continue
+		}
+
+		dirs := make(map[string]int)
+		for _, file := range files {
+			dirs[fp.relPath(filepath.Dir(file))]++
+		}
+		for _, file := range files {
+			qualifier := fp.relPath(filepath.Dir(file))
+			if dirs[qualifier] > 1 || qualifier == "." {
+				qualifier = fp.relPath(file)
+			}
+			fp.qualifiers[file] = qualifier
+		}
+	}
+}
+
+// relPath returns path relative to the scope directory with forward slashes,
+// or its base name if it can't be made relative.
+func (fp *FileProcessor) relPath(path string) string {
+	rel, err := filepath.Rel(fp.scopeDir, path)
+	if err != nil {
+		return filepath.Base(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// qualifyHeading appends a file's disambiguating qualifier to its top-level
+// heading, so that the heading's anchor matches generateTargetAnchor.
+func (fp *FileProcessor) qualifyHeading(doc ast.Node, filename string) {
+	qualifier, ok := fp.qualifiers[filename]
+	if !ok {
+		return
+	}
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		if heading, ok := child.(*ast.Heading); ok && heading.Level == 1 {
+			heading.AppendChild(heading, newLiteral(" ("+qualifier+")"))
+			return
+		}
+	}
+}
+
+// headingSlug returns the ID generated for a heading with the given text.
+func (fp *FileProcessor) headingSlug(text string) string {
+	return string(newSlugger(fp.opts).Generate([]byte(text), ast.KindHeading))
+}
+
+// CollapseTOC limits the table of contents to files at most --toc-collapse-depth
+// links from the root. Each deeper file is listed instead in a per-section table
+// of contents under the nearest included file it was reached through, nested
+// beneath its own parent when that is also collapsed.
+func (fp *FileProcessor) CollapseTOC(traversal *FileTraversal, orderedFiles []string) {
+	for _, file := range orderedFiles {
+		if traversal.Depth(file) <= fp.opts.TOCCollapseDepth {
+			continue
+		}
+		// Skip over ancestors left out by the tag and audience filters
+		parent := traversal.Parent(file)
+		for parent != "" && !fp.visitedFiles[parent] {
+			parent = traversal.Parent(parent)
+		}
+		if parent == "" {
+			continue
+		}
+		fp.collapsed[file] = true
+		fp.sectionTOCs[parent] = append(fp.sectionTOCs[parent], file)
+	}
+}
+
+// RenderTOC renders a table of contents for the combined document: a "Contents"
+// label followed by a bullet list linking to each included file's section.
+// Files collapsed by CollapseTOC and a root file without a section are left out.
+func (fp *FileProcessor) RenderTOC(orderedFiles []string) ([]byte, error) {
+	doc := ast.NewDocument()
+	label, list := fp.tocBlocks(orderedFiles)
+	doc.AppendChild(doc, label)
+	doc.AppendChild(doc, list)
+
+	renderer := fp.renderers.Get().(*markdown.Renderer)
+	defer fp.renderers.Put(renderer)
+
+	var buf bytes.Buffer
+	if err := renderer.Render(&buf, nil, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tocBlocks builds the "Contents" label and list of the global table of contents.
+func (fp *FileProcessor) tocBlocks(orderedFiles []string) (*ast.Paragraph, *ast.List) {
+	label := ast.NewParagraph()
+	label.AppendChild(label, ast.NewString([]byte("Contents:")))
+
+	var files, appendix []string
+	for _, file := range orderedFiles {
+		if !fp.visitedFiles[file] || fp.collapsed[file] || fp.omitsSection(file) {
+			continue
+		}
+		if fp.tocExcluded[file] {
+			continue
+		}
+		if fp.appendix[file] {
+			appendix = append(appendix, file)
+		} else {
+			files = append(files, file)
+		}
+	}
+	var list *ast.List
+	if fp.depths != nil {
+		list = fp.nestedTOCList(fp.files[0], files)
+	} else {
+		list = fp.tocList(fp.files[0], files, false)
+	}
+	if len(appendix) > 0 {
+		item := tocItem("#"+fp.appendixID, fp.opts.AppendixTitle)
+		item.AppendChild(item, fp.tocList(fp.files[0], appendix, false))
+		list.AppendChild(list, item)
+	}
+	list.SetBlankPreviousLines(true)
+	return label, list
+}
+
+// tocPlaceholderPattern matches the HTML comment marking where the root file
+// wants the table of contents.
+var tocPlaceholderPattern = regexp.MustCompile(`(?i)^<!--\s*toc\s*-->$`)
+
+// findTOCPlaceholder returns the first `<!-- toc -->` block in doc, or nil.
+func findTOCPlaceholder(doc ast.Node, source []byte) *ast.HTMLBlock {
+	var placeholder *ast.HTMLBlock
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		block, ok := n.(*ast.HTMLBlock)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		var content []byte
+		for i := 0; i < block.Lines().Len(); i++ {
+			segment := block.Lines().At(i)
+			content = append(content, segment.Value(source)...)
+		}
+		if tocPlaceholderPattern.Match(bytes.TrimSpace(content)) {
+			placeholder = block
+			return ast.WalkStop, nil
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	return placeholder
+}
+
+// tocExcludePattern matches the HTML comment that keeps the section whose
+// heading follows it out of the tables of contents.
+var tocExcludePattern = regexp.MustCompile(`(?i)^<!--\s*catmd:toc-exclude\s*-->$`)
+
+// excludedFromTOC reports whether file, parsed, keeps its section out of the
+// global and per-section tables of contents, while still being included: with
+// a <!-- catmd:toc-exclude --> comment on the line before the H1 opening the
+// section, or with toc_exclude front matter that is true or lists the
+// section's title.
+func (fp *FileProcessor) excludedFromTOC(file string, parsed *ParsedFile) bool {
+	switch value := parsed.FrontMatter["toc_exclude"].(type) {
+	case bool:
+		return value
+	case nil:
+	default:
+		title := fp.baseSectionTitle(file)
+		for _, heading := range frontMatterStrings(parsed.FrontMatter, "toc_exclude") {
+			if strings.EqualFold(heading, title) {
+				return true
+			}
+		}
+	}
+
+	if fp.generateFileHeader(file, fp.fileHeaders[file]) != "" {
+		return false
+	}
+	for child := parsed.AST.FirstChild(); child != nil; child = child.NextSibling() {
+		if heading, ok := child.(*ast.Heading); ok && heading.Level == 1 {
+			block, ok := heading.PreviousSibling().(*ast.HTMLBlock)
+			return ok && tocExcludePattern.Match(bytes.TrimSpace(htmlBlockSource(block, parsed.Source)))
+		}
+	}
+	return false
+}
+
+// TOCInline reports whether the root file has a `<!-- toc -->` placeholder, in
+// which case the table of contents replaces it instead of starting the output.
+func (fp *FileProcessor) TOCInline() bool {
+	return fp.inlineTOC
+}
+
+// replaceTOCPlaceholder replaces the root file's `<!-- toc -->` placeholder
+// with the table of contents.
+func (fp *FileProcessor) replaceTOCPlaceholder(doc ast.Node, source []byte, filename string) {
+	if !fp.inlineTOC || fp.fileOrder[filename] != 0 {
+		return
+	}
+	placeholder := findTOCPlaceholder(doc, source)
+	if placeholder == nil {
+		return
+	}
+
+	label, list := fp.tocBlocks(fp.files)
+	label.SetBlankPreviousLines(placeholder.HasBlankPreviousLines())
+	parent := placeholder.Parent()
+	parent.ReplaceChild(parent, placeholder, label)
+	parent.InsertAfter(parent, label, list)
+}
+
+// insertSectionTOC adds the per-section table of contents of the files collapsed
+// under filename right after its top-level heading, or at the start of the
+// document when the section gets a synthetic header.
+func (fp *FileProcessor) insertSectionTOC(doc ast.Node, filename string) {
+	files := fp.sectionTOCs[filename]
+	if len(files) == 0 || fp.collapsed[filename] {
+		return
+	}
+
+	var heading ast.Node
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		if h, ok := child.(*ast.Heading); ok && h.Level == 1 {
+			heading = h
+			break
+		}
+	}
+
+	label := ast.NewParagraph()
+	label.AppendChild(label, ast.NewString([]byte("In this section:")))
+	label.SetBlankPreviousLines(true)
+	list := fp.tocList(filename, files, true)
+	list.SetBlankPreviousLines(true)
+
+	switch {
+	case heading != nil:
+		doc.InsertAfter(doc, heading, label)
+	case doc.FirstChild() != nil:
+		doc.InsertBefore(doc, doc.FirstChild(), label)
+	default:
+		// Nothing but front matter
+		doc.AppendChild(doc, label)
+	}
+	doc.InsertAfter(doc, label, list)
+}
+
+// tocList builds a tight bullet list, for the section of from, linking to each
+// file's section. When nested is set, files collapsed under a listed file are
+// listed beneath it.
+func (fp *FileProcessor) tocList(from string, files []string, nested bool) *ast.List {
+	list := ast.NewList('-')
+	list.IsTight = true
+	for _, file := range files {
+		if fp.tocExcluded[file] {
+			// Files collapsed under it are still listed in its own section
+			continue
+		}
+		item := tocItem(fp.sectionLink(from, file), fp.sectionTitle(file))
+		if children := fp.sectionTOCs[file]; nested && len(children) > 0 {
+			item.AppendChild(item, fp.tocList(from, children, true))
+		}
+		list.AppendChild(list, item)
+	}
+	return list
+}
+
+// tocItem builds a table of contents entry linking to destination.
+func tocItem(destination, title string) *ast.ListItem {
+	link := ast.NewLink()
+	link.Destination = []byte(destination)
+	link.AppendChild(link, newLiteral(title))
+
+	block := ast.NewTextBlock()
+	block.AppendChild(block, link)
+
+	item := ast.NewListItem(2)
+	item.AppendChild(item, block)
+	return item
+}
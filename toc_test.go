@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileProcessor_SectionTOCWithoutContent(t *testing.T) {
+	dir := t.TempDir()
+	guide := filepath.Join(dir, "guide.md")
+	setup := filepath.Join(dir, "setup.md")
+	content := "---\ntitle: Guide\n---\n"
+	if err := os.WriteFile(guide, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(setup, []byte("# Setup\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	processor := NewFileProcessor(dir, []string{guide, setup}, Options{TOC: true, FrontMatter: true})
+	processor.sectionTOCs[guide] = []string{setup}
+	processed, err := processor.ProcessFile(guide, []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "In this section:\n\n- [Setup](#setup)"; !strings.Contains(string(processed), want) {
+		t.Errorf("ProcessFile() = %q, want it to contain %q", processed, want)
+	}
+}
@@ -2,12 +2,20 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
 
 	markdown "github.com/teekennedy/goldmark-markdown"
+	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
 	extast "github.com/yuin/goldmark/extension/ast"
 )
@@ -25,9 +33,17 @@ Header Generation Rules - Add synthetic header `# filename.md` when:
 2. Multiple level-1 headers - Multiple top-level headers would conflict
 3. Single level-1 header not at start - Content before the header prevents it from being the file's opening
 
+A level-1 header is at the start when no other header comes before it. --title-preamble
+can narrow that to only HTML comments, or nothing, before it; front matter and a byte
+order mark never count.
+
 Header Adjustment Rules - Increment ALL existing headers by 1 level when:
 - A synthetic header is added AND the original file had any level-1 headers
 
+With --promote-headings, a synthetic header instead shifts ALL existing headers so
+the highest level becomes 2, whatever it was (e.g. a file using only ### and ####
+gets ## and ###).
+
 Logic Summary:
 - 0 level-1 headers: Add synthetic `#`, keep existing headers unchanged (no conflicts)
 - 1 level-1 header at start: Use existing header as-is (goal already achieved)
@@ -37,6 +53,12 @@ Logic Summary:
 This ensures every file section in the concatenated output starts with exactly one `#` header,
 with proper hierarchy maintained throughout.
 
+With --flatten-below N, headings deeper than level N after these adjustments become
+bold paragraphs, keeping their anchors.
+
+With --no-root-section, the root file never gets a synthetic header: its content
+starts the document as written, under an anchor that links to it still reach.
+
 TRANSFORMATION PIPELINE
 
 The transform phase implements a three-pass pipeline on the parsed AST:
@@ -53,7 +75,7 @@ Pass 2: Footnote Inlining
 Pass 3: Link Transformation
 - Converts internal markdown links to section anchors for navigation
 - Uses goldmark's auto-generated header IDs for accurate anchor targets
-- Preserves fragments (#section) in transformed links
+- Rewrites fragments (#section) to the heading's final ID in the combined document
 
 Pass 4: Rendering
 - Uses goldmark-markdown renderer to convert transformed AST back to markdown
@@ -67,11 +89,48 @@ type FileProcessor struct {
 	fileOrder    map[string]int          // Order index of each file in traversal
 	visitedFiles map[string]bool         // Set of files included in concatenation
 	fileHeaders  map[string][]HeaderInfo // Cached header info for each file
+	backlinks    map[string][]string     // Included files linking to each file, in traversal order
+	qualifiers   map[string]string       // Suffixes disambiguating duplicate section titles
+	anchors      map[string]string       // Final ID of each heading, keyed by file + "#" + its own ID
+	htmlIDs      map[string][]string     // IDs of the raw HTML elements of each file, in source order
+	htmlAnchors  map[string]string       // Final ID of each raw HTML element's ID, keyed like anchors
+	elements     map[string][]string     // Fragments naming each file's unanchored elements, for --element-anchors
+	elementLinks map[string]bool         // Link targets, as file + "#" + fragment, for --element-anchors
+	elementIDs   map[string]string       // ID written before each linked element, keyed like anchors
+	pruned       map[string]string       // Files left out by --prune-empty, mapped to the file links to them go to
+	collapsed    map[string]bool         // Files left out of the TOC by --toc-collapse-depth
+	tocExcluded  map[string]bool         // Files whose sections are kept out of all TOCs, see excludedFromTOC
+	sectionTOCs  map[string][]string     // Collapsed files listed under each file's section
+	endnotes     []*endnote              // Footnotes collected in endnotes mode, in number order, nil until collected
+	endnoteBase  map[string]int          // Number of the endnotes reserved before each file's, see countEndnotes
+	endnoteCount map[string]int          // Number of the endnotes reserved for each file
+	bibliography map[string]*BibEntry    // Works citations may refer to, nil without --bibliography
+	cited        map[string]bool         // Keys of the works cited so far
+	abbrevs      map[string][]abbrev     // Abbreviation definitions found in each file
+	divClasses   map[string][]string     // Classes of each file's section div, for --section-classes
+	glossary     *Glossary               // Terms given hover definitions, nil without --glossary
+	files        []string                // Included files in traversal order
+	inlineTOC    bool                    // Whether the root file has a <!-- toc --> placeholder
+	fileHeader   *template.Template      // Written before each file's section, nil for nothing
+	fileFooter   *template.Template      // Written after each file's section, nil for nothing
+	exploded     bool                    // Whether sections are rendered as standalone files for --explode
+	explodeDir   string                  // Absolute directory --explode writes section files under
+	appendix     map[string]bool         // Files grouped under the appendix heading by --append-orphans
+	appendixID   string                  // ID of the appendix heading
+	depths       map[string]int          // Traversal depth of each file for --nest-by-depth, nil without it
+	chunks       map[string]int          // Chunk of each file for --chunks, counting from 0, nil without it
+	assetBase    string                  // Directory relative asset paths are rewritten against
+	assets       map[string]string       // Images copied for --assets-dir, mapped to their paths under it
+	mu           sync.Mutex              // Guards state collected while files are processed in parallel
+	opts         Options                 // Run options controlling optional transformations
+	md           goldmark.Markdown       // Parser configured for the enabled transformations
+	renderers    sync.Pool               // Reusable *markdown.Renderer instances
 }
 
 // NewFileProcessor creates a new file processor for the given scope directory
-// and list of files in traversal order. Pre-loads header information for all files.
-func NewFileProcessor(scopeDir string, orderedFiles []string) *FileProcessor {
+// and list of files in traversal order. Pre-loads header and backlink information
+// for all files.
+func NewFileProcessor(scopeDir string, orderedFiles []string, opts Options) *FileProcessor {
 	fileOrder := make(map[string]int)
 	for i, file := range orderedFiles {
 		fileOrder[file] = i
@@ -82,22 +141,141 @@ func NewFileProcessor(scopeDir string, orderedFiles []string) *FileProcessor {
 		visited[file] = true
 	}
 
-	// Pre-load header information for all files
-	fileHeaders := make(map[string][]HeaderInfo)
-	for _, file := range orderedFiles {
-		if content, err := os.ReadFile(file); err == nil {
-			if parsed, err := ParseMarkdownFile(content, scopeDir); err == nil {
-				fileHeaders[file] = parsed.Headers
+	fp := &FileProcessor{
+		scopeDir:     scopeDir,
+		fileOrder:    fileOrder,
+		visitedFiles: visited,
+		fileHeaders:  make(map[string][]HeaderInfo),
+		backlinks:    make(map[string][]string),
+		qualifiers:   make(map[string]string),
+		anchors:      make(map[string]string),
+		htmlIDs:      make(map[string][]string),
+		htmlAnchors:  make(map[string]string),
+		endnoteBase:  make(map[string]int),
+		endnoteCount: make(map[string]int),
+		elements:     make(map[string][]string),
+		elementLinks: make(map[string]bool),
+		elementIDs:   make(map[string]string),
+		pruned:       make(map[string]string),
+		collapsed:    make(map[string]bool),
+		tocExcluded:  make(map[string]bool),
+		sectionTOCs:  make(map[string][]string),
+		abbrevs:      make(map[string][]abbrev),
+		divClasses:   make(map[string][]string),
+		files:        orderedFiles,
+		assetBase:    opts.AssetBase,
+		assets:       make(map[string]string),
+		opts:         opts,
+		md:           NewMarkdownParser(parserExtensions(opts)...),
+	}
+	if opts.Abbreviations {
+		// Only the sources have definitions to collect; they are written
+		// back as text for the output
+		fp.md = NewMarkdownParser(append(parserExtensions(opts), abbreviations{})...)
+	}
+	fp.renderers.New = func() any { return newMarkdownRenderer(opts.NodeRenderers) }
+	if fp.assetBase == "" {
+		fp.assetBase = assetBaseDir(orderedFiles, opts.Output)
+	}
+
+	// Pre-load header and link information for all files, parsing them in
+	// parallel and recording what they contain in traversal order
+	preloaded := parallelMap(len(orderedFiles), opts.Jobs, func(i int) *ParsedFile {
+		content, err := opts.Snapshot.ReadFile(orderedFiles[i])
+		if err != nil || looksBinary(content) {
+			return nil
+		}
+		parsed, err := parseMarkdownWith(fp.md, content, scopeDir, newSlugger(opts))
+		if err != nil {
+			return nil
+		}
+		return parsed
+	})
+	empty := make(map[string]bool)
+	assetNames := make(map[string]bool)
+	endnotes := 0
+	for i, file := range orderedFiles {
+		if content, err := opts.Snapshot.ReadFile(file); err == nil {
+			if looksBinary(content) {
+				// Skipped when processed, so links to it are left as they are
+				delete(fp.visitedFiles, file)
+				continue
+			}
+			if parsed := preloaded[i]; parsed != nil {
+				fp.fileHeaders[file] = parsed.Headers
+				fp.htmlIDs[file] = rawHTMLIDs(parsed.AST, parsed.Source)
+				fp.recordBacklinks(file, parsed.Links)
+				if opts.ElementAnchors {
+					fp.recordElements(file, parsed)
+				}
+				if opts.PruneEmpty && isEmptyDocument(parsed.AST) {
+					empty[file] = true
+				}
+				if i == 0 && opts.TOC {
+					fp.inlineTOC = findTOCPlaceholder(parsed.AST, parsed.Source) != nil
+				}
+				if opts.TOC && fp.excludedFromTOC(file, parsed) {
+					fp.tocExcluded[file] = true
+				}
+				if opts.HeadingsOnly {
+					// Only what is kept gets copied assets and note numbers.
+					// Footnotes of headings are moved out first, as when the
+					// file is processed, so the same ones are kept
+					moveHeadingFootnotes(parsed.AST)
+					keepOutline(parsed.AST, findTOCPlaceholder(parsed.AST, parsed.Source))
+				}
+				if opts.AssetsDir != "" {
+					fp.allocateAssets(file, parsed.AST, assetNames)
+				}
+				if opts.SectionClasses {
+					fp.divClasses[file] = fp.sectionClassList(file, parsed.FrontMatter)
+				}
+				if opts.Footnotes == FootnotesEndnotes {
+					fp.endnoteBase[file] = endnotes
+					fp.endnoteCount[file] = countEndnotes(parsed)
+					endnotes += fp.endnoteCount[file]
+				}
 			}
 		}
 		// If we can't read/parse a file, it will have empty headers slice
 	}
 
-	return &FileProcessor{
-		scopeDir:     scopeDir,
-		fileOrder:    fileOrder,
-		visitedFiles: visited,
-		fileHeaders:  fileHeaders,
+	fp.endnotes = make([]*endnote, endnotes)
+
+	if len(empty) > 0 {
+		fp.pruneEmpty(empty)
+	}
+
+	if opts.TOC {
+		fp.disambiguateTitles(fp.files)
+	}
+	fp.resolveAnchors(fp.files)
+
+	return fp
+}
+
+// collected is what processing a file adds to the document-wide sections at
+// the end of the output. It is kept apart until the file's output is used, see
+// record, so files that are abandoned or left out add nothing.
+type collected struct {
+	endnotes map[int]*endnote // The file's endnotes by number
+	cited    map[string]bool  // Keys of the works the file cites
+	abbrevs  []abbrev         // The file's abbreviation definitions
+}
+
+// record adds what processing filename collected to the document-wide
+// sections.
+func (fp *FileProcessor) record(filename string, c *collected) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	for number, note := range c.endnotes {
+		fp.endnotes[number-1] = note
+	}
+	for key := range c.cited {
+		fp.cited[key] = true
+	}
+	if len(c.abbrevs) > 0 {
+		fp.abbrevs[filename] = c.abbrevs
 	}
 }
 
@@ -106,29 +284,115 @@ func NewFileProcessor(scopeDir string, orderedFiles []string) *FileProcessor {
 // 2. Converting internal links to section anchors
 // 3. Inlining footnotes and removing footnote definitions
 // Returns the transformed content ready for output.
+//
+// Content that is not valid UTF-8 is rejected, and a panic inside the parser or
+// renderer is reported as an error rather than crashing the whole run.
 func (fp *FileProcessor) ProcessFile(filename string, content []byte) ([]byte, error) {
-	parsed, err := ParseMarkdownFile(content, fp.scopeDir)
+	processed, c, err := fp.process(context.Background(), filename, content)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse file %q: %w", filename, err)
+		return nil, err
+	}
+	fp.record(filename, c)
+	return processed, nil
+}
+
+// process is ProcessFile without recording what the file adds to the
+// document-wide sections, which it returns instead. It gives up with ctx's
+// error once ctx is done, between the steps that take the longest.
+func (fp *FileProcessor) process(ctx context.Context, filename string, content []byte) (processed []byte, c *collected, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			processed, c, err = nil, nil, fmt.Errorf("failed to process file %q: %w", filename, &panicError{value: r, stack: debug.Stack()})
+		}
+	}()
+
+	if looksBinary(content) {
+		return nil, nil, fmt.Errorf("failed to read file %q: %w", filename, errBinaryContent)
+	}
+	if !utf8.Valid(content) {
+		return nil, nil, fmt.Errorf("failed to read file %q: %w", filename, errInvalidUTF8)
+	}
+
+	parsed, err := parseMarkdownWith(fp.md, content, fp.scopeDir, newSlugger(fp.opts))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse file %q: %w", filename, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	moveHeadingFootnotes(parsed.AST)
+	if fp.opts.ElementAnchors {
+		fp.insertElementAnchors(parsed.AST, filename)
+	}
+	fp.caseHeadings(parsed.AST, parsed.Source)
+	if fp.opts.HeadingsOnly {
+		keepOutline(parsed.AST, findTOCPlaceholder(parsed.AST, parsed.Source))
 	}
 
 	header := fp.generateFileHeader(filename, parsed.Headers)
+	anchor := fp.sectionAnchorTag(filename)
+	if fp.omitsSection(filename) {
+		// The anchor keeps links to the root file working without a heading
+		header = ""
+	}
+	if _, ok := fp.qualifiers[filename]; ok {
+		if header != "" {
+			header = "# " + fp.sectionTitle(filename)
+		} else {
+			fp.qualifyHeading(parsed.AST, filename)
+		}
+	}
+
+	if header != "" {
+		header = strings.Repeat("#", fp.nesting(filename)) + header
+	}
+
+	if header != "" && fp.opts.CollapseTitles {
+		removeDuplicateTitle(parsed.AST, filename, parsed.Headers)
+	}
+
+	if fp.titlesDocument(filename) {
+		removeTitleHeading(parsed.AST)
+	}
 
 	// Always use unified processing for consistency
 	needsHeaderAdjustment := header != ""
-	transformedContent, err := fp.renderModifiedContent(parsed, filename, needsHeaderAdjustment)
+	c = &collected{endnotes: make(map[int]*endnote), cited: make(map[string]bool)}
+	transformedContent, err := fp.renderModifiedContent(ctx, parsed, filename, needsHeaderAdjustment, c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to render modified content for %q: %w", filename, err)
+	}
+
+	before, err := fp.executeFileTemplate(fp.fileHeader, filename, parsed.FrontMatter)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := fp.executeFileTemplate(fp.fileFooter, filename, parsed.FrontMatter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to render modified content for %q: %w", filename, err)
+		return nil, nil, err
 	}
 
 	var result strings.Builder
+	if before != "" {
+		result.WriteString(before)
+		result.WriteString("\n\n")
+	}
+	if anchor != "" {
+		result.WriteString(anchor)
+		result.WriteString("\n\n")
+	}
 	if header != "" {
 		result.WriteString(header)
 		result.WriteString("\n\n")
 	}
 	result.Write(transformedContent)
-
-	return []byte(result.String()), nil
+	if after != "" {
+		result.WriteString("\n")
+		result.WriteString(after)
+		result.WriteString("\n")
+	}
+	return []byte(result.String()), c, nil
 }
 
 // generateFileHeader implements the Header Generation Rules above.
@@ -144,15 +408,14 @@ func (fp *FileProcessor) generateFileHeader(filename string, headers []HeaderInf
 
 	// If there are 0 or more than 1 top-level headers, create synthetic header
 	if len(topLevelHeaders) != 1 {
-		base := filepath.Base(filename)
-		return "# " + base
+		return "# " + fp.headerPath(filename)
 	}
 
 	// There's exactly 1 top-level header - check if it's at the start
 	firstHeaderIsTopLevel := false
 	for _, h := range headers {
 		if h.Level > 0 {
-			if h.Level == 1 {
+			if h.Level == 1 && fp.allowsPreamble(h.Preamble) {
 				firstHeaderIsTopLevel = true
 			}
 			break
@@ -164,60 +427,125 @@ func (fp *FileProcessor) generateFileHeader(filename string, headers []HeaderInf
 	}
 
 	// Top-level header exists but not at start, create synthetic header
-	base := filepath.Base(filename)
-	return "# " + base
+	return "# " + fp.headerPath(filename)
 }
 
-func (fp *FileProcessor) isInternalLink(url, currentFile string) bool {
-	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
-		return false
+// Ways --header-paths shows a file's path in its synthetic header.
+const (
+	HeaderPathsBase     = "base"     // The file name alone, like "api.md"
+	HeaderPathsRelative = "relative" // The path relative to the scope directory, like "docs/api.md"
+)
+
+// headerPath returns how filename is shown in its synthetic header. Relative
+// paths always use forward slashes, so output doesn't depend on the OS it was
+// built on.
+func (fp *FileProcessor) headerPath(filename string) string {
+	if fp.opts.HeaderPaths == HeaderPathsRelative {
+		return fp.relPath(filename)
 	}
+	return filepath.Base(filename)
+}
 
-	if strings.HasPrefix(url, "#") {
+// omitsSection reports whether filename is the root file and has no section
+// heading: --no-root-section keeps it from getting a synthetic header, or
+// --root-title makes its H1 the document title. Its content starts the
+// document directly.
+func (fp *FileProcessor) omitsSection(filename string) bool {
+	if order, ok := fp.fileOrder[filename]; !ok || order != 0 {
 		return false
 	}
+	return fp.titlesDocument(filename) || fp.opts.NoRootSection && fp.generateFileHeader(filename, fp.fileHeaders[filename]) != ""
+}
 
-	if strings.HasPrefix(url, "mailto:") {
+// titlesDocument reports whether filename is the root file and --root-title
+// makes the H1 opening it the title of the combined document. Like a book's
+// title page, the H1 is left out of the body, and the file's other headings
+// move up a level, as pandoc's --shift-heading-level-by=-1 does.
+func (fp *FileProcessor) titlesDocument(filename string) bool {
+	if order, ok := fp.fileOrder[filename]; !ok || order != 0 || !fp.opts.RootTitle {
 		return false
 	}
+	return len(fp.fileHeaders[filename]) > 0 && fp.generateFileHeader(filename, fp.fileHeaders[filename]) == ""
+}
 
-	if filepath.IsAbs(url) {
-		return false
+// DocumentTitle returns the title of the combined document: the root file's H1
+// with --root-title, or "" if it has none.
+func (fp *FileProcessor) DocumentTitle() string {
+	if len(fp.files) == 0 || !fp.titlesDocument(fp.files[0]) {
+		return ""
 	}
+	return fp.caseHeadingText(fp.fileHeaders[fp.files[0]][0].Text)
+}
 
-	return true
+// removeTitleHeading removes the H1 opening doc, which DocumentTitle uses as
+// the document's title, and moves the remaining headings up a level.
+func removeTitleHeading(doc ast.Node) {
+	var headings []*ast.Heading
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			headings = append(headings, heading)
+		}
+		return ast.WalkContinue, nil
+	})
+	if len(headings) == 0 {
+		return
+	}
+	title := headings[0]
+	title.Parent().RemoveChild(title.Parent(), title)
+	for _, heading := range headings[1:] {
+		heading.Level = max(heading.Level-1, 1)
+	}
 }
 
-func (fp *FileProcessor) resolveLink(currentFile, linkURL string) (string, error) {
-	currentDir := filepath.Dir(currentFile)
+// What may come before a file's level-1 header for it to open the file's
+// section, as accepted by --title-preamble.
+const (
+	TitlePreambleAny      = "any"      // Anything but other headers
+	TitlePreambleComments = "comments" // Only HTML comments
+	TitlePreambleNone     = "none"     // Nothing
+)
 
-	if strings.Contains(linkURL, "#") {
-		linkURL = strings.Split(linkURL, "#")[0]
+// allowsPreamble reports whether --title-preamble lets a level-1 header preceded
+// by preamble, one of the Preamble* constants, open its file.
+func (fp *FileProcessor) allowsPreamble(preamble int) bool {
+	switch fp.opts.TitlePreamble {
+	case TitlePreambleNone:
+		return preamble == PreambleNone
+	case TitlePreambleComments:
+		return preamble <= PreambleComments
 	}
+	return true
+}
 
-	if linkURL == "" {
-		return "", fmt.Errorf("empty link after fragment removal")
+func (fp *FileProcessor) isInternalLink(url, currentFile string) bool {
+	if isFileURL(url) {
+		_, ok := fileURLPath(url)
+		return ok
 	}
 
-	var resolvedPath string
-	if filepath.IsAbs(linkURL) {
-		resolvedPath = linkURL
-	} else {
-		resolvedPath = filepath.Join(currentDir, linkURL)
+	if isExternalScheme(url, fp.opts.Schemes) {
+		return false
 	}
 
-	cleanPath, err := filepath.Abs(resolvedPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to resolve absolute path: %w", err)
+	if strings.HasPrefix(url, "#") {
+		return false
+	}
+
+	if filepath.IsAbs(url) {
+		return false
 	}
 
-	return cleanPath, nil
+	return true
+}
+
+func (fp *FileProcessor) resolveLink(currentFile, linkURL string) (string, error) {
+	return resolveWith(fp.opts.Resolver, currentFile, linkURL)
 }
 
 // renderModifiedContent implements the Header Adjustment Rules above.
 // Applies content transformations consistently for all files, including conditional
 // header level adjustment when synthetic headers are added to files with exactly 1 level-1 header.
-func (fp *FileProcessor) renderModifiedContent(parsed *ParsedFile, filename string, needsHeaderAdjustment bool) ([]byte, error) {
+func (fp *FileProcessor) renderModifiedContent(ctx context.Context, parsed *ParsedFile, filename string, needsHeaderAdjustment bool, c *collected) ([]byte, error) {
 	// Implement Header Adjustment Rules: Increment ALL headers by 1 level when
 	// a synthetic header is added AND the original document had exactly 1 level-1 header
 	if needsHeaderAdjustment {
@@ -235,13 +563,31 @@ func (fp *FileProcessor) renderModifiedContent(parsed *ParsedFile, filename stri
 
 		// Adjust headers when adding synthetic header and any level-1 headers exist
 		// This prevents conflicts by ensuring only the synthetic header is level-1
-		if level1Count > 0 {
+		if fp.opts.PromoteHeadings {
+			promoteHeadingsInAST(parsed.AST)
+		} else if level1Count > 0 {
 			adjustHeaderLevelsInAST(parsed.AST)
 		}
 	}
 
+	// Appendix sections sit one level below the appendix heading, and
+	// --nest-by-depth sections one level below their parent's
+	for range fp.nesting(filename) {
+		adjustHeaderLevelsInAST(parsed.AST)
+	}
+
+	if fp.opts.FlattenBelow > 0 {
+		flattenHeadingsInAST(parsed.AST, fp.opts.FlattenBelow, func(id string) string {
+			return fp.finalAnchor(filename, id)
+		})
+	}
+
+	if fp.opts.HeadingAttributes {
+		fp.writeHeadingAttributes(parsed.AST, parsed.Source, filename)
+	}
+
 	// Render the modified AST back to markdown with link and footnote transformations
-	return fp.renderModifiedASTToMarkdownWithTransforms(parsed, filename)
+	return fp.renderModifiedASTToMarkdownWithTransforms(ctx, parsed, filename, c)
 }
 
 // adjustHeaderLevelsInAST increments ALL header levels by 1 to resolve conflicts.
@@ -264,6 +610,120 @@ func adjustHeaderLevelsInAST(doc ast.Node) {
 	})
 }
 
+// promoteHeadingsInAST shifts all headings by the same amount so the highest
+// level in the document becomes 2, directly under the synthetic header. A file
+// whose outline starts at ### no longer skips a level, and one with several
+// level-1 headers is demoted as adjustHeaderLevelsInAST would. Relative nesting
+// is kept, except that headings pushed past level 6 stay at 6.
+func promoteHeadingsInAST(doc ast.Node) {
+	var headings []*ast.Heading
+	highest := 6
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			headings = append(headings, heading)
+			highest = min(highest, heading.Level)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	shift := 2 - highest
+	for _, heading := range headings {
+		heading.Level = min(heading.Level+shift, 6)
+	}
+}
+
+// flattenHeadingsInAST turns headings deeper than maxLevel into paragraphs of
+// bold text, so long combined documents don't produce deep navigation trees.
+// Each keeps its heading's anchor as an HTML anchor with the ID anchor maps it
+// to, so links to it still resolve.
+func flattenHeadingsInAST(doc ast.Node, maxLevel int, anchor func(id string) string) {
+	var headings []*ast.Heading
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering && heading.Level > maxLevel {
+			headings = append(headings, heading)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, heading := range headings {
+		paragraph := ast.NewParagraph()
+		paragraph.SetBlankPreviousLines(heading.HasBlankPreviousLines())
+		if id, ok := heading.AttributeString("id"); ok {
+			if idBytes, ok := id.([]byte); ok {
+				paragraph.AppendChild(paragraph, newAnchor(anchor(string(idBytes))))
+			}
+		}
+
+		strong := ast.NewEmphasis(2)
+		for child := heading.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			strong.AppendChild(strong, child)
+			child = next
+		}
+		paragraph.AppendChild(paragraph, strong)
+
+		parent := heading.Parent()
+		parent.ReplaceChild(parent, heading, paragraph)
+	}
+}
+
+// keepOutline removes everything from doc but its top-level headings, its first
+// paragraph, and keep, for --headings-only digests. Footnote definitions are
+// kept for the references that remain.
+func keepOutline(doc ast.Node, keep ast.Node) {
+	paragraph := false
+	for child := doc.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		switch child.(type) {
+		case *ast.Heading, *extast.FootnoteList:
+		case *ast.Paragraph:
+			if paragraph {
+				doc.RemoveChild(doc, child)
+			}
+			paragraph = true
+		default:
+			if child != keep {
+				doc.RemoveChild(doc, child)
+			}
+		}
+		child = next
+	}
+}
+
+// duplicatesTitle reports whether the first of headers, the headings of
+// filename, opens the document and repeats the file's name, such as "## API"
+// at the start of api.md, which would otherwise stutter right below the
+// synthetic "# api.md" header. Anchors and the document model work out which
+// headings --collapse-duplicate-titles drops with it too, so they agree with
+// removeDuplicateTitle.
+func duplicatesTitle(filename string, headers []HeaderInfo) bool {
+	return len(headers) > 0 && headers[0].Preamble == PreambleNone && titleKey(headers[0].Text) == titleKey(filepath.Base(filename))
+}
+
+// removeDuplicateTitle drops the heading opening doc when duplicatesTitle
+// reports that it repeats the file's name.
+func removeDuplicateTitle(doc ast.Node, filename string, headers []HeaderInfo) {
+	if !duplicatesTitle(filename, headers) {
+		return
+	}
+	if heading, ok := doc.FirstChild().(*ast.Heading); ok {
+		doc.RemoveChild(doc, heading)
+	}
+}
+
+// titleKey reduces a title or file name to the letters and digits that matter
+// when comparing them, so "getting-started.md" matches "Getting Started".
+func titleKey(title string) string {
+	title = strings.TrimSuffix(title, filepath.Ext(title))
+	var key strings.Builder
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			key.WriteRune(r)
+		}
+	}
+	return key.String()
+}
+
 // renderModifiedASTToMarkdownWithTransforms implements the transformation pipeline
 // by applying footnote inlining, link transformation, and final rendering in sequence.
 //
@@ -274,19 +734,67 @@ func adjustHeaderLevelsInAST(doc ast.Node) {
 //
 // Each phase operates on the AST in-place, maintaining document structure
 // while applying the necessary transformations for concatenated output.
-func (fp *FileProcessor) renderModifiedASTToMarkdownWithTransforms(parsed *ParsedFile, filename string) ([]byte, error) {
-	// Pass 1: Inline footnotes
-	if err := fp.inlineFootnotes(parsed, filename); err != nil {
+func (fp *FileProcessor) renderModifiedASTToMarkdownWithTransforms(ctx context.Context, parsed *ParsedFile, filename string, c *collected) ([]byte, error) {
+	if fp.opts.Abbreviations {
+		c.abbrevs = collectAbbreviations(parsed.AST)
+	}
+
+	// Pass 1: Inline footnotes, or collect them as endnotes
+	if fp.opts.Footnotes == FootnotesEndnotes {
+		if err := fp.collectEndnotes(parsed, filename, c); err != nil {
+			return nil, err
+		}
+	} else if err := fp.inlineFootnotes(parsed, filename); err != nil {
 		return nil, err
 	}
 
+	if fp.opts.ConvertHTMLTables {
+		fp.convertHTMLTables(parsed.AST, parsed.Source, filename)
+	}
+
+	if fp.bibliography != nil {
+		fp.replaceCitations(parsed.AST, parsed.Source, filename, c.cited)
+	}
+
+	if fp.opts.StripSchemeLinks {
+		fp.stripSchemeLinks(parsed.AST, parsed.Source)
+	}
+
+	if len(fp.htmlIDs[filename]) > 0 {
+		fp.rewriteHTMLIDs(parsed.AST, parsed.Source, filename)
+	}
+
 	// Pass 2: Transform links
 	if err := fp.transformLinks(parsed.AST, filename); err != nil {
 		return nil, err
 	}
 
-	// Pass 3: Render to markdown using the standard renderer
-	renderer := markdown.NewRenderer()
+	if fp.opts.Emoji != "" {
+		convertEmoji(parsed.AST, fp.opts.Emoji)
+	}
+
+	if fp.opts.Backlinks {
+		fp.appendBacklinks(parsed.AST, filename)
+	}
+
+	if fp.opts.NavLinks {
+		fp.appendNavLinks(parsed.AST, filename)
+	}
+
+	if fp.opts.TOC {
+		fp.replaceTOCPlaceholder(parsed.AST, parsed.Source, filename)
+		fp.insertSectionTOC(parsed.AST, filename)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Pass 3: Render to markdown using the standard renderer. Renderers hold
+	// per-render state, so each one is only ever used by a single render at a time.
+	renderer := fp.renderers.Get().(*markdown.Renderer)
+	defer fp.renderers.Put(renderer)
+
 	var buf bytes.Buffer
 	if err := renderer.Render(&buf, parsed.Source, parsed.AST); err != nil {
 		return nil, err
@@ -295,6 +803,47 @@ func (fp *FileProcessor) renderModifiedASTToMarkdownWithTransforms(parsed *Parse
 	return buf.Bytes(), nil
 }
 
+// moveHeadingFootnotes moves the footnote references of each heading of doc to
+// the end of the paragraph right after it, or to a paragraph of their own there
+// when no paragraph follows. Inlined notes would garble the heading's text and
+// its ID, which extractHeaders works out without them, and endnote markers
+// would end up in the table of contents.
+func moveHeadingFootnotes(doc ast.Node) {
+	var headings []*ast.Heading
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			if hasFootnoteLink(heading) {
+				headings = append(headings, heading)
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, heading := range headings {
+		var refs []ast.Node
+		ast.Walk(heading, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+			if link, ok := n.(*extast.FootnoteLink); ok && entering {
+				refs = append(refs, link)
+			}
+			return ast.WalkContinue, nil
+		})
+
+		paragraph, ok := heading.NextSibling().(*ast.Paragraph)
+		if !ok {
+			paragraph = ast.NewParagraph()
+			paragraph.SetBlankPreviousLines(true)
+			parent := heading.Parent()
+			parent.InsertAfter(parent, heading, paragraph)
+		}
+		for _, ref := range refs {
+			parent := ref.Parent()
+			parent.RemoveChild(parent, ref)
+			paragraph.AppendChild(paragraph, ref)
+		}
+	}
+}
+
 // inlineFootnotes replaces footnote references with their content and removes footnote definitions.
 // This implements Pass 2 of the transformation pipeline.
 //
@@ -325,8 +874,11 @@ func (fp *FileProcessor) inlineFootnotes(parsed *ParsedFile, filename string) er
 		return ast.WalkContinue, nil
 	})
 
-	// Now walk the AST and replace footnote references and remove definitions
+	// Collect footnote references and definitions, replacing them after the
+	// walk since removing nodes during it would cut it short
+	var links []*extast.FootnoteLink
 	var nodesToRemove []ast.Node
+	definitions := make(map[string]*extast.Footnote)
 
 	ast.Walk(parsed.AST, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
 		if !entering {
@@ -335,37 +887,57 @@ func (fp *FileProcessor) inlineFootnotes(parsed *ParsedFile, filename string) er
 
 		switch node := n.(type) {
 		case *extast.FootnoteLink:
-			// Replace footnote reference with inline AST nodes
-			footnoteID := footnoteIndexToID[node.Index]
-			if nodes, exists := footnoteNodesMap[footnoteID]; exists {
-				parent := node.Parent()
-				if parent != nil {
-					// Insert opening parenthesis and space
-					parent.InsertBefore(parent, node, ast.NewString([]byte(" (")))
-
-					// Insert all footnote nodes
-					for _, footnoteNode := range nodes {
-						parent.InsertBefore(parent, node, footnoteNode)
-					}
-
-					// Insert closing parenthesis
-					parent.InsertBefore(parent, node, ast.NewString([]byte(")")))
-
-					// Remove the original footnote reference
-					parent.RemoveChild(parent, node)
-				}
-			}
+			links = append(links, node)
 			return ast.WalkSkipChildren, nil
 
-		case *extast.Footnote, *extast.FootnoteList:
-			// Mark for removal (can't remove during walk)
+		case *extast.Footnote:
+			definitions[string(node.Ref)] = node
 			nodesToRemove = append(nodesToRemove, n)
 			return ast.WalkSkipChildren, nil
+
+		case *extast.FootnoteList:
+			nodesToRemove = append(nodesToRemove, n)
 		}
 
 		return ast.WalkContinue, nil
 	})
 
+	// Replace footnote references with inline AST nodes
+	inlined := make(map[string]bool)
+	for _, link := range links {
+		footnoteID := footnoteIndexToID[link.Index]
+		nodes, exists := footnoteNodesMap[footnoteID]
+		parent := link.Parent()
+		if !exists || parent == nil {
+			continue
+		}
+		if inlined[footnoteID] {
+			// A node can only be in one place, so each further reference to
+			// the same footnote gets a fresh copy of its content
+			nodes = extractFootnoteNodes(fp.md, definitions[footnoteID], parsed.Source)
+		}
+		inlined[footnoteID] = true
+
+		// Insert opening parenthesis, after a space unless the reference
+		// starts its paragraph, as moved heading references do
+		opening := " ("
+		if link.PreviousSibling() == nil {
+			opening = "("
+		}
+		parent.InsertBefore(parent, link, ast.NewString([]byte(opening)))
+
+		// Insert all footnote nodes
+		for _, footnoteNode := range nodes {
+			parent.InsertBefore(parent, link, footnoteNode)
+		}
+
+		// Insert closing parenthesis
+		parent.InsertBefore(parent, link, ast.NewString([]byte(")")))
+
+		// Remove the original footnote reference
+		parent.RemoveChild(parent, link)
+	}
+
 	// Remove footnote definitions
 	for _, node := range nodesToRemove {
 		if parent := node.Parent(); parent != nil {
@@ -382,54 +954,264 @@ func (fp *FileProcessor) inlineFootnotes(parsed *ParsedFile, filename string) er
 // Internal links like "./other.md#section" become "#other.md#section" to point to
 // the correct file section in the concatenated output. Uses goldmark's auto-generated
 // header IDs when available for accurate anchor targeting.
+//
+// Query strings are ignored when resolving targets, and dropped from rewritten
+// links unless --keep-query is set.
+//
+// With --dual-links, each rewritten link is followed by a superscript link to the
+// target's original path relative to the scope directory.
 func (fp *FileProcessor) transformLinks(doc ast.Node, filename string) error {
+	var rewritten, omitted []*ast.Link
+	var sourcePaths, omittedPaths []string
 	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
 		if !entering {
 			return ast.WalkContinue, nil
 		}
 
-		if link, ok := n.(*ast.Link); ok {
+		switch node := n.(type) {
+		case *ast.Link:
+			link := node
 			if fp.isInternalLink(string(link.Destination), filename) {
-				if resolvedPath, err := fp.resolveLink(filename, string(link.Destination)); err == nil {
-					if fp.visitedFiles[resolvedPath] {
-						fragment := ""
-						if strings.Contains(string(link.Destination), "#") {
-							parts := strings.Split(string(link.Destination), "#")
-							if len(parts) > 1 {
-								fragment = "#" + strings.Join(parts[1:], "#")
-							}
-						}
-						sectionLink := fp.generateTargetAnchor(resolvedPath) + fragment
-						link.Destination = []byte(sectionLink)
+				resolvedPath, err := fp.resolveLink(filename, string(link.Destination))
+				if target, destination, ok := fp.retarget(resolvedPath, string(link.Destination)); err == nil && ok {
+					fragment := linkFragment(string(link.Destination))
+					link.Destination = []byte(fp.sectionDestination(filename, target, destination))
+					rewritten = append(rewritten, link)
+					sourcePaths = append(sourcePaths, fp.sourceDestination(filename, resolvedPath)+fragment)
+				} else {
+					if path, ok := fp.omittedSection(filename, string(link.Destination)); ok && fp.opts.OmissionNotes {
+						omitted = append(omitted, link)
+						omittedPaths = append(omittedPaths, path)
 					}
+					link.Destination = []byte(fp.rebaseAsset(filename, string(link.Destination)))
 				}
+			} else if fragment, ok := strings.CutPrefix(string(link.Destination), "#"); ok && !fp.exploded {
+				target, anchor, matches := fp.resolveBareFragment(filename, fragment)
+				if len(matches) > 1 {
+					var paths []string
+					for _, match := range matches {
+						paths = append(paths, fp.relPath(match))
+					}
+					fmt.Fprintf(os.Stderr, "Warning: %s: fragment %q matches anchors in %s; linking to the first\n", displayPath(filename), "#"+fragment, strings.Join(paths, ", "))
+				}
+				link.Destination = []byte(fp.chunkLink(filename, target) + "#" + anchor)
+			}
+		case *ast.Image:
+			if fp.opts.AssetsDir != "" && !fp.exploded {
+				node.Destination = []byte(fp.assetDestination(filename, string(node.Destination)))
+			} else {
+				node.Destination = []byte(fp.rebaseAsset(filename, string(node.Destination)))
 			}
 		}
 
 		return ast.WalkContinue, nil
 	})
 
+	// Insert after walking, so the walk never visits the added source links
+	if fp.opts.DualLinks {
+		for i, link := range rewritten {
+			appendSourceLink(link, sourcePaths[i])
+		}
+	}
+	for i, link := range omitted {
+		appendOmissionNote(link, omittedPaths[i])
+	}
+
 	return nil
 }
 
-// generateTargetAnchor creates the appropriate anchor for a target file.
-// If the file has an H1 header, use that header's anchor. Otherwise, use filename.
+// assetBaseDir returns the directory the combined document is written to:
+// that of output, or of the root file, the first of files, when writing to
+// standard output.
+func assetBaseDir(files []string, output string) string {
+	if output != "" && output != "/dev/stdout" {
+		if dir, err := filepath.Abs(filepath.Dir(output)); err == nil {
+			return dir
+		}
+	}
+	if len(files) == 0 {
+		return ""
+	}
+	return filepath.Dir(files[0])
+}
+
+// rebaseAsset returns a relative destination in filename, such as an image or
+// a link to a file left out of the output, rewritten to be relative to the
+// directory filename's output is written to, keeping any query string and
+// fragment: that of the combined document, or of filename's own section file
+// with --explode. Other destinations are returned as they are.
+func (fp *FileProcessor) rebaseAsset(filename, destination string) string {
+	dir := filepath.Dir(filename)
+	base := fp.assetBase
+	if fp.exploded {
+		base = filepath.Dir(filepath.Join(fp.explodeDir, filepath.FromSlash(fp.relPath(filename))))
+	}
+	if base == "" || base == dir {
+		return destination
+	}
+	if destination == "" || strings.HasPrefix(destination, "#") || strings.HasPrefix(destination, "/") || strings.Contains(destination, ":") {
+		return destination
+	}
+	end := len(destination)
+	if i := strings.IndexAny(destination, "?#"); i >= 0 {
+		end = i
+	}
+	rel, err := filepath.Rel(base, filepath.Join(dir, filepath.FromSlash(destination[:end])))
+	if err != nil {
+		return destination
+	}
+	return filepath.ToSlash(rel) + destination[end:]
+}
+
+// sectionDestination returns what a link in filename to destination, which
+// resolves to the included file target, is rewritten to.
+func (fp *FileProcessor) sectionDestination(filename, target, destination string) string {
+	fragment := linkFragment(destination)
+	sectionLink := fp.sectionLink(filename, target)
+	if fp.exploded {
+		sectionLink += fragment
+	} else if fragment != "" {
+		sectionLink = fp.chunkLink(filename, target) + "#" + fp.finalAnchor(target, fragment[1:])
+	}
+	if query := linkQuery(destination); query != "" && fp.opts.KeepQuery {
+		sectionLink = insertQuery(sectionLink, query)
+	}
+	return sectionLink
+}
+
+// linkFragment returns the fragment of a link destination, including its "#",
+// or "" if it has none.
+func linkFragment(destination string) string {
+	if _, fragment, ok := strings.Cut(destination, "#"); ok {
+		return "#" + fragment
+	}
+	return ""
+}
+
+// linkQuery returns the query string of a link destination, including its "?",
+// or "" if it has none.
+func linkQuery(destination string) string {
+	destination, _, _ = strings.Cut(destination, "#")
+	if i := strings.IndexByte(destination, '?'); i >= 0 {
+		return destination[i:]
+	}
+	return ""
+}
+
+// insertQuery adds query to a rewritten link, before its fragment.
+func insertQuery(link, query string) string {
+	path, fragment, ok := strings.Cut(link, "#")
+	if !ok {
+		return path + query
+	}
+	return path + query + "#" + fragment
+}
+
+// sourceDestination returns where the --dual-links source link of a link in
+// filename to the file target points: at target relative to the directory of
+// the combined document, the way rebaseAsset rebases other local files.
+func (fp *FileProcessor) sourceDestination(filename, target string) string {
+	rel, err := filepath.Rel(filepath.Dir(filename), target)
+	if err != nil {
+		return fp.relPath(target)
+	}
+	return fp.rebaseAsset(filename, filepath.ToSlash(rel))
+}
+
+// appendSourceLink inserts `<sup>[source](destination)</sup>` right after
+// link. Markdown has no superscript, so the <sup> element is raw HTML.
+func appendSourceLink(link *ast.Link, destination string) {
+	parent := link.Parent()
+	if parent == nil {
+		return
+	}
+
+	source := ast.NewLink()
+	source.Destination = []byte(destination)
+	source.AppendChild(source, ast.NewString([]byte("source")))
+
+	closing := newRawHTML("</sup>")
+	parent.InsertAfter(parent, link, closing)
+	parent.InsertBefore(parent, closing, source)
+	parent.InsertBefore(parent, source, newRawHTML("<sup>"))
+	parent.InsertBefore(parent, source.PreviousSibling(), ast.NewString([]byte(" ")))
+}
+
+// omittedSection reports whether destination, linked from filename, names a
+// markdown document that is left out of the output, such as a file outside the
+// scope, one filtered out by --tags or --audience, or one a LinkResolver
+// excluded, and returns its path for display.
+func (fp *FileProcessor) omittedSection(filename, destination string) (string, bool) {
+	target, err := fp.resolveLink(filename, destination)
+	if errors.Is(err, errLinkExcluded) {
+		path, _, _ := strings.Cut(destination, "#")
+		path, _, _ = strings.Cut(path, "?")
+		return path, true
+	}
+	if err != nil || fp.visitedFiles[target] {
+		return "", false
+	}
+	switch strings.ToLower(filepath.Ext(target)) {
+	case ".md", ".markdown":
+	default:
+		return "", false
+	}
+	if info, err := os.Stat(target); err != nil || info.IsDir() {
+		return "", false
+	}
+	return fp.relPath(target), true
+}
+
+// appendOmissionNote inserts ` *(section omitted: path)*` right after link.
+func appendOmissionNote(link *ast.Link, path string) {
+	parent := link.Parent()
+	if parent == nil {
+		return
+	}
+	note := ast.NewEmphasis(1)
+	note.AppendChild(note, newLiteral("(section omitted: "+path+")"))
+	parent.InsertAfter(parent, link, note)
+	parent.InsertAfter(parent, link, ast.NewString([]byte(" ")))
+}
+
+// generateTargetAnchor creates the anchor links to a target file's section point
+// at, as derived by the anchor strategy.
 func (fp *FileProcessor) generateTargetAnchor(targetPath string) string {
-	// Use cached header information
-	headers, exists := fp.fileHeaders[targetPath]
-	if !exists {
-		// Fallback to filename if no cached headers
+	if to, ok := fp.pruned[targetPath]; ok {
+		targetPath = to
+	}
+	return "#" + fp.anchorStrategy().SectionAnchor(SectionInfo{
+		Path:    fp.relPath(targetPath),
+		Title:   fp.sectionTitle(targetPath),
+		Heading: fp.headingAnchor(targetPath)[1:],
+	})
+}
+
+// headingAnchor returns the anchor of a target file's section heading: the ID
+// of its synthetic header if it gets one, or else of its H1. A root file without
+// a section uses the filename.
+//
+// Files whose titles were disambiguated link to the slug of the qualified title.
+func (fp *FileProcessor) headingAnchor(targetPath string) string {
+	if fp.omitsSection(targetPath) {
 		return GenerateSectionLink(targetPath)
 	}
 
+	if id, ok := fp.anchors[targetPath+"#"]; ok {
+		return "#" + id
+	}
+
+	if _, ok := fp.qualifiers[targetPath]; ok {
+		return "#" + fp.headingSlug(fp.sectionTitle(targetPath))
+	}
+
 	// Look for the first H1 header
-	for _, header := range headers {
+	for _, header := range fp.fileHeaders[targetPath] {
 		if header.Level == 1 {
-			// File has an H1 header, use its anchor from goldmark's auto-generated ID
-			return "#" + header.ID
+			// File has an H1 header, use the final anchor of its auto-generated ID
+			return "#" + fp.finalAnchor(targetPath, header.ID)
 		}
 	}
 
-	// No H1 header found, use filename (catmd will add synthetic header)
 	return GenerateSectionLink(targetPath)
 }
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func TestFileProcessor_GenerateFileHeader(t *testing.T) {
@@ -76,6 +81,50 @@ func TestFileProcessor_GenerateFileHeader(t *testing.T) {
 	}
 }
 
+func TestFileProcessor_TitlePreamble(t *testing.T) {
+	sources := []struct {
+		name    string
+		content string
+	}{
+		{"byte order mark", "\xef\xbb\xbf# Title\n"},
+		{"front matter", "---\ntags: [a]\n---\n\n# Title\n"},
+		{"comment", "<!-- generated -->\n# Title\n"},
+		{"paragraph", "Draft.\n\n# Title\n"},
+	}
+	expected := map[string][]string{
+		TitlePreambleAny:      {"", "", "", ""},
+		TitlePreambleComments: {"", "", "", "# doc.md"},
+		TitlePreambleNone:     {"", "", "# doc.md", "# doc.md"},
+	}
+
+	for policy, headers := range expected {
+		fp := &FileProcessor{opts: Options{TitlePreamble: policy}}
+		for i, source := range sources {
+			parsed, err := parseMarkdownWith(frontMatterParser(), []byte(source.content), "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fp.generateFileHeader("doc.md", parsed.Headers); got != headers[i] {
+				t.Errorf("--title-preamble %s, %s: generateFileHeader() = %q, want %q", policy, source.name, got, headers[i])
+			}
+		}
+	}
+}
+
+func TestFileProcessor_HeaderPaths(t *testing.T) {
+	filename := filepath.Join("/docs", "guides", "setup.md")
+	expected := map[string]string{
+		HeaderPathsBase:     "# setup.md",
+		HeaderPathsRelative: "# guides/setup.md",
+	}
+	for style, header := range expected {
+		fp := &FileProcessor{scopeDir: "/docs", opts: Options{HeaderPaths: style}}
+		if got := fp.generateFileHeader(filename, nil); got != header {
+			t.Errorf("--header-paths %s: generateFileHeader() = %q, want %q", style, got, header)
+		}
+	}
+}
+
 func TestFileProcessor_IsInternalLink(t *testing.T) {
 	fp := &FileProcessor{}
 
@@ -203,3 +252,299 @@ func TestFileProcessor_ResolveLink(t *testing.T) {
 		})
 	}
 }
+
+func TestFileProcessor_FileURLLinks(t *testing.T) {
+	dir := t.TempDir()
+	guide := filepath.Join(dir, "docs", "my guide.md")
+	if err := os.MkdirAll(filepath.Dir(guide), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(guide, []byte("# Guide\n\n## Setup\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "index.md")
+	content := "# Index\n\nSee [setup](file://" + filepath.ToSlash(dir) + "/docs/my%20guide.md#setup).\n"
+	if err := os.WriteFile(root, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := NewFileTraversal(root, dir).Traverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[1] != guide {
+		t.Fatalf("Traverse() = %q, want the root followed by %q", files, guide)
+	}
+
+	processed, err := NewFileProcessor(dir, files, Options{}).ProcessFile(root, []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[setup](#setup)"; !strings.Contains(string(processed), want) {
+		t.Errorf("ProcessFile() = %q, want it to contain %q", processed, want)
+	}
+}
+
+func TestFileProcessor_QueryStringLinks(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "page.md")
+	if err := os.WriteFile(page, []byte("# Page\n\n## Section\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "index.md")
+	content := "# Index\n\nSee [the section](page.md?highlight=term#section).\n"
+	if err := os.WriteFile(root, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := NewFileTraversal(root, dir).Traverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[1] != page {
+		t.Fatalf("Traverse() = %q, want the root followed by %q", files, page)
+	}
+
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{}, "[the section](#section)"},
+		{Options{KeepQuery: true}, "[the section](?highlight=term#section)"},
+	}
+	for _, tt := range tests {
+		processed, err := NewFileProcessor(dir, files, tt.opts).ProcessFile(root, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(processed), tt.want) {
+			t.Errorf("ProcessFile() with %+v = %q, want it to contain %q", tt.opts, processed, tt.want)
+		}
+	}
+}
+
+func TestFileProcessor_RebaseAssets(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "docs", "index.md")
+	setup := filepath.Join(dir, "docs", "guide", "setup.md")
+	if err := os.MkdirAll(filepath.Dir(setup), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(root, []byte("# Docs\n\n![Logo](img/logo.png)\n\nSee [setup](guide/setup.md).\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	content := "# Setup\n\n![Diagram](../img/flow.svg) and [the tool](files/tool.zip?v=2#top).\n"
+	if err := os.WriteFile(setup, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := NewFileTraversal(root, filepath.Join(dir, "docs")).Traverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		output string
+		want   []string
+	}{
+		{"", []string{"(img/flow.svg)", "(guide/files/tool.zip?v=2#top)"}},
+		{filepath.Join(dir, "build", "book.md"), []string{"(../docs/img/flow.svg)", "(../docs/guide/files/tool.zip?v=2#top)"}},
+		{filepath.Join(dir, "docs", "guide", "out", "book.md"), []string{"(../../img/flow.svg)", "(../files/tool.zip?v=2#top)"}},
+	}
+	for _, tt := range tests {
+		processed, err := NewFileProcessor(filepath.Join(dir, "docs"), files, Options{Output: tt.output}).ProcessFile(setup, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(string(processed), want) {
+				t.Errorf("ProcessFile() with output %q = %q, want it to contain %q", tt.output, processed, want)
+			}
+		}
+	}
+}
+
+func TestFileProcessor_AssetsDir(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "docs", "index.md")
+	shared := filepath.Join(dir, "shared", "logo.png")
+	for path, content := range map[string]string{
+		filepath.Join(dir, "docs", "img", "logo.png"): "docs",
+		shared: "shared",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content := "# Docs\n\n![Logo](img/logo.png#light) ![Shared](../shared/logo.png) ![Missing](img/missing.png)\n"
+	if err := os.WriteFile(root, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "build", "book.md")
+	processor := NewFileProcessor(filepath.Join(dir, "docs"), []string{root}, Options{Output: output, AssetsDir: "assets"})
+	processed, err := processor.ProcessFile(root, []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Images outside the scope are copied by base name; missing ones stay put
+	for _, want := range []string{"(assets/img/logo.png#light)", "(assets/logo.png)", "(../docs/img/missing.png)"} {
+		if !strings.Contains(string(processed), want) {
+			t.Errorf("ProcessFile() = %q, want it to contain %q", processed, want)
+		}
+	}
+
+	if err := processor.CopyAssets(); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{"img/logo.png": "docs", "logo.png": "shared"} {
+		got, err := os.ReadFile(filepath.Join(dir, "build", "assets", filepath.FromSlash(path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("copy of %s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestFileProcessor_FootnoteLinks(t *testing.T) {
+	dir := t.TempDir()
+	index := filepath.Join(dir, "index.md")
+	other := filepath.Join(dir, "other.md")
+	content := "# Index\n\nFirst[^a], again[^a].\n\n## Local\n\n[^a]: See [setup](other.md#setup), [other](other.md), and [here](#local).\n"
+	if err := os.WriteFile(index, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(other, []byte("# Other Document\n\n## Setup\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	processor := NewFileProcessor(dir, []string{index, other}, Options{})
+	processed, err := processor.ProcessFile(index, []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each reference gets its own copy of the footnote, with links rewritten
+	inlined := "(See [setup](#setup), [other](#other-document), and [here](#local).)"
+	if got := strings.Count(string(processed), inlined); got != 2 {
+		t.Errorf("ProcessFile() = %q, want %q twice", processed, inlined)
+	}
+}
+
+func TestTitleKey(t *testing.T) {
+	tests := []struct {
+		title, filename string
+		match           bool
+	}{
+		{"API", "api.md", true},
+		{"Getting Started", "getting-started.md", true},
+		{"Getting_Started!", "GETTING STARTED.markdown", true},
+		{"Release Notes", "changes.md", false},
+		{"API v2", "api.md", false},
+	}
+
+	for _, tt := range tests {
+		if got := titleKey(tt.title) == titleKey(tt.filename); got != tt.match {
+			t.Errorf("titleKey(%q) == titleKey(%q) is %v, want %v", tt.title, tt.filename, got, tt.match)
+		}
+	}
+}
+
+// writeBenchmarkTree creates a chain of n linked markdown files, each with a
+// footnote and a few sections, and returns the root file path.
+func writeBenchmarkTree(b testing.TB, n int) string {
+	b.Helper()
+	dir := b.TempDir()
+	for i := 0; i < n; i++ {
+		var content strings.Builder
+		fmt.Fprintf(&content, "# Document %d\n\nIntro text with a note[^1].\n\n", i)
+		fmt.Fprintf(&content, "## Details\n\nSome *emphasis* and `code`.\n\n")
+		if i+1 < n {
+			fmt.Fprintf(&content, "Continue to [the next page](doc%d.md#details).\n\n", i+1)
+		}
+		fmt.Fprintf(&content, "[^1]: See [the first page](doc0.md).\n")
+		path := filepath.Join(dir, fmt.Sprintf("doc%d.md", i))
+		if err := os.WriteFile(path, []byte(content.String()), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "doc0.md")
+}
+
+func BenchmarkFileProcessor_ProcessTree(b *testing.B) {
+	root := writeBenchmarkTree(b, 1000)
+	scopeDir := filepath.Dir(root)
+	files, err := NewFileTraversal(root, scopeDir).Traverse()
+	if err != nil {
+		b.Fatal(err)
+	}
+	contents := make([][]byte, len(files))
+	for i, file := range files {
+		if contents[i], err = os.ReadFile(file); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		processor := NewFileProcessor(scopeDir, files, Options{})
+		for j, file := range files {
+			if _, err := processor.ProcessFile(file, contents[j]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestLooksBinary(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{"markdown", "# Title\n\nSome *text*\twith a tab.\r\n", false},
+		{"empty", "", false},
+		{"ANSI escape", "\x1b[1mbold\x1b[0m\n", false},
+		{"form feed", "page one\fpage two\n", false},
+		{"PNG", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", true},
+		{"NUL", "text\x00more text", true},
+		{"vertical tab", "a\vb", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksBinary([]byte(tt.content)); got != tt.expected {
+				t.Errorf("looksBinary(%q) = %v, want %v", tt.content, got, tt.expected)
+			}
+		})
+	}
+}
+
+func FuzzProcessFile(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, content []byte) {
+		for _, footnotes := range []string{FootnotesInline, FootnotesEndnotes} {
+			opts := Options{Footnotes: footnotes, FileTimeout: 10 * time.Second}
+			processor := NewFileProcessor("/project", []string{"/project/index.md"}, opts)
+			output, err := processor.processWithTimeout("/project/index.md", content)
+			var perr *panicError
+			if errors.As(err, &perr) {
+				t.Fatalf("--footnotes %s: ProcessFile panicked: %v\n%s", footnotes, perr.value, perr.stack)
+			}
+			var terr *timeoutError
+			if errors.As(err, &terr) {
+				t.Fatalf("--footnotes %s: ProcessFile hung on %q", footnotes, content)
+			}
+			if err == nil && !utf8.Valid(output) {
+				t.Errorf("--footnotes %s: ProcessFile returned invalid UTF-8", footnotes)
+			}
+		}
+	})
+}
@@ -1,20 +1,71 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
 // FileTraversal handles the depth-first traversal of markdown files through internal links.
 type FileTraversal struct {
-	visited   map[string]bool // Set of files already processed to prevent cycles
-	scopeDir  string          // Directory boundary for internal link classification
-	rootFile  string          // Starting file for traversal
-	queue     []string        // Stack of files to process (LIFO for depth-first)
-	fileOrder []string        // Final order of files for concatenation
+	visited   map[string]bool   // Set of files already processed to prevent cycles
+	scopeDir  string            // Directory boundary for internal link classification
+	rootFile  string            // Starting file for traversal
+	queue     []queuedFile      // Stack of files to process (LIFO for depth-first)
+	fileOrder []string          // Final order of files for concatenation
+	parents   map[string]string // File whose link first led traversal to each file
+	depths    map[string]int    // Number of links from the root to each file
+	allowed   []string          // Directories traversal is restricted to, nil for the whole scope
+	excluded  []string          // Path patterns of files traversal leaves out
+	linkOrder string            // Order in which each file's links are followed, see the LinkOrder* constants
+	weights   map[string]*int   // Cached front matter weight of each linked file, nil if it has none
+	resolver  LinkResolver      // Maps link destinations to files
+	snapshot  *Snapshot         // Contents of the files read, as first read
+	typos     []LinkTypo        // Links that only resolved with stray characters removed
+}
+
+// LinkResolver maps link destinations to the files they refer to. Programs
+// embedding catmd can supply their own, through SetResolver and
+// Options.Resolver, to support custom schemes such as docs://service/page or
+// monorepo path aliases without changing traversal.
+type LinkResolver interface {
+	// ResolveTarget returns the absolute path of the file url refers to when it
+	// appears in fromFile, and whether that file may be included in the output.
+	// Links that fail to resolve or aren't included are left as they are.
+	ResolveTarget(fromFile, url string) (path string, include bool, err error)
+}
+
+// RelativeResolver is the default LinkResolver. It resolves links as paths
+// relative to the linking file, and file:// URLs to the local path they name.
+type RelativeResolver struct{}
+
+// ResolveTarget implements LinkResolver.
+func (RelativeResolver) ResolveTarget(fromFile, url string) (string, bool, error) {
+	path, err := resolveLinkTarget(fromFile, url)
+	return path, err == nil, err
+}
+
+// errLinkExcluded is returned for links a LinkResolver chose not to include.
+var errLinkExcluded = errors.New("link target excluded by resolver")
+
+// Orders in which traversal follows the links of a file, accepted by --link-order
+// and the link_order front matter key.
+const (
+	LinkOrderLink   = "link"   // The order the links appear in
+	LinkOrderAlpha  = "alpha"  // Alphabetically by path
+	LinkOrderWeight = "weight" // By the targets' front matter weight, lowest first, then unweighted files in link order
+	LinkOrderReadme = "readme" // Grouped by directory, each README or index first, then the rest alphabetically
+)
+
+// queuedFile is a traversal stack entry: a file and the file that linked to it.
+type queuedFile struct {
+	path   string
+	parent string
 }
 
 // NewFileTraversal creates a new file traversal starting from the given root file
@@ -24,18 +75,57 @@ func NewFileTraversal(rootFile, scopeDir string) *FileTraversal {
 		visited:   make(map[string]bool),
 		scopeDir:  scopeDir,
 		rootFile:  rootFile,
-		queue:     []string{rootFile},
+		queue:     []queuedFile{{path: rootFile}},
 		fileOrder: []string{},
+		parents:   make(map[string]string),
+		depths:    make(map[string]int),
+		linkOrder: LinkOrderLink,
+		weights:   make(map[string]*int),
+		resolver:  RelativeResolver{},
+		snapshot:  NewSnapshot(),
 	}
 }
 
+// Snapshot returns the contents of the files traversal read, for the rest of
+// the build to read them from.
+func (ft *FileTraversal) Snapshot() *Snapshot {
+	return ft.snapshot
+}
+
+// SetResolver replaces the LinkResolver used to find the files links refer to.
+// Resolved files must still be markdown files inside the scope to be followed.
+func (ft *FileTraversal) SetResolver(resolver LinkResolver) {
+	ft.resolver = resolver
+}
+
+// SetLinkOrder sets the order in which traversal follows the links of each file,
+// one of the LinkOrder* constants. A file's link_order front matter overrides it.
+func (ft *FileTraversal) SetLinkOrder(order string) {
+	ft.linkOrder = order
+}
+
+// RestrictTo limits traversal to files inside dirs, which must be absolute. Links
+// to other files in the scope are not followed, leaving those files unincluded.
+// The root file is always included.
+func (ft *FileTraversal) RestrictTo(dirs []string) {
+	ft.allowed = dirs
+}
+
+// Exclude leaves the files matching patterns out of traversal, as if links to
+// them weren't there. Patterns are matched like OrderRule patterns, against
+// paths relative to the scope directory. The root file is always included.
+func (ft *FileTraversal) Exclude(patterns []string) {
+	ft.excluded = patterns
+}
+
 // Traverse performs depth-first traversal of markdown files, following internal links
 // and returning the files in traversal order. Files are only included once.
 func (ft *FileTraversal) Traverse() ([]string, error) {
 	for len(ft.queue) > 0 {
 		// Take from the end for depth-first traversal (stack behavior)
-		currentFile := ft.queue[len(ft.queue)-1]
+		entry := ft.queue[len(ft.queue)-1]
 		ft.queue = ft.queue[:len(ft.queue)-1]
+		currentFile := entry.path
 
 		if ft.visited[currentFile] {
 			continue
@@ -43,6 +133,10 @@ func (ft *FileTraversal) Traverse() ([]string, error) {
 
 		ft.visited[currentFile] = true
 		ft.fileOrder = append(ft.fileOrder, currentFile)
+		if entry.parent != "" {
+			ft.parents[currentFile] = entry.parent
+			ft.depths[currentFile] = ft.depths[entry.parent] + 1
+		}
 
 		links, err := ft.extractLinksFromFile(currentFile)
 		if err != nil {
@@ -54,8 +148,8 @@ func (ft *FileTraversal) Traverse() ([]string, error) {
 		// Add links in reverse order so they are processed in forward order
 		for i := len(links) - 1; i >= 0; i-- {
 			link := links[i]
-			if !ft.visited[link] && ft.isWithinScope(link) {
-				ft.queue = append(ft.queue, link)
+			if !ft.visited[link] && ft.isWithinScope(link) && ft.IsAllowed(link) {
+				ft.queue = append(ft.queue, queuedFile{path: link, parent: currentFile})
 			}
 		}
 	}
@@ -63,17 +157,67 @@ func (ft *FileTraversal) Traverse() ([]string, error) {
 	return ft.fileOrder, nil
 }
 
+// Orphans returns the markdown files in the scope that traversal never reached,
+// sorted by path. Files outside the RestrictTo directories are left out.
+func (ft *FileTraversal) Orphans() ([]string, error) {
+	allFiles, err := WalkDirectoryForMarkdown(ft.scopeDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list markdown files: %w", err)
+	}
+	sort.Strings(allFiles)
+
+	var orphans []string
+	for _, file := range allFiles {
+		if !ft.visited[file] && ft.IsAllowed(file) {
+			orphans = append(orphans, file)
+		}
+	}
+	return orphans, nil
+}
+
+// LinkTypos returns the links traversal only resolved after removing stray
+// whitespace or punctuation from their paths, in the order they were found.
+func (ft *FileTraversal) LinkTypos() []LinkTypo {
+	return ft.typos
+}
+
+// Parent returns the file whose link first led traversal to filename, or "" for
+// the root file and files that were never reached.
+func (ft *FileTraversal) Parent(filename string) string {
+	return ft.parents[filename]
+}
+
+// Depth returns the number of links traversal followed from the root file to
+// reach filename; the root file has depth 0.
+func (ft *FileTraversal) Depth(filename string) int {
+	return ft.depths[filename]
+}
+
 func (ft *FileTraversal) extractLinksFromFile(filename string) ([]string, error) {
-	content, err := os.ReadFile(filename)
+	content, err := ft.snapshot.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
+	if looksBinary(content) {
+		// Processing skips the file with a warning
+		return nil, nil
+	}
 
-	parsed, err := ParseMarkdownFile(content, ft.scopeDir)
+	parsed, err := ft.snapshot.ParseFile(filename, ft.scopeDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse markdown: %w", err)
 	}
 
+	order := ft.linkOrder
+	if value, ok := parsed.FrontMatter["link_order"]; ok {
+		switch value {
+		case LinkOrderLink, LinkOrderAlpha, LinkOrderWeight, LinkOrderReadme:
+			order = value.(string)
+		default:
+			fmt.Fprintf(os.Stderr, "Warning: %s: invalid link_order %v (want link, alpha, weight, or readme)\n", displayPath(filename), value)
+		}
+	}
+
 	var linkedFiles []string
 	for _, link := range parsed.Links {
 		if link.IsInternal && !link.IsFootnote {
@@ -81,22 +225,129 @@ func (ft *FileTraversal) extractLinksFromFile(filename string) ([]string, error)
 			if err != nil {
 				continue
 			}
+			if fixed, ok := correctLinkURL(link.URL); ok {
+				if target, err := ft.resolveLink(filename, fixed); err == nil && target == resolvedPath {
+					fmt.Fprintf(os.Stderr, "Warning: %s: link %q has stray characters, resolved as %q (--fix corrects the source)\n", displayPath(filename), link.URL, fixed)
+					ft.typos = append(ft.typos, LinkTypo{File: filename, URL: link.URL, Fixed: fixed})
+				}
+			}
 
-			if ft.fileExists(resolvedPath) {
+			// Links to other files, such as downloads, are assets rather than sections
+			if ft.isMarkdownFile(resolvedPath) && ft.fileExists(resolvedPath) {
 				linkedFiles = append(linkedFiles, resolvedPath)
 			}
 		}
 	}
 
+	switch order {
+	case LinkOrderAlpha:
+		sort.SliceStable(linkedFiles, func(i, j int) bool {
+			return filepath.ToSlash(linkedFiles[i]) < filepath.ToSlash(linkedFiles[j])
+		})
+	case LinkOrderWeight:
+		sort.SliceStable(linkedFiles, func(i, j int) bool {
+			wi, wj := ft.weight(linkedFiles[i]), ft.weight(linkedFiles[j])
+			return wi != nil && (wj == nil || *wi < *wj)
+		})
+	case LinkOrderReadme:
+		sortReadmeFirst(linkedFiles)
+	}
+
 	return linkedFiles, nil
 }
 
+// sortReadmeFirst groups files by directory, in the order each directory first
+// appears, and sorts each group so that a README or index file comes first and
+// the rest follow alphabetically.
+func sortReadmeFirst(files []string) {
+	dirOrder := make(map[string]int)
+	for _, file := range files {
+		if _, ok := dirOrder[filepath.Dir(file)]; !ok {
+			dirOrder[filepath.Dir(file)] = len(dirOrder)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		di, dj := dirOrder[filepath.Dir(files[i])], dirOrder[filepath.Dir(files[j])]
+		if di != dj {
+			return di < dj
+		}
+		if ii, ij := isIndexFile(files[i]), isIndexFile(files[j]); ii != ij {
+			return ii
+		}
+		return filepath.ToSlash(files[i]) < filepath.ToSlash(files[j])
+	})
+}
+
+// isIndexFile reports whether filename is a directory's landing page: a README,
+// index, or _index file.
+func isIndexFile(filename string) bool {
+	base := filepath.Base(filename)
+	switch strings.ToLower(strings.TrimSuffix(base, filepath.Ext(base))) {
+	case "readme", "index", "_index":
+		return true
+	}
+	return false
+}
+
+// weight returns the integer weight front matter of filename, or nil if it has
+// none or can't be read.
+func (ft *FileTraversal) weight(filename string) *int {
+	if weight, ok := ft.weights[filename]; ok {
+		return weight
+	}
+
+	var weight *int
+	if content, err := ft.snapshot.ReadFile(filename); err == nil && !looksBinary(content) {
+		if parsed, err := ft.snapshot.ParseFile(filename, ft.scopeDir); err == nil {
+			switch value := parsed.FrontMatter["weight"].(type) {
+			case int:
+				weight = &value
+			case float64:
+				w := int(value)
+				weight = &w
+			}
+		}
+	}
+	ft.weights[filename] = weight
+	return weight
+}
+
 func (ft *FileTraversal) resolveLink(currentFile, linkURL string) (string, error) {
+	return resolveWith(ft.resolver, currentFile, linkURL)
+}
+
+// resolveWith resolves linkURL with resolver, or relative to currentFile when
+// resolver is nil. Links the resolver doesn't include are reported as errors.
+func resolveWith(resolver LinkResolver, currentFile, linkURL string) (string, error) {
+	if resolver == nil {
+		return resolveLinkTarget(currentFile, linkURL)
+	}
+	path, include, err := resolver.ResolveTarget(currentFile, linkURL)
+	if err != nil {
+		return "", err
+	}
+	if !include {
+		return "", errLinkExcluded
+	}
+	return path, nil
+}
+
+// resolveLinkTarget resolves a link destination relative to the file containing
+// it, dropping any fragment and query string (as in static site links like
+// "page.md?highlight=term#section"), and returns the absolute path of the target.
+// file:// URLs resolve to the local path they name. A path that only exists once
+// stray whitespace or trailing punctuation is removed resolves to that file.
+func resolveLinkTarget(currentFile, linkURL string) (string, error) {
 	currentDir := filepath.Dir(currentFile)
 
+	if path, ok := fileURLPath(linkURL); ok {
+		linkURL = path
+	}
+
 	if strings.Contains(linkURL, "#") {
 		linkURL = strings.Split(linkURL, "#")[0]
 	}
+	linkURL, _, _ = strings.Cut(linkURL, "?")
 
 	if linkURL == "" {
 		return "", fmt.Errorf("empty link after fragment removal")
@@ -114,9 +365,43 @@ func (ft *FileTraversal) resolveLink(currentFile, linkURL string) (string, error
 		return "", fmt.Errorf("failed to resolve absolute path: %w", err)
 	}
 
+	// Tolerate stray whitespace and punctuation, as in "api.md.", when the
+	// path as written doesn't exist but the corrected one does
+	if _, err := os.Stat(cleanPath); err != nil {
+		if fixed, ok := correctLinkURL(linkURL); ok {
+			if !filepath.IsAbs(fixed) {
+				fixed = filepath.Join(currentDir, fixed)
+			}
+			if fixedPath, err := filepath.Abs(fixed); err == nil {
+				if _, err := os.Stat(fixedPath); err == nil {
+					return fixedPath, nil
+				}
+			}
+		}
+	}
+
 	return cleanPath, nil
 }
 
+// fileURLPath returns the local path named by a file:// URL such as
+// file:///abs/path/doc.md, and false for anything else. URLs naming a remote
+// host can't be resolved locally and are rejected.
+func fileURLPath(linkURL string) (string, bool) {
+	if !isFileURL(linkURL) {
+		return "", false
+	}
+	u, err := url.Parse(linkURL)
+	if err != nil || (u.Host != "" && u.Host != "localhost") || u.Path == "" {
+		return "", false
+	}
+	return filepath.FromSlash(u.Path), true
+}
+
+// isFileURL reports whether linkURL uses the file: scheme.
+func isFileURL(linkURL string) bool {
+	return strings.HasPrefix(strings.ToLower(linkURL), "file:")
+}
+
 func (ft *FileTraversal) isWithinScope(filename string) bool {
 	absScope, err := filepath.Abs(ft.scopeDir)
 	if err != nil {
@@ -136,6 +421,27 @@ func (ft *FileTraversal) isWithinScope(filename string) bool {
 	return !strings.HasPrefix(relPath, "../") && relPath != ".."
 }
 
+// IsAllowed reports whether filename is inside one of the directories traversal
+// was restricted to, or whether traversal is unrestricted, and isn't excluded.
+func (ft *FileTraversal) IsAllowed(filename string) bool {
+	if rel, err := filepath.Rel(ft.scopeDir, filename); err == nil {
+		for _, pattern := range ft.excluded {
+			if matchesSectionPattern(pattern, filepath.ToSlash(rel)) {
+				return false
+			}
+		}
+	}
+	if ft.allowed == nil {
+		return true
+	}
+	for _, dir := range ft.allowed {
+		if rel, err := filepath.Rel(dir, filename); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
 func (ft *FileTraversal) fileExists(filename string) bool {
 	info, err := os.Stat(filename)
 	if err != nil {
@@ -182,6 +488,40 @@ func DetermineScopeDir(rootFile string, explicitScope string) (string, error) {
 	return filepath.Dir(rootAbs), nil
 }
 
+// ResolveOnlyDirs resolves the --only directories, relative to the scope
+// directory, to absolute paths, checking that each is a directory in the scope.
+func ResolveOnlyDirs(scopeDir string, dirs []string) ([]string, error) {
+	var resolved []string
+	for _, dir := range dirs {
+		abs := dir
+		if !filepath.IsAbs(dir) {
+			abs = filepath.Join(scopeDir, dir)
+		}
+		abs = filepath.Clean(abs)
+
+		if rel, err := filepath.Rel(scopeDir, abs); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("--only directory %q is outside the scope directory %q", dir, scopeDir)
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("--only directory %q does not exist: %w", dir, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("--only path %q is not a directory", dir)
+		}
+		resolved = append(resolved, abs)
+	}
+	return resolved, nil
+}
+
+// StdinRoot is the root file argument that reads the root file from standard
+// input, which needs --scope.
+const StdinRoot = "-"
+
+// stdinRootName is the name the root file read from standard input goes by, as
+// if it were a file at the top of the scope directory.
+const stdinRootName = "stdin.md"
+
 // ValidateRootFile checks that the root file exists and is a markdown file.
 func ValidateRootFile(rootFile string) error {
 	info, err := os.Stat(rootFile)
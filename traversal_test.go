@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -298,6 +299,15 @@ func TestFileTraversal_ResolveLink(t *testing.T) {
 				return filepath.Base(result) == "api.md"
 			},
 		},
+		{
+			name:        "link with query string and fragment",
+			currentFile: currentFile,
+			linkURL:     "api.md?highlight=term#section",
+			wantErr:     false,
+			checkResult: func(result string) bool {
+				return filepath.Base(result) == "api.md"
+			},
+		},
 		{
 			name:        "relative link with subdirectory",
 			currentFile: currentFile,
@@ -359,3 +369,280 @@ func TestFileTraversal_ResolveLink(t *testing.T) {
 func contains(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
+
+func TestFileTraversal_ParentAndDepth(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"index.md": "[a](a.md) [b](b.md)",
+		"a.md":     "[b](b.md) [c](sub/c.md)",
+		"b.md":     "[index](index.md)",
+		"sub/c.md": "# C",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root := filepath.Join(tempDir, "index.md")
+	ft := NewFileTraversal(root, tempDir)
+	if _, err := ft.Traverse(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file   string
+		parent string
+		depth  int
+	}{
+		{file: "index.md", parent: "", depth: 0},
+		{file: "a.md", parent: "index.md", depth: 1},
+		{file: "b.md", parent: "a.md", depth: 2}, // Depth-first: reached through a.md first
+		{file: "sub/c.md", parent: "a.md", depth: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			file := filepath.Join(tempDir, tt.file)
+			wantParent := ""
+			if tt.parent != "" {
+				wantParent = filepath.Join(tempDir, tt.parent)
+			}
+			if got := ft.Parent(file); got != wantParent {
+				t.Errorf("Parent(%q) = %q, want %q", tt.file, got, wantParent)
+			}
+			if got := ft.Depth(file); got != tt.depth {
+				t.Errorf("Depth(%q) = %d, want %d", tt.file, got, tt.depth)
+			}
+		})
+	}
+}
+
+func TestFileTraversal_RestrictTo(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"index.md":          "[intro](docs/intro.md) [notes](internal/notes.md) [setup](guides/setup.md)",
+		"docs/intro.md":     "# Intro",
+		"guides/setup.md":   "# Setup",
+		"internal/notes.md": "# Notes",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dirs, err := ResolveOnlyDirs(tempDir, []string{"docs/", "guides"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft := NewFileTraversal(filepath.Join(tempDir, "index.md"), tempDir)
+	ft.RestrictTo(dirs)
+	got, err := ft.Traverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected []string
+	for _, name := range []string{"index.md", "docs/intro.md", "guides/setup.md"} {
+		expected = append(expected, filepath.Join(tempDir, name))
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Traverse() = %q, want %q", got, expected)
+	}
+
+	if _, err := ResolveOnlyDirs(tempDir, []string{"../elsewhere"}); err == nil {
+		t.Error("ResolveOnlyDirs() accepted a directory outside the scope")
+	}
+}
+
+func TestFileTraversal_LinkOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"index.md": "[c](c.md) [a](a.md) [b](b.md) [alpha](sub/index.md)",
+		"a.md":     "---\nweight: 5\n---\n# A",
+		"b.md":     "# B",
+		"c.md":     "---\nweight: 10\n---\n# C",
+		// Front matter overrides the global order for this file's links
+		"sub/index.md": "---\nlink_order: alpha\n---\n[z](z.md) [y](y.md)",
+		"sub/y.md":     "# Y",
+		"sub/z.md":     "# Z",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{LinkOrderLink, []string{"index.md", "c.md", "a.md", "b.md", "sub/index.md", "sub/y.md", "sub/z.md"}},
+		{LinkOrderAlpha, []string{"index.md", "a.md", "b.md", "c.md", "sub/index.md", "sub/y.md", "sub/z.md"}},
+		{LinkOrderWeight, []string{"index.md", "a.md", "c.md", "b.md", "sub/index.md", "sub/y.md", "sub/z.md"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			ft := NewFileTraversal(filepath.Join(tempDir, "index.md"), tempDir)
+			ft.SetLinkOrder(tt.order)
+			ft.Snapshot().SetFrontMatter(true)
+			got, err := ft.Traverse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var expected []string
+			for _, name := range tt.expected {
+				expected = append(expected, filepath.Join(tempDir, name))
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("Traverse() = %q, want %q", got, expected)
+			}
+		})
+	}
+}
+
+// aliasResolver resolves docs://name links to name.md in dir, excludes links to
+// drafts/, and resolves everything else relative to the linking file.
+type aliasResolver struct {
+	dir string
+}
+
+func (r aliasResolver) ResolveTarget(fromFile, url string) (string, bool, error) {
+	if name, ok := strings.CutPrefix(url, "docs://"); ok {
+		name, _, _ = strings.Cut(name, "#")
+		return filepath.Join(r.dir, name+".md"), true, nil
+	}
+	if strings.HasPrefix(url, "drafts/") {
+		return "", false, nil
+	}
+	return RelativeResolver{}.ResolveTarget(fromFile, url)
+}
+
+func TestFileTraversal_SetResolver(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"index.md":      "# Index\n\n[Guide](docs://guide#setup) [Draft](drafts/wip.md) [API](api.md)\n",
+		"guide.md":      "# Guide\n\n## Setup\n",
+		"api.md":        "# API\n",
+		"drafts/wip.md": "# WIP\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resolver := aliasResolver{dir: tempDir}
+	root := filepath.Join(tempDir, "index.md")
+	ft := NewFileTraversal(root, tempDir)
+	ft.SetResolver(resolver)
+	result, err := ft.Traverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, file := range result {
+		rel, _ := filepath.Rel(tempDir, file)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	if want := []string{"index.md", "guide.md", "api.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Traverse() = %v, want %v", got, want)
+	}
+
+	processed, err := NewFileProcessor(tempDir, result, Options{Resolver: resolver}).ProcessFile(root, []byte(files["index.md"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[Guide](#setup) [Draft](drafts/wip.md) [API](#api)"; !strings.Contains(string(processed), want) {
+		t.Errorf("ProcessFile() = %q, want it to contain %q", processed, want)
+	}
+}
+
+func TestFileTraversal_Orphans(t *testing.T) {
+	tempDir := t.TempDir()
+	for name, content := range map[string]string{
+		"index.md":      "[a](a.md)",
+		"a.md":          "# A",
+		"z.md":          "# Z",
+		"docs/b.md":     "# B",
+		"other/c.md":    "# C",
+		"notes/readme":  "not markdown",
+		"docs/image.md": "# Image",
+	} {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ft := NewFileTraversal(filepath.Join(tempDir, "index.md"), tempDir)
+	ft.RestrictTo([]string{filepath.Join(tempDir, "docs")})
+	if _, err := ft.Traverse(); err != nil {
+		t.Fatal(err)
+	}
+	orphans, err := ft.Orphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(tempDir, "docs", "b.md"), filepath.Join(tempDir, "docs", "image.md")}
+	if !reflect.DeepEqual(orphans, want) {
+		t.Errorf("Orphans() = %q, want %q", orphans, want)
+	}
+}
+
+func TestFileTraversal_ReadmeFirstOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"index.md":        "[z](guide/z.md) [intro](intro.md) [a](guide/a.md) [api](api.md) [guide](guide/README.md)",
+		"intro.md":        "# Intro",
+		"api.md":          "# API",
+		"guide/README.md": "# Guide",
+		"guide/a.md":      "# A",
+		"guide/z.md":      "# Z",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ft := NewFileTraversal(filepath.Join(tempDir, "index.md"), tempDir)
+	ft.SetLinkOrder(LinkOrderReadme)
+	got, err := ft.Traverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected []string
+	for _, name := range []string{"index.md", "guide/README.md", "guide/a.md", "guide/z.md", "api.md", "intro.md"} {
+		expected = append(expected, filepath.Join(tempDir, name))
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Traverse() = %q, want %q", got, expected)
+	}
+}